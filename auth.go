@@ -0,0 +1,101 @@
+package httptreemux
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+)
+
+// CredentialStore checks the credentials of requests for BasicAuth and APIKeyAuth.
+// Credentials and APIKeys keep them in memory; implement it to check them against a
+// database or a secrets manager.
+type CredentialStore interface {
+	// Verify reports whether the secret is valid for the user. For APIKeyAuth, the
+	// user is empty and the secret is the API key.
+	Verify(user, secret string) bool
+}
+
+// Credentials is a CredentialStore that maps user names to their passwords, for
+// BasicAuth. Passwords are compared in constant time.
+type Credentials map[string]string
+
+// Verify implements CredentialStore.
+func (c Credentials) Verify(user, secret string) bool {
+	password, ok := c[user]
+	// Compare against something even for unknown users, so that the time taken doesn't
+	// reveal which users exist.
+	return secretsEqual(password, secret) && ok
+}
+
+// APIKeys returns a CredentialStore that accepts each of the keys, for APIKeyAuth. Keys
+// are compared in constant time.
+func APIKeys(keys ...string) CredentialStore {
+	return apiKeys(keys)
+}
+
+type apiKeys []string
+
+func (k apiKeys) Verify(user, secret string) bool {
+	valid := false
+	// Check every key, so that the time taken doesn't reveal which one matched.
+	for _, key := range k {
+		if secretsEqual(key, secret) {
+			valid = true
+		}
+	}
+	return valid && user == ""
+}
+
+// secretsEqual compares two secrets in constant time. They are hashed first, so that the
+// time doesn't depend on their lengths either.
+func secretsEqual(a, b string) bool {
+	hashA := sha256.Sum256([]byte(a))
+	hashB := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(hashA[:], hashB[:]) == 1
+}
+
+// BasicAuth returns middleware that only lets through requests with HTTP Basic
+// credentials that the store accepts. Other requests get a 401 Unauthorized response
+// with a WWW-Authenticate header naming the realm, which makes browsers ask for a user
+// name and password. Add it to a group to protect all of its routes:
+//
+//	admin := router.Group("/admin")
+//	admin.Use(httptreemux.BasicAuth("admin", httptreemux.Credentials{"ops": adminPassword}))
+//
+// Basic credentials are sent in the clear, so the routes should only be served over
+// HTTPS.
+func BasicAuth(realm string, store CredentialStore) MiddlewareFunc {
+	challenge := `Basic realm=` + strconv.Quote(realm) + `, charset="UTF-8"`
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			if user, password, ok := r.BasicAuth(); ok && store.Verify(user, password) {
+				next(w, r, params)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		}
+	}
+}
+
+// APIKeyAuth returns middleware that only lets through requests whose header holds an
+// API key that the store accepts. The header is X-API-Key if it is empty. Other
+// requests get a 401 Unauthorized response.
+//
+//	internal := router.Group("/internal")
+//	internal.Use(httptreemux.APIKeyAuth("", httptreemux.APIKeys(os.Getenv("INTERNAL_API_KEY"))))
+func APIKeyAuth(header string, store CredentialStore) MiddlewareFunc {
+	if header == "" {
+		header = "X-API-Key"
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			if key := r.Header.Get(header); key != "" && store.Verify("", key) {
+				next(w, r, params)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		}
+	}
+}
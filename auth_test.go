@@ -0,0 +1,74 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	router := New()
+	admin := router.Group("/admin")
+	admin.Use(BasicAuth("admin area", Credentials{"ops": "s3cret"}))
+	admin.GET("/users", simpleHandler)
+	router.GET("/public", simpleHandler)
+
+	tests := []struct {
+		path     string
+		user     string
+		password string
+		code     int
+	}{
+		{"/admin/users", "ops", "s3cret", http.StatusOK},
+		{"/admin/users", "ops", "wrong", http.StatusUnauthorized},
+		{"/admin/users", "other", "s3cret", http.StatusUnauthorized},
+		{"/admin/users", "", "", http.StatusUnauthorized},
+		{"/public", "", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		if test.user != "" {
+			r.SetBasicAuth(test.user, test.password)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s as %s:%s expected %d, saw %d", test.path, test.user, test.password, test.code, w.Code)
+		}
+		if challenge := w.Header().Get("WWW-Authenticate"); test.code == http.StatusUnauthorized &&
+			challenge != `Basic realm="admin area", charset="UTF-8"` {
+			t.Errorf("Expected a Basic challenge, saw %q", challenge)
+		}
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	router := New()
+	router.With(APIKeyAuth("", APIKeys("key1", "key2"))).GET("/internal", simpleHandler)
+	router.With(APIKeyAuth("X-Token", APIKeys("key1"))).GET("/token", simpleHandler)
+
+	tests := []struct {
+		path   string
+		header string
+		key    string
+		code   int
+	}{
+		{"/internal", "X-API-Key", "key1", http.StatusOK},
+		{"/internal", "X-API-Key", "key2", http.StatusOK},
+		{"/internal", "X-API-Key", "key3", http.StatusUnauthorized},
+		{"/internal", "X-API-Key", "", http.StatusUnauthorized},
+		{"/token", "X-Token", "key1", http.StatusOK},
+		{"/token", "X-API-Key", "key1", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		if test.key != "" {
+			r.Header.Set(test.header, test.key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s with %s %q expected %d, saw %d", test.path, test.header, test.key, test.code, w.Code)
+		}
+	}
+}
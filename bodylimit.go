@@ -0,0 +1,53 @@
+package httptreemux
+
+import (
+	"io"
+	"net/http"
+)
+
+// MaxBodyBytes returns middleware that limits the size of request bodies to n bytes,
+// for use with Use or With on the router or a group, so that each route can have its
+// own limit:
+//
+//	router.With(httptreemux.MaxBodyBytes(32<<20, nil)).POST("/uploads", uploadHandler)
+//
+// A request whose Content-Length is over the limit is rejected before the handler runs,
+// with the response written by tooLarge, or a plain 413 Request Entity Too Large if
+// tooLarge is nil. Otherwise the body is wrapped with http.MaxBytesReader, and reading
+// past the limit returns a *StatusError with the code 413, so a handler added with
+// HandleE can return the error to have ErrorHandler respond with that status.
+func MaxBodyBytes(n int64, tooLarge HandlerFunc) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			if r.ContentLength > n {
+				if tooLarge != nil {
+					tooLarge(w, r, params)
+				} else {
+					http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge),
+						http.StatusRequestEntityTooLarge)
+				}
+				return
+			}
+
+			if r.Body != nil {
+				r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, n), remaining: n}
+			}
+			next(w, r, params)
+		}
+	}
+}
+
+// limitedBody reports reading past the limit of http.MaxBytesReader as a *StatusError.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if err != nil && err != io.EOF && b.remaining <= 0 {
+		err = &StatusError{Code: http.StatusRequestEntityTooLarge, Err: err}
+	}
+	return n, err
+}
@@ -0,0 +1,52 @@
+package httptreemux
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodyBytes(t *testing.T) {
+	router := New()
+	router.With(MaxBodyBytes(5, nil)).HandleE("POST", "/small", func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		w.Write(body)
+		return nil
+	})
+	router.With(MaxBodyBytes(2, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write([]byte("custom"))
+	})).POST("/custom", simpleHandler)
+
+	tests := []struct {
+		path          string
+		body          string
+		contentLength bool
+		code          int
+		response      string
+	}{
+		{"/small", "hello", true, 200, "hello"},
+		{"/small", "hello!", true, 413, "Request Entity Too Large\n"},
+		// Without a Content-Length, the limit is found while reading.
+		{"/small", "hello", false, 200, "hello"},
+		{"/small", "hello!", false, 413, "http: request body too large\n"},
+		{"/custom", "abc", true, 413, "custom"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", test.path, strings.NewReader(test.body))
+		if !test.contentLength {
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.response {
+			t.Errorf("%s with %q expected %d %q, saw %d %q", test.path, test.body, test.code, test.response,
+				w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package httptreemux
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a route's circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through, counting the failures.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects requests without running the handler.
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe requests through to find out whether the
+	// handler has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "CircuitState(" + strconv.Itoa(int(s)) + ")"
+}
+
+// CircuitBreakerRecorder is implemented by a MetricsRecorder that records the state of
+// circuit breakers. When TreeMux.Metrics implements it, ObserveCircuitState is called
+// whenever the breaker of a route changes state.
+type CircuitBreakerRecorder interface {
+	ObserveCircuitState(method, route string, state CircuitState)
+}
+
+// CircuitBreaker stops running the handler of a route that keeps failing, such as a
+// Proxy route whose upstream is down, so that requests fail fast instead of waiting on
+// it. It is created by NewCircuitBreaker and applied to routes with
+// TreeMux.CircuitBreaker or Group.CircuitBreaker. Each route has a breaker of its own,
+// by its method and pattern.
+//
+// A breaker starts closed. After a number of failures in a row, it opens, and requests
+// get a 503 Service Unavailable response with a Retry-After header. Once it has been
+// open for a while it is half-open, and lets a number of probe requests through: if
+// they all succeed it closes again, and if one fails it opens again. By default, a
+// request fails if its handler panics or responds with a status code of 500 or more.
+type CircuitBreaker struct {
+	failures  int
+	openFor   time.Duration
+	probes    int
+	isFailure func(statusCode int) bool
+	handler   HandlerFunc
+
+	mutex  sync.Mutex
+	routes map[string]*circuit
+}
+
+// circuit is the state of the breaker of a single route.
+type circuit struct {
+	state CircuitState
+	// The number of failures in a row while closed, or of successful probes while
+	// half-open.
+	count int
+	// The number of probes that are running while half-open.
+	running  int
+	openedAt time.Time
+	// Incremented on each change of state, so that requests that started in an
+	// earlier state aren't counted.
+	generation int
+}
+
+// NewCircuitBreaker returns a CircuitBreaker that opens after the number of failures in
+// a row, and stays open for the duration. It lets one probe request through when
+// half-open.
+//
+//	backend := router.CircuitBreaker(httptreemux.NewCircuitBreaker(5, 30*time.Second))
+//	backend.Proxy("GET", "/api/*path", "http://backend/*path")
+func NewCircuitBreaker(failures int, openFor time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failures: failures,
+		openFor:  openFor,
+		probes:   1,
+		routes:   make(map[string]*circuit),
+	}
+}
+
+// Probes sets the number of requests that must succeed while half-open for the breaker
+// to close. No more than this many run at once.
+func (b *CircuitBreaker) Probes(probes int) *CircuitBreaker {
+	b.probes = probes
+	return b
+}
+
+// IsFailure sets the function that decides whether a response with the status code is
+// a failure. A panic is always a failure.
+func (b *CircuitBreaker) IsFailure(isFailure func(statusCode int) bool) *CircuitBreaker {
+	b.isFailure = isFailure
+	return b
+}
+
+// Handler sets the handler that writes the response for requests that the breaker
+// rejects. The Retry-After header is set before it is called.
+func (b *CircuitBreaker) Handler(handler HandlerFunc) *CircuitBreaker {
+	b.handler = handler
+	return b
+}
+
+// State returns the state of the breaker for the route with the method and full
+// pattern, which starts with the host for a route added through TreeMux.Host. Routes
+// that haven't been requested are closed.
+func (b *CircuitBreaker) State(method, pattern string) CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if c, ok := b.routes[method+" "+pattern]; ok {
+		return c.state
+	}
+	return CircuitClosed
+}
+
+// wrap returns the handler for the route, which runs handler when the breaker allows.
+func (b *CircuitBreaker) wrap(t *TreeMux, host, pattern string, handler HandlerFunc) HandlerFunc {
+	route := host + pattern
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		key := r.Method + " " + route
+		allowed, retry, generation := b.allow(t, r.Method, route, key)
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64((retry+time.Second-1)/time.Second), 10))
+			if b.handler != nil {
+				b.handler(w, r, params)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		rw := &recordingResponseWriter{ResponseWriter: w}
+		// A panic leaves finished false, and counts as a failure.
+		finished := false
+		defer func() {
+			failed := !finished
+			if finished {
+				if b.isFailure != nil {
+					failed = b.isFailure(rw.statusCode())
+				} else {
+					failed = rw.statusCode() >= 500
+				}
+			}
+			b.record(t, r.Method, route, key, generation, failed)
+		}()
+		handler(rw, r, params)
+		finished = true
+	}
+}
+
+// allow reports whether a request for the route may run, and if not, how long until
+// the breaker is half-open. It also returns the circuit's generation, for record.
+func (b *CircuitBreaker) allow(t *TreeMux, method, route, key string) (bool, time.Duration, int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	c := b.routes[key]
+	if c == nil {
+		c = &circuit{}
+		b.routes[key] = c
+	}
+
+	if c.state == CircuitOpen {
+		wait := c.openedAt.Add(b.openFor).Sub(time.Now())
+		if wait > 0 {
+			return false, wait, 0
+		}
+		b.setState(t, method, route, c, CircuitHalfOpen)
+	}
+	if c.state == CircuitHalfOpen {
+		if c.running+c.count >= b.probes {
+			return false, time.Second, 0
+		}
+		c.running++
+	}
+	return true, 0, c.generation
+}
+
+// record counts the result of a request that allow let through.
+func (b *CircuitBreaker) record(t *TreeMux, method, route, key string, generation int, failed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	c := b.routes[key]
+	if c.generation != generation {
+		// The request started before the state changed.
+		return
+	}
+	switch c.state {
+	case CircuitClosed:
+		if !failed {
+			c.count = 0
+		} else if c.count++; c.count >= b.failures {
+			b.open(t, method, route, c)
+		}
+	case CircuitHalfOpen:
+		c.running--
+		if failed {
+			b.open(t, method, route, c)
+		} else if c.count++; c.count >= b.probes {
+			b.setState(t, method, route, c, CircuitClosed)
+		}
+	}
+}
+
+func (b *CircuitBreaker) open(t *TreeMux, method, route string, c *circuit) {
+	c.openedAt = time.Now()
+	b.setState(t, method, route, c, CircuitOpen)
+}
+
+// setState changes the state of the circuit and reports it to the router's Metrics.
+// The mutex must be held.
+func (b *CircuitBreaker) setState(t *TreeMux, method, route string, c *circuit, state CircuitState) {
+	c.state = state
+	c.count = 0
+	c.running = 0
+	c.generation++
+	if recorder, ok := t.Metrics.(CircuitBreakerRecorder); ok {
+		recorder.ObserveCircuitState(method, route, state)
+	}
+}
+
+// CircuitBreaker returns a group with the same path and middleware as the router,
+// whose routes are protected by the breaker. See Group.CircuitBreaker.
+func (t *TreeMux) CircuitBreaker(breaker *CircuitBreaker) *Group {
+	return (&Group{mux: t}).CircuitBreaker(breaker)
+}
+
+// CircuitBreaker returns a group with the same path and middleware as this one, whose
+// routes are protected by the breaker, each with a state of its own. Like With, it can
+// be used for a single route.
+func (g *Group) CircuitBreaker(breaker *CircuitBreaker) *Group {
+	mux := g.mux
+	return g.withRouteWrapper(func(host, pattern string, handler HandlerFunc) HandlerFunc {
+		return breaker.wrap(mux, host, pattern, handler)
+	})
+}
@@ -0,0 +1,80 @@
+package httptreemux
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// circuitRecorder records the state changes of circuit breakers.
+type circuitRecorder struct {
+	changes []string
+}
+
+func (c *circuitRecorder) ObserveRequest(method, route string, statusCode int, duration time.Duration, size int64) {
+}
+
+func (c *circuitRecorder) ObserveCircuitState(method, route string, state CircuitState) {
+	c.changes = append(c.changes, method+" "+route+" "+state.String())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	recorder := &circuitRecorder{}
+	router := New()
+	router.Metrics = recorder
+
+	status := http.StatusInternalServerError
+	breaker := NewCircuitBreaker(2, 20*time.Millisecond)
+	backend := router.CircuitBreaker(breaker)
+	backend.GET("/flaky", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.WriteHeader(status)
+	})
+	backend.GET("/panics", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		panic("failed")
+	})
+
+	serve := func(path string) int {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+	expect := func(path string, codes ...int) {
+		for i, code := range codes {
+			if saw := serve(path); saw != code {
+				t.Errorf("%s request %d expected status %d, saw %d", path, i, code, saw)
+			}
+		}
+	}
+
+	expect("/flaky", 500, 500, 503, 503)
+	if state := breaker.State("GET", "/flaky"); state != CircuitOpen {
+		t.Errorf("Expected the breaker to be open, saw %s", state)
+	}
+
+	// A failed probe opens the breaker again.
+	time.Sleep(25 * time.Millisecond)
+	expect("/flaky", 500, 503)
+
+	// A successful probe closes it.
+	time.Sleep(25 * time.Millisecond)
+	status = http.StatusOK
+	expect("/flaky", 200, 200)
+	if state := breaker.State("GET", "/flaky"); state != CircuitClosed {
+		t.Errorf("Expected the breaker to be closed, saw %s", state)
+	}
+
+	// Panics are failures, and each route has its own breaker.
+	expect("/panics", 500, 500, 503)
+	expect("/flaky", 200)
+
+	expected := []string{
+		"GET /flaky open", "GET /flaky half-open", "GET /flaky open", "GET /flaky half-open",
+		"GET /flaky closed", "GET /panics open",
+	}
+	if fmt.Sprint(recorder.changes) != fmt.Sprint(expected) {
+		t.Errorf("Expected state changes %v, saw %v", expected, recorder.changes)
+	}
+}
@@ -0,0 +1,152 @@
+package httptreemux
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// coalescer merges concurrent identical GET requests for the routes of a group.
+type coalescer struct {
+	vary  []string
+	mutex sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall is a handler run whose response is shared by the requests waiting on
+// it.
+type coalescedCall struct {
+	done chan struct{}
+	// ok is false if the handler panicked, in which case the waiters run it themselves.
+	ok       bool
+	response *bufferedResponse
+}
+
+// bufferedResponse is a ResponseWriter that keeps the response in memory.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(statusCode int) {
+	if b.status == 0 {
+		b.status = statusCode
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// writeTo writes the response to w.
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	header := w.Header()
+	for key, values := range b.header {
+		header[key] = append([]string(nil), values...)
+	}
+	if b.status != 0 {
+		w.WriteHeader(b.status)
+	}
+	w.Write(b.body.Bytes())
+}
+
+// Coalesce returns a group with the same path and middleware as the router, whose
+// routes merge concurrent identical GET requests. See Group.Coalesce.
+func (t *TreeMux) Coalesce(vary ...string) *Group {
+	return (&Group{mux: t}).Coalesce(vary...)
+}
+
+// Coalesce returns a group with the same path and middleware as this one, whose routes
+// merge concurrent identical GET requests into a single run of the handler, whose
+// response is sent to all of them. This keeps many clients asking for the same
+// expensive resource at once, such as when a cache entry expires, from running the
+// handler for each of them. Like With, it can be used for a single route:
+//
+//	router.Coalesce().GET("/reports/:id", reportHandler)
+//
+// Requests are identical if they match the same route with the same parameters and
+// query string, and have the same values for the request headers named by vary. The
+// handler must not write a response that depends on anything else about the request,
+// such as a cookie or the Authorization header, unless vary includes it. The response
+// is kept in memory until the handler returns, so streaming responses don't work.
+// If the handler panics, the waiting requests run it themselves.
+func (g *Group) Coalesce(vary ...string) *Group {
+	c := &coalescer{vary: vary, calls: make(map[string]*coalescedCall)}
+	return g.withRouteWrapper(c.wrap)
+}
+
+// wrap returns the handler for the route, which shares the response of a run of
+// handler between identical requests.
+func (c *coalescer) wrap(host, pattern string, handler HandlerFunc) HandlerFunc {
+	route := host + pattern
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		if r.Method != "GET" {
+			handler(w, r, params)
+			return
+		}
+
+		key := c.key(route, r, params)
+		c.mutex.Lock()
+		if call, ok := c.calls[key]; ok {
+			c.mutex.Unlock()
+			<-call.done
+			if call.ok {
+				call.response.writeTo(w)
+			} else {
+				handler(w, r, params)
+			}
+			return
+		}
+		call := &coalescedCall{done: make(chan struct{}), response: &bufferedResponse{header: http.Header{}}}
+		c.calls[key] = call
+		c.mutex.Unlock()
+
+		defer func() {
+			c.mutex.Lock()
+			delete(c.calls, key)
+			c.mutex.Unlock()
+			close(call.done)
+		}()
+		handler(call.response, r, params)
+		call.ok = true
+		call.response.writeTo(w)
+	}
+}
+
+// key returns the key under which identical requests for the route are merged.
+func (c *coalescer) key(route string, r *http.Request, params map[string]string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteString(route)
+	for _, name := range names {
+		// Separate the parts with bytes that can't appear in paths or headers.
+		buf.WriteByte(0)
+		buf.WriteString(name)
+		buf.WriteByte(1)
+		buf.WriteString(params[name])
+	}
+	buf.WriteByte(0)
+	buf.WriteString(r.URL.RawQuery)
+	for _, name := range c.vary {
+		for _, value := range r.Header[http.CanonicalHeaderKey(name)] {
+			buf.WriteByte(0)
+			buf.WriteString(value)
+		}
+		buf.WriteByte(1)
+	}
+	return buf.String()
+}
@@ -0,0 +1,88 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesce(t *testing.T) {
+	var runs int32
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	router := New()
+	router.Coalesce("X-Tenant").GET("/reports/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		atomic.AddInt32(&runs, 1)
+		started <- struct{}{}
+		<-release
+		w.Header().Set("X-Report", params["id"])
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("report " + params["id"] + " " + r.Header.Get("X-Tenant")))
+	})
+
+	type result struct {
+		code   int
+		header string
+		body   string
+	}
+	serve := func(path, tenant string, results []result, i int, wg *sync.WaitGroup) {
+		defer wg.Done()
+		r, _ := http.NewRequest("GET", path, nil)
+		r.Header.Set("X-Tenant", tenant)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		results[i] = result{w.Code, w.Header().Get("X-Report"), w.Body.String()}
+	}
+
+	requests := []struct {
+		path   string
+		tenant string
+	}{
+		{"/reports/1", "a"},
+		{"/reports/1?full=1", "a"},
+		{"/reports/2", "a"},
+		{"/reports/1", "b"},
+	}
+	results := make([]result, len(requests)+3)
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		wg.Add(1)
+		go serve(req.path, req.tenant, results, i, &wg)
+	}
+	// Wait for each distinct request to start running the handler before adding the
+	// duplicates, so that they are sure to be merged.
+	for range requests {
+		<-started
+	}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go serve("/reports/1", "a", results, len(requests)+i, &wg)
+	}
+	// Give the duplicates time to start waiting.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if runs != int32(len(requests)) {
+		t.Errorf("Expected the handler to run %d times, saw %d", len(requests), runs)
+	}
+	expected := []string{"1 report 1 a", "1 report 1 a", "2 report 2 a", "1 report 1 b",
+		"1 report 1 a", "1 report 1 a", "1 report 1 a"}
+	for i, res := range results {
+		if res.code != http.StatusAccepted || res.header+" "+res.body != expected[i] {
+			t.Errorf("Request %d expected 202 %q, saw %d %q", i, expected[i], res.code, res.header+" "+res.body)
+		}
+	}
+
+	// Other methods aren't merged.
+	router.Coalesce().POST("/reports/:id", simpleHandler)
+	r, _ := http.NewRequest("POST", "/reports/1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected POST to run its handler, saw %d", w.Code)
+	}
+}
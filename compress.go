@@ -0,0 +1,396 @@
+package httptreemux
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoder compresses responses with a content coding, for Compression.Encoders. The
+// standard library has no brotli or zstd writer, so an Encoder lets one from another
+// package be used.
+type Encoder interface {
+	// Encoding returns the name of the content coding, as it appears in the
+	// Accept-Encoding and Content-Encoding headers, such as br.
+	Encoding() string
+	// NewWriter returns a writer that compresses what is written to it and writes the
+	// result to w. It is closed at the end of the response.
+	NewWriter(w io.Writer) io.WriteCloser
+}
+
+// Compression compresses the responses of routes for clients that accept it. Set
+// TreeMux.Compression to compress the responses of every route, or use
+// Group.Compression or Route.Compression to compress some of them, or to turn off
+// compression for routes that stream their responses or serve content that is already
+// compressed.
+//
+// A response is compressed with the first of Encoders, gzip and deflate that the
+// request's Accept-Encoding header accepts, unless it already has a Content-Encoding
+// header, has no body, is a partial response, or has a Content-Type that isn't in
+// ContentTypes. The Content-Length header is removed from compressed responses, and
+// Accept-Encoding is added to the Vary header of every response of the route. Flushing
+// the ResponseWriter flushes the compressed data written so far.
+type Compression struct {
+	// Level is the compression level for gzip and deflate, from flate.BestSpeed to
+	// flate.BestCompression. The default, when it is zero, is flate.DefaultCompression.
+	Level int
+	// MinSize is the size below which responses aren't compressed. The start of the
+	// response is held back until it reaches this size, unless the handler flushes it.
+	// The default, when it is zero, is 1024. Set it to a negative number to compress
+	// every response.
+	MinSize int
+	// ContentTypes lists the media types that are compressed. An entry ending with /*,
+	// such as text/*, matches every subtype. The default is text/*, application/json,
+	// application/javascript, application/xml, image/svg+xml, and the types that end
+	// with +json or +xml.
+	ContentTypes []string
+	// Encoders are content codings other than gzip and deflate, such as brotli, which
+	// are preferred over them in the order given.
+	Encoders []Encoder
+}
+
+var defaultCompressTypes = []string{"text/*", "application/json", "application/javascript",
+	"application/xml", "image/svg+xml"}
+
+// encoder returns the encoder for the request, or nil if it doesn't accept any of them.
+func (c *Compression) encoder(r *http.Request) Encoder {
+	accepted := acceptedEncodings(r.Header.Get("Accept-Encoding"))
+	if len(accepted) == 0 {
+		return nil
+	}
+	for _, encoder := range c.Encoders {
+		if accepted[encoder.Encoding()] {
+			return encoder
+		}
+	}
+	level := c.Level
+	if level < flate.BestSpeed || level > flate.BestCompression {
+		level = flate.DefaultCompression
+	}
+	if accepted["gzip"] {
+		return gzipEncoder(level)
+	}
+	if accepted["deflate"] {
+		return deflateEncoder(level)
+	}
+	return nil
+}
+
+// acceptedEncodings returns the content codings that the Accept-Encoding header
+// accepts, leaving out those with a quality of zero.
+func acceptedEncodings(header string) map[string]bool {
+	if header == "" {
+		return nil
+	}
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		encoding := part
+		if i := strings.IndexByte(part, ';'); i != -1 {
+			encoding = part[:i]
+			if q := strings.TrimSpace(part[i+1:]); strings.HasPrefix(q, "q=") {
+				if quality, err := strconv.ParseFloat(q[2:], 64); err == nil && quality == 0 {
+					continue
+				}
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(encoding))] = true
+	}
+	return accepted
+}
+
+// compresses reports whether responses with the Content-Type are compressed.
+func (c *Compression) compresses(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	types := c.ContentTypes
+	if types == nil {
+		if strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+			return true
+		}
+		types = defaultCompressTypes
+	}
+	for _, t := range types {
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrap returns the ResponseWriter that the handler for the request writes to, and a
+// function that finishes the response once the handler returns.
+func (c *Compression) wrap(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if r.Method == "HEAD" {
+		return w, func() {}
+	}
+	encoder := c.encoder(r)
+	if encoder == nil {
+		return w, func() {}
+	}
+
+	minSize := c.MinSize
+	if minSize == 0 {
+		minSize = 1024
+	}
+	cw := &compressResponseWriter{ResponseWriter: w, compression: c, encoder: encoder, minSize: minSize}
+	return cw, cw.close
+}
+
+// compressResponseWriter compresses the response written to it, once it knows enough
+// about the response to decide whether to.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	compression *Compression
+	encoder     Encoder
+	minSize     int
+
+	status int
+	// The start of the body, held until the decision is made.
+	buf     []byte
+	decided bool
+	// The compressing writer, if the response is compressed.
+	writer io.WriteCloser
+}
+
+func (w *compressResponseWriter) WriteHeader(statusCode int) {
+	if statusCode >= 100 && statusCode < 200 {
+		// An informational response, such as 103 Early Hints, comes before the real
+		// one, which decides whether to compress.
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if w.decided || w.status != 0 {
+		return
+	}
+	w.status = statusCode
+	if !bodyAllowed(statusCode) {
+		w.decide(false)
+	}
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.writer != nil {
+		return w.writer.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush writes what has been compressed so far and flushes the wrapped ResponseWriter,
+// if it supports flushing, so that streaming handlers keep working.
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decide(true)
+	}
+	if f, ok := w.writer.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection from the wrapped ResponseWriter, if it supports
+// hijacking, so that handlers such as websocket upgrades keep working when responses
+// are compressed. Nothing is written when the handler returns after hijacking.
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("The ResponseWriter does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.decided = true
+		w.buf = nil
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped ResponseWriter, for use by http.ResponseController.
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide decides whether to compress the response, writes the header, and writes the
+// body held so far. The response isn't compressed if big is false, or if its headers
+// rule it out.
+func (w *compressResponseWriter) decide(big bool) error {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buf) != 0 {
+		// Sniff the type now, as net/http would, since it won't once the body is
+		// compressed.
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	compress := big && bodyAllowed(w.status) && w.status != http.StatusPartialContent &&
+		header.Get("Content-Encoding") == "" && header.Get("Content-Range") == "" &&
+		w.compression.compresses(header.Get("Content-Type"))
+	if compress && w.minSize > 0 {
+		if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < w.minSize {
+			compress = false
+		}
+	}
+
+	if compress {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoder.Encoding())
+		w.ResponseWriter.WriteHeader(w.status)
+		w.writer = w.encoder.NewWriter(w.ResponseWriter)
+	} else if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.writer != nil {
+		_, err = w.writer.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
+
+// close finishes the response once the handler has returned.
+func (w *compressResponseWriter) close() {
+	if !w.decided {
+		// The body is smaller than MinSize.
+		w.decide(false)
+	}
+	if w.writer != nil {
+		w.writer.Close()
+	}
+}
+
+// bodyAllowed reports whether a response with the status code can have a body.
+func bodyAllowed(statusCode int) bool {
+	return statusCode >= 200 && statusCode != http.StatusNoContent && statusCode != http.StatusNotModified
+}
+
+// The pools of gzip and deflate writers, indexed by compression level from
+// flate.DefaultCompression, which is the lowest level that Compression uses.
+var (
+	gzipWriters  [flate.BestCompression - flate.DefaultCompression + 1]sync.Pool
+	flateWriters [flate.BestCompression - flate.DefaultCompression + 1]sync.Pool
+)
+
+// gzipEncoder is the Encoder for gzip at a compression level.
+type gzipEncoder int
+
+func (e gzipEncoder) Encoding() string {
+	return "gzip"
+}
+
+func (e gzipEncoder) NewWriter(w io.Writer) io.WriteCloser {
+	pool := &gzipWriters[int(e)-flate.DefaultCompression]
+	if gw, ok := pool.Get().(*gzip.Writer); ok {
+		gw.Reset(w)
+		return pooledWriter{gw, pool}
+	}
+	gw, _ := gzip.NewWriterLevel(w, int(e))
+	return pooledWriter{gw, pool}
+}
+
+// deflateEncoder is the Encoder for deflate at a compression level.
+type deflateEncoder int
+
+func (e deflateEncoder) Encoding() string {
+	return "deflate"
+}
+
+func (e deflateEncoder) NewWriter(w io.Writer) io.WriteCloser {
+	pool := &flateWriters[int(e)-flate.DefaultCompression]
+	if fw, ok := pool.Get().(*flate.Writer); ok {
+		fw.Reset(w)
+		return pooledWriter{fw, pool}
+	}
+	fw, _ := flate.NewWriter(w, int(e))
+	return pooledWriter{fw, pool}
+}
+
+// flushWriteCloser is implemented by gzip.Writer and flate.Writer.
+type flushWriteCloser interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// pooledWriter is a gzip or deflate writer that returns to its pool when closed.
+type pooledWriter struct {
+	flushWriteCloser
+	pool *sync.Pool
+}
+
+func (w pooledWriter) Close() error {
+	err := w.flushWriteCloser.Close()
+	w.pool.Put(w.flushWriteCloser)
+	return err
+}
+
+// Compression returns a group with the same path and middleware as this one, whose
+// routes compress their responses as set by c instead of TreeMux.Compression. A nil c
+// turns off compression for the group's routes. Like With, it can be used for a single
+// route:
+//
+//	router.With().Compression(nil).GET("/events", eventStream)
+func (g *Group) Compression(c *Compression) *Group {
+	group := *g
+	group.settings.compression = c
+	group.settings.compressionSet = true
+	return &group
+}
+
+// Compression sets how the route compresses its responses, replacing
+// TreeMux.Compression and that of the route's group. A nil c turns off compression for
+// the route.
+func (r *Route) Compression(c *Compression) *Route {
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	r.updateNodes(func(n *node) {
+		if n.leafCompression == nil {
+			n.leafCompression = make(map[string]*Compression)
+		}
+		n.leafCompression[r.method] = c
+	})
+	return r
+}
+
+// compression returns the compression for the handler of the node for the method,
+// which is the method the handler was added with.
+func (t *TreeMux) compression(n *node, method string) *Compression {
+	if c, ok := n.leafCompression[method]; ok {
+		return c
+	}
+	return t.Compression
+}
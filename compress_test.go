@@ -0,0 +1,208 @@
+package httptreemux
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testEncoder struct{}
+
+func (testEncoder) Encoding() string {
+	return "test"
+}
+
+func (testEncoder) NewWriter(w io.Writer) io.WriteCloser {
+	return nopWriteCloser{w}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestCompression(t *testing.T) {
+	long := strings.Repeat("compress me ", 200)
+	writeBody := func(contentType, body string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			if contentType != "" {
+				w.Header().Set("Content-Type", contentType)
+			}
+			w.Header().Set("Content-Length", "9999")
+			io.WriteString(w, body)
+		}
+	}
+
+	router := New()
+	router.Compression = &Compression{}
+	router.GET("/long", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		io.WriteString(w, long)
+	})
+	router.GET("/short", writeBody("text/plain", "short"))
+	router.GET("/json", writeBody("application/problem+json", long))
+	router.GET("/image", writeBody("image/png", long))
+	router.GET("/encoded", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.Header().Set("Content-Encoding", "gzip")
+		io.WriteString(w, long)
+	})
+	router.GET("/empty", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	router.GET("/off", writeBody("text/plain", long)).Compression(nil)
+	router.With().Compression(&Compression{MinSize: -1, Encoders: []Encoder{testEncoder{}}}).
+		GET("/custom", writeBody("text/plain", "short"))
+
+	tests := []struct {
+		path     string
+		accept   string
+		encoding string
+	}{
+		{"/long", "gzip, deflate", "gzip"},
+		{"/long", "deflate", "deflate"},
+		{"/long", "gzip;q=0, deflate", "deflate"},
+		{"/long", "", ""},
+		{"/long", "br", ""},
+		{"/short", "gzip", ""},
+		{"/json", "gzip", "gzip"},
+		{"/image", "gzip", ""},
+		{"/encoded", "deflate", "gzip"},
+		{"/empty", "gzip", ""},
+		{"/off", "gzip", ""},
+		{"/custom", "gzip, test", "test"},
+		{"/custom", "gzip", "gzip"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept-Encoding", test.accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		header := w.Header()
+		if encoding := header.Get("Content-Encoding"); encoding != test.encoding {
+			t.Errorf("%s with Accept-Encoding %q expected encoding %q, saw %q", test.path, test.accept,
+				test.encoding, encoding)
+			continue
+		}
+		if vary := header.Get("Vary"); (vary == "Accept-Encoding") == (test.path == "/off") {
+			t.Errorf("%s saw Vary %q", test.path, vary)
+		}
+		if (test.encoding == "gzip" || test.encoding == "deflate") && test.path != "/encoded" {
+			if header.Get("Content-Length") != "" {
+				t.Errorf("%s expected no Content-Length, saw %q", test.path, header.Get("Content-Length"))
+			}
+			var reader io.Reader
+			if test.encoding == "gzip" {
+				reader, _ = gzip.NewReader(w.Body)
+			} else {
+				reader = flate.NewReader(w.Body)
+			}
+			body, err := ioutil.ReadAll(reader)
+			if err != nil || string(body) != long && string(body) != "short" {
+				t.Errorf("%s expected the body to decompress, saw %q, %v", test.path, body, err)
+			}
+		}
+	}
+
+	r, _ := http.NewRequest("GET", "/long", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+		t.Errorf("Expected the sniffed Content-Type, saw %q", contentType)
+	}
+}
+
+func TestCompressionFlush(t *testing.T) {
+	router := New()
+	router.Compression = &Compression{}
+	flushed := make(chan []byte, 1)
+	router.GET("/events", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		flushed <- append([]byte(nil), w.(*compressResponseWriter).ResponseWriter.(*httptest.ResponseRecorder).Body.Bytes()...)
+	})
+
+	r, _ := http.NewRequest("GET", "/events", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	reader, err := gzip.NewReader(bytes.NewReader(<-flushed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := make([]byte, 9)
+	if _, err := io.ReadFull(reader, event); err != nil || string(event) != "data: 1\n\n" {
+		t.Errorf("Expected the event to be flushed, saw %q, %v", event, err)
+	}
+	if !w.Flushed {
+		t.Error("Expected the flush to reach the ResponseWriter")
+	}
+}
+
+func TestCompressionHijackAndInformational(t *testing.T) {
+	router := New()
+	router.Compression = &Compression{MinSize: -1}
+	router.GET("/ws", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	})
+	router.GET("/hints", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		// 103 is http.StatusEarlyHints, which needs Go 1.13.
+		w.WriteHeader(103)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "created")
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	get := func(path string) (*http.Response, string) {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		// Setting the header stops the client from decompressing the body itself.
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	if _, body := get("/ws"); body != "hijacked" {
+		t.Errorf("Expected the hijacked response, saw %q", body)
+	}
+
+	resp, body := get("/hints")
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a compressed 201 response after the early hints, saw %d with %q",
+			resp.StatusCode, resp.Header.Get("Content-Encoding"))
+	}
+	reader, err := gzip.NewReader(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, _ := ioutil.ReadAll(reader); string(decoded) != "created" {
+		t.Errorf("Expected the body to be compressed, saw %q", decoded)
+	}
+}
@@ -0,0 +1,116 @@
+package httptreemux
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// routeCondition is a handler that serves the requests of a route that match it, added
+// with When, WhenQuery or WhenHeader.
+type routeCondition struct {
+	match   func(r *http.Request) bool
+	handler HandlerFunc
+}
+
+// WhenQuery serves the route's requests that have the query parameter with the value
+// with another handler, so that an endpoint with several formats or versions doesn't
+// need a switch statement in its handler. If value is empty, requests that have the
+// parameter with any value match. Requests that don't match any condition fall through
+// to the route's own handler, or to its variants if it has any.
+//
+//	router.GET("/search", searchHandler).
+//		WhenQuery("format", "csv", searchCSVHandler).
+//		WhenQuery("format", "xml", searchXMLHandler)
+//
+// Conditions are checked in the order they were added, and the first one that matches
+// serves the request. The handler is wrapped in the same middleware as the route's own
+// handler, and the rate limits, circuit breakers and coalescing of the route's group
+// apply to it separately.
+func (r *Route) WhenQuery(name, value string, handler HandlerFunc) *Route {
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	return r.addCondition(name+"="+value, func(req *http.Request) bool {
+		values, ok := req.URL.Query()[name]
+		if !ok || value == "" {
+			return ok
+		}
+		return containsString(values, value)
+	}, handler)
+}
+
+// WhenHeader serves the route's requests whose header has the value with another
+// handler, such as for a webhook receiver that gets JSON and form posts at the same
+// URL. Values are compared without regard to case, and a value without parameters also
+// matches a header value that has them, so application/json matches a Content-Type of
+// application/json; charset=utf-8. If value is empty, requests that have the header
+// with any value match. Like WhenQuery, requests that match no condition fall through
+// to the route's own handler.
+//
+//	router.POST("/webhooks", jsonWebhook).
+//		WhenHeader("Content-Type", "multipart/form-data", formWebhook)
+func (r *Route) WhenHeader(name, value string, handler HandlerFunc) *Route {
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	name = http.CanonicalHeaderKey(name)
+	return r.addCondition(name+": "+value, func(req *http.Request) bool {
+		values, ok := req.Header[name]
+		if !ok || value == "" {
+			return ok
+		}
+		for _, v := range values {
+			if headerValueMatches(v, value) {
+				return true
+			}
+		}
+		return false
+	}, handler)
+}
+
+// headerValueMatches reports whether the value of a header matches the value given to
+// WhenHeader.
+func headerValueMatches(headerValue, value string) bool {
+	headerValue = strings.TrimSpace(headerValue)
+	if strings.EqualFold(headerValue, value) {
+		return true
+	}
+	if i := strings.IndexByte(headerValue, ';'); i != -1 && strings.IndexByte(value, ';') == -1 {
+		return strings.EqualFold(strings.TrimSpace(headerValue[:i]), value)
+	}
+	return false
+}
+
+// When serves the route's requests for which match returns true with another handler.
+// It is the general form of WhenQuery and WhenHeader, for conditions they can't
+// express. Like them, requests that match no condition fall through to the route's own
+// handler.
+func (r *Route) When(match func(r *http.Request) bool, handler HandlerFunc) *Route {
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	return r.addCondition("when "+strconv.Itoa(len(r.conditions)), match, handler)
+}
+
+// addCondition adds a condition to the route, whose handler is wrapped like the route's
+// own with the variant name. The router's mutex must be held.
+func (r *Route) addCondition(variant string, match func(r *http.Request) bool, handler HandlerFunc) *Route {
+	conditions := append(r.conditions[:len(r.conditions):len(r.conditions)],
+		routeCondition{match: match, handler: r.wrap(variant, handler)})
+	return r.setHandler(r.variants, r.versions, conditions)
+}
+
+// conditionHandler returns a handler that serves each request with the first of the
+// conditions that matches it, or with otherwise if none do.
+func conditionHandler(conditions []routeCondition, otherwise HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		for _, c := range conditions {
+			if c.match(r) {
+				c.handler(w, r, params)
+				return
+			}
+		}
+		otherwise(w, r, params)
+	}
+}
@@ -0,0 +1,97 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWhenQuery(t *testing.T) {
+	var served string
+	var wrapped int
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			served = name + " " + params["kind"]
+		}
+	}
+	router := New()
+	router.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			wrapped++
+			next(w, r, params)
+		}
+	})
+	router.GET("/search/:kind", makeHandler("default")).
+		WhenQuery("format", "csv", makeHandler("csv")).
+		WhenQuery("format", "xml", makeHandler("xml")).
+		WhenQuery("debug", "", makeHandler("debug")).
+		Variants(VariantFromHeader("X-Variant"), map[string]HandlerFunc{"b": makeHandler("b")})
+
+	tests := []struct {
+		url     string
+		variant string
+		served  string
+	}{
+		{"/search/books", "", "default books"},
+		{"/search/books?format=csv", "", "csv books"},
+		{"/search/books?format=xml&format=csv", "", "csv books"},
+		{"/search/books?format=json", "", "default books"},
+		{"/search/books?debug", "", "debug books"},
+		{"/search/books?debug=1&format=xml", "", "xml books"},
+		{"/search/books?format=json", "b", "b books"},
+		{"/search/books?format=csv", "b", "csv books"},
+	}
+	for _, test := range tests {
+		served, wrapped = "", 0
+		r, _ := http.NewRequest("GET", test.url, nil)
+		if test.variant != "" {
+			r.Header.Set("X-Variant", test.variant)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if served != test.served || wrapped != 1 {
+			t.Errorf("%s expected to be served by %s with the middleware once, saw %s with %d calls",
+				test.url, test.served, served, wrapped)
+		}
+	}
+}
+
+func TestWhenHeader(t *testing.T) {
+	var served string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			served = name
+		}
+	}
+	router := New()
+	router.POST("/webhooks", makeHandler("default")).
+		WhenHeader("content-type", "application/json", makeHandler("json")).
+		WhenHeader("Content-Type", "multipart/form-data", makeHandler("form")).
+		WhenHeader("X-GitHub-Event", "", makeHandler("github")).
+		When(func(r *http.Request) bool { return r.ContentLength > 10 }, makeHandler("large"))
+
+	tests := []struct {
+		headers map[string]string
+		body    string
+		served  string
+	}{
+		{map[string]string{"Content-Type": "application/json"}, "", "json"},
+		{map[string]string{"Content-Type": "Application/JSON; charset=utf-8"}, "", "json"},
+		{map[string]string{"Content-Type": "multipart/form-data; boundary=xyz"}, "", "form"},
+		{map[string]string{"Content-Type": "text/plain", "X-GitHub-Event": "push"}, "", "github"},
+		{map[string]string{"Content-Type": "application/jsonp"}, "", "default"},
+		{map[string]string{"Content-Type": "text/plain"}, "a long request body", "large"},
+		{nil, "", "default"},
+	}
+	for _, test := range tests {
+		served = ""
+		r, _ := http.NewRequest("POST", "/webhooks", strings.NewReader(test.body))
+		for key, value := range test.headers {
+			r.Header.Set(key, value)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if served != test.served {
+			t.Errorf("%v expected to be served by %s, saw %s", test.headers, test.served, served)
+		}
+	}
+}
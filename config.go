@@ -0,0 +1,152 @@
+package httptreemux
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// RouteSpec describes a route in a configuration file, for LoadRoutes. The struct
+// tags let the same file be written in YAML, by decoding it into a RouteConfig with a
+// YAML package.
+type RouteSpec struct {
+	Method string `json:"method" yaml:"method"`
+	Path   string `json:"path" yaml:"path"`
+	// Handler is the name of the route's handler in the map passed to LoadRoutes.
+	Handler string `json:"handler" yaml:"handler"`
+	// Name, if set, is given to the route with Route.Name.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Meta, if set, is added to the route with Route.Meta.
+	Meta map[string]interface{} `json:"meta,omitempty" yaml:"meta,omitempty"`
+}
+
+// RouteConfig is the document read by ParseRouteConfig, such as
+//
+//	{"routes": [
+//		{"method": "GET", "path": "/users/:id", "handler": "getUser", "name": "user"},
+//		{"method": "DELETE", "path": "/users/:id", "handler": "deleteUser",
+//			"meta": {"role": "admin"}}
+//	]}
+type RouteConfig struct {
+	Routes []RouteSpec `json:"routes" yaml:"routes"`
+}
+
+// routeSpecFields are the members a route may have in a JSON configuration.
+var routeSpecFields = map[string]bool{
+	"method":  true,
+	"path":    true,
+	"handler": true,
+	"name":    true,
+	"meta":    true,
+}
+
+// ParseRouteConfig parses a RouteConfig from JSON. The errors give the line and column
+// of a syntax error, and the index of a route with members of the wrong type or
+// members that RouteSpec doesn't have, which are most likely misspelled.
+func ParseRouteConfig(data []byte) ([]RouteSpec, error) {
+	var doc struct {
+		Routes []json.RawMessage `json:"routes"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, configError(data, err)
+	}
+
+	specs := make([]RouteSpec, len(doc.Routes))
+	for i, raw := range doc.Routes {
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &members); err != nil {
+			return nil, fmt.Errorf("routes[%d]: must be an object", i)
+		}
+		var unknown []string
+		for member := range members {
+			if !routeSpecFields[member] {
+				unknown = append(unknown, member)
+			}
+		}
+		if len(unknown) != 0 {
+			sort.Strings(unknown)
+			return nil, fmt.Errorf("routes[%d]: unknown member %q", i, unknown[0])
+		}
+
+		if err := json.Unmarshal(raw, &specs[i]); err != nil {
+			if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+				return nil, fmt.Errorf("routes[%d]: %s must be %s, not %s", i, typeErr.Field,
+					typeErr.Type, typeErr.Value)
+			}
+			return nil, fmt.Errorf("routes[%d]: %s", i, err)
+		}
+	}
+	return specs, nil
+}
+
+// configError adds the line and column of a JSON syntax error to it.
+func configError(data []byte, err error) error {
+	syntaxErr, ok := err.(*json.SyntaxError)
+	if !ok {
+		return fmt.Errorf("Invalid route configuration: %s", err)
+	}
+
+	// The offset is just past the character that caused the error.
+	before := data[:syntaxErr.Offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndex(before, []byte{'\n'}) - 1
+	return fmt.Errorf("Invalid route configuration at line %d, column %d: %s", line, column, err)
+}
+
+// LoadRoutes adds the routes described by specs, such as those returned by
+// ParseRouteConfig. The router is a *TreeMux or a *Group. The handler for each route is
+// found in handlers by its name.
+//
+// Every route is checked before any are added, and an error naming the route is
+// returned if one has no method or path, its handler isn't in handlers, or its name
+// is used by another route in specs. An error adding a route, such as a conflict with
+// an existing one, is returned as well, but the routes added before it remain. To load
+// a configuration without changing the routes being served until all of it has been
+// added, load it into a new router and pass that to TreeMux.Swap.
+func LoadRoutes(router interface {
+	HandleErr(method, path string, handler HandlerFunc) (*Route, error)
+}, specs []RouteSpec, handlers map[string]HandlerFunc) error {
+	names := make(map[string]int)
+	for i, spec := range specs {
+		switch {
+		case spec.Method == "":
+			return fmt.Errorf("routes[%d] (%s): has no method", i, spec.Path)
+		case spec.Path == "":
+			return fmt.Errorf("routes[%d] (%s): has no path", i, spec.Method)
+		case spec.Handler == "":
+			return fmt.Errorf("routes[%d] (%s %s): has no handler", i, spec.Method, spec.Path)
+		}
+		if _, ok := handlers[spec.Handler]; !ok {
+			return fmt.Errorf("routes[%d] (%s %s): no handler named %s", i, spec.Method, spec.Path,
+				spec.Handler)
+		}
+		if spec.Name != "" {
+			if other, ok := names[spec.Name]; ok {
+				return fmt.Errorf("routes[%d] (%s %s): name %s is already used by routes[%d]", i,
+					spec.Method, spec.Path, spec.Name, other)
+			}
+			names[spec.Name] = i
+		}
+	}
+
+	for i, spec := range specs {
+		route, err := router.HandleErr(spec.Method, spec.Path, handlers[spec.Handler])
+		if err == nil && spec.Name != "" {
+			err = route.setName(spec.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("routes[%d] (%s %s): %s", i, spec.Method, spec.Path, err)
+		}
+
+		keys := make([]string, 0, len(spec.Meta))
+		for key := range spec.Meta {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			route.Meta(key, spec.Meta[key])
+		}
+	}
+	return nil
+}
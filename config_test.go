@@ -0,0 +1,184 @@
+package httptreemux
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRoutes(t *testing.T) {
+	config := `{"routes": [
+		{"method": "GET", "path": "/users/:id", "handler": "getUser", "name": "user"},
+		{"method": "DELETE", "path": "/users/:id", "handler": "deleteUser",
+			"meta": {"role": "admin", "audit": true}}
+	]}`
+
+	var matched string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			matched = name + " " + params["id"]
+		}
+	}
+	handlers := map[string]HandlerFunc{
+		"getUser":    makeHandler("get"),
+		"deleteUser": makeHandler("delete"),
+	}
+
+	specs, err := ParseRouteConfig([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := New()
+	if err := LoadRoutes(router.Group("/api"), specs, handlers); err != nil {
+		t.Fatal(err)
+	}
+
+	for method, expect := range map[string]string{"GET": "get 5", "DELETE": "delete 5"} {
+		matched = ""
+		r, _ := newRequest(method, "/api/users/5", nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if matched != expect {
+			t.Errorf("%s expected match %q, saw %q", method, expect, matched)
+		}
+	}
+	if url, err := router.URL("user", map[string]string{"id": "7"}); err != nil || url != "/api/users/7" {
+		t.Errorf("Expected the route to be named, saw %q, %v", url, err)
+	}
+	if lr, _ := router.Lookup("DELETE", "/api/users/5"); lr.Meta["role"] != "admin" || lr.Meta["audit"] != true {
+		t.Errorf("Expected the route's metadata, saw %v", lr.Meta)
+	}
+}
+
+func TestRouteConfigErrors(t *testing.T) {
+	handlers := map[string]HandlerFunc{"h": simpleHandler}
+
+	parseTests := []struct {
+		config string
+		err    string
+	}{
+		{"{\"routes\": [\n  {\"method\": \"GET\",}\n]}",
+			"Invalid route configuration at line 2, column 20: invalid character '}' looking for beginning of object key string"},
+		{`{"routes": [{"method": "GET", "path": "/", "hander": "h"}]}`, `routes[0]: unknown member "hander"`},
+		{`{"routes": [{"method": "GET"}, {"method": 1}]}`, "routes[1]: method must be string, not number"},
+		{`{"routes": [5]}`, "routes[0]: must be an object"},
+	}
+	for _, test := range parseTests {
+		_, err := ParseRouteConfig([]byte(test.config))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("Config %s expected error %q, saw %v", test.config, test.err, err)
+		}
+	}
+
+	loadTests := []struct {
+		specs []RouteSpec
+		err   string
+	}{
+		{[]RouteSpec{{Path: "/a", Handler: "h"}}, "routes[0] (/a): has no method"},
+		{[]RouteSpec{{Method: "GET", Path: "/a", Handler: "x"}}, "routes[0] (GET /a): no handler named x"},
+		{[]RouteSpec{
+			{Method: "GET", Path: "/a", Handler: "h", Name: "a"},
+			{Method: "GET", Path: "/b", Handler: "h", Name: "a"},
+		}, "routes[1] (GET /b): name a is already used by routes[0]"},
+		{[]RouteSpec{
+			{Method: "GET", Path: "/a", Handler: "h"},
+			{Method: "GET", Path: "/a", Handler: "h"},
+		}, "routes[1] (GET /a): a already handles GET"},
+	}
+	for _, test := range loadTests {
+		err := LoadRoutes(New(), test.specs, handlers)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("Specs %+v expected error %q, saw %v", test.specs, test.err, err)
+		}
+	}
+
+	// A route name already used in the router is an error rather than a panic.
+	router := New()
+	router.GET("/x", simpleHandler).Name("a")
+	err := LoadRoutes(router, []RouteSpec{{Method: "GET", Path: "/a", Handler: "h", Name: "a"}}, handlers)
+	if err == nil || err.Error() != "routes[0] (GET /a): Route name a is already used by GET /x" {
+		t.Errorf("Expected an error for a name used by the router, saw %v", err)
+	}
+}
+
+func TestConfigWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httptreemux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "routes.json")
+
+	// Renaming the file into place keeps the watcher from seeing it half written.
+	write := func(config string) {
+		if err := ioutil.WriteFile(path+".tmp", []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status := func(router *TreeMux, path string) int {
+		lr, _ := router.Lookup("GET", path)
+		return lr.StatusCode
+	}
+
+	write(`{"routes": [{"method": "GET", "path": "/a", "handler": "h"}]}`)
+	router := New()
+	reloads := make(chan error, 10)
+	watcher := &ConfigWatcher{
+		Router:   router,
+		Path:     path,
+		Handlers: map[string]HandlerFunc{"h": simpleHandler},
+		Setup: func(next *TreeMux) error {
+			next.GET("/fixed", simpleHandler)
+			return nil
+		},
+		OnReload: func(err error) { reloads <- err },
+		Interval: 10 * time.Millisecond,
+	}
+	if err := watcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	if status(router, "/a") != http.StatusOK || status(router, "/fixed") != http.StatusOK {
+		t.Fatal("Expected the routes to be loaded by Start")
+	}
+
+	// The size changes, so the change is seen even if the modification time doesn't.
+	write(`{"routes": [{"method": "GET", "path": "/bb", "handler": "h"}]}`)
+	if err := <-reloads; err != nil {
+		t.Fatalf("Unexpected reload error %v", err)
+	}
+	if status(router, "/a") != http.StatusNotFound || status(router, "/bb") != http.StatusOK ||
+		status(router, "/fixed") != http.StatusOK {
+		t.Error("Expected the new routes to replace the old ones")
+	}
+
+	// A route that Validate rejects keeps the old routes.
+	write(`{"routes": [
+		{"method": "GET", "path": "/users/:id", "handler": "h"},
+		{"method": "GET", "path": "/users/:userID/posts", "handler": "h"}
+	]}`)
+	err = <-reloads
+	if err == nil || !strings.Contains(err.Error(), "calls a wildcard userID, but /users/:id calls it id") {
+		t.Errorf("Expected a validation error, saw %v", err)
+	}
+	if status(router, "/bb") != http.StatusOK || status(router, "/users/1") != http.StatusNotFound {
+		t.Error("Expected the old routes to be kept after a failed reload")
+	}
+
+	write(`{"routes": [{"method": "GET", "path": "/c", "handler": "missing"}]}`)
+	err = <-reloads
+	if err == nil || !strings.Contains(err.Error(), "no handler named missing") {
+		t.Errorf("Expected an error for the missing handler, saw %v", err)
+	}
+	if status(router, "/bb") != http.StatusOK {
+		t.Error("Expected the old routes to be kept after a failed reload")
+	}
+}
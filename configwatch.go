@@ -0,0 +1,207 @@
+package httptreemux
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultConfigWatchInterval is how often a ConfigWatcher checks its file when its
+// Interval is zero.
+const DefaultConfigWatchInterval = time.Second
+
+// ConfigWatcher keeps the routes of a router in sync with a configuration file in the
+// format read by ParseRouteConfig. Whenever the file changes, it builds the complete set
+// of routes again in a new router, checks them with Validate, and puts them in place
+// with TreeMux.Swap, so requests never see a partly loaded configuration. If anything
+// fails, the routes that are being served are kept.
+//
+//	watcher := &httptreemux.ConfigWatcher{
+//		Router:   router,
+//		Path:     "routes.json",
+//		Handlers: handlers,
+//		OnReload: func(err error) {
+//			if err != nil {
+//				log.Printf("Keeping the old routes: %s", err)
+//			}
+//		},
+//	}
+//	if err := watcher.Start(); err != nil {
+//		log.Fatal(err)
+//	}
+type ConfigWatcher struct {
+	// Router is the router whose routes are replaced.
+	Router *TreeMux
+	// Path is the name of the configuration file.
+	Path string
+	// Handlers maps the handler names used in the file to handlers, as for LoadRoutes.
+	Handlers map[string]HandlerFunc
+	// Setup, if set, is called with each new router before the routes from the file are
+	// added to it, to add the routes that don't come from the file, since every route of
+	// Router is replaced.
+	Setup func(router *TreeMux) error
+	// OnReload, if set, is called after each reload of the file, with nil if the new
+	// routes are being served, or the error that stopped them otherwise. It is not
+	// called for the first load done by Start, which returns the error instead.
+	OnReload func(err error)
+	// Interval is how often the file is checked for changes. The default is
+	// DefaultConfigWatchInterval.
+	Interval time.Duration
+	// SkipValidation puts the new routes in place even if Validate finds problems
+	// with them.
+	SkipValidation bool
+
+	// Serializes reloads.
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Start loads the routes from the file, and then checks it for changes in a separate
+// goroutine until Stop is called. If the first load fails, its error is returned and
+// the file isn't watched.
+func (w *ConfigWatcher) Start() error {
+	if err := w.Reload(); err != nil {
+		return err
+	}
+
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultConfigWatchInterval
+	}
+
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.watch(interval, w.stop, w.done)
+	return nil
+}
+
+// Stop stops checking the file for changes, and waits for a reload that is in
+// progress to finish.
+func (w *ConfigWatcher) Stop() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+}
+
+func (w *ConfigWatcher) watch(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if !w.changed() {
+			continue
+		}
+		err := w.Reload()
+		if w.OnReload != nil {
+			w.OnReload(err)
+		}
+	}
+}
+
+// changed reports whether the file's modification time or size is different from
+// when it was last loaded.
+func (w *ConfigWatcher) changed() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	info, err := os.Stat(w.Path)
+	if err != nil {
+		// Report the error through Reload, unless it was already reported.
+		return !w.modTime.IsZero()
+	}
+	return !info.ModTime().Equal(w.modTime) || info.Size() != w.size
+}
+
+// Reload loads the routes from the file now, whether or not it has changed, and
+// replaces the router's routes with them. If an error is returned, the router's routes
+// are not changed.
+func (w *ConfigWatcher) Reload() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	info, err := os.Stat(w.Path)
+	if err != nil {
+		w.modTime, w.size = time.Time{}, 0
+		return err
+	}
+	// Remember the version of the file even if it can't be loaded, so that the same
+	// error isn't reported on every check.
+	w.modTime, w.size = info.ModTime(), info.Size()
+
+	data, err := ioutil.ReadFile(w.Path)
+	if err != nil {
+		return err
+	}
+	specs, err := ParseRouteConfig(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", w.Path, err)
+	}
+
+	if err := w.Router.replaceRoutes(specs, w.Handlers, w.Setup, !w.SkipValidation); err != nil {
+		return fmt.Errorf("%s: %s", w.Path, err)
+	}
+	return nil
+}
+
+// replaceRoutes adds the routes to a new router, after those added by setup if it
+// isn't nil, checks them with Validate if validate is set, and swaps them in. If
+// anything fails, the router's routes are not changed.
+func (t *TreeMux) replaceRoutes(specs []RouteSpec, handlers map[string]HandlerFunc,
+	setup func(*TreeMux) error, validate bool) error {
+	next := t.stagingRouter()
+	if setup != nil {
+		if err := setup(next); err != nil {
+			return err
+		}
+	}
+	if err := LoadRoutes(next, specs, handlers); err != nil {
+		return err
+	}
+
+	if validate {
+		if errs := t.validateTrees(next.loadTrees()); len(errs) != 0 {
+			messages := make([]string, len(errs))
+			for i, err := range errs {
+				messages[i] = err.Error()
+			}
+			return errors.New("Invalid routes: " + strings.Join(messages, "; "))
+		}
+	}
+
+	t.Swap(next)
+	return nil
+}
+
+// stagingRouter returns a new router for building routes to Swap into this one. It
+// has the settings that are used while routes are added, and by the handlers the
+// router creates, such as those of ServeFiles and HandleE.
+func (t *TreeMux) stagingRouter() *TreeMux {
+	next := New()
+
+	t.mutex.Lock()
+	next.middleware = append([]MiddlewareFunc(nil), t.middleware...)
+	t.mutex.Unlock()
+
+	next.RedirectTrailingSlash = t.RedirectTrailingSlash
+	next.OptionsHandler = t.OptionsHandler
+	next.NotFoundHandler = t.NotFoundHandler
+	next.ErrorHandler = t.ErrorHandler
+	return next
+}
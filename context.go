@@ -0,0 +1,242 @@
+//go:build go1.7
+// +build go1.7
+
+package httptreemux
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// ContextGroup is a wrapper around Group that registers standard http.Handler and
+// http.HandlerFunc values instead of HandlerFunc. The URL parameters are stored in
+// the request's context, where they can be retrieved with ContextParams.
+type ContextGroup struct {
+	group *Group
+}
+
+// UsingContext returns a ContextGroup that registers routes at the root of the router.
+func (t *TreeMux) UsingContext() *ContextGroup {
+	return &ContextGroup{group: &Group{mux: t}}
+}
+
+// UsingContext returns a ContextGroup that registers routes in this group.
+func (g *Group) UsingContext() *ContextGroup {
+	return &ContextGroup{group: g}
+}
+
+// Group creates a new ContextGroup nested inside this one.
+func (cg *ContextGroup) Group(path string) *ContextGroup {
+	return &ContextGroup{group: cg.group.Group(path)}
+}
+
+// Use appends a middleware function to the group's middleware stack. See Group.Use.
+func (cg *ContextGroup) Use(middleware MiddlewareFunc) {
+	cg.group.Use(middleware)
+}
+
+// With returns a ContextGroup whose handlers are wrapped by the given middleware. See
+// Group.With.
+func (cg *ContextGroup) With(middleware ...MiddlewareFunc) *ContextGroup {
+	return &ContextGroup{group: cg.group.With(middleware...)}
+}
+
+// Handle adds an http.HandlerFunc for the path. Any URL parameters are added to the
+// request's context before the handler is called.
+func (cg *ContextGroup) Handle(method, path string, handler http.HandlerFunc) *Route {
+	return cg.group.Handle(method, path,
+		func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			if params != nil {
+				r = r.WithContext(AddParamsToContext(r.Context(), params))
+			}
+			handler(w, r)
+		})
+}
+
+// HandleMethods adds an http.HandlerFunc for each of the methods at the path. See
+// Group.HandleMethods.
+func (cg *ContextGroup) HandleMethods(methods []string, path string, handler http.HandlerFunc) []*Route {
+	return cg.group.HandleMethods(methods, path,
+		func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			if params != nil {
+				r = r.WithContext(AddParamsToContext(r.Context(), params))
+			}
+			handler(w, r)
+		})
+}
+
+// Handler adds an http.Handler for the path. Any URL parameters are added to the
+// request's context before the handler is called.
+func (cg *ContextGroup) Handler(method, path string, handler http.Handler) *Route {
+	return cg.Handle(method, path, handler.ServeHTTP)
+}
+
+// HandleGorilla adds an http.Handler for a pattern written for gorilla/mux, after
+// converting it with GorillaPattern, to ease migrating from gorilla/mux. The handler can
+// get the values of the pattern's variables with ContextParams instead of mux.Vars. It
+// panics if the pattern can't be converted.
+func (cg *ContextGroup) HandleGorilla(method, pattern string, handler http.Handler) *Route {
+	path, err := GorillaPattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return cg.Handler(method, path, handler)
+}
+
+// Syntactic sugar for Handle("GET", path, handler)
+func (cg *ContextGroup) GET(path string, handler http.HandlerFunc) *Route {
+	return cg.Handle("GET", path, handler)
+}
+
+// Syntactic sugar for Handle("POST", path, handler)
+func (cg *ContextGroup) POST(path string, handler http.HandlerFunc) *Route {
+	return cg.Handle("POST", path, handler)
+}
+
+// Syntactic sugar for Handle("PUT", path, handler)
+func (cg *ContextGroup) PUT(path string, handler http.HandlerFunc) *Route {
+	return cg.Handle("PUT", path, handler)
+}
+
+// Syntactic sugar for Handle("DELETE", path, handler)
+func (cg *ContextGroup) DELETE(path string, handler http.HandlerFunc) *Route {
+	return cg.Handle("DELETE", path, handler)
+}
+
+// Syntactic sugar for Handle("PATCH", path, handler)
+func (cg *ContextGroup) PATCH(path string, handler http.HandlerFunc) *Route {
+	return cg.Handle("PATCH", path, handler)
+}
+
+// Syntactic sugar for Handle("HEAD", path, handler)
+func (cg *ContextGroup) HEAD(path string, handler http.HandlerFunc) *Route {
+	return cg.Handle("HEAD", path, handler)
+}
+
+// Syntactic sugar for Handle("OPTIONS", path, handler)
+func (cg *ContextGroup) OPTIONS(path string, handler http.HandlerFunc) *Route {
+	return cg.Handle("OPTIONS", path, handler)
+}
+
+// Syntactic sugar for Handle(AnyMethod, path, handler). See TreeMux.Any.
+func (cg *ContextGroup) Any(path string, handler http.HandlerFunc) *Route {
+	return cg.Handle(AnyMethod, path, handler)
+}
+
+type contextKey int
+
+const (
+	paramsContextKey contextKey = iota
+	typedParamsContextKey
+	routeContextKey
+	metaContextKey
+	variantContextKey
+	requestIDContextKey
+	claimsContextKey
+	suggestionsContextKey
+)
+
+func init() {
+	withTypedParams = func(r *http.Request, values map[string]interface{}) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), typedParamsContextKey, values))
+	}
+	withRoute = func(r *http.Request, pattern string) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), routeContextKey, pattern))
+	}
+	withMeta = func(r *http.Request, meta map[string]interface{}) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), metaContextKey, meta))
+	}
+	withVariant = func(r *http.Request, name string) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), variantContextKey, name))
+	}
+	withRequestID = func(r *http.Request, id string) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), requestIDContextKey, id))
+	}
+	withClaims = func(r *http.Request, claims map[string]interface{}) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims))
+	}
+	withSuggestions = func(r *http.Request, suggestions []string) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), suggestionsContextKey, suggestions))
+	}
+	requestSuggestions = func(r *http.Request) []string {
+		return ContextSuggestions(r.Context())
+	}
+	localAddr = func(r *http.Request) net.Addr {
+		addr, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+		return addr
+	}
+}
+
+// ContextParams returns the URL parameters stored in the context by a handler
+// registered through a ContextGroup. The result is nil if the matched route had no
+// parameters.
+func ContextParams(ctx context.Context) map[string]string {
+	params, _ := ctx.Value(paramsContextKey).(map[string]string)
+	return params
+}
+
+// AddParamsToContext returns a copy of ctx holding the URL parameters, so that they
+// can be retrieved with ContextParams.
+func AddParamsToContext(ctx context.Context, params map[string]string) context.Context {
+	return context.WithValue(ctx, paramsContextKey, params)
+}
+
+// ContextTypedParams returns the converted values of the typed wildcards in the
+// matched route, such as :id:int, keyed by the wildcard names. The router stores them
+// in the request's context for every handler, whether or not it was registered
+// through a ContextGroup. The result is nil if the route had no typed wildcards.
+func ContextTypedParams(ctx context.Context) map[string]interface{} {
+	values, _ := ctx.Value(typedParamsContextKey).(map[string]interface{})
+	return values
+}
+
+// ContextRoute returns the pattern of the route that matched the request, such as
+// /users/:id, when TreeMux.RouteInContext is true. The result is an empty string if
+// the pattern is not in the context.
+func ContextRoute(ctx context.Context) string {
+	route, _ := ctx.Value(routeContextKey).(string)
+	return route
+}
+
+// ContextMeta returns the metadata added with Route.Meta to the route that matched the
+// request. The router stores it in the request's context for every handler and its
+// middleware, whether or not the handler was registered through a ContextGroup. The
+// result is nil if the route has no metadata. It must not be modified.
+func ContextMeta(ctx context.Context) map[string]interface{} {
+	meta, _ := ctx.Value(metaContextKey).(map[string]interface{})
+	return meta
+}
+
+// ContextVariant returns the name of the variant that serves the request, for a route
+// with variants added by Route.Variants or Route.Split. The result is an empty string
+// if the request is served by the route's own handler.
+func ContextVariant(ctx context.Context) string {
+	name, _ := ctx.Value(variantContextKey).(string)
+	return name
+}
+
+// ContextRequestID returns the ID of the request, when TreeMux.RequestID is set. The
+// router stores it in the request's context before the route is looked up, so it is
+// available to every handler and middleware, as well as PanicHandler and
+// NotFoundHandler. The result is an empty string if the ID is not in the context.
+func ContextRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// ContextClaims returns the claims of the token that TreeMux.JWT accepted for the
+// request, for a route that requires scopes with Route.Require. The result is nil if
+// the route doesn't require scopes. It must not be modified.
+func ContextClaims(ctx context.Context) map[string]interface{} {
+	claims, _ := ctx.Value(claimsContextKey).(map[string]interface{})
+	return claims
+}
+
+// ContextSuggestions returns the patterns of the routes that TreeMux.Suggestions found
+// similar to the path of a request that matched no route, closest first, for use by a
+// NotFoundHandler. The result is nil if there are none, or Suggestions is not set.
+func ContextSuggestions(ctx context.Context) []string {
+	suggestions, _ := ctx.Value(suggestionsContextKey).([]string)
+	return suggestions
+}
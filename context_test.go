@@ -0,0 +1,384 @@
+//go:build go1.7
+// +build go1.7
+
+package httptreemux
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestContextParams(t *testing.T) {
+	m := map[string]string{"id": "123"}
+	ctx := AddParamsToContext(context.Background(), m)
+
+	params := ContextParams(ctx)
+	if params["id"] != "123" {
+		t.Errorf("Expected id 123 in context params, saw %v", params)
+	}
+
+	if params := ContextParams(context.Background()); params != nil {
+		t.Errorf("Expected nil params from empty context, saw %v", params)
+	}
+}
+
+func TestContextGroupMethods(t *testing.T) {
+	for _, scenario := range scenarios {
+		t.Log(scenario.description)
+		testContextGroupMethods(t, scenario.RequestCreator)
+	}
+}
+
+func testContextGroupMethods(t *testing.T, newRequest RequestCreator) {
+	var result string
+
+	makeHandler := func(method string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			result = method + " " + ContextParams(r.Context())["param"]
+		}
+	}
+
+	router := New()
+	router.HeadCanUseGet = false
+	cg := router.UsingContext().Group("/base").Group("/user")
+	cg.GET("/:param", makeHandler("GET"))
+	cg.POST("/:param", makeHandler("POST"))
+	cg.PATCH("/:param", makeHandler("PATCH"))
+	cg.PUT("/:param", makeHandler("PUT"))
+	cg.DELETE("/:param", makeHandler("DELETE"))
+	cg.HEAD("/:param", makeHandler("HEAD"))
+	cg.OPTIONS("/:param", makeHandler("OPTIONS"))
+
+	for _, method := range []string{"GET", "POST", "PATCH", "PUT", "DELETE", "HEAD", "OPTIONS"} {
+		result = ""
+		w := httptest.NewRecorder()
+		r, _ := newRequest(method, "/base/user/abc", nil)
+		router.ServeHTTP(w, r)
+		if expected := method + " abc"; result != expected {
+			t.Errorf("Method %s expected result %q, saw %q", method, expected, result)
+		}
+	}
+}
+
+func TestContextGroupHandler(t *testing.T) {
+	var sawParams map[string]string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sawParams = ContextParams(r.Context())
+	})
+
+	router := New()
+	router.Group("/api").UsingContext().Handler("GET", "/static", handler)
+
+	w := httptest.NewRecorder()
+	r, _ := newRequest("GET", "/api/static", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for /api/static, saw %d", w.Code)
+	}
+	if sawParams != nil {
+		t.Errorf("Expected no params for static route, saw %v", sawParams)
+	}
+}
+
+func TestContextTypedParams(t *testing.T) {
+	RegisterParamType("even", func(segment string) (interface{}, error) {
+		n, err := strconv.Atoi(segment)
+		if err != nil || n%2 != 0 {
+			return nil, errors.New("not even")
+		}
+		return n, nil
+	})
+
+	var values map[string]interface{}
+	router := New()
+	router.GET("/orders/:id:int/:n:even", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		values = ContextTypedParams(r.Context())
+	})
+	router.UsingContext().GET("/users/:id:uint", func(w http.ResponseWriter, r *http.Request) {
+		values = ContextTypedParams(r.Context())
+		if ContextParams(r.Context())["id"] != "5" {
+			t.Errorf("Expected string param 5, saw %v", ContextParams(r.Context()))
+		}
+	})
+	router.GET("/plain/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		values = ContextTypedParams(r.Context())
+	})
+
+	tests := []struct {
+		path     string
+		code     int
+		expected map[string]interface{}
+	}{
+		{"/orders/12/4", http.StatusOK, map[string]interface{}{"id": 12, "n": 4}},
+		{"/orders/12/3", http.StatusNotFound, nil},
+		{"/orders/abc/4", http.StatusNotFound, nil},
+		{"/users/5", http.StatusOK, map[string]interface{}{"id": uint64(5)}},
+		{"/plain/5", http.StatusOK, nil},
+	}
+
+	for _, test := range tests {
+		values = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s expected code %d, saw %d", test.path, test.code, w.Code)
+		}
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("%s expected typed params %v, saw %v", test.path, test.expected, values)
+		}
+	}
+}
+
+func TestContextRoute(t *testing.T) {
+	var route, middlewareRoute string
+	router := New()
+	router.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			middlewareRoute = ContextRoute(r.Context())
+			next(w, r, params)
+		}
+	})
+	router.GET("/users/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		route = ContextRoute(r.Context())
+	})
+	router.UsingContext().GET("/posts/*path", func(w http.ResponseWriter, r *http.Request) {
+		route = ContextRoute(r.Context())
+	})
+
+	serve := func(path string) {
+		route, middlewareRoute = "", ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, r)
+	}
+
+	serve("/users/1")
+	if route != "" {
+		t.Errorf("Expected no route without RouteInContext, saw %s", route)
+	}
+
+	router.RouteInContext = true
+	serve("/users/1")
+	if route != "/users/:id" || middlewareRoute != "/users/:id" {
+		t.Errorf("Expected route /users/:id in handler and middleware, saw %q and %q", route, middlewareRoute)
+	}
+
+	serve("/posts/a/b")
+	if route != "/posts/*path" {
+		t.Errorf("Expected route /posts/*path, saw %q", route)
+	}
+}
+
+func TestContextMeta(t *testing.T) {
+	var role interface{}
+	router := New()
+	router.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			role = ContextMeta(r.Context())["auth"]
+			next(w, r, params)
+		}
+	})
+	router.GET("/admin/:id", simpleHandler).Meta("auth", "admin")
+	router.GET("/public", simpleHandler)
+
+	tests := []struct {
+		method string
+		path   string
+		expect interface{}
+	}{
+		{"GET", "/admin/1", "admin"},
+		{"HEAD", "/admin/1", "admin"},
+		{"GET", "/public", nil},
+	}
+	for _, test := range tests {
+		role = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, r)
+		if role != test.expect {
+			t.Errorf("%s %s expected auth %v in middleware, saw %v", test.method, test.path, test.expect, role)
+		}
+	}
+}
+
+func TestContextVariant(t *testing.T) {
+	var variant, served string
+	router := New()
+	router.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			variant = ContextVariant(r.Context())
+			next(w, r, params)
+		}
+	})
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			served = name
+		}
+	}
+	router.GET("/pricing", makeHandler("own")).Variants(VariantFromCookie("variant"),
+		map[string]HandlerFunc{"a": makeHandler("a"), "b": makeHandler("b")})
+	router.GET("/checkout", makeHandler("own")).Split(100, makeHandler("canary"), nil)
+
+	tests := []struct {
+		path    string
+		cookie  string
+		variant string
+		served  string
+	}{
+		{"/pricing", "a", "a", "a"},
+		{"/pricing", "b", "b", "b"},
+		{"/pricing", "c", "", "own"},
+		{"/pricing", "", "", "own"},
+		{"/checkout", "", "canary", "canary"},
+	}
+	for _, test := range tests {
+		variant, served = "", ""
+		r, _ := http.NewRequest("GET", test.path, nil)
+		if test.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "variant", Value: test.cookie})
+		}
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if variant != test.variant || served != test.served {
+			t.Errorf("%s with cookie %q expected variant %q served by %s, saw %q served by %s",
+				test.path, test.cookie, test.variant, test.served, variant, served)
+		}
+	}
+}
+
+func TestContextRequestID(t *testing.T) {
+	var handlerID, panicID string
+	router := New()
+	router.RequestID = &RequestID{}
+	router.GET("/users", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		handlerID = ContextRequestID(r.Context())
+	})
+	router.GET("/panic", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		panic("oops")
+	})
+	router.PanicHandler = func(w http.ResponseWriter, r *http.Request, err interface{}) {
+		panicID = ContextRequestID(r.Context())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	r, _ := http.NewRequest("GET", "/users", nil)
+	r.Header.Set("X-Request-ID", "abc")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if handlerID != "abc" {
+		t.Errorf("Expected the request ID abc in the context, saw %q", handlerID)
+	}
+
+	w := httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/panic", nil)
+	router.ServeHTTP(w, r)
+	if panicID == "" || panicID != w.Header().Get("X-Request-ID") {
+		t.Errorf("Expected the PanicHandler to see the generated ID %q, saw %q",
+			w.Header().Get("X-Request-ID"), panicID)
+	}
+}
+
+func TestContextClaims(t *testing.T) {
+	var claims map[string]interface{}
+	router := New()
+	router.JWT = &JWTAuth{Validator: &JWTValidator{Secret: []byte("secret")}}
+	router.GET("/me", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		claims = ContextClaims(r.Context())
+	}).Require()
+
+	r, _ := http.NewRequest("GET", "/me", nil)
+	r.Header.Set("Authorization", "Bearer "+signToken(map[string]interface{}{"sub": "user"}, []byte("secret"), nil))
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if claims["sub"] != "user" {
+		t.Errorf("Expected the token's claims in the context, saw %v", claims)
+	}
+}
+
+func TestPortFromListener(t *testing.T) {
+	router := New()
+	router.GET("/admin", simpleHandler).Port("9090")
+
+	for port, code := range map[string]int{"9090": http.StatusOK, "8080": http.StatusNotFound} {
+		r, _ := http.NewRequest("GET", "/admin", nil)
+		// The Host header is ignored when the listener's address is known.
+		r.Host = "example.com:9090"
+		portNumber, _ := strconv.Atoi(port)
+		addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: portNumber}
+		r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, addr))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("Listener port %s expected %d, saw %d", port, code, w.Code)
+		}
+	}
+}
+
+func TestContextSuggestions(t *testing.T) {
+	router := New()
+	router.Suggestions = 2
+	router.GET("/users/:id", simpleHandler)
+	router.GET("/users/:id/posts", simpleHandler)
+	router.POST("/users", simpleHandler)
+	router.GET("/orders/:id", simpleHandler)
+
+	r, _ := http.NewRequest("GET", "/usres/1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	expected := "404 page not found\n\nDid you mean:\n  /users/:id\n  /users\n"
+	if w.Code != http.StatusNotFound || w.Body.String() != expected {
+		t.Errorf("Expected the suggestions in the body, saw %d with %q", w.Code, w.Body.String())
+	}
+
+	var suggestions []string
+	router.NotFoundHandler = func(w http.ResponseWriter, r *http.Request) {
+		suggestions = ContextSuggestions(r.Context())
+	}
+	r, _ = http.NewRequest("GET", "/user/1/post", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if !reflect.DeepEqual(suggestions, []string{"/users/:id", "/users/:id/posts"}) {
+		t.Errorf("Expected the suggestions in the context, saw %v", suggestions)
+	}
+
+	r, _ = http.NewRequest("GET", "/something/else/entirely", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if suggestions != nil {
+		t.Errorf("Expected no suggestions for an unrelated path, saw %v", suggestions)
+	}
+}
+
+func TestHandleGorilla(t *testing.T) {
+	var vars map[string]string
+	router := New()
+	router.UsingContext().Group("/api").HandleGorilla("GET", "/articles/{category}/{id:[0-9]+}",
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			vars = ContextParams(r.Context())
+		}))
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/api/articles/news/42", nil)
+	router.ServeHTTP(w, r)
+	if expected := map[string]string{"category": "news", "id": "42"}; !reflect.DeepEqual(vars, expected) {
+		t.Errorf("Expected vars %v, saw %v", expected, vars)
+	}
+
+	vars = nil
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/api/articles/news/latest", nil)
+	router.ServeHTTP(w, r)
+	if vars != nil || w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for id that doesn't match the expression, saw %d %v", w.Code, vars)
+	}
+
+	defer func() {
+		if err := recover(); err == nil {
+			t.Error("Expected panic for pattern that can't be converted")
+		}
+	}()
+	router.UsingContext().HandleGorilla("GET", "/articles/{id}.json", http.NotFoundHandler())
+}
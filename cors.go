@@ -0,0 +1,176 @@
+package httptreemux
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS is a policy for cross-origin requests from browsers. Set TreeMux.CORS to apply
+// it to every route, or use Group.CORS or Route.CORS to apply it to some of them.
+//
+// The router answers the preflight OPTIONS request that a browser sends before a
+// cross-origin request itself, for any route with a policy, so no OPTIONS handler is
+// needed. The Access-Control-Allow-Methods header of the response lists the methods
+// that the matched pattern has a handler for, among those whose routes have a policy.
+// The policy of the route for the method that the browser asks about supplies the
+// other headers. Responses to the requests themselves get the
+// Access-Control-Allow-Origin header and the others that the policy calls for, before
+// the handler is called.
+type CORS struct {
+	// AllowedOrigins lists the origins, such as https://example.com, that are allowed to
+	// make cross-origin requests. An entry of "*" allows any origin.
+	AllowedOrigins []string
+	// AllowOrigin, if set, is called for origins that aren't in AllowedOrigins, and
+	// allows the origin if it returns true.
+	AllowOrigin func(origin string) bool
+	// AllowedHeaders lists the request headers, other than those browsers always
+	// allow, that cross-origin requests may send. An entry of "*" allows any header.
+	AllowedHeaders []string
+	// ExposedHeaders lists the response headers, other than those browsers always
+	// expose, that scripts may read.
+	ExposedHeaders []string
+	// AllowCredentials lets cross-origin requests include cookies and other
+	// credentials.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the response to a preflight request. If it
+	// is zero, the Access-Control-Max-Age header is left out.
+	MaxAge time.Duration
+}
+
+// allowsOrigin reports whether the policy allows requests from the origin.
+func (c *CORS) allowsOrigin(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return c.AllowOrigin != nil && c.AllowOrigin(origin)
+}
+
+// setOriginHeaders sets the headers that responses to both preflight and other
+// requests from the origin get. It returns false if the origin isn't allowed.
+func (c *CORS) setOriginHeaders(header http.Header, origin string) bool {
+	if !c.allowsOrigin(origin) {
+		return false
+	}
+	if !c.AllowCredentials && containsString(c.AllowedOrigins, "*") {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Add("Vary", "Origin")
+	}
+	if c.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// setHeaders sets the headers for a response to a request, other than a preflight
+// request, from the origin.
+func (c *CORS) setHeaders(header http.Header, origin string) {
+	if c.setOriginHeaders(header, origin) && len(c.ExposedHeaders) != 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+	}
+}
+
+// CORS returns a group with the same path and middleware as this one, whose routes use
+// the policy for cross-origin requests instead of TreeMux.CORS. A nil policy turns off
+// CORS for the group's routes. Like With, it can be used for a single route:
+//
+//	router.With().CORS(publicPolicy).GET("/widgets", widgetsHandler)
+func (g *Group) CORS(policy *CORS) *Group {
+	group := *g
+	group.settings.cors = policy
+	group.settings.corsSet = true
+	return &group
+}
+
+// CORS sets the policy for cross-origin requests to the route, replacing TreeMux.CORS
+// and that of the route's group. A nil policy turns off CORS for the route.
+func (r *Route) CORS(policy *CORS) *Route {
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	r.updateNodes(func(n *node) {
+		if n.leafCORS == nil {
+			n.leafCORS = make(map[string]*CORS)
+		}
+		n.leafCORS[r.method] = policy
+	})
+	return r
+}
+
+// corsPolicy returns the policy for the handler of the node for the method, which is
+// the method the handler was added with.
+func (t *TreeMux) corsPolicy(n *node, method string) *CORS {
+	if policy, ok := n.leafCORS[method]; ok {
+		return policy
+	}
+	return t.CORS
+}
+
+// handlerMethod returns the method of the node's handler that serves requests with
+// the method, or false if none does.
+func (t *TreeMux) handlerMethod(n *node, method string) (string, bool) {
+	if _, ok := n.leafHandler[method]; ok {
+		return method, true
+	}
+	if method == "HEAD" && t.HeadCanUseGet {
+		if _, ok := n.leafHandler["GET"]; ok {
+			return "GET", true
+		}
+	}
+	if _, ok := n.leafHandler[AnyMethod]; ok {
+		return AnyMethod, true
+	}
+	return "", false
+}
+
+// servePreflight answers the request if it is a CORS preflight request for a method
+// whose route on the node has a policy, and reports whether it did.
+func (t *TreeMux) servePreflight(w http.ResponseWriter, r *http.Request, n *node) bool {
+	origin := r.Header.Get("Origin")
+	requested := r.Header.Get("Access-Control-Request-Method")
+	if origin == "" || requested == "" {
+		return false
+	}
+	handlerMethod, ok := t.handlerMethod(n, requested)
+	if !ok {
+		return false
+	}
+	policy := t.corsPolicy(n, handlerMethod)
+	if policy == nil {
+		return false
+	}
+
+	header := w.Header()
+	if policy.setOriginHeaders(header, origin) {
+		methods := []string{requested}
+		for method := range t.allowedMethods(n) {
+			if method == requested {
+				continue
+			}
+			if m, ok := t.handlerMethod(n, method); ok && t.corsPolicy(n, m) != nil {
+				methods = append(methods, method)
+			}
+		}
+		sort.Strings(methods)
+		header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+		if requestHeaders := r.Header.Get("Access-Control-Request-Headers"); requestHeaders != "" {
+			if containsString(policy.AllowedHeaders, "*") {
+				header.Set("Access-Control-Allow-Headers", requestHeaders)
+			} else if len(policy.AllowedHeaders) != 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+			}
+		}
+		if policy.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.FormatInt(int64(policy.MaxAge/time.Second), 10))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
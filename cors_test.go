@@ -0,0 +1,179 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	router := New()
+	router.CORS = &CORS{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		ExposedHeaders: []string{"X-Total"},
+		MaxAge:         10 * time.Minute,
+	}
+	public := &CORS{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}}
+
+	router.GET("/orders/:id", simpleHandler)
+	router.PUT("/orders/:id", simpleHandler)
+	router.DELETE("/orders/:id", simpleHandler).CORS(nil)
+	router.With().CORS(public).GET("/widgets", simpleHandler)
+	router.OPTIONS("/custom", simpleHandler)
+	router.POST("/custom", simpleHandler).CORS(nil)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		code    int
+		expect  map[string]string
+	}{
+		{
+			name:   "preflight",
+			method: "OPTIONS",
+			path:   "/orders/1",
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "content-type",
+			},
+			code: http.StatusNoContent,
+			expect: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, HEAD, PUT",
+				"Access-Control-Allow-Headers": "Content-Type, Authorization",
+				"Access-Control-Max-Age":       "600",
+				"Vary":                         "Origin",
+			},
+		},
+		{
+			name:   "preflight from another origin",
+			method: "OPTIONS",
+			path:   "/orders/1",
+			headers: map[string]string{
+				"Origin":                        "https://evil.example.com",
+				"Access-Control-Request-Method": "PUT",
+			},
+			code:   http.StatusNoContent,
+			expect: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:   "preflight for a method without CORS",
+			method: "OPTIONS",
+			path:   "/orders/1",
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			code:   http.StatusMethodNotAllowed,
+			expect: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "preflight for a missing method",
+			method: "OPTIONS",
+			path:   "/orders/1",
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "PATCH",
+			},
+			code:   http.StatusMethodNotAllowed,
+			expect: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "preflight with any header",
+			method: "OPTIONS",
+			path:   "/widgets",
+			headers: map[string]string{
+				"Origin":                         "https://other.example.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "x-custom",
+			},
+			code: http.StatusNoContent,
+			expect: map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Headers": "x-custom",
+				"Access-Control-Max-Age":       "",
+				"Vary":                         "",
+			},
+		},
+		{
+			name:    "OPTIONS handler for a route without CORS",
+			method:  "OPTIONS",
+			path:    "/custom",
+			headers: map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST"},
+			code:    http.StatusOK,
+			expect:  map[string]string{"Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:    "request",
+			method:  "GET",
+			path:    "/orders/1",
+			headers: map[string]string{"Origin": "https://app.example.com"},
+			code:    http.StatusOK,
+			expect: map[string]string{
+				"Access-Control-Allow-Origin":   "https://app.example.com",
+				"Access-Control-Expose-Headers": "X-Total",
+			},
+		},
+		{
+			name:   "request without an origin",
+			method: "GET",
+			path:   "/orders/1",
+			code:   http.StatusOK,
+			expect: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:    "request to a route without CORS",
+			method:  "DELETE",
+			path:    "/orders/1",
+			headers: map[string]string{"Origin": "https://app.example.com"},
+			code:    http.StatusOK,
+			expect:  map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		for key, value := range test.headers {
+			r.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s: expected code %d, saw %d", test.name, test.code, w.Code)
+		}
+		for key, value := range test.expect {
+			if w.Header().Get(key) != value {
+				t.Errorf("%s: expected %s %q, saw %q", test.name, key, value, w.Header().Get(key))
+			}
+		}
+	}
+}
+
+func TestCORSGroup(t *testing.T) {
+	router := New()
+	api := router.Group("/api").CORS(&CORS{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true})
+	api.GET("/me", simpleHandler)
+	router.GET("/other", simpleHandler)
+
+	r, _ := http.NewRequest("GET", "/api/me", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected CORS headers for the group's route, saw %v", w.Header())
+	}
+
+	r, _ = http.NewRequest("GET", "/other", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no CORS headers outside the group, saw %v", w.Header())
+	}
+}
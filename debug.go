@@ -0,0 +1,63 @@
+//go:build go1.8
+// +build go1.8
+
+package httptreemux
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// MountPprof adds the handlers of net/http/pprof at the path, such as /debug/pprof, so
+// that the index is served at the path with a trailing slash, and each profile below
+// it. Unlike pprof.Index, the profiles work under any path. The middleware, if any,
+// wraps each of the handlers, which is the place to restrict who can reach them.
+//
+// Importing net/http/pprof also registers its handlers with http.DefaultServeMux, so
+// don't serve http.DefaultServeMux on a public address.
+func (t *TreeMux) MountPprof(path string, middleware ...MiddlewareFunc) {
+	(&Group{mux: t}).MountPprof(path, middleware...)
+}
+
+// MountPprof adds the handlers of net/http/pprof at the path, prefixed by the group's
+// path. See TreeMux.MountPprof.
+func (g *Group) MountPprof(path string, middleware ...MiddlewareFunc) {
+	g = g.With(middleware...)
+	path = strings.TrimSuffix(path, "/")
+
+	g.GET(path+"/", wrapHandlerFunc(pprof.Index))
+	g.GET(path+"/cmdline", wrapHandlerFunc(pprof.Cmdline))
+	g.GET(path+"/profile", wrapHandlerFunc(pprof.Profile))
+	g.GET(path+"/symbol", wrapHandlerFunc(pprof.Symbol))
+	g.POST(path+"/symbol", wrapHandlerFunc(pprof.Symbol))
+	g.GET(path+"/trace", wrapHandlerFunc(pprof.Trace))
+	// pprof.Index only serves the named profiles, such as heap and goroutine, under
+	// /debug/pprof/, so they get a route of their own.
+	g.GET(path+"/:profile", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		pprof.Handler(params["profile"]).ServeHTTP(w, r)
+	})
+}
+
+// MountExpvar adds the handler of the expvar package at the path, such as
+// /debug/vars. The middleware, if any, wraps the handler.
+//
+// Importing expvar also registers its handler with http.DefaultServeMux at /debug/vars.
+func (t *TreeMux) MountExpvar(path string, middleware ...MiddlewareFunc) {
+	(&Group{mux: t}).MountExpvar(path, middleware...)
+}
+
+// MountExpvar adds the handler of the expvar package at the path, prefixed by the
+// group's path. See TreeMux.MountExpvar.
+func (g *Group) MountExpvar(path string, middleware ...MiddlewareFunc) {
+	g.With(middleware...).GET(path, wrapHandlerFunc(expvar.Handler().ServeHTTP))
+}
+
+// wrapHandlerFunc converts an http.HandlerFunc to a HandlerFunc that ignores the
+// params.
+func wrapHandlerFunc(handler http.HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		handler(w, r)
+	}
+}
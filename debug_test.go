@@ -0,0 +1,52 @@
+//go:build go1.8
+// +build go1.8
+
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMountPprof(t *testing.T) {
+	router := New()
+	requireToken := func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			if r.Header.Get("X-Token") != "secret" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next(w, r, params)
+		}
+	}
+	router.Group("/internal").MountPprof("/pprof", requireToken)
+	router.MountExpvar("/vars")
+
+	tests := []struct {
+		path   string
+		token  bool
+		status int
+		body   string
+	}{
+		{"/internal/pprof/", true, http.StatusOK, "goroutine"},
+		{"/internal/pprof/", false, http.StatusForbidden, ""},
+		{"/internal/pprof/goroutine?debug=1", true, http.StatusOK, "goroutine profile"},
+		{"/internal/pprof/cmdline", true, http.StatusOK, ""},
+		{"/internal/pprof/nonexistent", true, http.StatusNotFound, "Unknown profile"},
+		{"/vars", false, http.StatusOK, `"memstats"`},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		if test.token {
+			r.Header.Set("X-Token", "secret")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.status || !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s expected %d with %q, saw %d %q", test.path, test.status, test.body,
+				w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package httptreemux
+
+import (
+	"net/http"
+	"time"
+)
+
+// Deprecation describes a deprecated route, as set with Route.Deprecated.
+type Deprecation struct {
+	// Sunset is when the route will stop working, or the zero time if that isn't
+	// known.
+	Sunset time.Time
+	// Link is the URL of a page about the deprecation, such as a migration guide, or
+	// an empty string.
+	Link string
+}
+
+// setHeaders adds the headers for the deprecation to a response.
+func (d *Deprecation) setHeaders(header http.Header) {
+	header.Set("Deprecation", "true")
+	if !d.Sunset.IsZero() {
+		header.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Link != "" {
+		header.Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+	}
+}
+
+// Deprecated marks the route as deprecated. Every response for the route then has a
+// Deprecation header, a Sunset header with the time the route will stop working unless
+// sunset is the zero time, and a Link header pointing to the link with the relation
+// type deprecation unless link is empty. The deprecation is available from
+// LookupResult.Deprecation and the RouteInfo passed to WalkRoutes, so that deprecated
+// routes can be listed.
+//
+//	router.GET("/v1/users/:id", getUserV1).
+//		Deprecated(time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC), "https://example.com/docs/v2")
+func (r *Route) Deprecated(sunset time.Time, link string) *Route {
+	changed := false
+	// This is deferred before the mutex is unlocked, so that it runs afterwards.
+	defer func() {
+		if changed {
+			r.mux.routeChanged(r)
+		}
+	}()
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	deprecation := &Deprecation{Sunset: sunset, Link: link}
+	err := r.updateNodes(func(n *node) {
+		if n.leafDeprecation == nil {
+			n.leafDeprecation = make(map[string]*Deprecation)
+		}
+		n.leafDeprecation[r.method] = deprecation
+	})
+	if err == nil {
+		r.deprecation = deprecation
+		changed = true
+	}
+	return r
+}
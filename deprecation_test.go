@@ -0,0 +1,61 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeprecated(t *testing.T) {
+	sunset := time.Date(2030, 6, 30, 12, 0, 0, 0, time.FixedZone("EST", -5*3600))
+	router := New()
+	router.GET("/v1/users/:id", simpleHandler).Deprecated(sunset, "https://example.com/v2").Name("v1")
+	router.POST("/v1/users/:id", simpleHandler).Deprecated(time.Time{}, "")
+	router.GET("/v2/users/:id", simpleHandler)
+
+	tests := []struct {
+		method      string
+		path        string
+		deprecation string
+		sunset      string
+		link        string
+	}{
+		{"GET", "/v1/users/1", "true", "Sun, 30 Jun 2030 17:00:00 GMT", `<https://example.com/v2>; rel="deprecation"`},
+		{"HEAD", "/v1/users/1", "true", "Sun, 30 Jun 2030 17:00:00 GMT", `<https://example.com/v2>; rel="deprecation"`},
+		{"POST", "/v1/users/1", "true", "", ""},
+		{"GET", "/v2/users/1", "", "", ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		header := w.Header()
+		if header.Get("Deprecation") != test.deprecation || header.Get("Sunset") != test.sunset ||
+			header.Get("Link") != test.link {
+			t.Errorf("%s %s unexpected headers %v", test.method, test.path, header)
+		}
+	}
+
+	deprecated := map[string]*Deprecation{}
+	router.WalkRoutes(func(route RouteInfo) bool {
+		if route.Deprecation != nil {
+			deprecated[route.Method+" "+route.Pattern] = route.Deprecation
+		}
+		return true
+	})
+	if len(deprecated) != 2 || !deprecated["GET /v1/users/:id"].Sunset.Equal(sunset) ||
+		deprecated["POST /v1/users/:id"] == nil {
+		t.Errorf("Expected the deprecated routes from WalkRoutes, saw %v", deprecated)
+	}
+	if info, _ := router.RouteByName("v1"); info.Deprecation == nil || info.Deprecation.Link != "https://example.com/v2" {
+		t.Errorf("Expected the deprecation from RouteByName, saw %v", info.Deprecation)
+	}
+
+	// Removing the route removes its deprecation.
+	router.Remove("GET", "/v1/users/:id")
+	router.GET("/v1/users/:id", simpleHandler)
+	if lr, _ := router.Lookup("GET", "/v1/users/1"); lr.Deprecation != nil {
+		t.Errorf("Expected a new route not to be deprecated, saw %v", lr.Deprecation)
+	}
+}
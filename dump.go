@@ -0,0 +1,143 @@
+package httptreemux
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dumpNode is the representation of a node used by DumpJSON and DumpDOT.
+type dumpNode struct {
+	// The kind of edge from the parent: root, static, regexp, typed, multiWildcard,
+	// wildcard, suffixCatchAll or catchAll.
+	Kind string `json:"kind"`
+	// The static text of the node, the constraint of a regexp wildcard, the type of a
+	// typed wildcard, the template of a segment with several wildcards, such as :.:, the
+	// suffix of a catch-all that must be followed by one, or the name of a catch-all.
+	Path     string `json:"path"`
+	Priority int    `json:"priority"`
+	// The pattern registered for the node, if it has handlers.
+	Pattern       string      `json:"pattern,omitempty"`
+	Methods       []string    `json:"methods,omitempty"`
+	WildcardNames []string    `json:"wildcardNames,omitempty"`
+	AddSlash      bool        `json:"addSlash,omitempty"`
+	Children      []*dumpNode `json:"children,omitempty"`
+}
+
+type dumpTrees struct {
+	Root  *dumpNode            `json:"root"`
+	Hosts map[string]*dumpNode `json:"hosts,omitempty"`
+}
+
+func (n *node) dumpNode(kind string) *dumpNode {
+	d := &dumpNode{
+		Kind:          kind,
+		Path:          n.path,
+		Priority:      n.priority,
+		Pattern:       n.fullPath,
+		WildcardNames: n.leafWildcardNames,
+		AddSlash:      n.addSlash,
+	}
+
+	for method := range n.leafHandler {
+		d.Methods = append(d.Methods, method)
+	}
+	sort.Strings(d.Methods)
+
+	for _, child := range n.staticChild {
+		d.Children = append(d.Children, child.dumpNode("static"))
+	}
+	for _, child := range n.constrainedWildcardChildren {
+		d.Children = append(d.Children, child.dumpNode(child.constrainedKind()))
+	}
+	if n.wildcardChild != nil {
+		d.Children = append(d.Children, n.wildcardChild.dumpNode("wildcard"))
+	}
+	for _, child := range n.suffixCatchAllChildren {
+		d.Children = append(d.Children, child.dumpNode("suffixCatchAll"))
+	}
+	if n.catchAllChild != nil {
+		d.Children = append(d.Children, n.catchAllChild.dumpNode("catchAll"))
+	}
+	return d
+}
+
+// DumpJSON returns a JSON representation of the routing trees. The object has a "root"
+// member with the default tree, and a "hosts" member mapping each host name to its
+// tree. Each node has its kind, path, priority, the pattern and methods of any
+// handlers, and its children in the order they are searched.
+func (t *TreeMux) DumpJSON() ([]byte, error) {
+	trees := t.loadTrees()
+	d := dumpTrees{Root: trees.root.dumpNode("root")}
+	if len(trees.hosts) != 0 {
+		d.Hosts = make(map[string]*dumpNode, len(trees.hosts))
+		for host, root := range trees.hosts {
+			d.Hosts[host] = root.dumpNode("root")
+		}
+	}
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// DumpDOT returns a Graphviz DOT representation of the routing trees, with each node
+// labelled by its path and the pattern and methods of any handlers, and each edge
+// labelled by the kind of child. The tree for each host is drawn in its own cluster.
+func (t *TreeMux) DumpDOT() string {
+	trees := t.loadTrees()
+	var buf bytes.Buffer
+	id := 0
+
+	buf.WriteString("digraph httptreemux {\n\tnode [shape=box];\n")
+	writeDOTNode(&buf, trees.root.dumpNode("root"), "\t", &id)
+
+	hosts := make([]string, 0, len(trees.hosts))
+	for host := range trees.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for i, host := range hosts {
+		fmt.Fprintf(&buf, "\tsubgraph cluster_%d {\n\t\tlabel=%s;\n", i, strconv.Quote("host "+host))
+		writeDOTNode(&buf, trees.hosts[host].dumpNode("root"), "\t\t", &id)
+		buf.WriteString("\t}\n")
+	}
+
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// nodeLabel returns the text used to show a node of the kind with the path, such as
+// :|^[0-9]+$ for a regexp wildcard.
+func nodeLabel(kind, path string) string {
+	switch kind {
+	case "wildcard":
+		return ":"
+	case "regexp":
+		return ":|" + path
+	case "typed":
+		return "::" + path
+	case "catchAll", "suffixCatchAll":
+		return "*" + path
+	}
+	return path
+}
+
+// writeDOTNode writes the node and its children, returning the node's ID.
+func writeDOTNode(buf *bytes.Buffer, d *dumpNode, indent string, id *int) string {
+	name := "n" + strconv.Itoa(*id)
+	*id++
+
+	label := nodeLabel(d.Kind, d.Path)
+	if len(d.Methods) != 0 {
+		label += "\n" + d.Pattern + "\n" + strings.Join(d.Methods, ", ")
+	}
+	fmt.Fprintf(buf, "%s%s [label=%s];\n", indent, name, strconv.Quote(label))
+
+	for _, child := range d.Children {
+		childName := writeDOTNode(buf, child, indent, id)
+		fmt.Fprintf(buf, "%s%s -> %s [label=%s];\n", indent, name, childName, strconv.Quote(child.Kind))
+	}
+	return name
+}
@@ -0,0 +1,94 @@
+package httptreemux
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDumpJSON(t *testing.T) {
+	router := New()
+	router.GET("/users/:id", simpleHandler)
+	router.POST("/users/:id", simpleHandler)
+	router.GET("/users/:id|^[0-9]+$/edit", simpleHandler)
+	router.GET("/files/*path", simpleHandler)
+	router.Host("example.com").GET("/", simpleHandler)
+
+	data, err := router.DumpJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var trees dumpTrees
+	if err := json.Unmarshal(data, &trees); err != nil {
+		t.Fatalf("Error decoding dump: %s", err)
+	}
+
+	find := func(n *dumpNode, pattern string) *dumpNode {
+		var search func(n *dumpNode) *dumpNode
+		search = func(n *dumpNode) *dumpNode {
+			if n.Pattern == pattern {
+				return n
+			}
+			for _, child := range n.Children {
+				if found := search(child); found != nil {
+					return found
+				}
+			}
+			return nil
+		}
+		return search(n)
+	}
+
+	tests := []struct {
+		pattern string
+		kind    string
+		methods []string
+	}{
+		{"/users/:id", "wildcard", []string{"GET", "POST"}},
+		{"/users/:id|^[0-9]+$/edit", "static", []string{"GET"}},
+		{"/files/*path", "catchAll", []string{"GET"}},
+	}
+
+	for _, test := range tests {
+		n := find(trees.Root, test.pattern)
+		if n == nil {
+			t.Errorf("Pattern %s not found in dump", test.pattern)
+			continue
+		}
+		if n.Kind != test.kind {
+			t.Errorf("Pattern %s expected kind %s, saw %s", test.pattern, test.kind, n.Kind)
+		}
+		if !reflect.DeepEqual(n.Methods, test.methods) {
+			t.Errorf("Pattern %s expected methods %v, saw %v", test.pattern, test.methods, n.Methods)
+		}
+	}
+
+	host := trees.Hosts["example.com"]
+	if host == nil || host.Kind != "root" || !reflect.DeepEqual(host.Methods, []string{"GET"}) {
+		t.Errorf("Expected a root with GET for example.com, saw %+v", host)
+	}
+}
+
+func TestDumpDOT(t *testing.T) {
+	router := New()
+	router.GET("/users/:id", simpleHandler)
+	router.GET("/files/*path", simpleHandler)
+	router.Host("example.com").GET("/", simpleHandler)
+
+	dot := router.DumpDOT()
+	expected := []string{
+		"digraph httptreemux {",
+		`[label="wildcard"]`,
+		`[label="catchAll"]`,
+		`"*path\n/files/*path\nGET"`,
+		"subgraph cluster_0 {",
+		`label="host example.com";`,
+	}
+	for _, s := range expected {
+		if !strings.Contains(dot, s) {
+			t.Errorf("Expected DOT output to contain %s, saw\n%s", s, dot)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package httptreemux
+
+import "net/http"
+
+// ErrHandlerFunc is a handler that returns an error instead of writing the error
+// response itself. Handlers of this type are added with HandleE, and any error they
+// return is passed to TreeMux.ErrorHandler.
+type ErrHandlerFunc func(http.ResponseWriter, *http.Request, map[string]string) error
+
+// StatusError is an error that carries the HTTP status code to respond with.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.Code)
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status code of the error.
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
+// SimpleErrorHandler is the default TreeMux.ErrorHandler. It responds with the status
+// code of the first error in the chain of wrapped errors that has a StatusCode() int
+// method, such as a *StatusError, or with 500 if there is none. For codes below 500 the
+// error's message is written as the body. For other codes only the status text is
+// written, so that internal details aren't exposed to clients.
+func SimpleErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	code := errorStatusCode(err)
+	if code < 500 {
+		http.Error(w, err.Error(), code)
+	} else {
+		http.Error(w, http.StatusText(code), code)
+	}
+}
+
+// errorStatusCode returns the status code for an error, as described for
+// SimpleErrorHandler.
+func errorStatusCode(err error) int {
+	for err != nil {
+		if sc, ok := err.(interface {
+			StatusCode() int
+		}); ok {
+			return sc.StatusCode()
+		}
+
+		u, ok := err.(interface {
+			Unwrap() error
+		})
+		if !ok {
+			break
+		}
+		err = u.Unwrap()
+	}
+	return http.StatusInternalServerError
+}
+
+// handleErrors converts an ErrHandlerFunc into a HandlerFunc that passes any error it
+// returns to ErrorHandler.
+func (t *TreeMux) handleErrors(handler ErrHandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		if err := handler(w, r, params); err != nil {
+			t.handleError(w, r, err)
+		}
+	}
+}
+
+// handleError passes an error to ErrorHandler, or to SimpleErrorHandler if
+// ErrorHandler is nil.
+func (t *TreeMux) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if t.ErrorHandler != nil {
+		t.ErrorHandler(w, r, err)
+	} else {
+		SimpleErrorHandler(w, r, err)
+	}
+}
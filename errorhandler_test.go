@@ -0,0 +1,75 @@
+package httptreemux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wrappedError wraps an error as fmt.Errorf with %w does, which needs Go 1.13.
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (e wrappedError) Error() string {
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e wrappedError) Unwrap() error {
+	return e.err
+}
+
+func TestHandleE(t *testing.T) {
+	router := New()
+	router.HandleE("GET", "/ok", func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		w.Write([]byte("ok"))
+		return nil
+	})
+	router.HandleE("GET", "/missing/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		return &StatusError{Code: http.StatusNotFound, Err: fmt.Errorf("no item %s", params["id"])}
+	})
+	router.HandleE("GET", "/wrapped", func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		return wrappedError{"checking access", &StatusError{Code: http.StatusForbidden}}
+	})
+	router.Group("/api").HandleE("GET", "/fail", func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		return errors.New("database password is hunter2")
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/ok", http.StatusOK, "ok"},
+		{"/missing/5", http.StatusNotFound, "no item 5\n"},
+		{"/wrapped", http.StatusForbidden, "checking access: Forbidden\n"},
+		{"/api/fail", http.StatusInternalServerError, "Internal Server Error\n"},
+	}
+
+	for _, test := range tests {
+		r, _ := newRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("Path %s expected %d %q, saw %d %q", test.path, test.code, test.body, w.Code, w.Body.String())
+		}
+	}
+
+	// A custom ErrorHandler set after the routes were added is still used.
+	var handled error
+	router.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		w.WriteHeader(http.StatusTeapot)
+	}
+
+	r, _ := newRequest("GET", "/api/fail", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot || handled == nil || !strings.Contains(handled.Error(), "hunter2") {
+		t.Errorf("Expected custom ErrorHandler to get the error, saw code %d and error %v", w.Code, handled)
+	}
+}
@@ -0,0 +1,171 @@
+package httptreemux
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Explanation describes how the router found the route for a request, as returned by
+// Explain.
+type Explanation struct {
+	Method string
+	Path   string
+	// Result is the result of the lookup, as Lookup returns it.
+	Result LookupResult
+	// Decision describes the outcome, such as "Matched /users/:id".
+	Decision string
+	// Steps lists the branches of the tree that were tried, and the other steps of the
+	// lookup, in the order they happened.
+	Steps []ExplainStep
+}
+
+// ExplainStep is a step in an Explanation.
+type ExplainStep struct {
+	// Depth is the number of branches that the step is nested in.
+	Depth int
+	// Kind is the kind of branch that was tried, as used by DumpJSON: static, regexp,
+	// typed, multiWildcard, wildcard, suffixCatchAll or catchAll. It is "note" for a
+	// step of the lookup itself, such as removing a trailing slash.
+	Kind string
+	// Node is the text of the branch's node, as shown by DumpDOT, such as users/ or
+	// :|^[0-9]+$, or the text of a note.
+	Node string
+	// Path is the part of the path that was left to match when the branch was tried.
+	Path string
+	// Matched reports whether a route was found through the branch.
+	Matched bool
+	// Reason says why the branch didn't lead to a route.
+	Reason string
+}
+
+// searchTrace records the steps of a search for Explain.
+type searchTrace struct {
+	steps []ExplainStep
+	// The indices of the steps for the branches that the search is in.
+	open []int
+}
+
+// enter records that the search is trying the node, a child of the kind, with the path
+// left to match at its parent. It returns the step to pass to exit.
+func (t *searchTrace) enter(kind string, n *node, path string) int {
+	t.steps = append(t.steps, ExplainStep{
+		Depth: len(t.open),
+		Kind:  kind,
+		Node:  nodeLabel(kind, n.path),
+		Path:  path,
+	})
+	step := len(t.steps) - 1
+	t.open = append(t.open, step)
+	return step
+}
+
+// exit records the result of the branch started by enter.
+func (t *searchTrace) exit(step int, found *node) {
+	t.open = t.open[:len(t.open)-1]
+	if found != nil {
+		t.steps[step].Matched = true
+	} else if t.steps[step].Reason == "" {
+		t.steps[step].Reason = "no route below it matched"
+	}
+}
+
+// match records a branch that matched without searching below it.
+func (t *searchTrace) match(kind string, n *node, path string) {
+	t.exit(t.enter(kind, n, path), n)
+}
+
+// reject records a branch that didn't match.
+func (t *searchTrace) reject(kind string, n *node, path, reason string) {
+	step := t.enter(kind, n, path)
+	t.steps[step].Reason = reason
+	t.exit(step, nil)
+}
+
+// rejectf is like reject, with the reason formatted from a format with a single %q
+// verb. Formatting it here keeps the search functions' frames small.
+func (t *searchTrace) rejectf(kind string, n *node, path, format, value string) {
+	t.reject(kind, n, path, fmt.Sprintf(format, value))
+}
+
+// fail gives the reason that the branch the search is in didn't match.
+func (t *searchTrace) fail(reason string) {
+	if len(t.open) == 0 {
+		t.note("The root doesn't match: " + reason)
+		return
+	}
+	t.steps[t.open[len(t.open)-1]].Reason = reason
+}
+
+// note records a step of the lookup.
+func (t *searchTrace) note(text string) {
+	t.steps = append(t.steps, ExplainStep{Depth: len(t.open), Kind: "note", Node: text})
+}
+
+// Explain looks up the route for a request with the method and path in the default
+// tree, as Lookup does, and describes how the route was chosen. Every branch of the
+// tree that the search tries is listed, along with why it didn't match, which helps
+// to find out why a route is shadowed by another. Explain is much slower than Lookup,
+// and is meant for debugging.
+//
+//	fmt.Println(router.Explain("GET", "/users/new"))
+func (t *TreeMux) Explain(method, path string) Explanation {
+	return t.explain(t.loadTrees().root, method, path)
+}
+
+// ExplainHost is like Explain, but uses the tree for the host when it has routes of
+// its own, as LookupHost does.
+func (t *TreeMux) ExplainHost(host, method, path string) Explanation {
+	return t.explain(t.loadTrees().rootForHost(host), method, path)
+}
+
+func (t *TreeMux) explain(root *node, method, path string) Explanation {
+	trace := &searchTrace{}
+	lr := t.lookupTrace(root, method, path, trace)
+	e := Explanation{Method: method, Path: path, Result: lr, Steps: trace.steps}
+
+	switch {
+	case lr.StatusCode == http.StatusOK && lr.headUsesGet:
+		e.Decision = "Matched " + lr.Pattern + ", using its GET handler"
+	case lr.StatusCode == http.StatusOK:
+		e.Decision = "Matched " + lr.Pattern
+	case lr.StatusCode == http.StatusNotFound && lr.Pattern != "":
+		e.Decision = "Not found, since the trailing slash doesn't match " + lr.Pattern
+	case lr.StatusCode == http.StatusNotFound:
+		e.Decision = "Not found, since no route matched"
+	case lr.StatusCode == http.StatusMethodNotAllowed:
+		methods := make([]string, 0, len(lr.Methods))
+		for m := range lr.Methods {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		e.Decision = fmt.Sprintf("Method not allowed, since %s only has handlers for %s",
+			lr.Pattern, strings.Join(methods, ", "))
+	case lr.StatusCode == http.StatusBadRequest:
+		e.Decision = "Bad request, since the path has an encoded slash"
+	default:
+		e.Decision = fmt.Sprintf("Redirected to %s with status %d", lr.RedirectPath, lr.StatusCode)
+	}
+	return e
+}
+
+// String returns the explanation as indented text, with a line for each step.
+func (e Explanation) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s\n", e.Method, e.Path)
+	for _, step := range e.Steps {
+		indent := strings.Repeat("  ", step.Depth+1)
+		if step.Kind == "note" {
+			fmt.Fprintf(&buf, "%s%s\n", indent, step.Node)
+		} else if step.Matched {
+			fmt.Fprintf(&buf, "%s%s %s at %q: matched\n", indent, step.Kind, step.Node, step.Path)
+		} else {
+			fmt.Fprintf(&buf, "%s%s %s at %q: %s\n", indent, step.Kind, step.Node, step.Path, step.Reason)
+		}
+	}
+	buf.WriteString(e.Decision)
+	buf.WriteString("\n")
+	return buf.String()
+}
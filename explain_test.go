@@ -0,0 +1,77 @@
+package httptreemux
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	router := New()
+	router.GET("/users/new", simpleHandler)
+	router.POST("/users/:id", simpleHandler)
+	router.GET("/users/:id|^[0-9]+$/posts", simpleHandler)
+	router.GET("/files/*path.js", simpleHandler)
+	router.GET("/files/*path", simpleHandler)
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		decision string
+		// Lines that the explanation must contain.
+		lines []string
+	}{
+		{"GET", "/users/12/posts", http.StatusOK, "Matched /users/:id|^[0-9]+$/posts", []string{
+			`regexp :|^[0-9]+$ at "12/posts": matched`,
+		}},
+		{"GET", "/users/ab/posts", http.StatusNotFound, "Not found, since no route matched", []string{
+			`regexp :|^[0-9]+$ at "ab/posts": "ab" doesn't match the constraint`,
+			`wildcard : at "ab/posts": no route below it matched`,
+		}},
+		{"POST", "/users/new", http.StatusMethodNotAllowed,
+			"Method not allowed, since /users/new only has handlers for GET, HEAD", []string{
+				`static new at "new": matched`,
+			}},
+		{"GET", "/files/a/b.css", http.StatusOK, "Matched /files/*path", []string{
+			`suffixCatchAll *.js at "a/b.css": the path doesn't end with ".js"`,
+			`catchAll *path at "a/b.css": matched`,
+		}},
+		{"GET", "/files/../users/new", http.StatusMovedPermanently, "Redirected to /users/new with status 301", []string{
+			"Searching for the clean path /users/new",
+			"The clean path matched, so the request is redirected to it",
+		}},
+		{"HEAD", "/users/new", http.StatusOK, "Matched /users/new, using its GET handler", nil},
+	}
+	for _, test := range tests {
+		e := router.Explain(test.method, test.path)
+		if e.Result.StatusCode != test.status || e.Decision != test.decision {
+			t.Errorf("%s %s expected %d %q, saw %d %q", test.method, test.path, test.status,
+				test.decision, e.Result.StatusCode, e.Decision)
+		}
+		text := e.String()
+		for _, line := range test.lines {
+			if !strings.Contains(text, line) {
+				t.Errorf("%s %s expected the explanation to contain %q, saw\n%s", test.method,
+					test.path, line, text)
+			}
+		}
+	}
+
+	// With BacktrackMethods, the explanation shows the second search.
+	router.BacktrackMethods = true
+	e := router.Explain("POST", "/users/new")
+	text := e.String()
+	for _, line := range []string{
+		"BacktrackMethods is set and /users/new has no handler for POST",
+		`static new at "new": the route has no handler for the method`,
+		`wildcard : at "new": matched`,
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("Expected the explanation to contain %q, saw\n%s", line, text)
+		}
+	}
+	if e.Decision != "Matched /users/:id" {
+		t.Errorf("Expected POST /users/new to match /users/:id, saw %q", e.Decision)
+	}
+}
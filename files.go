@@ -0,0 +1,78 @@
+//go:build go1.16
+// +build go1.16
+
+package httptreemux
+
+import (
+	"io/fs"
+	"net/http"
+)
+
+// ServeFiles serves files from fsys at the path, which must end with a catch-all, such as
+// /static/*filepath. The value of the catch-all is the name of the file within fsys,
+// so a request for /static/css/site.css is served from css/site.css. Names containing
+// . or .. elements are rejected with NotFoundHandler, so requests can't reach files
+// outside of fsys. Directories are served as by http.FileServer, using their
+// index.html file if they have one, and a listing otherwise. The root of fsys is served
+// at the path before the catch-all, which is registered as a route as well.
+//
+// To serve files from a directory on disk, use os.DirFS:
+//
+//	router.ServeFiles("/static/*filepath", os.DirFS("/var/www/static"))
+func (t *TreeMux) ServeFiles(path string, fsys fs.FS) *Route {
+	return (&Group{mux: t}).ServeFiles(path, fsys)
+}
+
+// ServeFiles serves files from fsys at the path, prefixed by the group's path.
+// See TreeMux.ServeFiles.
+func (g *Group) ServeFiles(path string, fsys fs.FS) *Route {
+	return g.serveFS("ServeFiles", path, fsys, false)
+}
+
+// ServeSPA serves a single-page app from fsys at the path, which must end with a
+// catch-all, such as /app/*path. Requests for files that exist in fsys are served as
+// by ServeFiles. Any other GET request under the path is served the index.html file at
+// the root of fsys, so that the app can handle its own routes. Routes outside the path,
+// such as those of an API, are not affected, and still get NotFoundHandler when
+// nothing matches.
+func (t *TreeMux) ServeSPA(path string, fsys fs.FS) *Route {
+	return (&Group{mux: t}).ServeSPA(path, fsys)
+}
+
+// ServeSPA serves a single-page app from fsys at the path, prefixed by the group's
+// path. See TreeMux.ServeSPA.
+func (g *Group) ServeSPA(path string, fsys fs.FS) *Route {
+	return g.serveFS("ServeSPA", path, fsys, true)
+}
+
+// serveFS adds the routes for ServeFiles and ServeSPA. If spa is true, names that are
+// not files in fsys are served the index.html file at its root.
+func (g *Group) serveFS(caller, path string, fsys fs.FS, spa bool) *Route {
+	star, param := catchAllParam(caller, path)
+
+	fileServer := http.FileServer(http.FS(fsys))
+	handler := func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		name := params[param]
+		if name == "" {
+			name = "."
+		}
+
+		if !fs.ValidPath(name) {
+			g.mux.notFound(w, r)
+			return
+		}
+
+		r = stripPrefix(r, params[param])
+		if spa {
+			if info, err := fs.Stat(fsys, name); err != nil || info.IsDir() {
+				r.URL.Path = "/"
+			}
+		}
+		fileServer.ServeHTTP(w, r)
+	}
+
+	// A catch-all doesn't match an empty value, so the root directory needs a route of
+	// its own.
+	g.GET(path[:star+1], handler)
+	return g.GET(path, handler)
+}
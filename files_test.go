@@ -0,0 +1,117 @@
+//go:build go1.16
+// +build go1.16
+
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServeFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":      {Data: []byte("index")},
+		"css/site.css":    {Data: []byte("body {}")},
+		"docs/index.html": {Data: []byte("docs")},
+		"docs/guide.txt":  {Data: []byte("guide")},
+	}
+
+	router := New()
+	router.ServeFiles("/static/*filepath", fsys)
+	router.Group("/api").ServeFiles("/assets/*path", fsys)
+
+	tests := []struct {
+		path     string
+		code     int
+		body     string
+		location string
+	}{
+		{"/static/css/site.css", http.StatusOK, "body {}", ""},
+		{"/static/", http.StatusOK, "index", ""},
+		{"/static/docs/", http.StatusOK, "docs", ""},
+		{"/static/docs", http.StatusMovedPermanently, "", "docs/"},
+		{"/static/docs/index.html", http.StatusMovedPermanently, "", "./"},
+		{"/static/missing.txt", http.StatusNotFound, "", ""},
+		{"/static/..%2f..%2fetc/passwd", http.StatusNotFound, "", ""},
+		{"/static/css%2f..%2f..%2findex.html", http.StatusNotFound, "", ""},
+		{"/api/assets/docs/guide.txt", http.StatusOK, "guide", ""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r, _ := newRequest("GET", test.path, nil)
+		router.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s expected code %d, saw %d", test.path, test.code, w.Code)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s expected body %q, saw %q", test.path, test.body, w.Body.String())
+		}
+		if location := w.Header().Get("Location"); location != test.location {
+			t.Errorf("%s expected Location %q, saw %q", test.path, test.location, location)
+		}
+	}
+}
+
+func TestServeFilesPanics(t *testing.T) {
+	for _, path := range []string{"/static", "/static/:file", "/static/*path/x"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected panic for ServeFiles path %s", path)
+				}
+			}()
+			New().ServeFiles(path, fstest.MapFS{})
+		}()
+	}
+}
+
+func TestServeSPA(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("app")},
+		"js/app.js":     {Data: []byte("js")},
+		"docs/a.txt":    {Data: []byte("a")},
+		"docs/b/b.html": {Data: []byte("b")},
+	}
+
+	router := New()
+	router.ServeSPA("/app/*path", fsys)
+	router.GET("/api/users", simpleHandler)
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/app/", http.StatusOK, "app"},
+		{"/app/js/app.js", http.StatusOK, "js"},
+		{"/app/users/5", http.StatusOK, "app"},
+		{"/app/docs", http.StatusOK, "app"},
+		{"/app/docs/", http.StatusOK, "app"},
+		{"/app/..%2fsecret", http.StatusNotFound, ""},
+		{"/api/missing", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r, _ := newRequest("GET", test.path, nil)
+		router.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("%s expected code %d, saw %d", test.path, test.code, w.Code)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s expected body %q, saw %q", test.path, test.body, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := newRequest("POST", "/app/users/5", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST under the app, saw %d", w.Code)
+	}
+}
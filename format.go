@@ -0,0 +1,46 @@
+package httptreemux
+
+import (
+	"net/http"
+	"strings"
+)
+
+// FormatParam is the name of the param that holds the extension of a request's path
+// when it is one of TreeMux.FormatExtensions.
+const FormatParam = "format"
+
+// splitFormat returns the path without its extension, and the extension as it appears
+// in FormatExtensions, if the last segment of the path ends with one of them. Otherwise
+// the format is empty.
+func (t *TreeMux) splitFormat(path string) (string, string) {
+	dot := strings.LastIndex(path, ".")
+	if dot <= 0 || path[dot-1] == '/' || strings.IndexByte(path[dot:], '/') != -1 {
+		return path, ""
+	}
+	ext := path[dot+1:]
+	for _, format := range t.FormatExtensions {
+		if strings.EqualFold(format, ext) {
+			return path[:dot], format
+		}
+	}
+	return path, ""
+}
+
+// WhenFormat serves the route's requests whose path ends with the extension format, one
+// of TreeMux.FormatExtensions, with another handler. Like WhenQuery, requests that match
+// no condition fall through to the route's own handler, which also gets the format in
+// its params.
+//
+//	router.FormatExtensions = []string{"json", "csv"}
+//	router.GET("/reports/:id", reportJSON).
+//		WhenFormat("csv", reportCSV)
+func (r *Route) WhenFormat(format string, handler HandlerFunc) *Route {
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	mux := r.mux
+	return r.addCondition("."+format, func(req *http.Request) bool {
+		_, ext := mux.splitFormat(req.URL.Path)
+		return ext != "" && strings.EqualFold(ext, format)
+	}, handler)
+}
@@ -0,0 +1,98 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFormatExtensions(t *testing.T) {
+	var served string
+	var params map[string]string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, p map[string]string) {
+			served, params = name, p
+		}
+	}
+	router := New()
+	router.FormatExtensions = []string{"json", "csv"}
+	router.GET("/reports/:id", makeHandler("report"))
+	router.GET("/reports", makeHandler("reports"))
+	router.GET("/data.json", makeHandler("static"))
+	router.GET("/files/*path", makeHandler("files"))
+
+	tests := []struct {
+		path   string
+		served string
+		params map[string]string
+	}{
+		{"/reports/123.json", "report", map[string]string{"id": "123", "format": "json"}},
+		{"/reports/123.CSV", "report", map[string]string{"id": "123", "format": "csv"}},
+		{"/reports/123", "report", map[string]string{"id": "123"}},
+		{"/reports/123.xml", "report", map[string]string{"id": "123.xml"}},
+		{"/reports.json", "reports", map[string]string{"format": "json"}},
+		// Nothing matches /data, so the whole path is looked up.
+		{"/data.json", "static", nil},
+		{"/files/a.b/c.json", "files", map[string]string{"path": "a.b/c", "format": "json"}},
+		{"/files/a.json/c", "files", map[string]string{"path": "a.json/c"}},
+	}
+	for _, test := range tests {
+		served, params = "", nil
+		r, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if served != test.served || len(params) != len(test.params) {
+			t.Errorf("%s expected %s with %v, saw %s with %v", test.path, test.served, test.params, served, params)
+			continue
+		}
+		for key, value := range test.params {
+			if params[key] != value {
+				t.Errorf("%s expected %v, saw %v", test.path, test.params, params)
+			}
+		}
+	}
+
+	// A path that starts with the dot has nothing before the extension.
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.URL.Path = ".json"
+	router.PathSource = URLPath
+	router.ServeHTTP(w, r)
+	router.PathSource = RequestURI
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the path .json, saw %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/reports/123.json", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for a method that the route doesn't have, saw %d", w.Code)
+	}
+}
+
+func TestWhenFormat(t *testing.T) {
+	var served string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			served = name + " " + params["format"]
+		}
+	}
+	router := New()
+	router.FormatExtensions = []string{"json", "csv"}
+	router.GET("/reports/:id", makeHandler("default")).
+		WhenFormat("csv", makeHandler("csv"))
+
+	for path, expected := range map[string]string{
+		"/reports/1.csv":  "csv csv",
+		"/reports/1.CSV":  "csv csv",
+		"/reports/1.json": "default json",
+		"/reports/1":      "default ",
+	} {
+		served = ""
+		r, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if served != expected {
+			t.Errorf("%s expected %q, saw %q", path, expected, served)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package httptreemux
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GorillaPattern converts a route pattern written for gorilla/mux, such as
+// /articles/{category}/{id:[0-9]+}, to this router's syntax, such as
+// /articles/:category/:id|^(?:[0-9]+)$. A variable with a regular expression becomes a
+// wildcard constrained to match the whole segment, as in gorilla/mux. A variable at the
+// end of the pattern whose expression is .* or .+ becomes a catch-all, although a
+// catch-all never matches an empty value.
+//
+// Each variable must take up a whole path segment, since this router doesn't support
+// patterns like /articles/{id}.json, and an expression can't contain a slash, since a
+// wildcard only matches a single segment. An error is returned for such patterns.
+func GorillaPattern(pattern string) (string, error) {
+	if len(pattern) == 0 || pattern[0] != '/' {
+		return "", fmt.Errorf("Path %s must start with slash", pattern)
+	}
+
+	var out []byte
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		if c == '}' {
+			return "", fmt.Errorf("Pattern %s has an unmatched }", pattern)
+		}
+		if c != '{' {
+			out = append(out, c)
+			i++
+			continue
+		}
+
+		// Find the closing brace, allowing for braces in the expression, such as in
+		// {id:[0-9]{3}}.
+		end, depth := i, 0
+		for ; end < len(pattern); end++ {
+			if pattern[end] == '{' {
+				depth++
+			} else if pattern[end] == '}' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		if end == len(pattern) {
+			return "", fmt.Errorf("Pattern %s has an unmatched {", pattern)
+		}
+		if pattern[i-1] != '/' || (end+1 < len(pattern) && pattern[end+1] != '/') {
+			return "", fmt.Errorf("Pattern %s has a variable that isn't a whole path segment", pattern)
+		}
+
+		name, expr := pattern[i+1:end], ""
+		if colon := strings.IndexByte(name, ':'); colon != -1 {
+			name, expr = name[:colon], name[colon+1:]
+		}
+		if !isWildcardName(name) {
+			return "", fmt.Errorf("Pattern %s has invalid variable name %q", pattern, name)
+		}
+
+		last := end+1 == len(pattern)
+		switch {
+		case expr == "":
+			out = append(out, ':')
+			out = append(out, name...)
+		case last && (expr == ".*" || expr == ".+"):
+			out = append(out, '*')
+			out = append(out, name...)
+		case strings.IndexByte(expr, '/') != -1:
+			return "", fmt.Errorf("Pattern %s has an expression for %s that contains a slash", pattern, name)
+		default:
+			out = append(out, ':')
+			out = append(out, name...)
+			out = append(out, "|^(?:"...)
+			out = append(out, expr...)
+			out = append(out, ")$"...)
+		}
+		i = end + 1
+	}
+	return string(out), nil
+}
@@ -0,0 +1,34 @@
+package httptreemux
+
+import "testing"
+
+func TestGorillaPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		expect  string
+		ok      bool
+	}{
+		{"/articles", "/articles", true},
+		{"/articles/{category}/", "/articles/:category/", true},
+		{"/articles/{category}/{id:[0-9]+}", "/articles/:category/:id|^(?:[0-9]+)$", true},
+		{"/codes/{code:[0-9]{3}}/x", "/codes/:code|^(?:[0-9]{3})$/x", true},
+		{"/files/{path:.*}", "/files/*path", true},
+		{"/files/{path:.+}", "/files/*path", true},
+		{"/files/{path:.*}/x", "/files/:path|^(?:.*)$/x", true},
+		{"/articles/{id}.json", "", false},
+		{"/articles/x{id}", "", false},
+		{"/files/{path:[a-z/]+}", "", false},
+		{"/articles/{id", "", false},
+		{"/articles/id}", "", false},
+		{"/articles/{}", "", false},
+		{"articles", "", false},
+	}
+
+	for _, test := range tests {
+		path, err := GorillaPattern(test.pattern)
+		if (err == nil) != test.ok || path != test.expect {
+			t.Errorf("Pattern %s expected %q with ok %v, saw %q with error %v",
+				test.pattern, test.expect, test.ok, path, err)
+		}
+	}
+}
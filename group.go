@@ -0,0 +1,426 @@
+package httptreemux
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Group is a set of routes that share a common path prefix. Groups register their
+// routes directly in the tree of the TreeMux that created them, so there is no
+// extra cost when looking up a route added through a group.
+type Group struct {
+	path string
+	// The host whose tree the group's routes are added to, or "" for the default tree.
+	host string
+	mux  *TreeMux
+	// The group's middleware stack, including that of the groups it is nested in.
+	middleware []MiddlewareFunc
+	// Wrappers that need the route's pattern, such as rate limits, including those of
+	// the groups the group is nested in. They run inside the middleware.
+	routeWrappers []routeWrapper
+	// The settings for the group's routes, such as their CORS policy and ports.
+	settings routeSettings
+}
+
+// routeWrapper wraps the handler of a route with the pattern, added to the host's tree.
+type routeWrapper func(host, pattern string, handler HandlerFunc) HandlerFunc
+
+// Group creates a new group of routes that will all be prefixed by path. The path
+// must start with a slash, and a trailing slash on it is ignored.
+func (t *TreeMux) Group(path string) *Group {
+	return (&Group{mux: t}).Group(path)
+}
+
+// Group creates a new group nested inside this one. The paths of routes added to the
+// new group are prefixed by this group's path, followed by the path given here. The new
+// group starts with this group's middleware stack.
+func (g *Group) Group(path string) *Group {
+	if len(path) == 0 || path[0] != '/' {
+		panic(fmt.Sprintf("Group path %s must start with slash", path))
+	}
+
+	if path[len(path)-1] == '/' {
+		path = path[:len(path)-1]
+	}
+
+	group := *g
+	group.path = g.path + path
+	// Limit the capacity so that appending to the new group's stack doesn't write into
+	// this one's.
+	group.middleware = g.middleware[:len(g.middleware):len(g.middleware)]
+	return &group
+}
+
+// Use appends a middleware function to the group's middleware stack. Handlers registered
+// through the group after this call are wrapped by the stack, inside the router's
+// middleware, and so are those of groups created from it afterwards. Other routes are
+// not affected.
+func (g *Group) Use(middleware MiddlewareFunc) {
+	g.middleware = append(g.middleware, middleware)
+}
+
+// With returns a group with the same path as this one, whose middleware stack has the
+// given middleware added to it. It is meant for adding middleware to a single route
+// without setting up a group for it:
+//
+//	router.With(longTimeout).GET("/export.csv", exportHandler)
+func (g *Group) With(middleware ...MiddlewareFunc) *Group {
+	stack := make([]MiddlewareFunc, 0, len(g.middleware)+len(middleware))
+	stack = append(stack, g.middleware...)
+	stack = append(stack, middleware...)
+	group := *g
+	group.middleware = stack
+	return &group
+}
+
+// withRouteWrapper returns a group with the same path and middleware as this one, and
+// the wrapper added to its route wrappers.
+func (g *Group) withRouteWrapper(wrapper routeWrapper) *Group {
+	group := *g
+	group.routeWrappers = append(g.routeWrappers[:len(g.routeWrappers):len(g.routeWrappers)], wrapper)
+	return &group
+}
+
+// wrapRoute wraps the handler for the pattern with the group's route wrappers, the
+// first one added running first.
+func (g *Group) wrapRoute(pattern string, handler HandlerFunc) HandlerFunc {
+	for i := len(g.routeWrappers) - 1; i >= 0; i-- {
+		handler = g.routeWrappers[i](g.host, pattern, handler)
+	}
+	return handler
+}
+
+// Path returns the full path prefix of the group.
+func (g *Group) Path() string {
+	return g.path
+}
+
+// Handle adds a handler for the path, prefixed by the group's path. The path follows
+// the same rules as TreeMux.Handle.
+func (g *Group) Handle(method, path string, handler HandlerFunc) *Route {
+	route, err := g.HandleErr(method, path, handler)
+	if err != nil {
+		panic(err)
+	}
+	return route
+}
+
+// HandleErr is like Handle, but returns an error instead of panicking if the route
+// can not be added.
+func (g *Group) HandleErr(method, path string, handler HandlerFunc) (*Route, error) {
+	if len(path) == 0 || path[0] != '/' {
+		return nil, fmt.Errorf("Path %s must start with slash", path)
+	}
+
+	routes, err := g.addRoutes([]string{method}, path, handler, g.settings)
+	if err != nil {
+		return nil, err
+	}
+	return routes[0], nil
+}
+
+// HandleMethods adds the handler for each of the methods at the path, prefixed by the
+// group's path. See TreeMux.HandleMethods.
+func (g *Group) HandleMethods(methods []string, path string, handler HandlerFunc) []*Route {
+	routes, err := g.HandleMethodsErr(methods, path, handler)
+	if err != nil {
+		panic(err)
+	}
+	return routes
+}
+
+// HandleMethodsErr is like HandleMethods, but returns an error instead of panicking
+// if the routes can not be added.
+func (g *Group) HandleMethodsErr(methods []string, path string, handler HandlerFunc) ([]*Route, error) {
+	if len(path) == 0 || path[0] != '/' {
+		return nil, fmt.Errorf("Path %s must start with slash", path)
+	}
+
+	return g.addRoutes(methods, path, handler, g.settings)
+}
+
+// addRoutes adds the handler for each of the methods at the path, prefixed by the
+// group's path, with the settings.
+func (g *Group) addRoutes(methods []string, path string, handler HandlerFunc, settings routeSettings) ([]*Route, error) {
+	handler = g.wrapRoute(g.path+path, handler)
+	routes, err := g.mux.addRoutes(g.host, methods, g.path+path, applyMiddleware(g.middleware, handler),
+		&settings)
+	if err != nil {
+		return nil, err
+	}
+	g.setRouteWrap(routes, g.path+path)
+	return routes, nil
+}
+
+// withMeta returns a group with the same path and middleware as this one, whose routes
+// get the value under the key in their metadata.
+func (g *Group) withMeta(key string, value interface{}) *Group {
+	group := *g
+	group.settings.meta = withMetaValue(g.settings.meta, key, value)
+	return &group
+}
+
+// setRouteWrap adds the group's middleware and route wrappers, as they are now, to the
+// wrap function of the routes, which were added with the pattern.
+func (g *Group) setRouteWrap(routes []*Route, pattern string) {
+	group := *g
+	for _, route := range routes {
+		outer := route.wrap
+		route.wrap = func(variant string, handler HandlerFunc) HandlerFunc {
+			handler = group.wrapRoute(pattern+" "+variant, handler)
+			return outer(variant, applyMiddleware(group.middleware, handler))
+		}
+	}
+}
+
+// HandleE adds a handler that returns an error for the path, prefixed by the group's
+// path. See TreeMux.HandleE.
+func (g *Group) HandleE(method, path string, handler ErrHandlerFunc) *Route {
+	return g.Handle(method, path, g.mux.handleErrors(handler))
+}
+
+// Remove removes the handler for the method and path, prefixed by the group's path.
+// See TreeMux.Remove.
+func (g *Group) Remove(method, path string) bool {
+	if len(path) == 0 || path[0] != '/' {
+		return false
+	}
+	return g.mux.removeRoute(g.host, method, g.path+path)
+}
+
+// Walk calls fn for each handler whose pattern is within the group, until fn returns
+// false. For a group created with TreeMux.Host, the host's tree is walked. See
+// TreeMux.Walk.
+func (g *Group) Walk(fn func(method, path string, handler HandlerFunc) bool) {
+	g.walk(func(n *node, method, path string, handler HandlerFunc) bool {
+		return fn(method, path, handler)
+	})
+}
+
+// WalkRoutes calls fn for each handler whose pattern is within the group, with a
+// description of its route, until fn returns false. See TreeMux.WalkRoutes.
+func (g *Group) WalkRoutes(fn func(route RouteInfo) bool) {
+	names := g.mux.routeNames(g.host)
+	g.walk(func(n *node, method, path string, handler HandlerFunc) bool {
+		return fn(RouteInfo{
+			Name:        names[method+" "+path],
+			Method:      method,
+			Host:        g.host,
+			Pattern:     path,
+			Handler:     handler,
+			Meta:        n.leafMeta[method],
+			Deprecation: n.leafDeprecation[method],
+		})
+	})
+}
+
+// walk calls fn for each handler in the group's tree whose pattern is within the group.
+func (g *Group) walk(fn func(n *node, method, path string, handler HandlerFunc) bool) {
+	trees := g.mux.loadTrees()
+	root := trees.root
+	if g.host != "" {
+		if root = trees.hosts[g.host]; root == nil {
+			return
+		}
+	}
+
+	root.walk([]walkPiece{{text: "/"}}, func(n *node, method, path string, handler HandlerFunc) bool {
+		if g.path != "" && path != g.path && !strings.HasPrefix(path, g.path+"/") {
+			return true
+		}
+		return fn(n, method, path, handler)
+	})
+}
+
+// Mount adds the routes of another router under the path, prefixed by the group's
+// path, so that separately developed parts of an application can each build their
+// own router. See TreeMux.Mount.
+func (g *Group) Mount(path string, sub *TreeMux) {
+	prefix := g.Group(path)
+	sub.loadTrees().root.walk([]walkPiece{{text: "/"}},
+		func(n *node, method, pattern string, handler HandlerFunc) bool {
+			// The route's settings in the sub-router replace those of the group, and are
+			// set as the route is added, so that it is never served without them.
+			settings := prefix.settings
+			if n.trailingSlashSet {
+				settings.trailingSlash, settings.trailingSlashSet = n.trailingSlash, true
+			}
+			for key, value := range n.leafMeta[method] {
+				settings.meta = withMetaValue(settings.meta, key, value)
+			}
+			if policy, ok := n.leafCORS[method]; ok {
+				settings.cors, settings.corsSet = policy, true
+			}
+			if compression, ok := n.leafCompression[method]; ok {
+				settings.compression, settings.compressionSet = compression, true
+			}
+			if _, err := prefix.addRoutes([]string{method}, pattern, handler, settings); err != nil {
+				panic(err)
+			}
+			return true
+		})
+}
+
+// mountMethods are the methods that MountHandler adds routes for.
+var mountMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// MountHandler passes requests under the path, prefixed by the group's path, to
+// handler. See TreeMux.MountHandler.
+func (g *Group) MountHandler(path string, handler http.Handler) {
+	star, param := catchAllParam("MountHandler", path)
+	h := func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		handler.ServeHTTP(w, stripPrefix(r, params[param]))
+	}
+
+	for _, method := range mountMethods {
+		// A catch-all doesn't match an empty value, so the prefix itself needs a route
+		// of its own.
+		g.Handle(method, path[:star+1], h)
+		g.Handle(method, path, h)
+	}
+}
+
+// Redirect adds a route that redirects requests for from, prefixed by the group's path,
+// to the path to. See TreeMux.Redirect.
+func (g *Group) Redirect(from, to string, statusCode int) *Route {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, 308:
+	default:
+		panic(fmt.Sprintf("Redirect status code %d for %s is not a redirect", statusCode, from))
+	}
+
+	origin, target := "", to
+	if i := strings.Index(to, "://"); i != -1 {
+		if j := strings.IndexByte(to[i+3:], '/'); j != -1 {
+			origin, target = to[:i+3+j], to[i+3+j:]
+		} else {
+			origin, target = to, "/"
+		}
+	}
+
+	target, err := translateBraces(target)
+	if err != nil {
+		panic(err)
+	}
+	pattern, err := translateBraces(from)
+	if err != nil {
+		panic(err)
+	}
+
+	// Check that the target only uses wildcards that every request will have.
+	params := make(map[string]string)
+	for _, name := range patternNames(pattern) {
+		params[name] = "x"
+	}
+	if _, err := buildPath(target, params); err != nil {
+		panic(fmt.Sprintf("Redirect from %s to %s: %s", from, to, err))
+	}
+
+	catchAll := ""
+	if star := strings.LastIndex(pattern, "/*"); star != -1 {
+		catchAll, _ = splitCatchAll(pattern[star+2:])
+	}
+
+	handler := func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		if value := params[catchAll]; catchAll != "" && strings.TrimLeft(value, `/\`) != value {
+			// A slash or backslash at the start of the catch-all can only come from one
+			// encoded in the request, such as /old/%2Fevil.com. It would make a location
+			// like //evil.com, which browsers take to be another host.
+			trimmed := make(map[string]string, len(params))
+			for name, value := range params {
+				trimmed[name] = value
+			}
+			trimmed[catchAll] = strings.TrimLeft(value, `/\`)
+			params = trimmed
+		}
+		location, err := buildPath(target, params)
+		if err != nil {
+			// The target was checked when the route was added.
+			panic(err)
+		}
+		location = origin + location
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, location, statusCode)
+	}
+
+	methods := []string{"GET"}
+	// 308 is http.StatusPermanentRedirect, which needs Go 1.7.
+	if statusCode == http.StatusTemporaryRedirect || statusCode == 308 {
+		// These codes tell the client to repeat the request with the same method.
+		methods = append(methods, "POST", "PUT", "PATCH", "DELETE")
+	}
+	// The methods are added together, so that none of them are if one conflicts.
+	return g.HandleMethods(methods, from, handler)[0]
+}
+
+// catchAllParam returns the position of the catch-all at the end of path, and its
+// name. It panics if path doesn't end with a catch-all.
+func catchAllParam(caller, path string) (int, string) {
+	star := strings.LastIndex(path, "/*")
+	if star == -1 || strings.ContainsAny(path[star+2:], "./") {
+		panic(caller + " path " + path + " must end with a catch-all, such as /*filepath")
+	}
+	return star, path[star+2:]
+}
+
+// stripPrefix returns a copy of the request whose URL path is the value of a catch-all,
+// so that the part of the path before the catch-all is removed.
+func stripPrefix(r *http.Request, value string) *http.Request {
+	// The router removes the trailing slash before the catch-all is matched, but the
+	// handler may need it, such as to tell a directory listing from a redirect.
+	path := "/" + value
+	if strings.HasSuffix(r.URL.Path, "/") && path != "/" {
+		path += "/"
+	}
+
+	r2 := new(http.Request)
+	*r2 = *r
+	u := *r.URL
+	u.Path = path
+	u.RawPath = ""
+	r2.URL = &u
+	return r2
+}
+
+// Syntactic sugar for Handle("GET", path, handler)
+func (g *Group) GET(path string, handler HandlerFunc) *Route {
+	return g.Handle("GET", path, handler)
+}
+
+// Syntactic sugar for Handle("POST", path, handler)
+func (g *Group) POST(path string, handler HandlerFunc) *Route {
+	return g.Handle("POST", path, handler)
+}
+
+// Syntactic sugar for Handle("PUT", path, handler)
+func (g *Group) PUT(path string, handler HandlerFunc) *Route {
+	return g.Handle("PUT", path, handler)
+}
+
+// Syntactic sugar for Handle("DELETE", path, handler)
+func (g *Group) DELETE(path string, handler HandlerFunc) *Route {
+	return g.Handle("DELETE", path, handler)
+}
+
+// Syntactic sugar for Handle("PATCH", path, handler)
+func (g *Group) PATCH(path string, handler HandlerFunc) *Route {
+	return g.Handle("PATCH", path, handler)
+}
+
+// Syntactic sugar for Handle("HEAD", path, handler)
+func (g *Group) HEAD(path string, handler HandlerFunc) *Route {
+	return g.Handle("HEAD", path, handler)
+}
+
+// Syntactic sugar for Handle("OPTIONS", path, handler)
+func (g *Group) OPTIONS(path string, handler HandlerFunc) *Route {
+	return g.Handle("OPTIONS", path, handler)
+}
+
+// Syntactic sugar for Handle(AnyMethod, path, handler). See TreeMux.Any.
+func (g *Group) Any(path string, handler HandlerFunc) *Route {
+	return g.Handle(AnyMethod, path, handler)
+}
@@ -0,0 +1,360 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestGroupPaths(t *testing.T) {
+	var matched string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			matched = name + " " + params["id"]
+		}
+	}
+
+	router := New()
+	api := router.Group("/api")
+	v1 := api.Group("/v1/")
+	v1.Handle("GET", "/users/:id", makeHandler("users"))
+	v1.Handle("GET", "/orders/:id", makeHandler("orders"))
+	api.Handle("GET", "/", makeHandler("index"))
+
+	if v1.Path() != "/api/v1" {
+		t.Errorf("Expected nested group path /api/v1, saw %s", v1.Path())
+	}
+
+	tests := []struct {
+		path   string
+		expect string
+	}{
+		{"/api/v1/users/5", "users 5"},
+		{"/api/v1/orders/6", "orders 6"},
+		{"/api/", "index "},
+	}
+
+	for _, test := range tests {
+		matched = ""
+		r, _ := newRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if matched != test.expect {
+			t.Errorf("Path %s expected match %q, saw %q", test.path, test.expect, matched)
+		}
+	}
+
+	r, _ := newRequest("GET", "/users/5", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for path outside of group, saw %d", w.Code)
+	}
+}
+
+func TestGroupMethods(t *testing.T) {
+	var result string
+
+	makeHandler := func(method string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			result = method
+		}
+	}
+
+	router := New()
+	router.HeadCanUseGet = false
+	g := router.Group("/base").Group("/user")
+	g.GET("/:param", makeHandler("GET"))
+	g.POST("/:param", makeHandler("POST"))
+	g.PATCH("/:param", makeHandler("PATCH"))
+	g.PUT("/:param", makeHandler("PUT"))
+	g.DELETE("/:param", makeHandler("DELETE"))
+	g.HEAD("/:param", makeHandler("HEAD"))
+	g.OPTIONS("/:param", makeHandler("OPTIONS"))
+
+	for _, method := range []string{"GET", "POST", "PATCH", "PUT", "DELETE", "HEAD", "OPTIONS"} {
+		result = ""
+		w := httptest.NewRecorder()
+		r, _ := newRequest(method, "/base/user/"+method, nil)
+		router.ServeHTTP(w, r)
+		if result != method {
+			t.Errorf("Method %s got result %s", method, result)
+		}
+	}
+}
+
+func TestGroupPanics(t *testing.T) {
+	expectPanic := func(desc string, f func()) {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Errorf("Expected panic for %s", desc)
+			}
+		}()
+		f()
+	}
+
+	router := New()
+	expectPanic("group without leading slash", func() { router.Group("api") })
+	expectPanic("empty group path", func() { router.Group("") })
+	expectPanic("group route without leading slash", func() {
+		router.Group("/api").Handle("GET", "users", simpleHandler)
+	})
+}
+
+func TestGroupWalk(t *testing.T) {
+	router := New()
+	router.GET("/api", simpleHandler)
+	router.GET("/apiary", simpleHandler)
+	api := router.Group("/api")
+	api.GET("/users", simpleHandler)
+	api.POST("/users/:id", simpleHandler)
+	router.Host("example.com").GET("/api/hosted", simpleHandler)
+
+	walk := func(g *Group) []string {
+		var routes []string
+		g.Walk(func(method, path string, handler HandlerFunc) bool {
+			routes = append(routes, method+" "+path)
+			return true
+		})
+		sort.Strings(routes)
+		return routes
+	}
+
+	expected := []string{"GET /api", "GET /api/users", "POST /api/users/:id"}
+	if routes := walk(api); !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Expected group routes %v, saw %v", expected, routes)
+	}
+
+	expected = []string{"GET /api/hosted"}
+	if routes := walk(router.Host("example.com")); !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Expected host routes %v, saw %v", expected, routes)
+	}
+
+	if routes := walk(router.Host("other.com")); len(routes) != 0 {
+		t.Errorf("Expected no routes for unknown host, saw %v", routes)
+	}
+}
+
+func TestMount(t *testing.T) {
+	var matched string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			matched = name + " " + params["id"]
+		}
+	}
+
+	var middlewareCalls []string
+	middleware := func(name string) MiddlewareFunc {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+				middlewareCalls = append(middlewareCalls, name)
+				next(w, r, params)
+			}
+		}
+	}
+
+	admin := New()
+	admin.Use(middleware("admin"))
+	admin.GET("/", makeHandler("index"))
+	admin.GET("/users/:id", makeHandler("user")).Meta("auth", "admin")
+	admin.POST("/users", makeHandler("create")).TrailingSlash(TrailingSlashEquivalent)
+
+	router := New()
+	router.Use(middleware("main"))
+	router.GET("/", makeHandler("main"))
+	router.Mount("/admin", admin)
+	router.Group("/api").Mount("/v1/admin", admin)
+
+	tests := []struct {
+		method string
+		path   string
+		expect string
+	}{
+		{"GET", "/", "main "},
+		{"GET", "/admin/", "index "},
+		{"GET", "/admin/users/5", "user 5"},
+		{"POST", "/admin/users/", "create "},
+		{"GET", "/api/v1/admin/users/6", "user 6"},
+	}
+
+	for _, test := range tests {
+		matched = ""
+		middlewareCalls = nil
+		r, _ := newRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if matched != test.expect {
+			t.Errorf("%s %s expected match %q, saw %q", test.method, test.path, test.expect, matched)
+		}
+		if test.path != "/" && !reflect.DeepEqual(middlewareCalls, []string{"main", "admin"}) {
+			t.Errorf("%s %s expected middleware [main admin], saw %v", test.method, test.path, middlewareCalls)
+		}
+	}
+
+	if lr, _ := router.Lookup("GET", "/admin/users/5"); lr.Meta["auth"] != "admin" {
+		t.Errorf("Expected mounted route to keep its metadata, saw %v", lr.Meta)
+	}
+
+	// The settings of a route are set as it is mounted, so it is never served without
+	// them.
+	mounted := New()
+	mounted.AddHooks(Hooks{
+		OnRouteAdded: func(route RouteInfo) {
+			lr, _ := mounted.LookupHost(route.Host, route.Method, route.Pattern)
+			if route.Pattern == "/admin/users/:id" && lr.Meta["auth"] != "admin" {
+				t.Errorf("Expected mounted route to have its metadata once added, saw %v", lr.Meta)
+			}
+		},
+		OnRouteChanged: func(route RouteInfo) {
+			t.Errorf("Expected mounted route %s to be added with its settings, saw it changed", route.Pattern)
+		},
+	})
+	mounted.Mount("/admin", admin)
+
+	// Routes added after mounting are not mounted.
+	admin.GET("/late", makeHandler("late"))
+	r, _ := newRequest("GET", "/admin/late", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for route added after Mount, saw %d", w.Code)
+	}
+}
+
+func TestMountHandler(t *testing.T) {
+	var seen string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Method + " " + r.URL.Path
+	})
+
+	router := New()
+	router.MountHandler("/debug/*path", handler)
+	router.Group("/api").MountHandler("/:version/grpc/*method", handler)
+
+	tests := []struct {
+		method string
+		path   string
+		expect string
+	}{
+		{"GET", "/debug/vars", "GET /vars"},
+		{"GET", "/debug/", "GET /"},
+		{"GET", "/debug/a/b/", "GET /a/b/"},
+		{"POST", "/debug/a%20b", "POST /a b"},
+		{"DELETE", "/api/v1/grpc/Service/Method", "DELETE /Service/Method"},
+	}
+
+	for _, test := range tests {
+		seen = ""
+		r, _ := newRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if seen != test.expect {
+			t.Errorf("%s %s expected handler to see %q, saw %q", test.method, test.path, test.expect, seen)
+		}
+	}
+
+	func() {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Error("Expected panic for MountHandler path without a catch-all")
+			}
+		}()
+		router.MountHandler("/metrics", handler)
+	}()
+}
+
+func TestGroupMiddleware(t *testing.T) {
+	var calls []string
+	middleware := func(name string) MiddlewareFunc {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+				calls = append(calls, name)
+				next(w, r, params)
+			}
+		}
+	}
+
+	router := New()
+	router.Use(middleware("global"))
+	router.GET("/public", simpleHandler)
+
+	admin := router.Group("/admin")
+	admin.Use(middleware("auth"))
+	admin.GET("/users", simpleHandler)
+
+	// Both nested groups start from admin's stack, and neither changes the other's.
+	audit := admin.Group("/audit")
+	audit.Use(middleware("audit"))
+	audit.GET("/log", simpleHandler)
+	reports := admin.Group("/reports")
+	reports.Use(middleware("reports"))
+	reports.GET("/daily", simpleHandler)
+
+	admin.Use(middleware("late"))
+	admin.GET("/settings", simpleHandler)
+
+	tests := []struct {
+		path   string
+		expect []string
+	}{
+		{"/public", []string{"global"}},
+		{"/admin/users", []string{"global", "auth"}},
+		{"/admin/audit/log", []string{"global", "auth", "audit"}},
+		{"/admin/reports/daily", []string{"global", "auth", "reports"}},
+		{"/admin/settings", []string{"global", "auth", "late"}},
+	}
+
+	for _, test := range tests {
+		calls = nil
+		r, _ := newRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if !reflect.DeepEqual(calls, test.expect) {
+			t.Errorf("Path %s expected middleware %v, saw %v", test.path, test.expect, calls)
+		}
+	}
+}
+
+func TestWith(t *testing.T) {
+	var calls []string
+	middleware := func(name string) MiddlewareFunc {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+				calls = append(calls, name)
+				next(w, r, params)
+			}
+		}
+	}
+
+	router := New()
+	router.Use(middleware("global"))
+	router.With(middleware("timeout"), middleware("csv")).GET("/export.csv", simpleHandler)
+	router.GET("/export.json", simpleHandler)
+
+	api := router.Group("/api")
+	api.Use(middleware("api"))
+	api.With(middleware("timeout")).GET("/slow", simpleHandler)
+	api.GET("/fast", simpleHandler)
+
+	tests := []struct {
+		path   string
+		expect []string
+	}{
+		{"/export.csv", []string{"global", "timeout", "csv"}},
+		{"/export.json", []string{"global"}},
+		{"/api/slow", []string{"global", "api", "timeout"}},
+		{"/api/fast", []string{"global", "api"}},
+	}
+
+	for _, test := range tests {
+		calls = nil
+		r, _ := newRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if !reflect.DeepEqual(calls, test.expect) {
+			t.Errorf("Path %s expected middleware %v, saw %v", test.path, test.expect, calls)
+		}
+	}
+}
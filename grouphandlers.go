@@ -0,0 +1,216 @@
+package httptreemux
+
+import (
+	"net/http"
+	"strings"
+)
+
+// groupHandlers holds the NotFound and MethodNotAllowed handlers set on a group, and
+// whether it is in maintenance mode.
+type groupHandlers struct {
+	host string
+	path string
+
+	notFound         http.HandlerFunc
+	methodNotAllowed func(w http.ResponseWriter, r *http.Request, methods map[string]HandlerFunc)
+
+	// The handler that replaces those of the group's routes while it is in maintenance
+	// mode, or nil.
+	maintenance HandlerFunc
+}
+
+// SetNotFoundHandler sets the handler that is called instead of
+// TreeMux.NotFoundHandler when no route matches a request whose path is within the
+// group. When several groups contain the path, the handler of the one with the longest
+// path is used, so an /api group can respond with JSON errors while the rest of the
+// site uses HTML. Groups with the same path share their handlers. Setting the handler
+// to nil removes it.
+func (g *Group) SetNotFoundHandler(handler http.HandlerFunc) {
+	g.mux.setGroupHandlers(g.host, g.path, func(h *groupHandlers) {
+		h.notFound = handler
+	})
+}
+
+// SetMethodNotAllowedHandler sets the handler that is called instead of
+// TreeMux.MethodNotAllowedHandler when a route within the group matches a request but
+// has no handler for its method. The handler is chosen as for SetNotFoundHandler.
+// Setting the handler to nil removes it.
+func (g *Group) SetMethodNotAllowedHandler(handler func(w http.ResponseWriter, r *http.Request,
+	methods map[string]HandlerFunc)) {
+	g.mux.setGroupHandlers(g.host, g.path, func(h *groupHandlers) {
+		h.methodNotAllowed = handler
+	})
+}
+
+// setGroupHandlers changes the handlers of the group with the host and path, and
+// publishes them with a new copy of the routing trees.
+func (t *TreeMux) setGroupHandlers(host, path string, fn func(h *groupHandlers)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	trees := t.loadTrees()
+	handlers := make([]*groupHandlers, 0, len(trees.groupHandlers)+1)
+	var changed *groupHandlers
+	for _, h := range trees.groupHandlers {
+		if h.host == host && h.path == path {
+			copied := *h
+			h = &copied
+			changed = h
+		}
+		handlers = append(handlers, h)
+	}
+
+	if changed == nil {
+		changed = &groupHandlers{host: host, path: path}
+		// Keep the longest paths first, so that the first match is the deepest group.
+		i := 0
+		for i < len(handlers) && len(handlers[i].path) >= len(path) {
+			i++
+		}
+		handlers = append(handlers, nil)
+		copy(handlers[i+1:], handlers[i:])
+		handlers[i] = changed
+	}
+	fn(changed)
+
+	if changed.notFound == nil && changed.methodNotAllowed == nil && changed.maintenance == nil {
+		for i, h := range handlers {
+			if h == changed {
+				handlers = append(handlers[:i], handlers[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(handlers) == 0 {
+		handlers = nil
+	}
+
+	newTrees := &routingTrees{root: trees.root, hosts: trees.hosts, hostPatterns: trees.hostPatterns,
+		groupHandlers: handlers}
+	for _, h := range handlers {
+		if h.maintenance != nil {
+			newTrees.maintenance = true
+			break
+		}
+	}
+	t.trees.Store(newTrees)
+}
+
+// SetMaintenance puts every route within the group into maintenance mode, or takes
+// them out of it, without removing them. While the group is in maintenance mode,
+// requests matching its routes are served by the handler, wrapped in the group's and
+// the router's middleware, or with a 503 Service Unavailable response if the handler is
+// nil. Other responses, such as redirects and 404 errors, are not affected. The change
+// applies to requests that start after SetMaintenance returns. When enabled is false,
+// the handler is ignored.
+//
+// A route is within the group if its pattern starts with the group's path, including
+// routes added to the same prefix in other ways, and routes added after maintenance
+// mode is enabled. Nested groups can be put into maintenance mode separately, and the
+// handler of the deepest one that is in maintenance mode is used.
+func (g *Group) SetMaintenance(enabled bool, handler HandlerFunc) {
+	if enabled {
+		if handler == nil {
+			handler = maintenanceHandler
+		}
+		handler = applyMiddleware(g.middleware, handler)
+	}
+
+	g.mux.setGroupHandlers(g.host, g.path, func(h *groupHandlers) {
+		if enabled {
+			h.maintenance = g.mux.wrapHandler(handler)
+		} else {
+			h.maintenance = nil
+		}
+	})
+}
+
+// maintenanceHandler is the default handler for Group.SetMaintenance.
+func maintenanceHandler(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
+// maintenanceHandlerFor returns the maintenance handler of the deepest group in
+// maintenance mode that contains the pattern, or nil if there isn't one.
+func (trees *routingTrees) maintenanceHandlerFor(r *http.Request, pattern string) HandlerFunc {
+	host := trees.groupHost(r)
+	for _, h := range trees.groupHandlers {
+		if h.maintenance != nil && h.host == host && withinPath(pattern, h.path) {
+			return h.maintenance
+		}
+	}
+	return nil
+}
+
+// groupHost returns the host of the groups that apply to the request. Groups of a host
+// only apply to requests served from the host's tree, and groups of the default tree
+// only apply to requests served from it.
+func (trees *routingTrees) groupHost(r *http.Request) string {
+	host, _ := trees.matchHost(r.Host)
+	return host
+}
+
+// withinPath returns true if path is prefix, or is below it.
+func withinPath(path, prefix string) bool {
+	return path == prefix || (strings.HasPrefix(path, prefix) && path[len(prefix)] == '/')
+}
+
+// findGroupHandlers calls fn with the handlers of each group containing the request's
+// path, from the deepest group out, until fn returns true.
+func (t *TreeMux) findGroupHandlers(r *http.Request, fn func(h *groupHandlers) bool) bool {
+	trees := t.loadTrees()
+	if trees.groupHandlers == nil {
+		return false
+	}
+
+	host := trees.groupHost(r)
+	for _, h := range trees.groupHandlers {
+		if h.host == host && withinPath(r.URL.Path, h.path) && fn(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// notFound calls the NotFound handler of the deepest group containing the request's
+// path that has one, or TreeMux.NotFoundHandler.
+func (t *TreeMux) notFound(w http.ResponseWriter, r *http.Request) {
+	for _, hooks := range t.loadHooks() {
+		if hooks.OnNotFound != nil {
+			hooks.OnNotFound(r)
+		}
+	}
+
+	if t.Suggestions > 0 && withSuggestions != nil {
+		if suggestions := t.suggest(r); len(suggestions) != 0 {
+			r = withSuggestions(r, suggestions)
+		}
+	}
+
+	found := t.findGroupHandlers(r, func(h *groupHandlers) bool {
+		if h.notFound == nil {
+			return false
+		}
+		h.notFound(w, r)
+		return true
+	})
+	if !found {
+		t.NotFoundHandler(w, r)
+	}
+}
+
+// methodNotAllowed calls the MethodNotAllowed handler of the deepest group containing
+// the request's path that has one, or TreeMux.MethodNotAllowedHandler.
+func (t *TreeMux) methodNotAllowed(w http.ResponseWriter, r *http.Request,
+	methods map[string]HandlerFunc) {
+	found := t.findGroupHandlers(r, func(h *groupHandlers) bool {
+		if h.methodNotAllowed == nil {
+			return false
+		}
+		h.methodNotAllowed(w, r, methods)
+		return true
+	})
+	if !found {
+		t.MethodNotAllowedHandler(w, r, methods)
+	}
+}
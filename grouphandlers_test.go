@@ -0,0 +1,143 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGroupErrorHandlers(t *testing.T) {
+	writeBody := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(body))
+		}
+	}
+
+	router := New()
+	router.GET("/about", simpleHandler)
+	api := router.Group("/api")
+	api.GET("/users/:id", simpleHandler)
+	api.SetNotFoundHandler(writeBody("api"))
+	api.SetMethodNotAllowedHandler(func(w http.ResponseWriter, r *http.Request,
+		methods map[string]HandlerFunc) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("api 405"))
+	})
+	v2 := api.Group("/v2")
+	v2.SetNotFoundHandler(writeBody("v2"))
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"GET", "/missing", http.StatusNotFound, "404 page not found\n"},
+		{"GET", "/apix", http.StatusNotFound, "404 page not found\n"},
+		{"GET", "/api", http.StatusNotFound, "api"},
+		{"GET", "/api/missing", http.StatusNotFound, "api"},
+		{"GET", "/api/v2/missing", http.StatusNotFound, "v2"},
+		{"POST", "/api/users/1", http.StatusMethodNotAllowed, "api 405"},
+		{"POST", "/about", http.StatusMethodNotAllowed, ""},
+	}
+	for _, test := range tests {
+		r, _ := newRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.status || w.Body.String() != test.body {
+			t.Errorf("%s %s expected %d %q, saw %d %q", test.method, test.path,
+				test.status, test.body, w.Code, w.Body.String())
+		}
+	}
+
+	// Without a handler of its own, the deepest group falls back to the next one out.
+	v2.SetNotFoundHandler(nil)
+	r, _ := newRequest("GET", "/api/v2/missing", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Body.String() != "api" {
+		t.Errorf("Expected the /api handler after removing the /api/v2 one, saw %q", w.Body.String())
+	}
+
+	// Adding routes afterwards keeps the groups' handlers.
+	router.GET("/api/later", simpleHandler)
+	r, _ = newRequest("GET", "/api/missing", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Body.String() != "api" {
+		t.Errorf("Expected the /api handler after adding a route, saw %q", w.Body.String())
+	}
+
+	// Handlers of a host's group only apply to that host.
+	host := router.Host("example.com")
+	host.GET("/", simpleHandler)
+	host.SetNotFoundHandler(writeBody("host"))
+	for _, test := range []struct{ host, body string }{
+		{"example.com:8080", "host"},
+		{"other.com", "404 page not found\n"},
+	} {
+		r, _ = newRequest("GET", "/missing", nil)
+		r.Host = test.host
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Body.String() != test.body {
+			t.Errorf("Host %s expected %q, saw %q", test.host, test.body, w.Body.String())
+		}
+	}
+}
+
+func TestGroupMaintenance(t *testing.T) {
+	router := New()
+	router.GET("/about", simpleHandler)
+	api := router.Group("/api")
+	api.GET("/users/:id", simpleHandler)
+	admin := api.Group("/admin")
+	admin.GET("/stats", simpleHandler)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		r, _ := newRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	api.SetMaintenance(true, nil)
+	for path, status := range map[string]int{
+		"/about":           http.StatusOK,
+		"/api/users/1":     http.StatusServiceUnavailable,
+		"/api/admin/stats": http.StatusServiceUnavailable,
+		"/api/missing":     http.StatusNotFound,
+	} {
+		if w := serve(path); w.Code != status {
+			t.Errorf("%s expected %d in maintenance mode, saw %d", path, status, w.Code)
+		}
+	}
+
+	// The deepest group in maintenance mode chooses the handler, and gets the params.
+	admin.SetMaintenance(true, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	if w := serve("/api/admin/stats"); w.Code != http.StatusTeapot {
+		t.Errorf("Expected the /api/admin handler, saw %d", w.Code)
+	}
+
+	var id string
+	api.SetMaintenance(true, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		id = params["id"]
+	})
+	if serve("/api/users/5"); id != "5" {
+		t.Errorf("Expected the maintenance handler to get the params, saw %q", id)
+	}
+
+	api.SetMaintenance(false, nil)
+	admin.SetMaintenance(false, nil)
+	for _, path := range []string{"/api/users/1", "/api/admin/stats"} {
+		if w := serve(path); w.Code != http.StatusOK {
+			t.Errorf("%s expected 200 after maintenance mode, saw %d", path, w.Code)
+		}
+	}
+	if trees := router.loadTrees(); trees.maintenance || trees.groupHandlers != nil {
+		t.Error("Expected no group handlers after leaving maintenance mode")
+	}
+}
@@ -0,0 +1,203 @@
+//go:build go1.7
+// +build go1.7
+
+package httptreemux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHealthCheckTimeout is the timeout for a health check that hasn't been given
+// one with HealthCheck.Timeout.
+const DefaultHealthCheckTimeout = 5 * time.Second
+
+// Health serves the health of a service as JSON, based on checks that are added to it.
+// Checks are either liveness checks, which fail when the service is broken and should
+// be restarted, or readiness checks, which fail when the service can't serve requests
+// right now, such as while a database it depends on is down. Create one with
+// TreeMux.Health.
+type Health struct {
+	mutex  sync.RWMutex
+	checks []*HealthCheck
+}
+
+// HealthCheck is a check added to a Health. Its methods change how it is run, and
+// return the check so that they can be chained.
+type HealthCheck struct {
+	health   *Health
+	name     string
+	check    func(ctx context.Context) error
+	timeout  time.Duration
+	liveness bool
+}
+
+// HealthStatus is the JSON response of a Health endpoint.
+type HealthStatus struct {
+	// Status is "ok" if every check passed, and "fail" otherwise.
+	Status string `json:"status"`
+	// Checks has the result of each check that was run, by name.
+	Checks map[string]HealthCheckStatus `json:"checks,omitempty"`
+}
+
+// HealthCheckStatus is the result of a single check in a HealthStatus.
+type HealthCheckStatus struct {
+	// Status is "ok" if the check passed, and "fail" otherwise.
+	Status string `json:"status"`
+	// Error is the error returned by the check, if it failed.
+	Error string `json:"error,omitempty"`
+	// Duration is how long the check took, such as "1.5ms".
+	Duration string `json:"duration"`
+}
+
+var errHealthCheckTimeout = errors.New("timed out")
+
+// Health adds endpoints that report the health of the service at the path, and
+// returns the Health to add checks to. The path itself and path/ready run every
+// check, and path/live runs only the liveness checks, so that an orchestrator such as
+// Kubernetes doesn't restart a service just because a dependency is down. Each
+// endpoint responds with a HealthStatus, and a 200 status code if every check passed,
+// or 503 otherwise.
+//
+//	health := router.Health("/healthz")
+//	health.AddCheck("database", db.PingContext).Timeout(time.Second)
+//	health.AddCheck("deadlock", checkWorkers).Liveness()
+func (t *TreeMux) Health(path string) *Health {
+	return (&Group{mux: t}).Health(path)
+}
+
+// Health adds endpoints that report the health of the service at the path, prefixed
+// by the group's path. See TreeMux.Health.
+func (g *Group) Health(path string) *Health {
+	h := &Health{}
+	base := strings.TrimSuffix(path, "/")
+	g.GET(path, h.handler(false))
+	g.GET(base+"/ready", h.handler(false))
+	g.GET(base+"/live", h.handler(true))
+	return h
+}
+
+// AddCheck adds a readiness check with the name, which should be unique. The check
+// fails if it returns an error, or if it doesn't return before its timeout. The
+// context passed to it is canceled when the timeout passes, or when the request is
+// canceled.
+func (h *Health) AddCheck(name string, check func(ctx context.Context) error) *HealthCheck {
+	c := &HealthCheck{health: h, name: name, check: check, timeout: DefaultHealthCheckTimeout}
+	h.mutex.Lock()
+	h.checks = append(h.checks, c)
+	h.mutex.Unlock()
+	return c
+}
+
+// Timeout sets how long the check may take before it fails.
+func (c *HealthCheck) Timeout(timeout time.Duration) *HealthCheck {
+	c.health.mutex.Lock()
+	c.timeout = timeout
+	c.health.mutex.Unlock()
+	return c
+}
+
+// Liveness makes the check a liveness check, which is run by the live endpoint as
+// well as by the others.
+func (c *HealthCheck) Liveness() *HealthCheck {
+	c.health.mutex.Lock()
+	c.liveness = true
+	c.health.mutex.Unlock()
+	return c
+}
+
+// Check runs the checks, in parallel, and returns their results. If liveness is true,
+// only the liveness checks are run.
+func (h *Health) Check(ctx context.Context, liveness bool) HealthStatus {
+	type check struct {
+		name    string
+		check   func(ctx context.Context) error
+		timeout time.Duration
+	}
+
+	h.mutex.RLock()
+	checks := make([]check, 0, len(h.checks))
+	for _, c := range h.checks {
+		if c.liveness || !liveness {
+			checks = append(checks, check{c.name, c.check, c.timeout})
+		}
+	}
+	h.mutex.RUnlock()
+
+	status := HealthStatus{Status: "ok"}
+	if len(checks) == 0 {
+		return status
+	}
+
+	results := make([]HealthCheckStatus, len(checks))
+	var wg sync.WaitGroup
+	wg.Add(len(checks))
+	for i := range checks {
+		go func(i int) {
+			defer wg.Done()
+			results[i] = runHealthCheck(ctx, checks[i].check, checks[i].timeout)
+		}(i)
+	}
+	wg.Wait()
+
+	status.Checks = make(map[string]HealthCheckStatus, len(checks))
+	for i, c := range checks {
+		if results[i].Status != "ok" {
+			status.Status = "fail"
+		}
+		status.Checks[c.name] = results[i]
+	}
+	return status
+}
+
+// runHealthCheck runs a check, giving up on it once the timeout has passed even if it
+// ignores its context.
+func runHealthCheck(ctx context.Context, check func(ctx context.Context) error,
+	timeout time.Duration) HealthCheckStatus {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errHealthCheckTimeout
+	}
+
+	result := HealthCheckStatus{Status: "ok", Duration: time.Since(start).String()}
+	if err != nil {
+		result.Status = "fail"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// handler returns the handler for an endpoint of the Health.
+func (h *Health) handler(liveness bool) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		status := h.Check(r.Context(), liveness)
+		body, err := json.Marshal(status)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if status.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(body)
+	}
+}
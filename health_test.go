@@ -0,0 +1,68 @@
+//go:build go1.7
+// +build go1.7
+
+package httptreemux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	router := New()
+	health := router.Health("/healthz")
+
+	serve := func(path string) (int, HealthStatus) {
+		r, _ := newRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		var status HealthStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%s returned invalid JSON %q: %s", path, w.Body.String(), err)
+		}
+		return w.Code, status
+	}
+
+	// With no checks, everything is healthy.
+	if code, status := serve("/healthz"); code != http.StatusOK || status.Status != "ok" {
+		t.Errorf("Expected an empty Health to be ok, saw %d %+v", code, status)
+	}
+
+	var dbErr error
+	health.AddCheck("db", func(ctx context.Context) error { return dbErr })
+	health.AddCheck("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}).Timeout(10 * time.Millisecond)
+	health.AddCheck("workers", func(ctx context.Context) error { return nil }).Liveness()
+
+	code, status := serve("/healthz/ready")
+	if code != http.StatusServiceUnavailable || status.Status != "fail" || len(status.Checks) != 3 {
+		t.Fatalf("Expected the ready endpoint to fail, saw %d %+v", code, status)
+	}
+	if c := status.Checks["slow"]; c.Status != "fail" || c.Error != "timed out" {
+		t.Errorf("Expected the slow check to time out, saw %+v", c)
+	}
+	if c := status.Checks["db"]; c.Status != "ok" || c.Duration == "" {
+		t.Errorf("Expected the db check to pass, saw %+v", c)
+	}
+
+	// The live endpoint only runs the liveness checks.
+	code, status = serve("/healthz/live")
+	if code != http.StatusOK || len(status.Checks) != 1 || status.Checks["workers"].Status != "ok" {
+		t.Errorf("Expected only the workers check to run, saw %d %+v", code, status)
+	}
+
+	dbErr = errors.New("connection refused")
+	health = router.Group("/api").Health("/health/")
+	health.AddCheck("db", func(ctx context.Context) error { return dbErr })
+	code, status = serve("/api/health/ready")
+	if code != http.StatusServiceUnavailable || status.Checks["db"].Error != "connection refused" {
+		t.Errorf("Expected the db check to fail, saw %d %+v", code, status)
+	}
+}
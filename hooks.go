@@ -0,0 +1,238 @@
+package httptreemux
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+// Hooks are functions that a TreeMux calls when its routes change and when requests
+// are matched against them, such as to keep a service catalog or the rules of a web
+// application firewall in step with the routes. Add them with TreeMux.AddHooks. Any of
+// the functions may be nil.
+//
+// The route hooks are called after the change, on the goroutine that made it, once the
+// router is unlocked, so they may look up or change routes themselves. A route with
+// optional segments is reported once for each of the patterns it adds, as Walk lists
+// them. Swap and Restore report the routes that they add, remove and change.
+type Hooks struct {
+	// OnRouteAdded is called after a route is added, with the metadata that its group
+	// gave it, such as with Group.Port.
+	OnRouteAdded func(route RouteInfo)
+	// OnRouteChanged is called after the name, metadata or deprecation of a route
+	// changes.
+	OnRouteChanged func(route RouteInfo)
+	// OnRouteRemoved is called after a route is removed, with the description it had.
+	OnRouteRemoved func(route RouteInfo)
+	// OnMatch is called for each request that matches a route, before the handler is
+	// called. When ReuseParams is set, the params map of the result is only valid until
+	// OnMatch returns. It is called on the request's goroutine, so it should not block.
+	OnMatch func(r *http.Request, result LookupResult)
+	// OnNotFound is called for each request that matches no route, before the
+	// NotFoundHandler. It is called on the request's goroutine, so it should not block.
+	OnNotFound func(r *http.Request)
+}
+
+// AddHooks adds hooks to the router. Hooks added earlier are called first.
+func (t *TreeMux) AddHooks(hooks Hooks) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	existing := t.loadHooks()
+	all := make([]Hooks, len(existing), len(existing)+1)
+	copy(all, existing)
+	t.hooks.Store(append(all, hooks))
+}
+
+// loadHooks returns the hooks added with AddHooks.
+func (t *TreeMux) loadHooks() []Hooks {
+	hooks, _ := t.hooks.Load().([]Hooks)
+	return hooks
+}
+
+// routeInfos returns a description of the route for each of its patterns. The router's
+// mutex must be held.
+func (r *Route) routeInfos() []RouteInfo {
+	infos := make([]RouteInfo, len(r.paths))
+	for i, path := range r.paths {
+		infos[i] = RouteInfo{
+			Name:        r.name,
+			Method:      r.method,
+			Host:        r.host,
+			Pattern:     path,
+			Handler:     r.handler,
+			Meta:        r.meta,
+			Deprecation: r.deprecation,
+		}
+	}
+	return infos
+}
+
+// leafRouteInfo returns a description of the route for the handler of the node.
+func leafRouteInfo(n *node, name, method, host, pattern string, handler HandlerFunc) RouteInfo {
+	return RouteInfo{
+		Name:        name,
+		Method:      method,
+		Host:        host,
+		Pattern:     pattern,
+		Handler:     handler,
+		Meta:        n.leafMeta[method],
+		Deprecation: n.leafDeprecation[method],
+	}
+}
+
+// routesAdded calls the OnRouteAdded hooks for the routes. The router's mutex must not
+// be held.
+func (t *TreeMux) routesAdded(routes []*Route) {
+	hooks := t.loadHooks()
+	if len(hooks) == 0 || len(routes) == 0 {
+		return
+	}
+
+	var infos []RouteInfo
+	t.mutex.Lock()
+	for _, route := range routes {
+		infos = append(infos, route.routeInfos()...)
+	}
+	t.mutex.Unlock()
+	callRouteHooks(hooks, func(h Hooks) func(RouteInfo) { return h.OnRouteAdded }, infos)
+}
+
+// routeChanged calls the OnRouteChanged hooks for the route. The router's mutex must
+// not be held.
+func (t *TreeMux) routeChanged(route *Route) {
+	hooks := t.loadHooks()
+	if len(hooks) == 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	infos := route.routeInfos()
+	t.mutex.Unlock()
+	callRouteHooks(hooks, func(h Hooks) func(RouteInfo) { return h.OnRouteChanged }, infos)
+}
+
+// routesRemoved calls the OnRouteRemoved hooks for the routes. The router's mutex must
+// not be held.
+func (t *TreeMux) routesRemoved(infos []RouteInfo) {
+	callRouteHooks(t.loadHooks(), func(h Hooks) func(RouteInfo) { return h.OnRouteRemoved }, infos)
+}
+
+// callRouteHooks calls the hook that choose returns from each of the hooks, if it isn't
+// nil, with each of the routes.
+func callRouteHooks(hooks []Hooks, choose func(h Hooks) func(RouteInfo), infos []RouteInfo) {
+	for _, h := range hooks {
+		if hook := choose(h); hook != nil {
+			for _, info := range infos {
+				hook(info)
+			}
+		}
+	}
+}
+
+// routeTable describes the routes of a router at one time, for reporting the changes
+// made by Swap and Restore.
+type routeTable struct {
+	trees *routingTrees
+	// The names of the routes, keyed by routeKey.
+	names map[string]string
+}
+
+// routeKey identifies a route in a routeTable.
+func routeKey(method, host, pattern string) string {
+	return method + " " + host + " " + pattern
+}
+
+// routeTable returns the router's routes. The router's mutex must be held.
+func (t *TreeMux) routeTable() routeTable {
+	names := make(map[string]string, len(t.namedRoutes))
+	for name, route := range t.namedRoutes {
+		names[routeKey(route.method, route.host, route.path)] = name
+	}
+	return routeTable{trees: t.loadTrees(), names: names}
+}
+
+// infos returns a description of each route in the table, in the order of Walk, with
+// the default tree first and then each host's in alphabetical order.
+func (rt routeTable) infos() []RouteInfo {
+	var infos []RouteInfo
+	add := func(host string, root *node) {
+		root.walk([]walkPiece{{text: "/"}}, func(n *node, method, pattern string, handler HandlerFunc) bool {
+			infos = append(infos, leafRouteInfo(n, rt.names[routeKey(method, host, pattern)],
+				method, host, pattern, handler))
+			return true
+		})
+	}
+
+	add("", rt.trees.root)
+	hosts := make([]string, 0, len(rt.trees.hosts))
+	for host := range rt.trees.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		add(host, rt.trees.hosts[host])
+	}
+	return infos
+}
+
+// reportChanges calls the route hooks for the differences between the route tables.
+// The router's mutex must not be held.
+func (t *TreeMux) reportChanges(before, after routeTable) {
+	hooks := t.loadHooks()
+	if len(hooks) == 0 || before.trees == after.trees {
+		return
+	}
+
+	beforeInfos, afterInfos := before.infos(), after.infos()
+	index := func(infos []RouteInfo) map[string]RouteInfo {
+		m := make(map[string]RouteInfo, len(infos))
+		for _, info := range infos {
+			m[routeKey(info.Method, info.Host, info.Pattern)] = info
+		}
+		return m
+	}
+	beforeIndex, afterIndex := index(beforeInfos), index(afterInfos)
+
+	var added, changed, removed []RouteInfo
+	for _, info := range beforeInfos {
+		if _, ok := afterIndex[routeKey(info.Method, info.Host, info.Pattern)]; !ok {
+			removed = append(removed, info)
+		}
+	}
+	for _, info := range afterInfos {
+		old, ok := beforeIndex[routeKey(info.Method, info.Host, info.Pattern)]
+		if !ok {
+			added = append(added, info)
+		} else if old.Name != info.Name || !reflect.DeepEqual(old.Meta, info.Meta) ||
+			!reflect.DeepEqual(old.Deprecation, info.Deprecation) {
+			changed = append(changed, info)
+		}
+	}
+
+	callRouteHooks(hooks, func(h Hooks) func(RouteInfo) { return h.OnRouteRemoved }, removed)
+	callRouteHooks(hooks, func(h Hooks) func(RouteInfo) { return h.OnRouteAdded }, added)
+	callRouteHooks(hooks, func(h Hooks) func(RouteInfo) { return h.OnRouteChanged }, changed)
+}
+
+// removedRoutes returns descriptions of the routes for the method and patterns in the
+// host's tree, for reporting them once they have been removed. The patterns must have
+// had their trailing slashes trimmed. The router's mutex must be held.
+func (t *TreeMux) removedRoutes(host, method string, paths []string) []RouteInfo {
+	trees := t.loadTrees()
+	root := trees.root
+	if host != "" {
+		root = trees.hosts[host]
+	}
+	names := t.routeTable().names
+
+	var infos []RouteInfo
+	root.walk([]walkPiece{{text: "/"}}, func(n *node, m, pattern string, handler HandlerFunc) bool {
+		if trimmed, _ := t.trimTrailingSlash(pattern); m == method && containsString(paths, trimmed) {
+			infos = append(infos, leafRouteInfo(n, names[routeKey(method, host, pattern)],
+				method, host, pattern, handler))
+		}
+		return true
+	})
+	return infos
+}
@@ -0,0 +1,101 @@
+package httptreemux
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	var events []string
+	describe := func(event string) func(route RouteInfo) {
+		return func(route RouteInfo) {
+			events = append(events, event+" "+route.Method+" "+route.Host+route.Pattern+" "+
+				route.Name+" "+fmt.Sprint(route.Meta))
+		}
+	}
+
+	router := New()
+	router.AddHooks(Hooks{
+		OnRouteAdded:   describe("added"),
+		OnRouteChanged: describe("changed"),
+		OnRouteRemoved: describe("removed"),
+		OnMatch: func(r *http.Request, result LookupResult) {
+			events = append(events, "match "+r.Method+" "+result.Pattern+" "+fmt.Sprint(result.Meta))
+		},
+		OnNotFound: func(r *http.Request) {
+			events = append(events, "not found "+r.URL.Path)
+		},
+	})
+	// Hooks may use the router.
+	router.AddHooks(Hooks{
+		OnRouteAdded: func(route RouteInfo) {
+			if _, ok := router.LookupHost(route.Host, route.Method, route.Pattern); !ok {
+				t.Errorf("Expected %s to be served when it is reported", route.Pattern)
+			}
+		},
+	})
+
+	router.GET("/users/:id", simpleHandler).Name("user").Meta("owner", "accounts")
+	router.Host("api.example.com").Group("/v1").Port("8443").POST("/orders", simpleHandler)
+	router.GET("/archive/:year?", simpleHandler)
+	expected := []string{
+		"added GET /users/:id  map[]",
+		"changed GET /users/:id user map[]",
+		"changed GET /users/:id user map[owner:accounts]",
+		"added POST api.example.com/v1/orders  map[ports:[8443]]",
+		"added GET /archive  map[]",
+		"added GET /archive/:year  map[]",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected the routes to be reported as\n%q\nsaw\n%q", expected, events)
+	}
+
+	events = nil
+	for _, path := range []string{"/users/1", "/missing"} {
+		r, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	expected = []string{
+		"match GET /users/:id map[owner:accounts]",
+		"not found /missing",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected the requests to be reported as\n%q\nsaw\n%q", expected, events)
+	}
+
+	events = nil
+	snapshot := router.Snapshot()
+	router.Remove("GET", "/users/:id")
+	router.Remove("GET", "/archive/:year?")
+	router.Remove("GET", "/missing")
+	expected = []string{
+		"removed GET /users/:id user map[owner:accounts]",
+		"removed GET /archive  map[]",
+		"removed GET /archive/:year  map[]",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected the removals to be reported as\n%q\nsaw\n%q", expected, events)
+	}
+
+	events = nil
+	next := New()
+	next.GET("/users/:id", simpleHandler).Meta("owner", "profiles")
+	next.Host("api.example.com").Group("/v1").Port("8443").POST("/orders", simpleHandler)
+	next.GET("/health", simpleHandler)
+	router.Swap(next)
+	router.Restore(snapshot)
+	expected = []string{
+		"added GET /users/:id  map[owner:profiles]",
+		"added GET /health  map[]",
+		"removed GET /health  map[]",
+		"added GET /archive  map[]",
+		"added GET /archive/:year  map[]",
+		"changed GET /users/:id user map[owner:accounts]",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected Swap and Restore to be reported as\n%q\nsaw\n%q", expected, events)
+	}
+}
@@ -0,0 +1,185 @@
+package httptreemux
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Host returns a group whose routes only match requests for the given host. Each host
+// has its own routing tree, and requests for a host that has no routes registered are
+// matched against the default tree. Once a request's host has a tree though, only that
+// tree is searched.
+//
+// Host names are matched without regard to case, and any port in the request's Host
+// header is ignored.
+//
+// A label of the host that starts with a colon is a param, which matches any label of
+// the request's host and is passed to the handlers with the params of the path:
+//
+//	tenant := router.Host(":tenant.example.com")
+//	tenant.GET("/users/:id", userHandler) // params["tenant"] is "acme" for acme.example.com
+//
+// A first label of * matches one or more labels, so *.example.com matches
+// staging.example.com and a.b.example.com, but not example.com itself.
+//
+// A host name without params or * takes precedence over those with them, and of those,
+// the one with the most labels that aren't params or * is used, with params preferred
+// over *. Requests for hosts that match none of them use the default tree. A path param
+// with the same name as a host param takes precedence over it.
+func (t *TreeMux) Host(host string) *Group {
+	host = normalizeHost(host)
+	if host == "" {
+		panic("Host name must not be empty")
+	}
+	if strings.Contains(host[1:], "*") {
+		panic("* must be the first label of host " + host)
+	}
+	return &Group{host: host, mux: t}
+}
+
+// normalizeHost converts a host name passed to Host to the form used as the key of its
+// tree, which is lowercase except for the names of its params.
+func normalizeHost(host string) string {
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(label, ":") {
+			labels[i] = strings.ToLower(label)
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// isHostPattern reports whether the key of a host's tree has params or *.
+func isHostPattern(host string) bool {
+	return strings.HasPrefix(host, ":") || strings.HasPrefix(host, "*") || strings.Contains(host, ".:")
+}
+
+// hostPatternOrder sorts host patterns so that the first that matches a host is the
+// one it should use.
+type hostPatternOrder []string
+
+func (p hostPatternOrder) Len() int      { return len(p) }
+func (p hostPatternOrder) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p hostPatternOrder) Less(i, j int) bool {
+	si, sj := staticLabels(p[i]), staticLabels(p[j])
+	if si != sj {
+		return si > sj
+	}
+	if wi, wj := p[i][0] == '*', p[j][0] == '*'; wi != wj {
+		return wj
+	}
+	return p[i] < p[j]
+}
+
+// staticLabels returns the number of labels of a host pattern that aren't params or *.
+func staticLabels(pattern string) int {
+	count := 0
+	for _, label := range strings.Split(pattern, ".") {
+		if !strings.HasPrefix(label, ":") && label != "*" {
+			count++
+		}
+	}
+	return count
+}
+
+// hostPatterns returns the keys of the hosts that have params or *, in the order they
+// are tried.
+func hostPatterns(hosts map[string]*node) []string {
+	var patterns []string
+	for host := range hosts {
+		if isHostPattern(host) {
+			patterns = append(patterns, host)
+		}
+	}
+	sort.Sort(hostPatternOrder(patterns))
+	return patterns
+}
+
+// matchHostPattern reports whether the host, as returned by hostKey, matches the
+// pattern, and returns the values of its params.
+func matchHostPattern(pattern, host string) (map[string]string, bool) {
+	patternLabels := strings.Split(pattern, ".")
+	hostLabels := strings.Split(host, ".")
+	if patternLabels[0] == "*" {
+		// The * takes the labels that the rest of the pattern doesn't.
+		patternLabels = patternLabels[1:]
+		if len(hostLabels) <= len(patternLabels) || hostLabels[0] == "" {
+			return nil, false
+		}
+		hostLabels = hostLabels[len(hostLabels)-len(patternLabels):]
+	}
+	if len(patternLabels) != len(hostLabels) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, label := range patternLabels {
+		if strings.HasPrefix(label, ":") {
+			if hostLabels[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[label[1:]] = hostLabels[i]
+		} else if label != hostLabels[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// matchHost returns the key of the tree for the host, which may include a port, and the
+// params of its pattern, if it has any. The key is empty for the default tree.
+func (trees *routingTrees) matchHost(host string) (string, map[string]string) {
+	if trees.hosts == nil {
+		return "", nil
+	}
+	key := hostKey(host)
+	if _, ok := trees.hosts[key]; ok {
+		return key, nil
+	}
+	for _, pattern := range trees.hostPatterns {
+		if params, ok := matchHostPattern(pattern, key); ok {
+			return pattern, params
+		}
+	}
+	return "", nil
+}
+
+// rootForHost returns the root of the tree for the host, which may include a port, or
+// of the default tree if the host has no routes.
+func (trees *routingTrees) rootForHost(host string) *node {
+	if key, _ := trees.matchHost(host); key != "" {
+		return trees.hosts[key]
+	}
+	return trees.root
+}
+
+// lookupHost looks up the route for the method and path in the tree for the host, and
+// adds the params of the host's pattern to those of the path.
+func (t *TreeMux) lookupHost(host, method, path string) LookupResult {
+	trees := t.loadTrees()
+	key, hostParams := trees.matchHost(host)
+	root := trees.root
+	if key != "" {
+		root = trees.hosts[key]
+	}
+
+	lr := t.lookup(root, method, path)
+	if lr.StatusCode == http.StatusOK || lr.StatusCode == http.StatusMethodNotAllowed {
+		for name, value := range hostParams {
+			lr.addParam(name, value)
+		}
+	}
+	return lr
+}
+
+// hostKey converts the Host header of a request to the form used to look up its tree.
+func hostKey(host string) string {
+	// Strip the port, taking care not to break up an IPv6 address in brackets.
+	if colon := strings.LastIndex(host, ":"); colon != -1 && colon > strings.LastIndex(host, "]") {
+		host = host[:colon]
+	}
+	return strings.ToLower(host)
+}
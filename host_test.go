@@ -0,0 +1,209 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostRouting(t *testing.T) {
+	var matched string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			matched = name
+		}
+	}
+
+	router := New()
+	router.GET("/", makeHandler("default index"))
+	router.GET("/shared", makeHandler("default shared"))
+	router.Host("api.example.com").GET("/", makeHandler("api index"))
+	router.Host("API.example.com").Group("/v1").GET("/users", makeHandler("api users"))
+	router.Host("www.example.com").GET("/", makeHandler("www index"))
+
+	tests := []struct {
+		host   string
+		path   string
+		expect string
+		code   int
+	}{
+		{"api.example.com", "/", "api index", http.StatusOK},
+		{"api.example.com:8080", "/", "api index", http.StatusOK},
+		{"Api.Example.com", "/v1/users", "api users", http.StatusOK},
+		{"www.example.com", "/", "www index", http.StatusOK},
+		{"other.example.com", "/", "default index", http.StatusOK},
+		{"[::1]:8080", "/shared", "default shared", http.StatusOK},
+		{"", "/", "default index", http.StatusOK},
+		// Hosts with their own tree don't fall back to the default tree.
+		{"api.example.com", "/shared", "", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		matched = ""
+		r, _ := newRequest("GET", test.path, nil)
+		r.Host = test.host
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if matched != test.expect || w.Code != test.code {
+			t.Errorf("Host %s path %s expected %q with code %d, saw %q with code %d",
+				test.host, test.path, test.expect, test.code, matched, w.Code)
+		}
+	}
+}
+
+func TestHostParams(t *testing.T) {
+	var matched string
+	var params map[string]string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, p map[string]string) {
+			matched, params = name, p
+		}
+	}
+
+	router := New()
+	router.GET("/", makeHandler("default"))
+	router.Host(":tenant.example.com").GET("/users/:id", makeHandler("tenant user"))
+	router.Host(":tenant.example.com").GET("/", makeHandler("tenant index"))
+	router.Host(":Region.:tenant.example.com").GET("/", makeHandler("regional"))
+	router.Host(":env.api.example.com").GET("/", makeHandler("api"))
+	router.Host("www.example.com").GET("/", makeHandler("www"))
+	router.Host(":tenant.example.com").GET("/tenants/:tenant", makeHandler("tenant override"))
+
+	tests := []struct {
+		host    string
+		path    string
+		matched string
+		params  map[string]string
+	}{
+		{"acme.example.com", "/users/1", "tenant user", map[string]string{"tenant": "acme", "id": "1"}},
+		{"ACME.example.com:8080", "/", "tenant index", map[string]string{"tenant": "acme"}},
+		{"eu.acme.example.com", "/", "regional", map[string]string{"Region": "eu", "tenant": "acme"}},
+		{"staging.api.example.com", "/", "api", map[string]string{"env": "staging"}},
+		{"www.example.com", "/", "www", nil},
+		{"example.com", "/", "default", nil},
+		{"acme.example.org", "/", "default", nil},
+		{"acme.example.com", "/tenants/other", "tenant override", map[string]string{"tenant": "other"}},
+	}
+	for _, test := range tests {
+		matched, params = "", nil
+		r, _ := newRequest("GET", test.path, nil)
+		r.Host = test.host
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if matched != test.matched || len(params) != len(test.params) {
+			t.Errorf("Host %s path %s expected %q with %v, saw %q with %v", test.host, test.path,
+				test.matched, test.params, matched, params)
+			continue
+		}
+		for key, value := range test.params {
+			if params[key] != value {
+				t.Errorf("Host %s path %s expected %v, saw %v", test.host, test.path, test.params, params)
+			}
+		}
+	}
+
+	lr, found := router.LookupHost("acme.example.com", "GET", "/users/2")
+	if !found || lr.Params["tenant"] != "acme" || lr.Params["id"] != "2" {
+		t.Errorf("Expected LookupHost to return the host params, saw %v", lr.Params)
+	}
+}
+
+func TestHostWildcards(t *testing.T) {
+	var matched string
+	var params map[string]string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, p map[string]string) {
+			matched, params = name, p
+		}
+	}
+
+	router := New()
+	router.GET("/", makeHandler("default"))
+	router.Host("*.example.com").GET("/", makeHandler("wildcard"))
+	router.Host("*.staging.example.com").GET("/", makeHandler("staging"))
+	router.Host(":app.example.com").GET("/", makeHandler("app"))
+	router.Host("*.:region.example.net").GET("/", makeHandler("regional"))
+	router.Host("www.example.com").GET("/", makeHandler("exact"))
+
+	tests := []struct {
+		host    string
+		matched string
+		params  map[string]string
+	}{
+		{"www.example.com", "exact", nil},
+		{"shop.example.com", "app", map[string]string{"app": "shop"}},
+		{"a.b.example.com", "wildcard", nil},
+		{"api.staging.example.com", "staging", nil},
+		{"a.b.staging.example.com", "staging", nil},
+		{"staging.example.com", "app", map[string]string{"app": "staging"}},
+		{"web.eu.example.net", "regional", map[string]string{"region": "eu"}},
+		{"eu.example.net", "default", nil},
+		{"example.com", "default", nil},
+		{".example.com", "default", nil},
+	}
+	for _, test := range tests {
+		matched, params = "", nil
+		r, _ := newRequest("GET", "/", nil)
+		r.Host = test.host
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if matched != test.matched || len(params) != len(test.params) {
+			t.Errorf("Host %s expected %q with %v, saw %q with %v", test.host, test.matched, test.params,
+				matched, params)
+			continue
+		}
+		for key, value := range test.params {
+			if params[key] != value {
+				t.Errorf("Host %s expected %v, saw %v", test.host, test.params, params)
+			}
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for * after the first label")
+		}
+	}()
+	router.Host("www.*.example.com")
+}
+
+func TestHostKey(t *testing.T) {
+	tests := map[string]string{
+		"example.com":    "example.com",
+		"EXAMPLE.com:80": "example.com",
+		"[::1]":          "[::1]",
+		"[::1]:8080":     "[::1]",
+		"127.0.0.1:8080": "127.0.0.1",
+		"":               "",
+	}
+
+	for host, expected := range tests {
+		if key := hostKey(host); key != expected {
+			t.Errorf("Host %q expected key %q, saw %q", host, expected, key)
+		}
+	}
+}
+
+func TestLookupHost(t *testing.T) {
+	router := New()
+	router.GET("/users/:id", simpleHandler)
+	router.Host("api.example.com").GET("/v1/users/:id", simpleHandler)
+
+	tests := []struct {
+		host    string
+		path    string
+		pattern string
+		found   bool
+	}{
+		{"api.example.com:8080", "/v1/users/5", "/v1/users/:id", true},
+		{"API.example.com", "/users/5", "", false},
+		{"www.example.com", "/users/5", "/users/:id", true},
+		{"", "/users/5", "/users/:id", true},
+	}
+
+	for _, test := range tests {
+		lr, found := router.LookupHost(test.host, "GET", test.path)
+		if found != test.found || lr.Pattern != test.pattern {
+			t.Errorf("Host %s path %s expected found %v with pattern %q, saw %v with %q",
+				test.host, test.path, test.found, test.pattern, found, lr.Pattern)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+//go:build go1.7
+// +build go1.7
+
+// Package httprouter provides the API of github.com/julienschmidt/httprouter on top of
+// httptreemux, so that a project can switch routers by changing its import path. Routes
+// are stored in an httptreemux tree, which allows patterns that httprouter rejects, such
+// as a static route and a wildcard route that share a prefix. It needs Go 1.7 or later,
+// for the request context.
+package httprouter
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/dimfeld/httptreemux"
+)
+
+// Param is a single URL parameter, consisting of a key and a value.
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params is a list of URL parameters, in the order they appear in the route's pattern.
+type Params []Param
+
+// ByName returns the value of the first Param whose key matches the name, or an empty
+// string if there is none.
+func (ps Params) ByName(name string) string {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+type paramsKey struct{}
+
+// ParamsKey is the request context key under which Handler and HandlerFunc store the
+// URL params.
+var ParamsKey = paramsKey{}
+
+// ParamsFromContext returns the URL params stored in a request context by Handler and
+// HandlerFunc, or nil if there are none.
+func ParamsFromContext(ctx context.Context) Params {
+	p, _ := ctx.Value(ParamsKey).(Params)
+	return p
+}
+
+// Handle is a function that handles a request, like http.HandlerFunc, with the values of
+// the route's wildcards.
+type Handle func(http.ResponseWriter, *http.Request, Params)
+
+// Router dispatches requests to handlers, with the same methods and settings as the
+// Router of httprouter.
+type Router struct {
+	mux *httptreemux.TreeMux
+
+	// RedirectTrailingSlash redirects a request whose path only matches a route with
+	// or without a trailing slash. Like RedirectFixedPath, it applies to routes added
+	// after it is set.
+	RedirectTrailingSlash bool
+	// RedirectFixedPath redirects a request whose path matches a route once it has been
+	// cleaned, such as by removing duplicate slashes and .. elements.
+	RedirectFixedPath bool
+	// HandleMethodNotAllowed responds with MethodNotAllowed when a route matches the
+	// path but not the method. Otherwise NotFound is used.
+	HandleMethodNotAllowed bool
+	// HandleOPTIONS answers OPTIONS requests for routes without an OPTIONS handler,
+	// with the Allow header set and by calling GlobalOPTIONS if it is set.
+	HandleOPTIONS bool
+	// GlobalOPTIONS is called for OPTIONS requests answered automatically.
+	GlobalOPTIONS http.Handler
+	// NotFound is called when no route matches. It is http.NotFound if nil.
+	NotFound http.Handler
+	// MethodNotAllowed is called when a route matches the path but not the method, and
+	// HandleMethodNotAllowed is set. The Allow header is set before it is called.
+	MethodNotAllowed http.Handler
+	// PanicHandler is called with the recovered value when a handler panics. If it is
+	// nil, panics are not recovered.
+	PanicHandler func(http.ResponseWriter, *http.Request, interface{})
+}
+
+// New returns a new Router with the same defaults as httprouter.
+func New() *Router {
+	rt := &Router{
+		mux:                    httptreemux.New(),
+		RedirectTrailingSlash:  true,
+		RedirectFixedPath:      true,
+		HandleMethodNotAllowed: true,
+		HandleOPTIONS:          true,
+	}
+
+	mux := rt.mux
+	mux.AutoOptions = true
+	for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		mux.RedirectMethodBehavior[method] = httptreemux.Redirect308
+	}
+	mux.NotFoundHandler = rt.notFound
+	mux.MethodNotAllowedHandler = rt.methodNotAllowed
+	mux.AutoOptionsHandler = rt.autoOptions
+	mux.PanicHandler = rt.panic
+	return rt
+}
+
+// Handle adds a handler for the method and path. Wildcards are written as :name, and a
+// catch-all at the end of the path as *name. As in httprouter, the value of a
+// catch-all starts with a slash.
+func (rt *Router) Handle(method, path string, handle Handle) {
+	names, catchAll := paramNames(path)
+
+	rt.mux.RedirectTrailingSlash = rt.RedirectTrailingSlash
+	rt.mux.RedirectCleanPath = rt.RedirectFixedPath
+	rt.mux.Handle(method, path, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		handle(w, r, orderParams(names, catchAll, params))
+	})
+}
+
+// Handler adds an http.Handler for the method and path. The params can be retrieved
+// with ParamsFromContext.
+func (rt *Router) Handler(method, path string, handler http.Handler) {
+	rt.Handle(method, path, func(w http.ResponseWriter, r *http.Request, ps Params) {
+		if len(ps) != 0 {
+			r = r.WithContext(context.WithValue(r.Context(), ParamsKey, ps))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// HandlerFunc adds an http.HandlerFunc for the method and path.
+func (rt *Router) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	rt.Handler(method, path, handler)
+}
+
+// GET is a shortcut for Handle("GET", path, handle).
+func (rt *Router) GET(path string, handle Handle) {
+	rt.Handle("GET", path, handle)
+}
+
+// HEAD is a shortcut for Handle("HEAD", path, handle).
+func (rt *Router) HEAD(path string, handle Handle) {
+	rt.Handle("HEAD", path, handle)
+}
+
+// OPTIONS is a shortcut for Handle("OPTIONS", path, handle).
+func (rt *Router) OPTIONS(path string, handle Handle) {
+	rt.Handle("OPTIONS", path, handle)
+}
+
+// POST is a shortcut for Handle("POST", path, handle).
+func (rt *Router) POST(path string, handle Handle) {
+	rt.Handle("POST", path, handle)
+}
+
+// PUT is a shortcut for Handle("PUT", path, handle).
+func (rt *Router) PUT(path string, handle Handle) {
+	rt.Handle("PUT", path, handle)
+}
+
+// PATCH is a shortcut for Handle("PATCH", path, handle).
+func (rt *Router) PATCH(path string, handle Handle) {
+	rt.Handle("PATCH", path, handle)
+}
+
+// DELETE is a shortcut for Handle("DELETE", path, handle).
+func (rt *Router) DELETE(path string, handle Handle) {
+	rt.Handle("DELETE", path, handle)
+}
+
+// ServeFiles serves files from root at the path, which must end with /*filepath, as
+// in httprouter.
+func (rt *Router) ServeFiles(path string, root http.FileSystem) {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic("path must end with /*filepath in path '" + path + "'")
+	}
+
+	fileServer := http.FileServer(root)
+	rt.GET(path, func(w http.ResponseWriter, r *http.Request, ps Params) {
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path = ps.ByName("filepath")
+		u.RawPath = ""
+		r2.URL = &u
+		fileServer.ServeHTTP(w, r2)
+	})
+}
+
+// Lookup finds the handler for the method and path. If no handler is found, tsr
+// reports whether the router would redirect the path to add or remove a trailing
+// slash.
+func (rt *Router) Lookup(method, path string) (handle Handle, ps Params, tsr bool) {
+	lr, found := rt.mux.Lookup(method, path)
+	if !found {
+		redirect := lr.StatusCode >= 300 && lr.StatusCode < 400
+		tsr = redirect && strings.TrimSuffix(lr.RedirectPath, "/") == strings.TrimSuffix(path, "/")
+		return nil, nil, tsr
+	}
+
+	names, catchAll := paramNames(lr.Pattern)
+	handle = func(w http.ResponseWriter, r *http.Request, ps Params) {
+		var params map[string]string
+		if len(ps) != 0 {
+			params = make(map[string]string, len(ps))
+			for _, p := range ps {
+				params[p.Key] = p.Value
+			}
+			if catchAll {
+				name := names[len(names)-1]
+				params[name] = strings.TrimPrefix(params[name], "/")
+			}
+		}
+		lr.Handler(w, r, params)
+	}
+	return handle, orderParams(names, catchAll, lr.Params), false
+}
+
+// ServeHTTP makes the router implement the http.Handler interface.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+func (rt *Router) notFound(w http.ResponseWriter, r *http.Request) {
+	if rt.NotFound != nil {
+		rt.NotFound.ServeHTTP(w, r)
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+func (rt *Router) methodNotAllowed(w http.ResponseWriter, r *http.Request, methods map[string]httptreemux.HandlerFunc) {
+	if !rt.HandleMethodNotAllowed {
+		rt.notFound(w, r)
+		return
+	}
+
+	if rt.MethodNotAllowed == nil {
+		httptreemux.MethodNotAllowedHandler(w, r, methods)
+		return
+	}
+
+	// Let the default handler set the Allow header, but discard its response.
+	httptreemux.MethodNotAllowedHandler(headerOnlyWriter{w}, r, methods)
+	rt.MethodNotAllowed.ServeHTTP(w, r)
+}
+
+func (rt *Router) autoOptions(w http.ResponseWriter, r *http.Request, methods map[string]httptreemux.HandlerFunc) {
+	if !rt.HandleOPTIONS {
+		delete(methods, "OPTIONS")
+		rt.methodNotAllowed(w, r, methods)
+		return
+	}
+
+	if rt.GlobalOPTIONS == nil {
+		httptreemux.AutoOptionsHandler(w, r, methods)
+		return
+	}
+
+	httptreemux.AutoOptionsHandler(headerOnlyWriter{w}, r, methods)
+	rt.GlobalOPTIONS.ServeHTTP(w, r)
+}
+
+func (rt *Router) panic(w http.ResponseWriter, r *http.Request, err interface{}) {
+	if panicErr, ok := err.(*httptreemux.PanicError); ok {
+		err = panicErr.Err
+	}
+	if rt.PanicHandler == nil {
+		panic(err)
+	}
+	rt.PanicHandler(w, r, err)
+}
+
+// headerOnlyWriter lets a handler set headers, but discards its status code and body.
+type headerOnlyWriter struct {
+	http.ResponseWriter
+}
+
+func (w headerOnlyWriter) WriteHeader(int) {}
+
+func (w headerOnlyWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// paramNames returns the names of the wildcards in a pattern in order, and whether the
+// last one is a catch-all.
+func paramNames(path string) (names []string, catchAll bool) {
+	for _, segment := range strings.Split(path, "/") {
+		if len(segment) < 2 {
+			continue
+		}
+
+		switch segment[0] {
+		case ':':
+			name := segment[1:]
+			// Drop any constraint on the wildcard.
+			if i := strings.IndexAny(name, ":|"); i != -1 {
+				name = name[:i]
+			}
+			names = append(names, name)
+		case '*':
+			names = append(names, segment[1:])
+			catchAll = true
+		}
+	}
+	return names, catchAll
+}
+
+// orderParams converts a params map to Params, in the order of names.
+func orderParams(names []string, catchAll bool, params map[string]string) Params {
+	if len(names) == 0 {
+		return nil
+	}
+
+	ps := make(Params, len(names))
+	for i, name := range names {
+		ps[i] = Param{Key: name, Value: params[name]}
+	}
+	if catchAll {
+		ps[len(ps)-1].Value = "/" + ps[len(ps)-1].Value
+	}
+	return ps
+}
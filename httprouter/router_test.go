@@ -0,0 +1,115 @@
+//go:build go1.7
+// +build go1.7
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouterParams(t *testing.T) {
+	var seen Params
+	handle := func(w http.ResponseWriter, r *http.Request, ps Params) {
+		seen = ps
+	}
+
+	router := New()
+	router.GET("/users/:user/posts/:post", handle)
+	router.GET("/users/new", handle)
+	router.GET("/files/*filepath", handle)
+	router.Handler("GET", "/ctx/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = ParamsFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		path   string
+		expect Params
+	}{
+		{"/users/5/posts/6", Params{{"user", "5"}, {"post", "6"}}},
+		{"/users/new", nil},
+		{"/files/a/b.txt", Params{{"filepath", "/a/b.txt"}}},
+		{"/ctx/7", Params{{"id", "7"}}},
+	}
+
+	for _, test := range tests {
+		seen = Params{{"unset", ""}}
+		r := httptest.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || !reflect.DeepEqual(seen, test.expect) {
+			t.Errorf("Path %s expected params %v, saw %d %v", test.path, test.expect, w.Code, seen)
+		}
+	}
+
+	if v := seen.ByName("id"); v != "7" {
+		t.Errorf("Expected ByName to return 7, saw %q", v)
+	}
+
+	handleFound, ps, _ := router.Lookup("GET", "/files/x/y")
+	if handleFound == nil || !reflect.DeepEqual(ps, Params{{"filepath", "/x/y"}}) {
+		t.Fatalf("Expected Lookup to find the catch-all route, saw %v", ps)
+	}
+	seen = nil
+	handleFound(httptest.NewRecorder(), httptest.NewRequest("GET", "/files/x/y", nil), ps)
+	if !reflect.DeepEqual(seen, ps) {
+		t.Errorf("Expected the handle from Lookup to see %v, saw %v", ps, seen)
+	}
+
+	if handleFound, _, tsr := router.Lookup("GET", "/users/new/"); handleFound != nil || !tsr {
+		t.Error("Expected Lookup to report a trailing slash redirect")
+	}
+}
+
+func TestRouterErrorHandlers(t *testing.T) {
+	router := New()
+	router.GET("/path", func(w http.ResponseWriter, r *http.Request, ps Params) {})
+	router.GET("/panic", func(w http.ResponseWriter, r *http.Request, ps Params) {
+		panic("oops")
+	})
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := serve("POST", "/path"); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") == "" {
+		t.Errorf("Expected 405 with an Allow header, saw %d %v", w.Code, w.Header())
+	}
+	if w := serve("OPTIONS", "/path"); w.Code != http.StatusOK || w.Header().Get("Allow") == "" {
+		t.Errorf("Expected automatic OPTIONS response, saw %d %v", w.Code, w.Header())
+	}
+
+	router.HandleMethodNotAllowed = false
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	if w := serve("POST", "/path"); w.Code != http.StatusTeapot {
+		t.Errorf("Expected NotFound for wrong method when HandleMethodNotAllowed is false, saw %d", w.Code)
+	}
+	if w := serve("GET", "/missing"); w.Code != http.StatusTeapot {
+		t.Errorf("Expected custom NotFound, saw %d", w.Code)
+	}
+
+	var recovered interface{}
+	router.PanicHandler = func(w http.ResponseWriter, r *http.Request, err interface{}) {
+		recovered = err
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	if w := serve("GET", "/panic"); w.Code != http.StatusInternalServerError || recovered != "oops" {
+		t.Errorf("Expected PanicHandler to get the panic value, saw %d %v", w.Code, recovered)
+	}
+
+	router.PanicHandler = nil
+	func() {
+		defer func() {
+			if err := recover(); err != "oops" {
+				t.Errorf("Expected panic to propagate without a PanicHandler, saw %v", err)
+			}
+		}()
+		serve("GET", "/panic")
+	}()
+}
@@ -0,0 +1,104 @@
+package httptreemux
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HTTPSRedirect redirects requests that weren't made over HTTPS to the same URL with
+// the https scheme, so that a group of routes, such as those for logging in, is only
+// served over HTTPS. Its Middleware is added with Group.Use or With:
+//
+//	account := router.Group("/account")
+//	account.Use(httptreemux.HTTPSRedirect{TrustedProxies: []string{"10.0.0.0/8"}}.Middleware())
+//
+// A request was made over HTTPS if its connection used TLS, or if it comes from one of
+// TrustedProxies and its X-Forwarded-Proto header is https. The header is ignored for
+// requests from other clients, since it can be forged.
+type HTTPSRedirect struct {
+	// StatusCode is the status of the redirect. The default, when it is zero, is 301
+	// Moved Permanently for GET and HEAD requests, and 308 Permanent Redirect for
+	// others, so that their method and body are kept.
+	StatusCode int
+	// Port is the port of the redirect's URL. If it is empty, the URL has no port, so
+	// the default port of 443 is used.
+	Port string
+	// TrustedProxies lists the addresses of the proxies, as CIDR blocks or single
+	// addresses, whose X-Forwarded-Proto header is trusted.
+	TrustedProxies []string
+}
+
+// Middleware returns the middleware that redirects the requests. It panics if an
+// address in TrustedProxies can't be parsed.
+func (h HTTPSRedirect) Middleware() MiddlewareFunc {
+	middleware, err := h.MiddlewareErr()
+	if err != nil {
+		panic(err)
+	}
+	return middleware
+}
+
+// MiddlewareErr is like Middleware, but returns an error instead of panicking if an
+// address can't be parsed.
+func (h HTTPSRedirect) MiddlewareErr() (MiddlewareFunc, error) {
+	trusted, err := parseIPNets(h.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			if isHTTPS(r, trusted) {
+				next(w, r, params)
+				return
+			}
+
+			host := r.Host
+			if hostname, _, err := net.SplitHostPort(host); err == nil {
+				host = hostname
+				if strings.IndexByte(host, ':') != -1 {
+					// Put the brackets back around an IPv6 address.
+					host = "[" + host + "]"
+				}
+			}
+			if h.Port != "" {
+				host += ":" + h.Port
+			}
+
+			statusCode := h.StatusCode
+			if statusCode == 0 {
+				statusCode = http.StatusMovedPermanently
+				if r.Method != "GET" && r.Method != "HEAD" {
+					// http.StatusPermanentRedirect needs Go 1.7.
+					statusCode = 308
+				}
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), statusCode)
+		}
+	}, nil
+}
+
+// isHTTPS reports whether the request was made over HTTPS, trusting the
+// X-Forwarded-Proto header of requests from the trusted proxies.
+func isHTTPS(r *http.Request, trusted []*net.IPNet) bool {
+	if r.TLS != nil {
+		return true
+	}
+	proto := r.Header.Get("X-Forwarded-Proto")
+	if proto == "" || len(trusted) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !containsIP(trusted, ip) {
+		return false
+	}
+	// Take the scheme that the first proxy saw, if several have added to the header.
+	if comma := strings.IndexByte(proto, ','); comma != -1 {
+		proto = proto[:comma]
+	}
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
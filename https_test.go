@@ -0,0 +1,67 @@
+package httptreemux
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	router := New()
+	router.GET("/", simpleHandler)
+	account := router.Group("/account")
+	account.Use(HTTPSRedirect{TrustedProxies: []string{"10.0.0.0/8"}}.Middleware())
+	account.GET("/login", simpleHandler)
+	account.POST("/login", simpleHandler)
+	router.With(HTTPSRedirect{StatusCode: http.StatusFound, Port: "8443"}.Middleware()).GET("/pay", simpleHandler)
+
+	tests := []struct {
+		method     string
+		url        string
+		host       string
+		remoteAddr string
+		proto      string
+		tls        bool
+		code       int
+		location   string
+	}{
+		{"GET", "/account/login?next=%2F", "example.com", "198.51.100.1:1234", "", false,
+			http.StatusMovedPermanently, "https://example.com/account/login?next=%2F"},
+		{"POST", "/account/login", "example.com:8080", "198.51.100.1:1234", "", false,
+			308, "https://example.com/account/login"},
+		{"GET", "/account/login", "[::1]:8080", "198.51.100.1:1234", "", false,
+			http.StatusMovedPermanently, "https://[::1]/account/login"},
+		{"GET", "/account/login", "example.com", "198.51.100.1:1234", "", true, http.StatusOK, ""},
+		{"GET", "/account/login", "example.com", "10.0.0.1:1234", "https", false, http.StatusOK, ""},
+		{"GET", "/account/login", "example.com", "10.0.0.1:1234", "http", false,
+			http.StatusMovedPermanently, "https://example.com/account/login"},
+		// The header is ignored from clients that aren't trusted proxies.
+		{"GET", "/account/login", "example.com", "198.51.100.1:1234", "https", false,
+			http.StatusMovedPermanently, "https://example.com/account/login"},
+		{"GET", "/pay", "example.com:8080", "10.0.0.1:1234", "https", false,
+			http.StatusFound, "https://example.com:8443/pay"},
+		{"GET", "/", "example.com", "198.51.100.1:1234", "", false, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.url, nil)
+		r.Host = test.host
+		r.RemoteAddr = test.remoteAddr
+		if test.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", test.proto)
+		}
+		if test.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("%s %s on %s expected %d to %q, saw %d to %q", test.method, test.url, test.host,
+				test.code, test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	if _, err := (HTTPSRedirect{TrustedProxies: []string{"proxy"}}).MiddlewareErr(); err == nil {
+		t.Error("Expected an error for an invalid proxy address")
+	}
+}
@@ -0,0 +1,145 @@
+package httptreemux
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPAccess restricts the routes of a group, or a single route, to clients with certain
+// IP addresses, such as for admin endpoints that should only be reachable from an
+// internal network. Its Middleware is added with Group.Use or With:
+//
+//	admin := router.Group("/admin")
+//	admin.Use(httptreemux.IPAccess{Allow: []string{"10.0.0.0/8"}}.Middleware())
+//
+// Requests from addresses in Deny, or not in Allow when it isn't empty, get a 403
+// Forbidden response. The client's address is that of the connection, unless the
+// connection comes from one of TrustedProxies. Then it is taken from the
+// X-Forwarded-For header, as the last address in it that isn't a trusted proxy, or from
+// X-Real-IP if there is no X-Forwarded-For header. Headers from other clients are
+// ignored, since they can be forged.
+type IPAccess struct {
+	// Allow lists the addresses that are allowed, as CIDR blocks such as 10.0.0.0/8 or
+	// single addresses. If it is empty, every address that isn't denied is allowed.
+	Allow []string
+	// Deny lists the addresses that are denied, even if they are in Allow.
+	Deny []string
+	// TrustedProxies lists the addresses of the proxies whose forwarding headers are
+	// trusted.
+	TrustedProxies []string
+	// Forbidden writes the response for requests that aren't allowed. The default
+	// writes the status text.
+	Forbidden HandlerFunc
+}
+
+// Middleware returns the middleware that checks the addresses. It panics if an address
+// can't be parsed.
+func (a IPAccess) Middleware() MiddlewareFunc {
+	middleware, err := a.MiddlewareErr()
+	if err != nil {
+		panic(err)
+	}
+	return middleware
+}
+
+// MiddlewareErr is like Middleware, but returns an error instead of panicking if an
+// address can't be parsed.
+func (a IPAccess) MiddlewareErr() (MiddlewareFunc, error) {
+	allow, err := parseIPNets(a.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseIPNets(a.Deny)
+	if err != nil {
+		return nil, err
+	}
+	trusted, err := parseIPNets(a.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	forbidden := a.Forbidden
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			ip := clientIP(r, trusted)
+			if ip != nil && !containsIP(deny, ip) && (len(allow) == 0 || containsIP(allow, ip)) {
+				next(w, r, params)
+				return
+			}
+			if forbidden != nil {
+				forbidden(w, r, params)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		}
+	}, nil
+}
+
+// parseIPNets parses a list of CIDR blocks and single addresses.
+func parseIPNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if strings.IndexByte(entry, '/') == -1 {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid IP address %s", entry)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CIDR block %s", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// containsIP reports whether one of the networks contains the address.
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client that sent the request, using the
+// forwarding headers if the connection is from a trusted proxy. It returns nil if the
+// address can't be parsed.
+func clientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(trusted, ip) {
+		return ip
+	}
+
+	forwarded := r.Header["X-Forwarded-For"]
+	if len(forwarded) == 0 {
+		if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+			return realIP
+		}
+		return ip
+	}
+
+	// Each proxy appends the address it got the request from, so the last address that
+	// wasn't added by a trusted proxy is the client's.
+	addresses := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(addresses) - 1; i >= 0; i-- {
+		ip = net.ParseIP(strings.TrimSpace(addresses[i]))
+		if ip == nil || !containsIP(trusted, ip) {
+			return ip
+		}
+	}
+	return ip
+}
@@ -0,0 +1,66 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPAccess(t *testing.T) {
+	router := New()
+	admin := router.Group("/admin")
+	admin.Use(IPAccess{
+		Allow:          []string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.7"},
+		Deny:           []string{"10.0.0.66"},
+		TrustedProxies: []string{"172.16.0.0/12"},
+	}.Middleware())
+	admin.GET("/", simpleHandler)
+	router.With(IPAccess{Deny: []string{"203.0.113.0/24"}}.Middleware()).GET("/public", simpleHandler)
+
+	tests := []struct {
+		path       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		code       int
+	}{
+		{"/admin/", "10.1.2.3:1234", "", "", http.StatusOK},
+		{"/admin/", "[2001:db8::1]:1234", "", "", http.StatusOK},
+		{"/admin/", "192.0.2.7:1234", "", "", http.StatusOK},
+		{"/admin/", "192.0.2.8:1234", "", "", http.StatusForbidden},
+		{"/admin/", "10.0.0.66:1234", "", "", http.StatusForbidden},
+		// Forwarding headers from untrusted clients are ignored.
+		{"/admin/", "198.51.100.1:1234", "10.1.2.3", "", http.StatusForbidden},
+		{"/admin/", "172.16.0.1:1234", "10.1.2.3", "", http.StatusOK},
+		{"/admin/", "172.16.0.1:1234", "10.1.2.3, 198.51.100.1", "", http.StatusForbidden},
+		{"/admin/", "172.16.0.1:1234", "198.51.100.1, 10.1.2.3, 172.16.0.2", "", http.StatusOK},
+		{"/admin/", "172.16.0.1:1234", "", "10.1.2.3", http.StatusOK},
+		{"/admin/", "172.16.0.1:1234", "", "", http.StatusForbidden},
+		{"/admin/", "garbage", "", "", http.StatusForbidden},
+		{"/public", "198.51.100.1:1234", "", "", http.StatusOK},
+		{"/public", "203.0.113.9:1234", "", "", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if test.realIP != "" {
+			r.Header.Set("X-Real-IP", test.realIP)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s from %s forwarded for %q expected %d, saw %d", test.path, test.remoteAddr,
+				test.forwarded, test.code, w.Code)
+		}
+	}
+
+	if _, err := (IPAccess{Allow: []string{"10.0.0.0/33"}}).MiddlewareErr(); err == nil {
+		t.Error("Expected an error for an invalid CIDR block")
+	}
+	if _, err := (IPAccess{Deny: []string{"localhost"}}).MiddlewareErr(); err == nil {
+		t.Error("Expected an error for an invalid address")
+	}
+}
@@ -0,0 +1,301 @@
+package httptreemux
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// withClaims returns the request with the claims of its token added to its context. It
+// is nil when the context package is not available.
+var withClaims func(r *http.Request, claims map[string]interface{}) *http.Request
+
+// ScopesMetaKey is the metadata key under which Route.Require stores the scopes that a
+// route requires, as a []string.
+const ScopesMetaKey = "scopes"
+
+// Require returns a group with the same path and middleware as this one, whose routes
+// need a token with all of the scopes, as with Route.Require. The scopes are set as each
+// route is added, so the routes are never served without them, even while the router
+// is serving requests. Calling Require again adds to the scopes.
+//
+//	orders := router.Group("/orders").Require("orders:read")
+//	orders.GET("/:id", getOrder)
+//	orders.Require("orders:write").POST("/:id/cancel", cancelOrder)
+func (g *Group) Require(scopes ...string) *Group {
+	existing, _ := g.settings.meta[ScopesMetaKey].([]string)
+	required := make([]string, 0, len(existing)+len(scopes))
+	required = append(required, existing...)
+	required = append(required, scopes...)
+	return g.withMeta(ScopesMetaKey, required)
+}
+
+// Require marks the route as needing a token with all of the scopes, which
+// TreeMux.JWT checks before the handler or its middleware is called. With no scopes,
+// any valid token is enough. Calling Require again adds to the scopes. The scopes are
+// stored in the route's metadata under ScopesMetaKey, so they are listed by WalkRoutes
+// and RoutesHandler.
+//
+// The route is served without the scopes until Require returns. When routes are added
+// while the router is serving requests, use Group.Require instead, which sets them as
+// the route is added.
+//
+//	router.POST("/orders", createOrder).Require("orders:write")
+func (r *Route) Require(scopes ...string) *Route {
+	changed := false
+	// This is deferred before the mutex is unlocked, so that it runs afterwards.
+	defer func() {
+		if changed {
+			r.mux.routeChanged(r)
+		}
+	}()
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	existing, _ := r.meta[ScopesMetaKey].([]string)
+	required := make([]string, 0, len(existing)+len(scopes))
+	required = append(required, existing...)
+	required = append(required, scopes...)
+	changed = r.setMeta(ScopesMetaKey, required) == nil
+	return r
+}
+
+// TokenValidator checks a bearer token and returns its claims, for JWTAuth.
+// JWTValidator validates JWTs signed with HS256 or RS256; implement it to use another
+// JWT package or an introspection endpoint.
+type TokenValidator interface {
+	ValidateToken(token string) (claims map[string]interface{}, err error)
+}
+
+// JWTAuth checks the bearer tokens of requests for the routes that call Route.Require.
+// Set TreeMux.JWT to use it. Routes that don't call Require aren't checked.
+//
+// A request without a valid token gets a 401 Unauthorized response, and one whose
+// token lacks a required scope gets a 403 Forbidden response, each with a
+// WWW-Authenticate header. The scopes of a token are taken from its scope claim, a
+// space-separated string, or from its scp or scopes claim, which may also be an array.
+// The claims of an accepted token are stored in the request's context, where
+// ContextClaims retrieves them.
+type JWTAuth struct {
+	// Validator checks the tokens.
+	Validator TokenValidator
+	// Token returns the token of the request. The default takes it from an
+	// Authorization header with the Bearer scheme.
+	Token func(r *http.Request) string
+	// Unauthorized writes the response for requests without a valid token. The
+	// WWW-Authenticate header is set before it is called. The default writes the
+	// status text.
+	Unauthorized HandlerFunc
+	// Forbidden writes the response for requests whose token lacks a required scope.
+	// The WWW-Authenticate header is set before it is called. The default writes the
+	// status text.
+	Forbidden HandlerFunc
+}
+
+// authorize checks the request's token for the scopes, and writes the error response if
+// it isn't allowed. It returns the request with the token's claims in its context, and
+// whether it is allowed. With no JWTAuth, no request is allowed, so that routes that
+// require scopes aren't left open by mistake.
+func (a *JWTAuth) authorize(w http.ResponseWriter, r *http.Request, params map[string]string,
+	scopes []string) (*http.Request, bool) {
+
+	var token string
+	if a != nil && a.Token != nil {
+		token = a.Token(r)
+	} else {
+		token = bearerToken(r)
+	}
+
+	var claims map[string]interface{}
+	err := errors.New("No token")
+	if token != "" && a != nil && a.Validator != nil {
+		claims, err = a.Validator.ValidateToken(token)
+	}
+	if err != nil {
+		challenge := "Bearer"
+		if token != "" {
+			challenge += ` error="invalid_token"`
+		}
+		w.Header().Set("WWW-Authenticate", challenge)
+		if a != nil && a.Unauthorized != nil {
+			a.Unauthorized(w, r, params)
+		} else {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		}
+		return r, false
+	}
+
+	granted := tokenScopes(claims)
+	for _, scope := range scopes {
+		if !containsString(granted, scope) {
+			w.Header().Set("WWW-Authenticate",
+				`Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+			if a.Forbidden != nil {
+				a.Forbidden(w, r, params)
+			} else {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			}
+			return r, false
+		}
+	}
+
+	if withClaims != nil {
+		r = withClaims(r, claims)
+	}
+	return r, true
+}
+
+// bearerToken returns the token from the request's Authorization header, or an empty
+// string if it doesn't have one with the Bearer scheme.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// tokenScopes returns the scopes granted by a token's claims.
+func tokenScopes(claims map[string]interface{}) []string {
+	for _, name := range []string{"scope", "scp", "scopes"} {
+		switch value := claims[name].(type) {
+		case string:
+			return strings.Fields(value)
+		case []interface{}:
+			scopes := make([]string, 0, len(value))
+			for _, v := range value {
+				if s, ok := v.(string); ok {
+					scopes = append(scopes, s)
+				}
+			}
+			return scopes
+		}
+	}
+	return nil
+}
+
+// JWTValidator is a TokenValidator for JWTs signed with HS256, using Secret, or RS256,
+// using PublicKey. Tokens signed with any other algorithm are rejected. The exp and nbf
+// claims are checked when present, and so are iss and aud when Issuer and Audience are
+// set.
+type JWTValidator struct {
+	// Secret is the key for tokens signed with HS256.
+	Secret []byte
+	// PublicKey is the key for tokens signed with RS256.
+	PublicKey *rsa.PublicKey
+	// Issuer, if set, must match the token's iss claim.
+	Issuer string
+	// Audience, if set, must be the token's aud claim or one of its values.
+	Audience string
+	// Leeway is the clock skew allowed when checking exp and nbf.
+	Leeway time.Duration
+}
+
+// ValidateToken implements TokenValidator.
+func (v *JWTValidator) ValidateToken(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, errors.New("Malformed token signature")
+	}
+
+	signed := parts[0] + "." + parts[1]
+	switch {
+	case header.Alg == "HS256" && v.Secret != nil:
+		mac := hmac.New(sha256.New, v.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("Invalid token signature")
+		}
+	case header.Alg == "RS256" && v.PublicKey != nil:
+		digest := sha256.Sum256([]byte(signed))
+		if rsa.VerifyPKCS1v15(v.PublicKey, crypto.SHA256, digest[:], signature) != nil {
+			return nil, errors.New("Invalid token signature")
+		}
+	default:
+		return nil, errors.New("Unsupported token algorithm " + header.Alg)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && now.Add(-v.Leeway).After(unixTime(exp)) {
+		return nil, errors.New("Token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.Leeway).Before(unixTime(nbf)) {
+		return nil, errors.New("Token is not valid yet")
+	}
+	if v.Issuer != "" && claims["iss"] != v.Issuer {
+		return nil, errors.New("Token has the wrong issuer")
+	}
+	if v.Audience != "" && !hasAudience(claims["aud"], v.Audience) {
+		return nil, errors.New("Token has the wrong audience")
+	}
+	return claims, nil
+}
+
+// decodeTokenPart decodes the base64url-encoded JSON of a part of a JWT into v.
+func decodeTokenPart(part string, v interface{}) error {
+	data, err := decodeSegment(part)
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		return errors.New("Malformed token")
+	}
+	return nil
+}
+
+// decodeSegment decodes a part of a JWT, which is base64url-encoded without padding.
+// The padding is added back so that base64.URLEncoding can decode it, since
+// base64.RawURLEncoding needs Go 1.5.
+func decodeSegment(segment string) ([]byte, error) {
+	if strings.IndexByte(segment, '=') != -1 {
+		return nil, errors.New("Padded token segment")
+	}
+	if n := len(segment) % 4; n != 0 {
+		segment += strings.Repeat("=", 4-n)
+	}
+	return base64.URLEncoding.DecodeString(segment)
+}
+
+// unixTime converts a NumericDate claim to a time.
+func unixTime(seconds float64) time.Time {
+	return time.Unix(int64(seconds), 0)
+}
+
+// hasAudience reports whether the aud claim, a string or an array of them, contains the
+// audience.
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
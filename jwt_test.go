@@ -0,0 +1,170 @@
+package httptreemux
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// encodeSegment encodes a part of a JWT, without the padding that JWTs leave out.
+func encodeSegment(data []byte) string {
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(data), "=")
+}
+
+// signToken returns a JWT with the claims, signed with HS256 using the secret, or with
+// RS256 if key is not nil.
+func signToken(claims map[string]interface{}, secret []byte, key *rsa.PrivateKey) string {
+	alg := "HS256"
+	if key != nil {
+		alg = "RS256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := encodeSegment(header) + "." + encodeSegment(payload)
+
+	var signature []byte
+	if key != nil {
+		digest := sha256.Sum256([]byte(signed))
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	} else {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	}
+	return signed + "." + encodeSegment(signature)
+}
+
+func TestJWTAuth(t *testing.T) {
+	secret := []byte("secret")
+	router := New()
+	router.JWT = &JWTAuth{
+		Validator: &JWTValidator{Secret: secret, Issuer: "issuer", Audience: "api"},
+		Forbidden: func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("missing scope"))
+		},
+	}
+	router.GET("/orders", simpleHandler).Require("orders:read")
+	router.POST("/orders", simpleHandler).Require("orders:read").Require("orders:write")
+	router.GET("/me", simpleHandler).Require()
+	router.GET("/public", simpleHandler)
+	router.AddHooks(Hooks{
+		OnRouteAdded: func(route RouteInfo) {
+			// Group.Require sets the scopes as the route is added.
+			r, _ := http.NewRequest(route.Method, route.Pattern, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected %s to require a token once added, saw %d", route.Pattern, w.Code)
+			}
+		},
+	})
+	admin := router.Group("/admin").Require("admin")
+	admin.GET("/users", simpleHandler)
+	admin.Require("admin:write").DELETE("/users/:id", simpleHandler)
+
+	future := float64(time.Now().Add(time.Hour).Unix())
+	valid := func(claims map[string]interface{}) map[string]interface{} {
+		claims["iss"] = "issuer"
+		claims["aud"] = []string{"web", "api"}
+		claims["exp"] = future
+		return claims
+	}
+	readToken := signToken(valid(map[string]interface{}{"scope": "orders:read profile"}), secret, nil)
+	writeToken := signToken(valid(map[string]interface{}{"scp": []string{"orders:read", "orders:write"}}), secret, nil)
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		token     string
+		code      int
+		challenge string
+	}{
+		{"read", "GET", "/orders", readToken, http.StatusOK, ""},
+		{"write", "POST", "/orders", writeToken, http.StatusOK, ""},
+		{"missing scope", "POST", "/orders", readToken, http.StatusForbidden,
+			`Bearer error="insufficient_scope", scope="orders:read orders:write"`},
+		{"no token", "GET", "/orders", "", http.StatusUnauthorized, "Bearer"},
+		{"no scopes", "GET", "/me", readToken, http.StatusOK, ""},
+		{"public", "GET", "/public", "", http.StatusOK, ""},
+		{"group scope", "GET", "/admin/users", readToken, http.StatusForbidden,
+			`Bearer error="insufficient_scope", scope="admin"`},
+		{"added group scope", "DELETE", "/admin/users/1", readToken, http.StatusForbidden,
+			`Bearer error="insufficient_scope", scope="admin admin:write"`},
+		{"wrong secret", "GET", "/me", signToken(valid(map[string]interface{}{}), []byte("other"), nil),
+			http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"expired", "GET", "/me", signToken(map[string]interface{}{"iss": "issuer", "aud": "api", "exp": 1000}, secret, nil),
+			http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"wrong audience", "GET", "/me", signToken(map[string]interface{}{"iss": "issuer", "aud": "web"}, secret, nil),
+			http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"garbage", "GET", "/me", "not.a.token", http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"padded", "GET", "/me", readToken + "=", http.StatusUnauthorized, `Bearer error="invalid_token"`},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("WWW-Authenticate") != test.challenge {
+			t.Errorf("%s: expected %d with challenge %q, saw %d with %q", test.name, test.code, test.challenge,
+				w.Code, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	var scopes []string
+	router.WalkRoutes(func(route RouteInfo) bool {
+		if route.Method == "POST" {
+			scopes, _ = route.Meta[ScopesMetaKey].([]string)
+		}
+		return true
+	})
+	if expected := []string{"orders:read", "orders:write"}; !reflect.DeepEqual(scopes, expected) {
+		t.Errorf("Expected scopes %v from WalkRoutes, saw %v", expected, scopes)
+	}
+
+	// Without a JWTAuth, routes that require scopes are closed.
+	router.JWT = nil
+	r, _ := http.NewRequest("GET", "/orders", nil)
+	r.Header.Set("Authorization", "Bearer "+readToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a JWTAuth, saw %d", w.Code)
+	}
+}
+
+func TestJWTValidatorRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator := &JWTValidator{PublicKey: &key.PublicKey, Secret: []byte("secret")}
+
+	claims, err := validator.ValidateToken(signToken(map[string]interface{}{"sub": "user"}, nil, key))
+	if err != nil || claims["sub"] != "user" {
+		t.Errorf("Expected the RS256 token to be valid, saw %v, %v", claims, err)
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := validator.ValidateToken(signToken(map[string]interface{}{}, nil, other)); err == nil {
+		t.Error("Expected a token signed with another key to be rejected")
+	}
+	none := encodeSegment([]byte(`{"alg":"none"}`)) + "." +
+		encodeSegment([]byte(`{}`)) + "."
+	if _, err := validator.ValidateToken(none); err == nil {
+		t.Error("Expected an unsigned token to be rejected")
+	}
+}
@@ -0,0 +1,260 @@
+//go:build go1.7
+// +build go1.7
+
+package httptreemux
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// lambdaEvent holds the members of the API Gateway REST API, API Gateway HTTP API, and
+// Application Load Balancer events that are needed to build a request.
+type lambdaEvent struct {
+	// Version is "2.0" for HTTP API events that use the 2.0 payload format.
+	Version string `json:"version"`
+
+	// REST API and ALB events.
+	HTTPMethod                      string              `json:"httpMethod"`
+	Path                            string              `json:"path"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+
+	// HTTP API events.
+	RawPath        string   `json:"rawPath"`
+	RawQueryString string   `json:"rawQueryString"`
+	Cookies        []string `json:"cookies"`
+
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+
+	RequestContext struct {
+		// REST API events.
+		Identity struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+		// HTTP API events.
+		HTTP struct {
+			Method   string `json:"method"`
+			SourceIP string `json:"sourceIp"`
+		} `json:"http"`
+		// ALB events.
+		ELB *struct {
+			TargetGroupArn string `json:"targetGroupArn"`
+		} `json:"elb"`
+	} `json:"requestContext"`
+}
+
+// LambdaResponse is the response to an API Gateway or Application Load Balancer event,
+// returned by ServeLambda. Only the members used by the kind of event that was served
+// are set.
+type LambdaResponse struct {
+	StatusCode int `json:"statusCode"`
+	// StatusDescription is set for ALB events, such as "200 OK".
+	StatusDescription string              `json:"statusDescription,omitempty"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	// Cookies holds the Set-Cookie headers for HTTP API events.
+	Cookies         []string `json:"cookies,omitempty"`
+	Body            string   `json:"body"`
+	IsBase64Encoded bool     `json:"isBase64Encoded"`
+}
+
+// ServeLambda serves an AWS Lambda event from API Gateway or an Application Load
+// Balancer, so that the same routes can be served by Lambda and by a regular server.
+// REST API and HTTP API proxy events are supported, using either payload format for
+// HTTP APIs, as are ALB target group events with or without multi-value headers.
+// ServeLambda has the signature of a handler for lambda.Start from
+// github.com/aws/aws-lambda-go, without depending on it:
+//
+//	lambda.Start(router.ServeLambda)
+//
+// The event is converted to an http.Request, which is served by ServeHTTP with the
+// context ctx, and the response is converted to the form expected for the event.
+// Response bodies that aren't valid UTF-8 are base64 encoded.
+func (t *TreeMux) ServeLambda(ctx context.Context, event json.RawMessage) (*LambdaResponse, error) {
+	var e lambdaEvent
+	if err := json.Unmarshal(event, &e); err != nil {
+		return nil, fmt.Errorf("Invalid Lambda event: %s", err)
+	}
+
+	r, err := e.request()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &lambdaResponseWriter{header: make(http.Header)}
+	t.ServeHTTP(w, r.WithContext(ctx))
+	return e.response(w), nil
+}
+
+// request builds the http.Request for the event.
+func (e *lambdaEvent) request() (*http.Request, error) {
+	var method, uri, remoteAddr string
+	header := make(http.Header)
+	switch {
+	case e.Version == "2.0":
+		method = e.RequestContext.HTTP.Method
+		uri = e.RawPath
+		if e.RawQueryString != "" {
+			uri += "?" + e.RawQueryString
+		}
+		remoteAddr = e.RequestContext.HTTP.SourceIP
+		if len(e.Cookies) != 0 {
+			header.Set("Cookie", strings.Join(e.Cookies, "; "))
+		}
+
+	case e.RequestContext.ELB != nil:
+		// ALBs pass the path and query parameters as they appeared in the request.
+		method = e.HTTPMethod
+		uri = e.Path
+		var query []string
+		if e.MultiValueQueryStringParameters != nil {
+			for key, values := range e.MultiValueQueryStringParameters {
+				for _, value := range values {
+					query = append(query, key+"="+value)
+				}
+			}
+		} else {
+			for key, value := range e.QueryStringParameters {
+				query = append(query, key+"="+value)
+			}
+		}
+		if len(query) != 0 {
+			sort.Strings(query)
+			uri += "?" + strings.Join(query, "&")
+		}
+
+	default:
+		// REST APIs pass the path and query parameters decoded.
+		method = e.HTTPMethod
+		uri = (&url.URL{Path: e.Path}).EscapedPath()
+		query := make(url.Values)
+		if e.MultiValueQueryStringParameters != nil {
+			for key, values := range e.MultiValueQueryStringParameters {
+				query[key] = values
+			}
+		} else {
+			for key, value := range e.QueryStringParameters {
+				query.Set(key, value)
+			}
+		}
+		if len(query) != 0 {
+			uri += "?" + query.Encode()
+		}
+		remoteAddr = e.RequestContext.Identity.SourceIP
+	}
+
+	if e.MultiValueHeaders != nil {
+		for key, values := range e.MultiValueHeaders {
+			for _, value := range values {
+				header.Add(key, value)
+			}
+		}
+	} else {
+		for key, value := range e.Headers {
+			header.Set(key, value)
+		}
+	}
+
+	body := []byte(e.Body)
+	if e.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(e.Body); err != nil {
+			return nil, fmt.Errorf("Invalid base64 body in Lambda event: %s", err)
+		}
+	}
+
+	r, err := http.NewRequest(method, uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid request in Lambda event: %s", err)
+	}
+	r.RequestURI = uri
+	r.Header = header
+	r.Host = header.Get("Host")
+	r.RemoteAddr = remoteAddr
+	return r, nil
+}
+
+// response converts the recorded response to the form expected for the event.
+func (e *lambdaEvent) response(w *lambdaResponseWriter) *LambdaResponse {
+	resp := &LambdaResponse{StatusCode: w.statusCode()}
+
+	body := w.body.Bytes()
+	if utf8.Valid(body) {
+		resp.Body = string(body)
+	} else {
+		resp.Body = base64.StdEncoding.EncodeToString(body)
+		resp.IsBase64Encoded = true
+	}
+
+	switch {
+	case e.Version == "2.0":
+		resp.Headers = make(map[string]string, len(w.header))
+		for key, values := range w.header {
+			if key == "Set-Cookie" {
+				resp.Cookies = values
+			} else {
+				resp.Headers[key] = strings.Join(values, ",")
+			}
+		}
+
+	case e.RequestContext.ELB != nil:
+		resp.StatusDescription = strconv.Itoa(resp.StatusCode) + " " + http.StatusText(resp.StatusCode)
+		// The response must use multi-value headers if and only if the request did.
+		if e.MultiValueHeaders != nil {
+			resp.MultiValueHeaders = w.header
+		} else {
+			resp.Headers = make(map[string]string, len(w.header))
+			for key, values := range w.header {
+				resp.Headers[key] = values[len(values)-1]
+			}
+		}
+
+	default:
+		resp.MultiValueHeaders = w.header
+	}
+	return resp
+}
+
+// lambdaResponseWriter records the response to a Lambda event.
+type lambdaResponseWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (w *lambdaResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *lambdaResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *lambdaResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *lambdaResponseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,115 @@
+//go:build go1.7
+// +build go1.7
+
+package httptreemux
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestServeLambda(t *testing.T) {
+	router := New()
+	router.POST("/users/:name", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Add("X-Tag", "a")
+		w.Header().Add("X-Tag", "b")
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(params["name"] + " " + r.URL.Query().Get("q") + " " + r.Host + " " +
+			r.Header.Get("Cookie") + " " + string(body)))
+	})
+	router.GET("/binary", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.Write([]byte{0xff, 0xfe})
+	})
+
+	tests := []struct {
+		desc     string
+		event    string
+		expected LambdaResponse
+	}{
+		{
+			"REST API",
+			`{"httpMethod": "POST", "path": "/users/a b",
+				"multiValueQueryStringParameters": {"q": ["x&y"]},
+				"multiValueHeaders": {"Host": ["example.com"], "Cookie": ["c=1"]},
+				"body": "aGk=", "isBase64Encoded": true,
+				"requestContext": {"identity": {"sourceIp": "1.2.3.4"}}}`,
+			LambdaResponse{
+				StatusCode: http.StatusCreated,
+				MultiValueHeaders: map[string][]string{
+					"X-Tag":      {"a", "b"},
+					"Set-Cookie": {"session=1"},
+				},
+				Body: "a b x&y example.com c=1 hi",
+			},
+		},
+		{
+			"HTTP API",
+			`{"version": "2.0", "rawPath": "/users/a%20b", "rawQueryString": "q=x%26y",
+				"cookies": ["c=1", "d=2"], "headers": {"host": "example.com"}, "body": "hi",
+				"requestContext": {"http": {"method": "POST", "sourceIp": "1.2.3.4"}}}`,
+			LambdaResponse{
+				StatusCode: http.StatusCreated,
+				Headers:    map[string]string{"X-Tag": "a,b"},
+				Cookies:    []string{"session=1"},
+				Body:       "a b x&y example.com c=1; d=2 hi",
+			},
+		},
+		{
+			"ALB",
+			`{"httpMethod": "POST", "path": "/users/a%20b", "queryStringParameters": {"q": "x%26y"},
+				"headers": {"host": "example.com"}, "body": "hi",
+				"requestContext": {"elb": {"targetGroupArn": "arn"}}}`,
+			LambdaResponse{
+				StatusCode:        http.StatusCreated,
+				StatusDescription: "201 Created",
+				Headers:           map[string]string{"X-Tag": "b", "Set-Cookie": "session=1"},
+				Body:              "a b x&y example.com  hi",
+			},
+		},
+		{
+			"ALB with multi-value headers",
+			`{"httpMethod": "GET", "path": "/missing", "multiValueHeaders": {},
+				"requestContext": {"elb": {"targetGroupArn": "arn"}}}`,
+			LambdaResponse{
+				StatusCode:        http.StatusNotFound,
+				StatusDescription: "404 Not Found",
+				MultiValueHeaders: map[string][]string{
+					"Content-Type":           {"text/plain; charset=utf-8"},
+					"X-Content-Type-Options": {"nosniff"},
+				},
+				Body: "404 page not found\n",
+			},
+		},
+		{
+			"binary body",
+			`{"httpMethod": "GET", "path": "/binary"}`,
+			LambdaResponse{
+				StatusCode:        http.StatusOK,
+				MultiValueHeaders: map[string][]string{},
+				Body:              "//4=",
+				IsBase64Encoded:   true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		resp, err := router.ServeLambda(context.Background(), json.RawMessage(test.event))
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(*resp, test.expected) {
+			t.Errorf("%s: expected response\n%+v\nsaw\n%+v", test.desc, test.expected, *resp)
+		}
+	}
+
+	if _, err := router.ServeLambda(context.Background(), json.RawMessage(`[`)); err == nil {
+		t.Error("Expected error for invalid event")
+	}
+}
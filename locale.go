@@ -0,0 +1,137 @@
+package httptreemux
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// LocaleParam is the name of the param that holds the locale at the start of a
+// request's path, when TreeMux.Locales is set.
+const LocaleParam = "locale"
+
+// Locales lets the paths of requests start with a locale, such as /en/about or
+// /fr-CA/about, without a copy of the routes for each locale. Set it as
+// TreeMux.Locales. When the first segment of a path is one of the supported locales,
+// the route is looked up without it, and the locale is passed to the handler in the
+// locale param. If no route matches the path without the locale, the whole path is
+// looked up instead, so routes such as /api/status can be served without one.
+type Locales struct {
+	// Supported lists the locales, such as en and fr-CA. They are matched without
+	// regard to case, and passed to handlers as they are written here.
+	Supported []string
+	// Default is the locale that Redirect uses when the Accept-Language header of a
+	// request doesn't match any of the supported locales. If it is empty, the first of
+	// Supported is used.
+	Default string
+	// Redirect, if true, redirects GET and HEAD requests whose path doesn't start with a
+	// locale, but matches a route, to the same path with the locale that best matches
+	// their Accept-Language header. The redirect uses status 302, since the locale
+	// depends on the client.
+	Redirect bool
+}
+
+// split returns the locale at the start of the path and the rest of the path, or an
+// empty locale if the path doesn't start with one.
+func (l *Locales) split(path string) (string, string) {
+	if len(path) < 2 || path[0] != '/' {
+		return "", path
+	}
+	segment, rest := path[1:], "/"
+	if slash := strings.IndexByte(segment, '/'); slash != -1 {
+		segment, rest = segment[:slash], segment[slash:]
+	}
+	for _, locale := range l.Supported {
+		if strings.EqualFold(locale, segment) {
+			return locale, rest
+		}
+	}
+	return "", path
+}
+
+// redirect returns the result for a redirect to the path with a locale, if the request
+// should be redirected, and otherwise lr.
+func (l *Locales) redirect(w http.ResponseWriter, r *http.Request, lr LookupResult) LookupResult {
+	if lr.StatusCode != http.StatusOK || (r.Method != "GET" && r.Method != "HEAD") {
+		return lr
+	}
+	if locale, _ := l.split(r.URL.Path); locale != "" {
+		return lr
+	}
+	locale := l.negotiate(r.Header.Get("Accept-Language"))
+	if locale == "" {
+		return lr
+	}
+
+	w.Header().Add("Vary", "Accept-Language")
+	path := "/" + locale
+	if r.URL.Path != "/" {
+		path += r.URL.Path
+	}
+	return LookupResult{StatusCode: http.StatusFound, RedirectPath: path}
+}
+
+// negotiate returns the supported locale that best matches the Accept-Language header.
+// A language range matches a locale exactly, or by its language alone, so fr matches
+// fr-CA and fr-FR matches fr.
+func (l *Locales) negotiate(acceptLanguage string) string {
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, quality := part, 1.0
+		if i := strings.IndexByte(part, ';'); i != -1 {
+			tag = part[:i]
+			if q := strings.TrimSpace(part[i+1:]); strings.HasPrefix(q, "q=") {
+				if parsed, err := strconv.ParseFloat(q[2:], 64); err == nil {
+					quality = parsed
+				}
+			}
+		}
+		// The earlier of two ranges with the same quality wins.
+		if quality <= bestQuality {
+			continue
+		}
+		if locale := l.match(strings.TrimSpace(tag)); locale != "" {
+			best, bestQuality = locale, quality
+		}
+	}
+	if best != "" {
+		return best
+	}
+
+	if l.Default != "" {
+		return l.Default
+	}
+	if len(l.Supported) != 0 {
+		return l.Supported[0]
+	}
+	return ""
+}
+
+// match returns the supported locale that matches the language range, or an empty
+// string if none do.
+func (l *Locales) match(tag string) string {
+	if tag == "" || tag == "*" {
+		return ""
+	}
+	for _, locale := range l.Supported {
+		if strings.EqualFold(locale, tag) {
+			return locale
+		}
+	}
+	primary := primaryLanguage(tag)
+	for _, locale := range l.Supported {
+		if strings.EqualFold(primaryLanguage(locale), primary) {
+			return locale
+		}
+	}
+	return ""
+}
+
+// primaryLanguage returns the language of a language tag, without its region or
+// script.
+func primaryLanguage(tag string) string {
+	if i := strings.IndexAny(tag, "-_"); i != -1 {
+		return tag[:i]
+	}
+	return tag
+}
@@ -0,0 +1,101 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocales(t *testing.T) {
+	var served string
+	var params map[string]string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, p map[string]string) {
+			served, params = name, p
+		}
+	}
+	router := New()
+	router.Locales = &Locales{Supported: []string{"en", "fr-CA"}}
+	router.FormatExtensions = []string{"json"}
+	router.GET("/", makeHandler("home"))
+	router.GET("/about", makeHandler("about"))
+	router.GET("/posts/:id", makeHandler("post"))
+	router.GET("/en/legacy", makeHandler("legacy"))
+
+	tests := []struct {
+		path   string
+		served string
+		params map[string]string
+	}{
+		{"/en/about", "about", map[string]string{"locale": "en"}},
+		{"/FR-ca/about", "about", map[string]string{"locale": "fr-CA"}},
+		{"/fr-CA", "home", map[string]string{"locale": "fr-CA"}},
+		{"/fr-CA/", "home", map[string]string{"locale": "fr-CA"}},
+		{"/en/posts/1.json", "post", map[string]string{"locale": "en", "id": "1", "format": "json"}},
+		{"/about", "about", nil},
+		{"/de/about", "", nil},
+		// Nothing matches /legacy, so the whole path is looked up.
+		{"/en/legacy", "legacy", nil},
+	}
+	for _, test := range tests {
+		served, params = "", nil
+		r, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if served != test.served || len(params) != len(test.params) {
+			t.Errorf("%s expected %q with %v, saw %q with %v", test.path, test.served, test.params, served, params)
+			continue
+		}
+		for key, value := range test.params {
+			if params[key] != value {
+				t.Errorf("%s expected %v, saw %v", test.path, test.params, params)
+			}
+		}
+	}
+}
+
+func TestLocalesRedirect(t *testing.T) {
+	router := New()
+	router.Locales = &Locales{Supported: []string{"en", "fr-CA", "de"}, Default: "de", Redirect: true}
+	router.GET("/", simpleHandler)
+	router.GET("/about", simpleHandler)
+	router.POST("/about", simpleHandler)
+	router.GET("/en/legacy", simpleHandler)
+
+	tests := []struct {
+		method         string
+		url            string
+		acceptLanguage string
+		location       string
+	}{
+		{"GET", "/about", "fr-CA,fr;q=0.9,en;q=0.8", "/fr-CA/about"},
+		{"GET", "/about", "fr", "/fr-CA/about"},
+		{"GET", "/about?x=1", "es, en-US;q=0.5", "/en/about?x=1"},
+		{"GET", "/about", "en;q=0.5, de-AT", "/de/about"},
+		{"GET", "/about", "es", "/de/about"},
+		{"GET", "/about", "en;q=0, *", "/de/about"},
+		{"HEAD", "/", "en", "/en"},
+		{"GET", "/en/about", "fr", ""},
+		{"GET", "/en/legacy", "fr", ""},
+		{"POST", "/about", "en", ""},
+		{"GET", "/missing", "en", ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.url, nil)
+		r.Header.Set("Accept-Language", test.acceptLanguage)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if test.location == "" {
+			if w.Code == http.StatusFound {
+				t.Errorf("%s %s expected no redirect, saw one to %s", test.method, test.url, w.Header().Get("Location"))
+			}
+			continue
+		}
+		if w.Code != http.StatusFound || w.Header().Get("Location") != test.location {
+			t.Errorf("%s %s with %q expected a redirect to %s, saw %d to %s", test.method, test.url,
+				test.acceptLanguage, test.location, w.Code, w.Header().Get("Location"))
+		}
+		if w.Header().Get("Vary") != "Accept-Language" {
+			t.Errorf("%s expected Vary: Accept-Language, saw %q", test.url, w.Header().Get("Vary"))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package httptreemux
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// MethodOverride lets clients that can't send every method, such as HTML forms, which
+// can only send GET and POST, ask for another one. Set TreeMux.MethodOverride to use
+// it. The method is changed before the route is looked up, so the request is routed
+// and handled as if it had been sent with the new method.
+type MethodOverride struct {
+	// Header is the header that holds the method. The default is
+	// X-HTTP-Method-Override.
+	Header string
+	// FormField is the field of a URL-encoded form body that holds the method, which is
+	// checked when the header is missing. The default is _method. Checking it parses
+	// the form, so handlers find the form's values in r.PostForm rather than in the body.
+	FormField string
+	// From lists the methods that can be overridden. The default is POST, so that a
+	// request with a safe method such as GET can't be turned into one that changes
+	// data.
+	From []string
+	// To lists the methods that a request can be changed to. The default is PUT, PATCH
+	// and DELETE.
+	To []string
+}
+
+var (
+	defaultOverrideFrom = []string{"POST"}
+	defaultOverrideTo   = []string{"PUT", "PATCH", "DELETE"}
+)
+
+// apply returns the request with its method changed, if it asks for a method that it
+// is allowed to change to.
+func (mo *MethodOverride) apply(r *http.Request) *http.Request {
+	method := mo.method(r)
+	if method == "" || method == r.Method {
+		return r
+	}
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Method = method
+	return r2
+}
+
+// method returns the method the request asks for, or an empty string if it doesn't ask
+// for one that is allowed.
+func (mo *MethodOverride) method(r *http.Request) string {
+	from := mo.From
+	if from == nil {
+		from = defaultOverrideFrom
+	}
+	if !containsString(from, r.Method) {
+		return ""
+	}
+
+	header := mo.Header
+	if header == "" {
+		header = "X-HTTP-Method-Override"
+	}
+	method := r.Header.Get(header)
+
+	if method == "" {
+		field := mo.FormField
+		if field == "" {
+			field = "_method"
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+			method = r.PostFormValue(field)
+		}
+	}
+
+	method = strings.ToUpper(method)
+	to := mo.To
+	if to == nil {
+		to = defaultOverrideTo
+	}
+	if !containsString(to, method) {
+		return ""
+	}
+	return method
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
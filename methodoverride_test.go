@@ -0,0 +1,71 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMethodOverride(t *testing.T) {
+	var matched, form string
+	handler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			matched = name + " " + r.Method
+			form = r.PostFormValue("title")
+		}
+	}
+
+	router := New()
+	router.GET("/posts/:id", handler("get"))
+	router.POST("/posts/:id", handler("post"))
+	router.PUT("/posts/:id", handler("put"))
+	router.DELETE("/posts/:id", handler("delete"))
+	router.MethodOverride = &MethodOverride{}
+
+	tests := []struct {
+		method string
+		header string
+		body   string
+		expect string
+	}{
+		{"POST", "", "", "post POST"},
+		{"POST", "PUT", "", "put PUT"},
+		{"POST", "delete", "", "delete DELETE"},
+		{"POST", "", "_method=PUT&title=a", "put PUT"},
+		{"POST", "DELETE", "_method=PUT", "delete DELETE"},
+		// Only POST requests can be overridden, and only to the allowed methods.
+		{"GET", "DELETE", "", "get GET"},
+		{"POST", "GET", "", "post POST"},
+		{"POST", "", "_method=CONNECT", "post POST"},
+	}
+	for _, test := range tests {
+		matched, form = "", ""
+		r, _ := http.NewRequest(test.method, "/posts/1", strings.NewReader(test.body))
+		if test.header != "" {
+			r.Header.Set("X-HTTP-Method-Override", test.header)
+		}
+		if test.body != "" {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if matched != test.expect {
+			t.Errorf("%s with header %q and body %q expected %q, saw %q", test.method, test.header, test.body,
+				test.expect, matched)
+		}
+		if test.body == "_method=PUT&title=a" && form != "a" {
+			t.Errorf("Expected the form to remain available to the handler, saw title %q", form)
+		}
+	}
+
+	router.MethodOverride = &MethodOverride{Header: "X-Method", From: []string{"POST", "GET"}, To: []string{"DELETE"}}
+	r, _ := http.NewRequest("GET", "/posts/1", nil)
+	r.Header.Set("X-Method", "DELETE")
+	if lr, _ := router.LookupRequest(r); lr.Pattern != "/posts/:id" {
+		t.Errorf("Expected LookupRequest to find /posts/:id, saw %q", lr.Pattern)
+	}
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if matched != "delete DELETE" {
+		t.Errorf("Expected custom settings to override GET with DELETE, saw %q", matched)
+	}
+}
@@ -0,0 +1,116 @@
+package httptreemux
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// MetricsRecorder records metrics for the requests served by a TreeMux. Since only the
+// router knows which route matched a request, it passes the route's pattern, such as
+// /users/:id, so that metrics can be grouped by route without a separate series for
+// every path. The pattern is empty for requests that matched no route, including
+// those answered with a 404, or a 400 for a rejected encoded slash. Redirects and 405
+// responses have the pattern of the route that was found.
+type MetricsRecorder interface {
+	// ObserveRequest is called after a request is served. It is called on the
+	// request's goroutine, so it should not block.
+	ObserveRequest(method, route string, statusCode int, duration time.Duration, size int64)
+}
+
+// Tracer starts tracing spans for the requests served by a TreeMux, or adds the route to
+// spans started by earlier middleware. Like MetricsRecorder, it is given the pattern of
+// the matched route, which makes a good low-cardinality span name. For OpenTelemetry,
+// the pattern is the value of the http.route attribute.
+type Tracer interface {
+	// StartSpan is called after the route for a request has been found, and before
+	// its handler or the router's own response is run. The pattern is empty if no
+	// route matched. It returns the request to continue with, typically carrying a
+	// new span in its context, and a function that is called with the response's
+	// status code once the request has been served. The function may be nil.
+	StartSpan(r *http.Request, route string) (*http.Request, func(statusCode int))
+}
+
+// RequestInfo describes a request that a TreeMux has served, for TreeMux.OnRequest.
+type RequestInfo struct {
+	// Request is the request that was served.
+	Request *http.Request
+	// Route is the pattern of the matched route, or an empty string if no route
+	// matched.
+	Route string
+	// Params holds the values of the route's wildcards and catch-all, or nil if it has
+	// none. When ReuseParams is set, the map is reused once OnRequest returns.
+	Params map[string]string
+	// StatusCode is the status code of the response.
+	StatusCode int
+	// Duration is how long the request took to serve, including the lookup.
+	Duration time.Duration
+	// Size is the number of bytes written to the response body.
+	Size int64
+	// RequestID is the ID of the request, when TreeMux.RequestID is set.
+	RequestID string
+}
+
+// recordingResponseWriter records the status code and number of bytes of a response,
+// for Metrics, Tracer and OnRequest.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *recordingResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush passes the flush on to the wrapped ResponseWriter, if it supports flushing, so
+// that streaming handlers keep working when metrics are recorded.
+func (w *recordingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection from the wrapped ResponseWriter, if it supports
+// hijacking, so that handlers such as websocket upgrades keep working when metrics are
+// recorded. A hijacked response is recorded with http.StatusSwitchingProtocols unless a
+// status was already written.
+func (w *recordingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("The ResponseWriter does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped ResponseWriter, for use by http.ResponseController.
+func (w *recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// statusCode returns the status code of the response. A handler that writes nothing
+// results in a 200 response.
+func (w *recordingResponseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
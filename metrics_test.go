@@ -0,0 +1,225 @@
+package httptreemux
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type observedRequest struct {
+	method, route string
+	statusCode    int
+	size          int64
+}
+
+type testMetrics struct {
+	mutex    sync.Mutex
+	observed []observedRequest
+}
+
+func (m *testMetrics) ObserveRequest(method, route string, statusCode int, duration time.Duration, size int64) {
+	if duration <= 0 {
+		panic("Expected a positive duration")
+	}
+	m.mutex.Lock()
+	m.observed = append(m.observed, observedRequest{method, route, statusCode, size})
+	m.mutex.Unlock()
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := &testMetrics{}
+	router := New()
+	router.Metrics = metrics
+	router.GET("/users/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.Write([]byte("user " + params["id"]))
+	})
+	router.POST("/users", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	router.GET("/panic", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		panic("oops")
+	})
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{"GET", "/users/5"},
+		{"GET", "/users/67"},
+		{"POST", "/users"},
+		{"GET", "/missing"},
+		{"DELETE", "/users/5"},
+		{"GET", "/panic"},
+	}
+	for _, req := range requests {
+		r, _ := newRequest(req.method, req.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	lr, _ := router.Lookup("GET", "/users/8")
+	r, _ := newRequest("GET", "/users/8", nil)
+	router.ServeLookupResult(httptest.NewRecorder(), r, lr)
+
+	expected := []observedRequest{
+		{"GET", "/users/:id", http.StatusOK, 6},
+		{"GET", "/users/:id", http.StatusOK, 7},
+		{"POST", "/users", http.StatusCreated, 0},
+		{"GET", "", http.StatusNotFound, 19},
+		{"DELETE", "/users/:id", http.StatusMethodNotAllowed, 0},
+		{"GET", "/panic", http.StatusInternalServerError, 0},
+		{"GET", "/users/:id", http.StatusOK, 6},
+	}
+	if !reflect.DeepEqual(metrics.observed, expected) {
+		t.Errorf("Expected metrics\n%v\nsaw\n%v", expected, metrics.observed)
+	}
+}
+
+type testTracer struct {
+	spans []string
+}
+
+func (tr *testTracer) StartSpan(r *http.Request, route string) (*http.Request, func(statusCode int)) {
+	i := len(tr.spans)
+	tr.spans = append(tr.spans, r.Method+" "+route)
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Header = http.Header{"X-Span": []string{strconv.Itoa(i)}}
+	return r2, func(statusCode int) {
+		tr.spans[i] += " " + strconv.Itoa(statusCode)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &testTracer{}
+	router := New()
+	router.Tracer = tracer
+
+	var span string
+	router.GET("/users/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		span = r.Header.Get("X-Span")
+	})
+	router.GET("/panic", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		panic("oops")
+	})
+
+	for _, path := range []string{"/users/5", "/missing", "/panic"} {
+		r, _ := newRequest("GET", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if span != "0" {
+		t.Errorf("Expected handler to get the request from StartSpan, saw span %q", span)
+	}
+
+	expected := []string{"GET /users/:id 200", "GET  404", "GET /panic 500"}
+	if !reflect.DeepEqual(tracer.spans, expected) {
+		t.Errorf("Expected spans %v, saw %v", expected, tracer.spans)
+	}
+}
+
+func TestOnRequest(t *testing.T) {
+	for _, reuse := range []bool{false, true} {
+		var infos []RequestInfo
+		router := New()
+		router.ReuseParams = reuse
+		router.OnRequest = func(info RequestInfo) {
+			// Copy the params, since they may be reused.
+			var params map[string]string
+			if info.Params != nil {
+				params = make(map[string]string, len(info.Params))
+				for key, value := range info.Params {
+					params[key] = value
+				}
+			}
+			info.Params = params
+			infos = append(infos, info)
+		}
+		router.GET("/users/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			w.Write([]byte("user " + params["id"]))
+		})
+
+		for _, path := range []string{"/users/5", "/missing"} {
+			r, _ := newRequest("GET", path, nil)
+			router.ServeHTTP(httptest.NewRecorder(), r)
+		}
+
+		if len(infos) != 2 {
+			t.Fatalf("ReuseParams %v expected 2 calls to OnRequest, saw %d", reuse, len(infos))
+		}
+
+		info := infos[0]
+		if info.Request == nil || info.Request.URL.Path != "/users/5" || info.Route != "/users/:id" ||
+			!reflect.DeepEqual(info.Params, map[string]string{"id": "5"}) ||
+			info.StatusCode != http.StatusOK || info.Size != 6 || info.Duration <= 0 {
+			t.Errorf("ReuseParams %v saw unexpected info %+v", reuse, info)
+		}
+
+		info = infos[1]
+		if info.Route != "" || info.Params != nil || info.StatusCode != http.StatusNotFound {
+			t.Errorf("ReuseParams %v saw unexpected info for 404 %+v", reuse, info)
+		}
+	}
+}
+
+func TestMetricsHijack(t *testing.T) {
+	metrics := &testMetrics{}
+	router := New()
+	router.Metrics = metrics
+	hijack := func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	}
+	router.GET("/hijack", hijack)
+	router.CircuitBreaker(NewCircuitBreaker(1, time.Minute)).GET("/breaker", hijack)
+
+	// The client can have the hijacked response before the request is observed, so wait
+	// for ServeHTTP to return.
+	served := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r)
+		served <- true
+	}))
+	defer server.Close()
+	for _, path := range []string{"/hijack", "/breaker"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "hijacked" {
+			t.Errorf("%s expected the hijacked response, saw %q", path, body)
+		}
+		<-served
+	}
+
+	expected := []observedRequest{
+		{"GET", "/hijack", http.StatusSwitchingProtocols, 0},
+		{"GET", "/breaker", http.StatusSwitchingProtocols, 0},
+	}
+	metrics.mutex.Lock()
+	observed := metrics.observed
+	metrics.mutex.Unlock()
+	if !reflect.DeepEqual(observed, expected) {
+		t.Errorf("Expected %v, saw %v", expected, observed)
+	}
+
+	// A ResponseWriter that can't be hijacked gives an error rather than a panic.
+	r, _ := http.NewRequest("GET", "/hijack", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected a 500 response when hijacking isn't supported, saw %d", w.Code)
+	}
+}
@@ -0,0 +1,96 @@
+//go:build go1.7
+// +build go1.7
+
+package httptreemux
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Mirror returns middleware that sends a copy of each request to the shadow handler
+// as well, for trying out a new implementation against real traffic. Use it with With
+// or Use to mirror a route or a group:
+//
+//	router.With(httptreemux.Mirror(shadowHandler, 1<<20)).POST("/orders", orderHandler)
+//
+// The route's own handler serves the response as usual, and the shadow handler runs in
+// a separate goroutine with a copy of the request, whose context isn't canceled when
+// the request ends, and a ResponseWriter that discards what it writes. A panic in the
+// shadow handler is recovered and ignored. The request body is read into memory for
+// the copy, up to maxBodyBytes; requests with a larger body aren't mirrored.
+//
+// To mirror to another server, use a shadow handler that proxies the request, such as
+// one from httputil.NewSingleHostReverseProxy.
+func Mirror(shadow HandlerFunc, maxBodyBytes int64) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			if copied, ok := mirrorRequest(r, maxBodyBytes); ok {
+				// Copy the params, since they may be reused once the request is served.
+				var shadowParams map[string]string
+				if params != nil {
+					shadowParams = make(map[string]string, len(params))
+					for key, value := range params {
+						shadowParams[key] = value
+					}
+				}
+				go runShadow(shadow, copied, shadowParams)
+			}
+			next(w, r, params)
+		}
+	}
+}
+
+// mirrorRequest returns a copy of the request for the shadow handler. It reads the
+// body, and replaces that of r with one that returns the same bytes. It returns false
+// if the body is larger than the limit, or can't be read.
+func mirrorRequest(r *http.Request, maxBodyBytes int64) (*http.Request, bool) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+		// The handler still gets the whole body.
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil || int64(len(body)) > maxBodyBytes {
+			return nil, false
+		}
+	}
+
+	copied := r.WithContext(context.Background())
+	copied.Header = make(http.Header, len(r.Header))
+	for key, values := range r.Header {
+		copied.Header[key] = append([]string(nil), values...)
+	}
+	u := *r.URL
+	copied.URL = &u
+	if r.Body != nil {
+		copied.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return copied, true
+}
+
+// readCloser combines a Reader with the Closer of the body it reads from.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// runShadow serves the mirrored request, discarding the response.
+func runShadow(shadow HandlerFunc, r *http.Request, params map[string]string) {
+	defer func() {
+		recover()
+	}()
+	shadow(discardResponse{header: http.Header{}}, r, params)
+}
+
+// discardResponse is a ResponseWriter that discards the response.
+type discardResponse struct {
+	header http.Header
+}
+
+func (d discardResponse) Header() http.Header         { return d.header }
+func (d discardResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (d discardResponse) WriteHeader(statusCode int)  {}
@@ -0,0 +1,67 @@
+//go:build go1.7
+// +build go1.7
+
+package httptreemux
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMirror(t *testing.T) {
+	type mirrored struct {
+		body   string
+		id     string
+		header string
+	}
+	shadowed := make(chan mirrored, 10)
+	shadow := func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		body, _ := ioutil.ReadAll(r.Body)
+		shadowed <- mirrored{string(body), params["id"], r.Header.Get("X-Test")}
+		w.WriteHeader(http.StatusTeapot)
+		panic("the shadow's panics are ignored")
+	}
+
+	router := New()
+	router.With(Mirror(shadow, 5)).POST("/orders/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+
+	serve := func(body string) string {
+		r, _ := http.NewRequest("POST", "/orders/7", strings.NewReader(body))
+		r.Header.Set("X-Test", "yes")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected the primary handler's status 200, saw %d", w.Code)
+		}
+		return w.Body.String()
+	}
+
+	if body := serve("hello"); body != "hello" {
+		t.Errorf("Expected the primary handler to read the body, saw %q", body)
+	}
+	select {
+	case m := <-shadowed:
+		if m != (mirrored{"hello", "7", "yes"}) {
+			t.Errorf("Unexpected mirrored request %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the request to be mirrored")
+	}
+
+	// A body over the limit is served but not mirrored.
+	if body := serve("hello world"); body != "hello world" {
+		t.Errorf("Expected the primary handler to read the whole body, saw %q", body)
+	}
+	select {
+	case m := <-shadowed:
+		t.Errorf("Expected the large request not to be mirrored, saw %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
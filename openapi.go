@@ -0,0 +1,121 @@
+package httptreemux
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// openAPIMethods maps the operation keys of an OpenAPI path item to HTTP methods.
+var openAPIMethods = map[string]string{
+	"get":     "GET",
+	"put":     "PUT",
+	"post":    "POST",
+	"delete":  "DELETE",
+	"options": "OPTIONS",
+	"head":    "HEAD",
+	"patch":   "PATCH",
+	"trace":   "TRACE",
+}
+
+// HandleOpenAPI adds a route for each operation in an OpenAPI document, given as JSON.
+// The router is a *TreeMux or a *Group. The handler for each operation is found in
+// handlers by its operationId, and path templates such as /users/{id} are converted to
+// wildcards such as /users/:id. A template must take up a whole path segment.
+//
+// Every operation is checked before any routes are added, and an error is returned if
+// the document can't be parsed, an operation has no operationId or no handler, or a
+// path can't be converted. An error adding a route, such as a conflict with an existing
+// one, is returned as well, but the routes added before it remain.
+func HandleOpenAPI(router interface {
+	HandleErr(method, path string, handler HandlerFunc) (*Route, error)
+}, spec []byte, handlers map[string]HandlerFunc) error {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return fmt.Errorf("Invalid OpenAPI document: %s", err)
+	}
+
+	type operation struct {
+		method  string
+		path    string
+		handler HandlerFunc
+	}
+
+	// Sort the paths so that errors and the order routes are added in don't depend on
+	// map iteration.
+	templates := make([]string, 0, len(doc.Paths))
+	for template := range doc.Paths {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+
+	var operations []operation
+	for _, template := range templates {
+		path, err := openAPIPath(template)
+		if err != nil {
+			return err
+		}
+
+		item := doc.Paths[template]
+		keys := make([]string, 0, len(item))
+		for key := range item {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			method, ok := openAPIMethods[key]
+			if !ok {
+				// Other members, such as parameters and summary, aren't operations.
+				continue
+			}
+
+			var op struct {
+				OperationID string `json:"operationId"`
+			}
+			if err := json.Unmarshal(item[key], &op); err != nil {
+				return fmt.Errorf("Invalid OpenAPI operation %s %s: %s", method, template, err)
+			}
+			if op.OperationID == "" {
+				return fmt.Errorf("OpenAPI operation %s %s has no operationId", method, template)
+			}
+
+			handler, ok := handlers[op.OperationID]
+			if !ok {
+				return fmt.Errorf("No handler for OpenAPI operation %s (%s %s)", op.OperationID, method, template)
+			}
+			operations = append(operations, operation{method: method, path: path, handler: handler})
+		}
+	}
+
+	for _, op := range operations {
+		if _, err := router.HandleErr(op.method, op.path, op.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openAPIPath converts an OpenAPI path template to a pattern.
+func openAPIPath(template string) (string, error) {
+	if len(template) == 0 || template[0] != '/' {
+		return "", fmt.Errorf("OpenAPI path %s must start with slash", template)
+	}
+
+	segments := strings.Split(template, "/")
+	for i, segment := range segments {
+		if !strings.ContainsAny(segment, "{}") {
+			continue
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}")
+		if len(name) != len(segment)-2 || name == "" || strings.ContainsAny(name, "{}:|") {
+			return "", fmt.Errorf("OpenAPI path %s has a template that isn't a whole segment", template)
+		}
+		segments[i] = ":" + name
+	}
+	return strings.Join(segments, "/"), nil
+}
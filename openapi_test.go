@@ -0,0 +1,87 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleOpenAPI(t *testing.T) {
+	spec := `{
+		"openapi": "3.0.0",
+		"paths": {
+			"/users": {
+				"get": {"operationId": "listUsers"},
+				"post": {"operationId": "createUser"}
+			},
+			"/users/{userId}": {
+				"parameters": [{"name": "userId", "in": "path"}],
+				"get": {"operationId": "getUser"}
+			}
+		}
+	}`
+
+	var matched string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			matched = name + " " + params["userId"]
+		}
+	}
+	handlers := map[string]HandlerFunc{
+		"listUsers":  makeHandler("list"),
+		"createUser": makeHandler("create"),
+		"getUser":    makeHandler("get"),
+	}
+
+	router := New()
+	if err := HandleOpenAPI(router.Group("/v1"), []byte(spec), handlers); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		expect string
+	}{
+		{"GET", "/v1/users", "list "},
+		{"POST", "/v1/users", "create "},
+		{"GET", "/v1/users/5", "get 5"},
+	}
+	for _, test := range tests {
+		matched = ""
+		r, _ := newRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if matched != test.expect {
+			t.Errorf("%s %s expected match %q, saw %q", test.method, test.path, test.expect, matched)
+		}
+	}
+
+	errorTests := []struct {
+		spec   string
+		expect string
+	}{
+		{`{"paths": {"/a": {"get": {}}}}`, "has no operationId"},
+		{`{"paths": {"/a": {"get": {"operationId": "unknown"}}}}`, "No handler for OpenAPI operation unknown"},
+		{`{"paths": {"/a/{id}.json": {"get": {"operationId": "getUser"}}}}`, "isn't a whole segment"},
+		{`{"paths": {"a": {"get": {"operationId": "getUser"}}}}`, "must start with slash"},
+		{`{"paths": [`, "Invalid OpenAPI document"},
+	}
+	for _, test := range errorTests {
+		err := HandleOpenAPI(New(), []byte(test.spec), handlers)
+		if err == nil || !strings.Contains(err.Error(), test.expect) {
+			t.Errorf("Spec %s expected error containing %q, saw %v", test.spec, test.expect, err)
+		}
+	}
+
+	// Nothing is added when an operation is invalid.
+	router = New()
+	spec = `{"paths": {"/a": {"get": {"operationId": "listUsers"}}, "/b": {"get": {"operationId": "unknown"}}}}`
+	if err := HandleOpenAPI(router, []byte(spec), handlers); err == nil {
+		t.Error("Expected error for unknown operation")
+	}
+	if _, found := router.Lookup("GET", "/a"); found {
+		t.Error("Expected no routes to be added after an invalid operation")
+	}
+}
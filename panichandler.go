@@ -26,8 +26,15 @@ func ShowErrorsPanicHandler(w http.ResponseWriter, r *http.Request, err interfac
 func renderPrettyError(rw http.ResponseWriter, req *http.Request, err interface{}, stack []byte) {
 	_, filePath, line, _ := runtime.Caller(4)
 
+	var route string
+	if panicErr, ok := err.(*PanicError); ok {
+		err = panicErr.Err
+		route = panicErr.Route
+	}
+
 	data := map[string]interface{}{
 		"Error":    err,
+		"Route":    route,
 		"Stack":    string(stack),
 		"Params":   req.URL.Query(),
 		"Method":   req.Method,
@@ -174,6 +181,7 @@ const panicPageTpl string = `
       <pre class="stack">{{ .Stack }}</pre>
       <h2>Request</h2>
       <p><strong>Method:</strong> {{ .Method }}</p>
+      {{ if .Route }}<p><strong>Route:</strong> {{ .Route }}</p>{{ end }}
       <h3>Parameters:</h3>
       <ul>
         {{ range $key, $value := .Params }}
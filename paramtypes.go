@@ -0,0 +1,110 @@
+package httptreemux
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// paramType is a named type that a wildcard can be restricted to with the :name:type
+// syntax.
+type paramType struct {
+	parse func(segment string) (interface{}, error)
+}
+
+var (
+	paramTypesMutex sync.RWMutex
+	paramTypes      = map[string]*paramType{
+		"int":   {parse: parseInt},
+		"uint":  {parse: parseUint},
+		"float": {parse: parseFloat},
+		"uuid":  {parse: parseUUID},
+	}
+)
+
+// RegisterParamType adds a type that wildcards can be restricted to. A wildcard
+// written as :name:type only matches path segments that parse accepts, and the value
+// parse returns is available to handlers through ContextTypedParams. The segment
+// passed to parse has already been unescaped.
+//
+// These types are built in:
+//
+//	int    an int, as parsed by strconv.Atoi
+//	uint   a uint64, as parsed by strconv.ParseUint in base 10
+//	float  a float64, as parsed by strconv.ParseFloat
+//	uuid   a string in the form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx, of hex digits
+//
+// Registering a type with an existing name replaces it for routes that are added
+// afterwards. Types must be registered before the routes that use them are added.
+func RegisterParamType(name string, parse func(segment string) (interface{}, error)) {
+	if name == "" || parse == nil {
+		panic("RegisterParamType requires a name and a parse function")
+	}
+
+	paramTypesMutex.Lock()
+	paramTypes[name] = &paramType{parse: parse}
+	paramTypesMutex.Unlock()
+}
+
+// withTypedParams returns the request with the converted values of typed wildcards
+// added to its context. It is nil when the context package is not available, in which
+// case typed wildcards still restrict what they match.
+var withTypedParams func(r *http.Request, values map[string]interface{}) *http.Request
+
+// typedParams converts the values of the typed wildcards of the node's route. The
+// params are the raw values from search.
+func (n *node) typedParams(params []string) map[string]interface{} {
+	values := make(map[string]interface{}, len(n.leafParamTypes))
+	for i, pt := range n.leafParamTypes {
+		if pt == nil {
+			continue
+		}
+
+		// The segment already matched the type in search, so this can't fail.
+		value := unescapeToken(params[len(params)-i-1])
+		values[n.leafWildcardNames[i]], _ = pt.parse(value)
+	}
+	return values
+}
+
+func lookupParamType(name string) *paramType {
+	paramTypesMutex.RLock()
+	defer paramTypesMutex.RUnlock()
+	return paramTypes[name]
+}
+
+func parseInt(segment string) (interface{}, error) {
+	return strconv.Atoi(segment)
+}
+
+func parseUint(segment string) (interface{}, error) {
+	return strconv.ParseUint(segment, 10, 64)
+}
+
+func parseFloat(segment string) (interface{}, error) {
+	return strconv.ParseFloat(segment, 64)
+}
+
+var errInvalidUUID = errors.New("Invalid UUID")
+
+func parseUUID(segment string) (interface{}, error) {
+	if len(segment) != 36 {
+		return nil, errInvalidUUID
+	}
+
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return nil, errInvalidUUID
+			}
+		default:
+			if !isHex(c) {
+				return nil, errInvalidUUID
+			}
+		}
+	}
+	return segment, nil
+}
@@ -0,0 +1,88 @@
+package httptreemux
+
+import (
+	"net"
+	"net/http"
+)
+
+// localAddr returns the address of the listener that accepted the request, or nil if
+// it isn't known. It is nil when the context package is not available.
+var localAddr func(r *http.Request) net.Addr
+
+// PortsMetaKey is the metadata key under which Route.Port stores the ports that a route
+// is served on, as a []string.
+const PortsMetaKey = "ports"
+
+// Port returns a group with the same path and middleware as this one, whose routes are
+// only served for requests that arrive on one of the ports, such as for admin routes
+// that should only be reachable through an internal listener when one TreeMux serves
+// several:
+//
+//	admin := router.Group("/admin").Port("9090")
+//	admin.GET("/stats", statsHandler)
+//
+// Requests for the routes on other ports get the NotFound handler, as if the routes
+// didn't exist. The ports are set as each route is added, so the routes are never
+// served on other ports, even while the router is serving requests. Like With, it can
+// be used for a single route, and calling it again replaces the ports. See Route.Port.
+func (g *Group) Port(ports ...string) *Group {
+	if len(ports) != 0 {
+		return g.withMeta(PortsMetaKey, append([]string(nil), ports...))
+	}
+
+	group := *g
+	if _, ok := g.settings.meta[PortsMetaKey]; ok {
+		// The metadata is copied without the ports, since the routes already added
+		// share it.
+		meta := make(map[string]interface{}, len(g.settings.meta))
+		for key, value := range g.settings.meta {
+			if key != PortsMetaKey {
+				meta[key] = value
+			}
+		}
+		group.settings.meta = meta
+	}
+	return &group
+}
+
+// Port restricts the route to requests that arrive on one of the ports, replacing any
+// ports set before. With no ports, the route is served on every port. The port of a request is that of the listener that accepted it,
+// which net/http records in the request's context since Go 1.7. When it isn't known,
+// such as with Go 1.6 or for requests from other servers, the port of the Host header
+// is used, or 80 or 443 if the header has none. Clients can set the Host header to
+// anything, so the routes must not rely on it for security.
+//
+// The ports are stored in the route's metadata under PortsMetaKey, so they are listed
+// by WalkRoutes and RoutesHandler.
+func (r *Route) Port(ports ...string) *Route {
+	changed := false
+	// This is deferred before the mutex is unlocked, so that it runs afterwards.
+	defer func() {
+		if changed {
+			r.mux.routeChanged(r)
+		}
+	}()
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	changed = r.setMeta(PortsMetaKey, append([]string(nil), ports...)) == nil
+	return r
+}
+
+// requestPort returns the port that the request arrived on.
+func requestPort(r *http.Request) string {
+	if localAddr != nil {
+		if addr := localAddr(r); addr != nil {
+			if _, port, err := net.SplitHostPort(addr.String()); err == nil {
+				return port
+			}
+		}
+	}
+	if _, port, err := net.SplitHostPort(r.Host); err == nil {
+		return port
+	}
+	if r.TLS != nil {
+		return "443"
+	}
+	return "80"
+}
@@ -0,0 +1,62 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPort(t *testing.T) {
+	router := New()
+	router.GET("/", simpleHandler)
+	admin := router.Group("/admin").Port("9090")
+	admin.GET("/stats", simpleHandler)
+	admin.Group("/debug").GET("/vars", simpleHandler)
+	router.With().Port("8443", "443").GET("/secure", simpleHandler)
+	router.GET("/any", simpleHandler).Port("8443").Port()
+	admin.Port().GET("/open", simpleHandler)
+
+	tests := []struct {
+		host string
+		path string
+		code int
+	}{
+		{"example.com:9090", "/admin/stats", http.StatusOK},
+		{"example.com:9090", "/admin/debug/vars", http.StatusOK},
+		{"example.com:8080", "/admin/stats", http.StatusNotFound},
+		{"example.com", "/admin/stats", http.StatusNotFound},
+		{"example.com:8080", "/", http.StatusOK},
+		{"example.com:8443", "/secure", http.StatusOK},
+		{"example.com:8080", "/secure", http.StatusNotFound},
+		{"example.com:8080", "/any", http.StatusOK},
+		{"example.com:9090", "/any", http.StatusOK},
+		{"example.com:8080", "/admin/open", http.StatusOK},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		r.Host = test.host
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s%s expected %d, saw %d", test.host, test.path, test.code, w.Code)
+		}
+	}
+
+	// The ports are set as a route is added, so it is never served on other ports.
+	router.AddHooks(Hooks{
+		OnRouteAdded: func(route RouteInfo) {
+			r, _ := http.NewRequest("GET", route.Pattern, nil)
+			r.Host = "example.com:8080"
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != http.StatusNotFound {
+				t.Errorf("Expected %s to be restricted to its port once added, saw %d", route.Pattern, w.Code)
+			}
+		},
+	})
+	admin.GET("/late", simpleHandler)
+
+	if port := requestPort(&http.Request{Host: "example.com"}); port != "80" {
+		t.Errorf("Expected port 80 without a port in the Host header, saw %s", port)
+	}
+}
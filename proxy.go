@@ -0,0 +1,192 @@
+//go:build go1.7
+// +build go1.7
+
+package httptreemux
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// proxyTargetKey is the context key for the URL that a proxied request is sent to.
+type proxyTargetKey struct{}
+
+// proxyPart is a piece of a proxy target: literal text, or the name of a parameter
+// whose value is substituted for it.
+type proxyPart struct {
+	text     string
+	param    bool
+	catchAll bool
+}
+
+// Proxy adds a route that forwards requests to the target URL with an
+// httputil.ReverseProxy. The target may use the wildcards and catch-all of the path,
+// written the same way, and their values from the request are substituted into it,
+// anywhere in the URL:
+//
+//	router.Proxy("GET", "/svc/:name/*path", "http://internal-:name.svc/*path")
+//
+// A wildcard's value is escaped as a single path segment, while the slashes in a
+// catch-all value are kept. The query of the request is added to that of the target,
+// and the Host header is set to the target's host. Proxy panics if the target isn't an
+// absolute URL, uses a name that the path doesn't have, or the route can't be added.
+//
+// The returned proxy can be customized before the router starts serving, such as by
+// setting its Transport, ModifyResponse or ErrorHandler. To change the requests further,
+// wrap its Director, which has already rewritten the URL when it returns:
+//
+//	proxy := router.Proxy("GET", "/api/*path", "http://backend/*path")
+//	director := proxy.Director
+//	proxy.Director = func(r *http.Request) {
+//		director(r)
+//		r.Header.Set("X-Gateway", "edge")
+//	}
+func (t *TreeMux) Proxy(method, path, target string) *httputil.ReverseProxy {
+	return (&Group{mux: t}).Proxy(method, path, target)
+}
+
+// ProxyErr is like Proxy, but returns an error instead of panicking.
+func (t *TreeMux) ProxyErr(method, path, target string) (*httputil.ReverseProxy, error) {
+	return (&Group{mux: t}).ProxyErr(method, path, target)
+}
+
+// Proxy adds a route that forwards requests to the target URL, with the path prefixed
+// by the group's path. See TreeMux.Proxy.
+func (g *Group) Proxy(method, path, target string) *httputil.ReverseProxy {
+	proxy, err := g.ProxyErr(method, path, target)
+	if err != nil {
+		panic(err)
+	}
+	return proxy
+}
+
+// ProxyErr is like Proxy, but returns an error instead of panicking.
+func (g *Group) ProxyErr(method, path, target string) (*httputil.ReverseProxy, error) {
+	parts, err := parseProxyTarget(g.path+path, target)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := &httputil.ReverseProxy{Director: proxyDirector}
+	_, err = g.HandleErr(method, path, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		u, err := url.Parse(buildProxyTarget(parts, params))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxyTargetKey{}, u)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return proxy, nil
+}
+
+// parseProxyTarget splits the target into its parts, and checks that the parameters
+// it uses are in the pattern, and that it is an absolute URL.
+func parseProxyTarget(pattern, target string) ([]proxyPart, error) {
+	names := map[string]bool{}
+	for _, name := range patternNames(pattern) {
+		names[name] = true
+	}
+
+	var parts []proxyPart
+	start := 0
+	for i := 0; i < len(target); i++ {
+		c := target[i]
+		if (c != ':' && c != '*') || i+1 == len(target) || !isProxyNameStart(target[i+1]) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(target) && isProxyNameChar(target[end]) {
+			end++
+		}
+		name := target[i+1 : end]
+		if !names[name] {
+			return nil, fmt.Errorf("Proxy target %s uses %s, which pattern %s doesn't have", target,
+				target[i:end], pattern)
+		}
+
+		if start < i {
+			parts = append(parts, proxyPart{text: target[start:i]})
+		}
+		parts = append(parts, proxyPart{text: name, param: true, catchAll: c == '*'})
+		start = end
+		i = end - 1
+	}
+	if start < len(target) {
+		parts = append(parts, proxyPart{text: target[start:]})
+	}
+
+	// Check the rest of the URL with a value in place of each parameter.
+	sample := map[string]string{}
+	for name := range names {
+		sample[name] = "x"
+	}
+	u, err := url.Parse(buildProxyTarget(parts, sample))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid proxy target %s: %s", target, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("Proxy target %s must be an absolute URL", target)
+	}
+	return parts, nil
+}
+
+func isProxyNameStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
+
+func isProxyNameChar(c byte) bool {
+	return isProxyNameStart(c) || '0' <= c && c <= '9'
+}
+
+// buildProxyTarget fills in the parameters of a target.
+func buildProxyTarget(parts []proxyPart, params map[string]string) string {
+	var buf []byte
+	for _, part := range parts {
+		switch {
+		case !part.param:
+			buf = append(buf, part.text...)
+		case part.catchAll:
+			for i, segment := range strings.Split(params[part.text], "/") {
+				if i != 0 {
+					buf = append(buf, '/')
+				}
+				buf = append(buf, escapePathSegment(segment)...)
+			}
+		default:
+			buf = append(buf, escapePathSegment(params[part.text])...)
+		}
+	}
+	return string(buf)
+}
+
+// proxyDirector points the request at the target URL that the route's handler stored
+// in its context.
+func proxyDirector(r *http.Request) {
+	target, ok := r.Context().Value(proxyTargetKey{}).(*url.URL)
+	if !ok {
+		return
+	}
+
+	r.URL.Scheme = target.Scheme
+	r.URL.Host = target.Host
+	r.URL.Path = target.Path
+	r.URL.RawPath = target.RawPath
+	if target.RawQuery == "" || r.URL.RawQuery == "" {
+		r.URL.RawQuery = target.RawQuery + r.URL.RawQuery
+	} else {
+		r.URL.RawQuery = target.RawQuery + "&" + r.URL.RawQuery
+	}
+	r.Host = target.Host
+	if _, ok := r.Header["User-Agent"]; !ok {
+		// Keep the transport from adding its own User-Agent.
+		r.Header.Set("User-Agent", "")
+	}
+}
@@ -0,0 +1,75 @@
+//go:build go1.7
+// +build go1.7
+
+package httptreemux
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// hostTransport records the URL of each request, and sends it to a test server
+// instead of its host.
+type hostTransport struct {
+	server *httptest.Server
+	urls   []string
+}
+
+func (t *hostTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.urls = append(t.urls, r.URL.String())
+	server, _ := url.Parse(t.server.URL)
+	r.URL.Host = server.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s %s", r.Host, r.URL.EscapedPath(), r.Header.Get("X-Gateway"))
+	}))
+	defer upstream.Close()
+	transport := &hostTransport{server: upstream}
+
+	router := New()
+	proxy := router.Group("/svc").Proxy("GET", "/:name/*path", "http://internal-:name.svc/v1/*path?via=gw")
+	proxy.Transport = transport
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Header.Set("X-Gateway", "edge")
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/svc/users/a/b%20c?page=2", nil)
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, saw %d", w.Code)
+	}
+	if body := w.Body.String(); body != "internal-users.svc /v1/a/b%20c edge" {
+		t.Errorf("Unexpected upstream request %q", body)
+	}
+	expected := []string{"http://internal-users.svc/v1/a/b%20c?via=gw&page=2"}
+	if fmt.Sprint(transport.urls) != fmt.Sprint(expected) {
+		t.Errorf("Expected upstream URLs %v, saw %v", expected, transport.urls)
+	}
+
+	errorTests := []struct {
+		path   string
+		target string
+		err    string
+	}{
+		{"/svc/:name", "http://:other.svc/", "Proxy target http://:other.svc/ uses :other, which pattern /svc/:name doesn't have"},
+		{"/svc/:name", "/:name", "Proxy target /:name must be an absolute URL"},
+		{"svc", "http://svc", "Path svc must start with slash"},
+	}
+	for _, test := range errorTests {
+		_, err := router.ProxyErr("GET", test.path, test.target)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s -> %s: expected error %q, saw %v", test.path, test.target, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package httptreemux
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitStore counts the requests for a RateLimit. MemoryRateLimitStore keeps the
+// counts in memory; implementing it on a shared store, such as Redis with INCR and
+// EXPIRE, makes the limits apply across servers.
+type RateLimitStore interface {
+	// Increment adds one to the count for the key in its current window, starting a
+	// window of the given length at zero if the key has none or its window has ended.
+	// It returns the new count and the time that the window ends.
+	Increment(key string, window time.Duration) (count int64, reset time.Time, err error)
+}
+
+// RateLimitKeyFunc returns the key that a request is counted under, such as the
+// client's address or a user ID. Requests for which it returns an empty string are
+// not limited.
+type RateLimitKeyFunc func(r *http.Request, params map[string]string) string
+
+// RateLimit limits the number of requests to each route in a window of time. It is
+// created by Limit and applied to routes with TreeMux.RateLimit or Group.RateLimit.
+// Each route is counted separately, by its method and pattern along with the key of
+// the request, so a limit on a group doesn't let one busy route use up the limit of
+// the others.
+//
+// A request over the limit gets a 429 Too Many Requests response with a Retry-After
+// header. Every limited request gets X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset headers, the last holding the end of the window in Unix seconds.
+// If the store returns an error, the request is allowed.
+type RateLimit struct {
+	limit   int64
+	window  time.Duration
+	key     RateLimitKeyFunc
+	store   RateLimitStore
+	handler HandlerFunc
+}
+
+// Limit returns a RateLimit that allows limit requests per window, counted by the
+// client's IP address in a new MemoryRateLimitStore.
+//
+//	api := router.RateLimit(httptreemux.Limit(100, time.Minute).Key(byUser))
+func Limit(limit int, window time.Duration) *RateLimit {
+	return &RateLimit{
+		limit:  int64(limit),
+		window: window,
+		key:    RateLimitByIP,
+		store:  NewMemoryRateLimitStore(),
+	}
+}
+
+// Key sets the function that returns the key requests are counted under.
+func (l *RateLimit) Key(key RateLimitKeyFunc) *RateLimit {
+	l.key = key
+	return l
+}
+
+// Store sets the store that the requests are counted in.
+func (l *RateLimit) Store(store RateLimitStore) *RateLimit {
+	l.store = store
+	return l
+}
+
+// Handler sets the handler that writes the response for requests over the limit.
+// The rate limit headers, including Retry-After, are set before it is called.
+func (l *RateLimit) Handler(handler HandlerFunc) *RateLimit {
+	l.handler = handler
+	return l
+}
+
+// wrap returns the handler for the route, which runs handler if the request is
+// within the limit.
+func (l *RateLimit) wrap(host, pattern string, handler HandlerFunc) HandlerFunc {
+	prefix := host + pattern + " "
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		key := l.key(r, params)
+		if key == "" {
+			handler(w, r, params)
+			return
+		}
+
+		count, reset, err := l.store.Increment(r.Method+" "+prefix+key, l.window)
+		if err != nil {
+			handler(w, r, params)
+			return
+		}
+
+		remaining := l.limit - count
+		if remaining < 0 {
+			remaining = 0
+		}
+		header := w.Header()
+		header.Set("X-RateLimit-Limit", strconv.FormatInt(l.limit, 10))
+		header.Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		header.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if count <= l.limit {
+			handler(w, r, params)
+			return
+		}
+
+		// Round up, so that a client waiting this long finds the window over.
+		retry := (reset.Sub(time.Now()) + time.Second - 1) / time.Second
+		if retry < 1 {
+			retry = 1
+		}
+		header.Set("Retry-After", strconv.FormatInt(int64(retry), 10))
+		if l.handler != nil {
+			l.handler(w, r, params)
+			return
+		}
+		// 429 is http.StatusTooManyRequests, which needs Go 1.6, as does its status text.
+		http.Error(w, "Too Many Requests", 429)
+	}
+}
+
+// RateLimitByIP counts requests by the IP address of the client, from
+// Request.RemoteAddr. Behind a proxy, set RemoteAddr from the forwarding headers first,
+// or use a key function that reads them.
+func RateLimitByIP(r *http.Request, params map[string]string) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RateLimitByParam returns a key function that counts requests by the value of the
+// route's parameter with the name, such as a tenant ID.
+func RateLimitByParam(name string) RateLimitKeyFunc {
+	return func(r *http.Request, params map[string]string) string {
+		return params[name]
+	}
+}
+
+// RateLimit returns a group with the same path and middleware as the router, whose
+// routes are limited by the limit. See Group.RateLimit.
+func (t *TreeMux) RateLimit(limit *RateLimit) *Group {
+	return (&Group{mux: t}).RateLimit(limit)
+}
+
+// RateLimit returns a group with the same path and middleware as this one, whose
+// routes are limited by the limit as well as by those of this group. The limit is
+// checked inside the group's middleware. Like With, it can be used for a single route:
+//
+//	router.RateLimit(httptreemux.Limit(5, time.Minute)).POST("/login", loginHandler)
+func (g *Group) RateLimit(limit *RateLimit) *Group {
+	return g.withRouteWrapper(limit.wrap)
+}
+
+// MemoryRateLimitStore is a RateLimitStore that keeps the counts in memory, for a
+// single server. Counts whose window has ended are removed as the store grows.
+type MemoryRateLimitStore struct {
+	mutex   sync.Mutex
+	windows map[string]*rateLimitWindow
+	// The number of keys after the last removal of ended windows.
+	swept int
+}
+
+type rateLimitWindow struct {
+	count int64
+	reset time.Time
+}
+
+// NewMemoryRateLimitStore returns an empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{windows: make(map[string]*rateLimitWindow)}
+}
+
+// Increment implements RateLimitStore.
+func (s *MemoryRateLimitStore) Increment(key string, window time.Duration) (int64, time.Time, error) {
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.reset) {
+		if !ok && len(s.windows) >= 2*s.swept+1024 {
+			s.sweep(now)
+		}
+		w = &rateLimitWindow{reset: now.Add(window)}
+		s.windows[key] = w
+	}
+	w.count++
+	return w.count, w.reset, nil
+}
+
+// sweep removes the windows that have ended. The mutex must be held.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, w := range s.windows {
+		if !now.Before(w.reset) {
+			delete(s.windows, key)
+		}
+	}
+	s.swept = len(s.windows)
+}
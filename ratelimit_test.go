@@ -0,0 +1,94 @@
+package httptreemux
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingRateLimitStore is a RateLimitStore that can't be reached.
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Increment(key string, window time.Duration) (int64, time.Time, error) {
+	return 0, time.Time{}, errors.New("store is down")
+}
+
+func TestRateLimit(t *testing.T) {
+	router := New()
+	api := router.Group("/api").RateLimit(Limit(2, time.Minute))
+	api.GET("/a", simpleHandler)
+	api.GET("/b", simpleHandler)
+	router.RateLimit(Limit(1, time.Minute).Key(RateLimitByParam("tenant")).Handler(
+		func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})).GET("/t/:tenant", simpleHandler)
+	router.RateLimit(Limit(1, time.Minute).Store(failingRateLimitStore{})).GET("/down", simpleHandler)
+
+	serve := func(path, addr string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", path, nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		path      string
+		addr      string
+		code      int
+		remaining string
+	}{
+		{"/api/a", "10.0.0.1:1000", 200, "1"},
+		// The port doesn't matter.
+		{"/api/a", "10.0.0.1:2000", 200, "0"},
+		{"/api/a", "10.0.0.1:1000", 429, "0"},
+		// Each route and client is counted separately.
+		{"/api/b", "10.0.0.1:1000", 200, "1"},
+		{"/api/a", "10.0.0.2:1000", 200, "1"},
+		{"/t/x", "10.0.0.1:1000", 200, "0"},
+		{"/t/x", "10.0.0.2:1000", 503, "0"},
+		{"/t/y", "10.0.0.1:1000", 200, "0"},
+		{"/down", "10.0.0.1:1000", 200, ""},
+		{"/down", "10.0.0.1:1000", 200, ""},
+	}
+	for i, test := range tests {
+		w := serve(test.path, test.addr)
+		if w.Code != test.code {
+			t.Errorf("%d: %s from %s expected status %d, saw %d", i, test.path, test.addr, test.code, w.Code)
+		}
+		if remaining := w.Header().Get("X-RateLimit-Remaining"); remaining != test.remaining {
+			t.Errorf("%d: %s expected %q remaining, saw %q", i, test.path, test.remaining, remaining)
+		}
+		if retry := w.Header().Get("Retry-After"); (test.code != 200) != (retry != "") {
+			t.Errorf("%d: %s unexpected Retry-After %q", i, test.path, retry)
+		}
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	count, reset, _ := store.Increment("a", time.Millisecond)
+	if count != 1 || reset.IsZero() {
+		t.Errorf("Expected a new window, saw count %d, reset %v", count, reset)
+	}
+	if count, _, _ = store.Increment("a", time.Millisecond); count != 2 {
+		t.Errorf("Expected count 2, saw %d", count)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if count, _, _ = store.Increment("a", time.Millisecond); count != 1 {
+		t.Errorf("Expected the count to restart in a new window, saw %d", count)
+	}
+
+	// Ended windows are removed as the store grows.
+	for i := 0; i < 1100; i++ {
+		store.Increment(string(rune('a'+i%26))+time.Duration(i).String(), time.Nanosecond)
+	}
+	store.mutex.Lock()
+	size := len(store.windows)
+	store.mutex.Unlock()
+	if size >= 1100 {
+		t.Errorf("Expected ended windows to be removed, saw %d", size)
+	}
+}
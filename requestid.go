@@ -0,0 +1,83 @@
+package httptreemux
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// withRequestID returns the request with its ID added to its context. It is nil when the
+// context package is not available.
+var withRequestID func(r *http.Request, id string) *http.Request
+
+// RequestID gives each request that a TreeMux serves an ID, for matching up the logs,
+// metrics and traces of a request. Set TreeMux.RequestID to use it. The router takes the
+// ID from the request's X-Request-ID header, or generates one if the header is missing,
+// before the route is looked up, so every response has it, including 404 and 405
+// responses and those written by PanicHandler.
+//
+// The ID is sent back in the same header of the response, stored in the request's
+// context, where it can be retrieved with ContextRequestID, and passed to OnRequest in
+// RequestInfo.RequestID. When TreeMux.Metrics implements RequestIDRecorder, it gets the
+// ID as well.
+type RequestID struct {
+	// Header is the request and response header that holds the ID. The default is
+	// X-Request-ID.
+	Header string
+	// Generate returns a new ID. The default returns 32 random hexadecimal digits.
+	Generate func() string
+	// IgnoreIncoming makes the router generate an ID for every request, rather than use
+	// the one the client sent. Set it when the clients aren't trusted, such as when
+	// there is no proxy in front of the router that sets the header.
+	IgnoreIncoming bool
+}
+
+// RequestIDRecorder is implemented by a MetricsRecorder that records the ID of each
+// request, such as for exemplars. When TreeMux.Metrics implements it and
+// TreeMux.RequestID is set, ObserveRequestWithID is called instead of ObserveRequest.
+type RequestIDRecorder interface {
+	ObserveRequestWithID(method, route string, statusCode int, duration time.Duration, size int64, requestID string)
+}
+
+// header returns the name of the header that holds the ID.
+func (ri *RequestID) header() string {
+	if ri.Header == "" {
+		return "X-Request-ID"
+	}
+	return ri.Header
+}
+
+// id returns the ID of the request, from its header if it has a usable one.
+func (ri *RequestID) id(r *http.Request) string {
+	if !ri.IgnoreIncoming {
+		if id := r.Header.Get(ri.header()); validRequestID(id) {
+			return id
+		}
+	}
+	if ri.Generate != nil {
+		return ri.Generate()
+	}
+	return newRequestID()
+}
+
+// validRequestID reports whether an ID sent by a client can be used. It must be made up
+// of up to 128 printable ASCII characters, so that it is safe to write to logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random ID of 32 hexadecimal digits.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
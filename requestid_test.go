@@ -0,0 +1,85 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testRequestIDMetrics struct {
+	ids []string
+}
+
+func (m *testRequestIDMetrics) ObserveRequest(method, route string, statusCode int, duration time.Duration, size int64) {
+	panic("Expected ObserveRequestWithID to be called instead")
+}
+
+func (m *testRequestIDMetrics) ObserveRequestWithID(method, route string, statusCode int, duration time.Duration,
+	size int64, requestID string) {
+	m.ids = append(m.ids, requestID)
+}
+
+func TestRequestID(t *testing.T) {
+	metrics := &testRequestIDMetrics{}
+	var logged []string
+	router := New()
+	router.RequestID = &RequestID{}
+	router.Metrics = metrics
+	router.OnRequest = func(info RequestInfo) {
+		logged = append(logged, info.RequestID)
+	}
+	router.GET("/users", simpleHandler)
+
+	tests := []struct {
+		method   string
+		path     string
+		incoming string
+		code     int
+	}{
+		{"GET", "/users", "abc-123", http.StatusOK},
+		{"GET", "/users", "", http.StatusOK},
+		{"GET", "/missing", "def", http.StatusNotFound},
+		{"POST", "/users", "", http.StatusMethodNotAllowed},
+		{"GET", "/users", "bad\nid", http.StatusOK},
+		{"GET", "/users", strings.Repeat("x", 129), http.StatusOK},
+	}
+	for i, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		if test.incoming != "" {
+			r.Header.Set("X-Request-ID", test.incoming)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		id := w.Header().Get("X-Request-ID")
+		if w.Code != test.code {
+			t.Errorf("%s %s expected code %d, saw %d", test.method, test.path, test.code, w.Code)
+		}
+		if validRequestID(test.incoming) {
+			if id != test.incoming {
+				t.Errorf("%s %s expected the incoming ID %q, saw %q", test.method, test.path, test.incoming, id)
+			}
+		} else if len(id) != 32 {
+			t.Errorf("%s %s expected a generated ID, saw %q", test.method, test.path, id)
+		}
+		if len(logged) != i+1 || logged[i] != id || len(metrics.ids) != i+1 || metrics.ids[i] != id {
+			t.Errorf("%s %s expected the hooks to get ID %q, saw %v and %v", test.method, test.path, id,
+				logged, metrics.ids)
+		}
+	}
+
+	router.RequestID = &RequestID{
+		Header:         "X-Trace",
+		Generate:       func() string { return "generated" },
+		IgnoreIncoming: true,
+	}
+	r, _ := http.NewRequest("GET", "/users", nil)
+	r.Header.Set("X-Trace", "abc")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if id := w.Header().Get("X-Trace"); id != "generated" {
+		t.Errorf("Expected the generated ID, saw %q", id)
+	}
+}
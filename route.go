@@ -0,0 +1,435 @@
+package httptreemux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var errNoRoute = errors.New("No route matches the pattern")
+
+// withRoute returns the request with the pattern of its route added to its context. It
+// is nil when the context package is not available.
+var withRoute func(r *http.Request, pattern string) *http.Request
+
+// withMeta returns the request with the metadata of its route added to its context. It
+// is nil when the context package is not available.
+var withMeta func(r *http.Request, meta map[string]interface{}) *http.Request
+
+// withVariant returns the request with the name of the variant of its route that
+// serves it added to its context. It is nil when the context package is not available.
+var withVariant func(r *http.Request, name string) *http.Request
+
+// Route is returned when a handler is added to the router. Its methods set additional
+// options on the route.
+type Route struct {
+	mux    *TreeMux
+	host   string
+	method string
+	path   string
+	name   string
+	// The patterns the route was added as, which is more than one if it has optional
+	// segments.
+	paths []string
+	// The handler, wrapped in the middleware, and the metadata, for RouteByName. The
+	// metadata is replaced rather than changed, like the node's copy.
+	handler HandlerFunc
+	meta    map[string]interface{}
+	// The deprecation set with Deprecated, or nil.
+	deprecation *Deprecation
+	// wrap wraps a handler in the middleware and route wrappers that the route's
+	// handler was added with, for the other handlers of a Split. The variant is passed
+	// to the route wrappers with the pattern, so that each variant is counted
+	// separately.
+	wrap func(variant string, handler HandlerFunc) HandlerFunc
+	// The route's handler before Split, Variants, Version or a condition replaced it, or
+	// nil.
+	unsplit HandlerFunc
+	// The function that chooses between the variants set with Split or Variants, given
+	// the route's own handler, or nil.
+	variants func(own HandlerFunc) HandlerFunc
+	// The handlers added with Version, by version, or nil.
+	versions map[string]HandlerFunc
+	// The conditions added with WhenQuery, in the order they are checked.
+	conditions []routeCondition
+}
+
+// RouteInfo describes a route, as passed to the function given to WalkRoutes.
+type RouteInfo struct {
+	// Name is the name given to the route with Route.Name, if any.
+	Name   string
+	Method string
+	// Host is the host the route was registered for, or an empty string for the
+	// default tree.
+	Host string
+	// Pattern is the full pattern of the route, as passed to Walk.
+	Pattern string
+	Handler HandlerFunc
+	// Meta holds the metadata added with Route.Meta, or nil if there is none. It must
+	// not be modified.
+	Meta map[string]interface{}
+	// Deprecation is the deprecation set with Route.Deprecated, or nil if the route
+	// isn't deprecated.
+	Deprecation *Deprecation
+}
+
+// Method returns the HTTP method the route was registered for.
+func (r *Route) Method() string {
+	return r.method
+}
+
+// Host returns the host the route was registered for, or an empty string if the
+// route is in the default tree.
+func (r *Route) Host() string {
+	return r.host
+}
+
+// Path returns the full pattern of the route, including any group prefix.
+func (r *Route) Path() string {
+	return r.path
+}
+
+// Name gives the route a name, so that URLs for it can be built with TreeMux.URL.
+// Names must be unique within a router.
+func (r *Route) Name(name string) *Route {
+	if err := r.setName(name); err != nil {
+		panic(err.Error())
+	}
+	return r
+}
+
+// setName is like Name, but returns an error if the name is already used.
+func (r *Route) setName(name string) error {
+	changed := false
+	// This is deferred before the mutex is unlocked, so that it runs afterwards.
+	defer func() {
+		if changed {
+			r.mux.routeChanged(r)
+		}
+	}()
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	if existing, ok := r.mux.namedRoutes[name]; ok && existing != r {
+		return fmt.Errorf("Route name %s is already used by %s %s",
+			name, existing.method, existing.path)
+	}
+
+	if r.name != "" {
+		delete(r.mux.namedRoutes, r.name)
+	}
+
+	if r.mux.namedRoutes == nil {
+		r.mux.namedRoutes = make(map[string]*Route)
+	}
+	r.mux.namedRoutes[name] = r
+	r.name = name
+	changed = true
+	return nil
+}
+
+// TrailingSlash overrides the router's TrailingSlashBehavior for the route's pattern.
+// Like the trailing slash flag itself, the setting is shared by every method
+// registered for the pattern.
+func (r *Route) TrailingSlash(behavior TrailingSlashBehavior) *Route {
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	r.updateNodes(func(n *node) {
+		n.trailingSlash = behavior
+		n.trailingSlashSet = true
+	})
+	return r
+}
+
+// Meta attaches a value to the route under the key, replacing any value already set
+// for the key. Metadata belongs to the route's method, and lets middleware make
+// decisions, such as which users may call a route, without matching on paths. The
+// metadata of the matched route is available from ContextMeta, LookupResult.Meta and
+// WalkRoutes.
+func (r *Route) Meta(key string, value interface{}) *Route {
+	changed := false
+	// This is deferred before the mutex is unlocked, so that it runs afterwards.
+	defer func() {
+		if changed {
+			r.mux.routeChanged(r)
+		}
+	}()
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	changed = r.setMeta(key, value) == nil
+	return r
+}
+
+// setMeta sets the value under the key in the route's metadata. It returns an error if
+// the route has been removed. The router's mutex must be held.
+func (r *Route) setMeta(key string, value interface{}) error {
+	meta := withMetaValue(r.meta, key, value)
+	err := r.updateNodes(func(n *node) {
+		if n.leafMeta == nil {
+			n.leafMeta = make(map[string]map[string]interface{})
+		}
+		n.leafMeta[r.method] = meta
+	})
+	if err == nil {
+		r.meta = meta
+	}
+	return err
+}
+
+// withMetaValue returns a copy of the metadata with the value set under the key. The
+// metadata is copied rather than changed, since the nodes of published trees share it.
+func withMetaValue(meta map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(meta)+1)
+	for k, v := range meta {
+		copied[k] = v
+	}
+	copied[key] = value
+	return copied
+}
+
+// updateNodes calls fn with a copy of the node for each of the route's patterns, and
+// publishes the changed tree. Nothing is changed if the route has been removed. The
+// router's mutex must be held.
+func (r *Route) updateNodes(fn func(n *node)) error {
+	t := r.mux
+	return t.updateTree(r.host, func(root *node) error {
+		for _, path := range r.paths {
+			path, _ = t.trimTrailingSlash(path)
+
+			// Walking the existing pattern with addPath copies the nodes along the way.
+			n, err := root.addPath(path[1:], nil)
+			if err != nil {
+				return err
+			}
+			if _, ok := n.leafHandler[r.method]; !ok {
+				// The route has been removed.
+				return errNoRoute
+			}
+			fn(n)
+		}
+		return nil
+	})
+}
+
+// URL builds the path for the route with the given name, filling in its wildcards and
+// catch-all from params. Wildcard values are escaped so that they match a single path
+// segment, while the slashes in a catch-all value are kept as segment separators. For a
+// pattern with optional segments, those whose params are missing are left out.
+func (t *TreeMux) URL(name string, params map[string]string) (string, error) {
+	t.mutex.Lock()
+	route, ok := t.namedRoutes[name]
+	t.mutex.Unlock()
+	if !ok {
+		return "", fmt.Errorf("No route named %s", name)
+	}
+
+	// A pattern with optional segments uses the longest of its paths that has all of its
+	// params, so that the optional ones can be left out.
+	for i := len(route.paths) - 1; i > 0; i-- {
+		path, err := buildPath(route.paths[i], params)
+		if _, missing := err.(missingParamError); !missing {
+			return path, err
+		}
+	}
+	return buildPath(route.paths[0], params)
+}
+
+// missingParamError is returned by buildPath when params lacks one of the pattern's
+// wildcards.
+type missingParamError struct {
+	name, pattern string
+}
+
+func (e missingParamError) Error() string {
+	return fmt.Sprintf("Missing parameter %s for pattern %s", e.name, e.pattern)
+}
+
+// RouteByName returns a description of the route with the given name, including its
+// handler and metadata. The handler is wrapped in the middleware it was added with, so
+// calling it is like serving a request that matched the route, without another trip
+// through the router. The boolean result is false if no route has the name.
+func (t *TreeMux) RouteByName(name string) (RouteInfo, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	route, ok := t.namedRoutes[name]
+	if !ok {
+		return RouteInfo{}, false
+	}
+	return RouteInfo{
+		Name:        name,
+		Method:      route.method,
+		Host:        route.host,
+		Pattern:     route.path,
+		Handler:     route.handler,
+		Meta:        route.meta,
+		Deprecation: route.deprecation,
+	}, true
+}
+
+// routeNames returns the names of the routes for the host, keyed by their method and
+// pattern separated by a space.
+func (t *TreeMux) routeNames(host string) map[string]string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	names := make(map[string]string, len(t.namedRoutes))
+	for name, route := range t.namedRoutes {
+		if route.host == host {
+			names[route.method+" "+route.path] = name
+		}
+	}
+	return names
+}
+
+// HandlerByName returns the handler of the route with the given name. See RouteByName.
+func (t *TreeMux) HandlerByName(name string) (HandlerFunc, bool) {
+	info, ok := t.RouteByName(name)
+	return info.Handler, ok
+}
+
+func buildPath(pattern string, params map[string]string) (string, error) {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if len(segment) == 0 {
+			continue
+		}
+
+		c := segment[0]
+		if c != ':' && c != '*' {
+			continue
+		}
+
+		name := segment[1:]
+		suffix := ""
+		if c == '*' {
+			name, suffix = splitCatchAll(name)
+		} else {
+			if names, template, _ := splitMultiWildcard(name); names != nil {
+				value, err := buildMultiWildcard(pattern, names, template, params)
+				if err != nil {
+					return "", err
+				}
+				segments[i] = value
+				continue
+			}
+
+			// Drop the wildcard's constraint.
+			name, _, _ = splitWildcard(name)
+		}
+
+		value, ok := params[name]
+		if !ok {
+			return "", missingParamError{name, pattern}
+		}
+
+		if c == ':' {
+			if len(value) == 0 {
+				return "", fmt.Errorf("Empty value for parameter %s in pattern %s", name, pattern)
+			}
+			segments[i] = escapePathSegment(value)
+		} else {
+			parts := strings.Split(value, "/")
+			for j, part := range parts {
+				parts[j] = escapePathSegment(part)
+			}
+			segments[i] = strings.Join(parts, "/") + suffix
+		}
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// patternNames returns the names of the wildcards and catch-all in a pattern. Optional
+// wildcards are left out, since a request may not have them.
+func patternNames(pattern string) []string {
+	var names []string
+	for _, segment := range strings.Split(pattern, "/") {
+		if len(segment) == 0 {
+			continue
+		}
+
+		switch segment[0] {
+		case '*':
+			name, _ := splitCatchAll(segment[1:])
+			names = append(names, name)
+		case ':':
+			if segment[len(segment)-1] == '?' && strings.IndexByte(segment, '|') == -1 {
+				continue
+			}
+			if multi, _, _ := splitMultiWildcard(segment[1:]); multi != nil {
+				names = append(names, multi...)
+				continue
+			}
+			name, _, _ := splitWildcard(segment[1:])
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// buildMultiWildcard fills in a segment with several wildcards from its template.
+func buildMultiWildcard(pattern string, names []string, template string, params map[string]string) (string, error) {
+	var buf []byte
+	name := 0
+	for i := 0; i < len(template); i++ {
+		if template[i] != ':' {
+			buf = append(buf, template[i])
+			continue
+		}
+
+		value, ok := params[names[name]]
+		if !ok {
+			return "", missingParamError{names[name], pattern}
+		} else if len(value) == 0 {
+			return "", fmt.Errorf("Empty value for parameter %s in pattern %s", names[name], pattern)
+		}
+		buf = append(buf, escapePathSegment(value)...)
+		name++
+	}
+	return string(buf), nil
+}
+
+// shouldEscape reports whether the byte must be percent-encoded inside a path segment.
+// Along with the reserved characters, + is escaped, since some servers and clients
+// treat it as a space.
+func shouldEscape(c byte) bool {
+	if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+		return false
+	}
+
+	switch c {
+	case '-', '.', '_', '~', '!', '$', '&', '\'', '(', ')', '*', ',', ';', '=', ':', '@':
+		return false
+	}
+	return true
+}
+
+func escapePathSegment(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	escapeCount := 0
+	for i := 0; i < len(s); i++ {
+		if shouldEscape(s[i]) {
+			escapeCount++
+		}
+	}
+
+	if escapeCount == 0 {
+		return s
+	}
+
+	buf := make([]byte, 0, len(s)+2*escapeCount)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if shouldEscape(c) {
+			buf = append(buf, '%', hex[c>>4], hex[c&15])
+		} else {
+			buf = append(buf, c)
+		}
+	}
+	return string(buf)
+}
@@ -0,0 +1,206 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	router := New()
+	router.GET("/", simpleHandler).Name("index")
+	router.GET("/users/:id", simpleHandler).Name("user.show")
+	router.Group("/files").GET("/:owner/*path", simpleHandler).Name("files")
+	router.GET("/posts/", simpleHandler).Name("posts")
+	router.GET("/orders/:id|^[0-9]+$", simpleHandler).Name("order")
+	router.GET("/items/:id:int", simpleHandler).Name("item")
+	router.GET("/downloads/:name.:ext", simpleHandler).Name("download")
+	router.GET("/scripts/*path.js", simpleHandler).Name("script")
+	router.GET("/articles/:year/:month?/:day?", simpleHandler).Name("articles")
+
+	tests := []struct {
+		name     string
+		params   map[string]string
+		expected string
+	}{
+		{"index", nil, "/"},
+		{"user.show", map[string]string{"id": "42"}, "/users/42"},
+		{"user.show", map[string]string{"id": "a/b c+d"}, "/users/a%2Fb%20c%2Bd"},
+		{"files", map[string]string{"owner": "me", "path": "a b/c.txt"}, "/files/me/a%20b/c.txt"},
+		{"posts", nil, "/posts/"},
+		{"order", map[string]string{"id": "7"}, "/orders/7"},
+		{"item", map[string]string{"id": "8"}, "/items/8"},
+		{"download", map[string]string{"name": "a b", "ext": "pdf"}, "/downloads/a%20b.pdf"},
+		{"script", map[string]string{"path": "lib/app"}, "/scripts/lib/app.js"},
+		{"articles", map[string]string{"year": "2020"}, "/articles/2020"},
+		{"articles", map[string]string{"year": "2020", "month": "05"}, "/articles/2020/05"},
+		{"articles", map[string]string{"year": "2020", "month": "05", "day": "17"}, "/articles/2020/05/17"},
+		{"articles", map[string]string{"year": "2020", "day": "17"}, "/articles/2020"},
+	}
+
+	for _, test := range tests {
+		url, err := router.URL(test.name, test.params)
+		if err != nil {
+			t.Errorf("Route %s returned error %s", test.name, err)
+		} else if url != test.expected {
+			t.Errorf("Route %s with params %v expected URL %s, saw %s",
+				test.name, test.params, test.expected, url)
+		}
+	}
+
+	if _, err := router.URL("user.show", nil); err == nil {
+		t.Error("Expected error for missing parameter")
+	}
+
+	if _, err := router.URL("user.show", map[string]string{"id": ""}); err == nil {
+		t.Error("Expected error for empty wildcard parameter")
+	}
+
+	if _, err := router.URL("articles", map[string]string{"month": "05"}); err == nil {
+		t.Error("Expected error for missing required parameter of optional pattern")
+	}
+
+	if _, err := router.URL("nothing", nil); err == nil {
+		t.Error("Expected error for unknown route name")
+	}
+}
+
+func TestURLRoundTrip(t *testing.T) {
+	var sawParams map[string]string
+	handler := func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		sawParams = params
+	}
+
+	router := New()
+	router.GET("/users/:id/*rest", handler).Name("user")
+
+	params := map[string]string{"id": "a/b c+d", "rest": "x y/z%"}
+	url, err := router.URL("user", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := newRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	for key, value := range params {
+		if sawParams[key] != value {
+			t.Errorf("URL %s expected param %s=%q, saw %q", url, key, value, sawParams[key])
+		}
+	}
+}
+
+func TestDuplicateRouteName(t *testing.T) {
+	defer func() {
+		if err := recover(); err == nil {
+			t.Error("Expected panic when reusing a route name")
+		}
+	}()
+
+	router := New()
+	router.GET("/a", simpleHandler).Name("a")
+	router.GET("/b", simpleHandler).Name("a")
+}
+
+func TestRouteMeta(t *testing.T) {
+	router := New()
+	route := router.GET("/users/:id", simpleHandler).Meta("auth", "user").Meta("scope", "read")
+	router.POST("/users/:id", simpleHandler)
+	router.GET("/posts/:year/:month?", simpleHandler).Meta("cache", 60)
+
+	lr, _ := router.Lookup("GET", "/users/1")
+	if expected := map[string]interface{}{"auth": "user", "scope": "read"}; !reflect.DeepEqual(lr.Meta, expected) {
+		t.Errorf("Expected metadata %v, saw %v", expected, lr.Meta)
+	}
+	if lr, _ := router.Lookup("POST", "/users/1"); lr.Meta != nil {
+		t.Errorf("Expected no metadata for POST, saw %v", lr.Meta)
+	}
+
+	// Every form of a pattern with optional segments gets the metadata.
+	for _, path := range []string{"/posts/2024", "/posts/2024/05"} {
+		if lr, _ := router.Lookup("GET", path); lr.Meta["cache"] != 60 {
+			t.Errorf("%s expected cache metadata, saw %v", path, lr.Meta)
+		}
+	}
+
+	// Replacing a value doesn't change the map returned by earlier lookups.
+	route.Meta("auth", "admin")
+	if lr.Meta["auth"] != "user" {
+		t.Errorf("Expected earlier lookup to keep auth user, saw %v", lr.Meta["auth"])
+	}
+
+	found := map[string]interface{}{}
+	router.WalkRoutes(func(info RouteInfo) bool {
+		if info.Handler == nil {
+			t.Errorf("Nil handler for %s %s", info.Method, info.Pattern)
+		}
+		found[info.Method+" "+info.Pattern] = info.Meta["auth"]
+		return true
+	})
+	if found["GET /users/:id"] != "admin" || found["POST /users/:id"] != nil {
+		t.Errorf("Unexpected metadata from WalkRoutes: %v", found)
+	}
+
+	// Removing the route removes its metadata.
+	router.Remove("GET", "/users/:id")
+	router.GET("/users/:id", simpleHandler)
+	if lr, _ := router.Lookup("GET", "/users/1"); lr.Meta != nil {
+		t.Errorf("Expected no metadata after the route was added again, saw %v", lr.Meta)
+	}
+}
+
+func TestRouteByName(t *testing.T) {
+	var calls []string
+	router := New()
+	router.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			calls = append(calls, "middleware")
+			next(w, r, params)
+		}
+	})
+	router.GET("/users/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		calls = append(calls, "user "+params["id"])
+	}).Name("user.show").Meta("auth", "user")
+	router.Host("example.com").POST("/orders", simpleHandler).Name("order.create")
+
+	info, ok := router.RouteByName("user.show")
+	if !ok {
+		t.Fatal("Expected to find route user.show")
+	}
+	if info.Name != "user.show" || info.Method != "GET" || info.Host != "" || info.Pattern != "/users/:id" ||
+		info.Meta["auth"] != "user" {
+		t.Errorf("Unexpected route info %+v", info)
+	}
+
+	handler, ok := router.HandlerByName("user.show")
+	if !ok {
+		t.Fatal("Expected to find handler for user.show")
+	}
+	handler(httptest.NewRecorder(), nil, map[string]string{"id": "5"})
+	if expected := []string{"middleware", "user 5"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected calls %v, saw %v", expected, calls)
+	}
+
+	if info, ok := router.RouteByName("order.create"); !ok || info.Host != "example.com" || info.Method != "POST" {
+		t.Errorf("Unexpected route info for order.create: %+v, %v", info, ok)
+	}
+
+	names := map[string]string{}
+	router.WalkRoutes(func(info RouteInfo) bool {
+		names[info.Method+" "+info.Pattern] = info.Name
+		return true
+	})
+	if names["GET /users/:id"] != "user.show" {
+		t.Errorf("Expected WalkRoutes to include the route name, saw %v", names)
+	}
+
+	router.Remove("GET", "/users/:id")
+	if _, ok := router.RouteByName("user.show"); ok {
+		t.Error("Expected removed route not to be found by name")
+	}
+	if _, ok := router.HandlerByName("nothing"); ok {
+		t.Error("Expected no handler for unknown name")
+	}
+}
@@ -5,35 +5,80 @@
 package httptreemux
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"github.com/dimfeld/httppath"
+	"net"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // The params argument contains the parameters parsed from wildcards and catch-alls in the URL.
 type HandlerFunc func(http.ResponseWriter, *http.Request, map[string]string)
 type PanicHandler func(http.ResponseWriter, *http.Request, interface{})
 
+// MiddlewareFunc wraps a HandlerFunc, returning a new HandlerFunc that typically
+// does some work before or after calling next.
+type MiddlewareFunc func(next HandlerFunc) HandlerFunc
+
 // RedirectBehavior sets the behavior when the router redirects the request to the
 // canonical version of the requested URL using RedirectTrailingSlash or RedirectClean.
 // The default behavior is to return a 301 status, redirecting the browser to the version
 // of the URL that matches the given pattern.
 //
 // On a POST request, most browsers that receive a 301 will submit a GET request to
-// the redirected URL, meaning that any data will likely be lost. If you want to handle
-// and avoid this behavior, you may use Redirect307, which causes most browsers to
-// resubmit the request using the original method and request body.
-//
-// Since 307 is supposed to be a temporary redirect, the new 308 status code has been
-// proposed, which is treated the same, except it indicates correctly that the redirection
-// is permanent. The big caveat here is that the RFC is relatively recent, and older
-// browsers will not know what to do with it. Therefore its use is not recommended
-// unless you really know what you're doing.
+// the redirected URL, meaning that any data will likely be lost. To avoid this,
+// TreeMux.RedirectNonGetBehavior replaces Redirect301 for methods other than GET and
+// HEAD, and defaults to Redirect308, which causes browsers to resubmit the request using
+// the original method and request body. Redirect307 does the same, but indicates that
+// the redirection is temporary.
 //
 // Finally, the UseHandler value will simply call the handler function for the pattern.
 type RedirectBehavior int
 
+// TrailingSlashBehavior sets how the router handles a request whose path differs from a
+// matching pattern only by a trailing slash.
+type TrailingSlashBehavior int
+
+const (
+	TrailingSlashRedirect   TrailingSlashBehavior = iota // Redirect to the form the pattern was added with
+	TrailingSlashAdd                                     // Redirect to the version with a trailing slash
+	TrailingSlashRemove                                  // Redirect to the version without a trailing slash
+	TrailingSlashEquivalent                              // Call the handler for either version
+	TrailingSlashStrict                                  // Only match the form the pattern was added with
+)
+
+// EncodedSlashBehavior sets how the router handles an encoded slash (%2F) in the path of
+// a request. It only applies when PathSource is RequestURI, since URL.Path has already
+// been unescaped.
+type EncodedSlashBehavior int
+
+const (
+	EncodedSlashInParam   EncodedSlashBehavior = iota // Keep the slash inside the segment's value
+	EncodedSlashSeparator                             // Treat the slash as a path separator
+	EncodedSlashReject                                // Respond with 400 Bad Request
+)
+
+// AnyMethod is the method to pass to Handle to add a handler for every method that has
+// no handler of its own, as Any does.
+const AnyMethod = "*"
+
+// MatchKind is a kind of child of a node in the routing tree, for TreeMux.Precedence.
+type MatchKind int
+
+const (
+	MatchStatic      MatchKind = iota // Static path segments
+	MatchConstrained                  // Wildcards with a regular expression or type, and segments with several wildcards
+	MatchWildcard                     // Wildcards without a constraint
+	MatchCatchAll                     // Catch-alls, with those that have a suffix first
+)
+
 type PathSource int
 
 const (
@@ -46,32 +91,143 @@ const (
 	URLPath                      // Use r.URL.Path
 )
 
-type TreeMux struct {
+// Redirect302 returns 302 Found, a temporary redirect that most clients follow with a
+// GET request. It comes after UseHandler so that the values of the others don't change.
+const Redirect302 = UseHandler + 1
+
+// RedirectReason is the reason that the router redirects a request to the canonical
+// version of its URL, for TreeMux.RedirectReasonBehavior.
+type RedirectReason int
+
+const (
+	ReasonTrailingSlash RedirectReason = iota // The trailing slash differs from the route's
+	ReasonCleanPath                           // The path has . or .. segments or repeated slashes
+	ReasonCase                                // The path only matched without regard to case, with RedirectCase
+)
+
+// routingTrees holds the trees that requests are matched against. Registration never
+// modifies a routingTrees that has been published. Instead it copies the nodes it
+// changes and publishes a new routingTrees, so requests being served always see a
+// complete tree.
+type routingTrees struct {
 	root *node
 
-	// The default PanicHandler just returns a 500 code.
+	// The trees for routes added with Host, keyed by the lowercase host name.
+	hosts map[string]*node
+	// The keys of hosts that have params, in the order they are tried.
+	hostPatterns []string
+
+	// The NotFound, MethodNotAllowed and maintenance handlers set on groups, with the
+	// longest paths first.
+	groupHandlers []*groupHandlers
+	// True if any group is in maintenance mode.
+	maintenance bool
+}
+
+type TreeMux struct {
+	// The number of requests being served, when CountInFlight is set. It is first in the
+	// struct so that it is aligned for atomic access on 32-bit platforms.
+	inFlight int64
+
+	// The current *routingTrees.
+	trees atomic.Value
+
+	// Serializes changes to the routes, the middleware stack, and the route names.
+	mutex sync.Mutex
+
+	// The []Hooks added with AddHooks.
+	hooks atomic.Value
+
+	// The middleware stack added with Use, applied to handlers as they are registered.
+	middleware []MiddlewareFunc
+
+	// Routes that have been given a name with Route.Name.
+	namedRoutes map[string]*Route
+
+	// PanicHandler is called when a handler or the router itself panics while
+	// serving a request. The err argument is a *PanicError containing the
+	// recovered value and the pattern of the matched route. The default
+	// PanicHandler is SimplePanicHandler, which just returns a 500 code. Set
+	// it to nil to let panics propagate to the http server.
 	PanicHandler PanicHandler
-	// The default NotFoundHandler is http.NotFound.
-	NotFoundHandler func(w http.ResponseWriter, r *http.Request)
+	// ErrorHandler is called with the error returned by a handler added with HandleE,
+	// and writes the response for it. The default ErrorHandler is SimpleErrorHandler,
+	// which maps the error to a status code.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+	// Metrics, if set, is called after each request with the pattern of the route that
+	// served it, the response's status code and size, and how long it took. See
+	// MetricsRecorder.
+	Metrics MetricsRecorder
+	// Tracer, if set, is called for each request once its route has been found, so that
+	// a tracing span can be given the route's pattern. See Tracer.
+	Tracer Tracer
+	// OnRequest, if set, is called after each request with the request's route, params
+	// and response, such as for writing an access log. See RequestInfo.
+	OnRequest func(info RequestInfo)
+	// CountHits counts the requests served by each route, which RouteStats and
+	// PublishRouteStats report, so that routes that are never used can be found. The
+	// counters are atomic, so the cost is small. This is false by default.
+	CountHits bool
+	// LatencyBuckets, if not nil, makes the router keep a histogram of how long each
+	// route takes to serve requests, including its middleware, with buckets that have
+	// these upper bounds. RouteStats reports the histograms, and ExportHistograms passes
+	// them to Metrics. DefaultLatencyBuckets suits most services. It should be set
+	// before serving requests. This is nil by default.
+	LatencyBuckets []time.Duration
+	// CountInFlight counts the requests that are being served, by the router as a whole
+	// and by each route, which InFlight and RouteStats report, so that the route holding
+	// up goroutines during an overload can be found. This is false by default.
+	CountInFlight bool
+	// NotFoundHandler is called when no route matches the request, after the router
+	// has tried the trailing slash and clean path fallbacks. The default
+	// NotFoundHandler is NotFoundHandler, which responds as http.NotFound does. A group
+	// can replace it for the paths within it with Group.SetNotFoundHandler.
+	NotFoundHandler http.HandlerFunc
+
+	// Suggestions, if greater than zero, is the number of routes with patterns similar
+	// to the path of a request that matches no route to list in the response, for use
+	// during development. They are stored in the request's context, where
+	// ContextSuggestions retrieves them for a custom NotFoundHandler, and listed in the
+	// body by the default one. Finding them looks at every route, so this should not be
+	// used in production. It is zero by default, and requires Go 1.7 or later.
+	Suggestions int
 	// The default OptionsHandler is a nil function. Set this function to
 	// automatically register a global OPTIONS handler for all registered paths.
 	OptionsHandler HandlerFunc
+	// AutoOptions makes the router answer OPTIONS requests for patterns that have no
+	// OPTIONS handler by calling AutoOptionsHandler, instead of responding with
+	// MethodNotAllowedHandler. This is false by default.
+	AutoOptions bool
+	// AutoOptionsHandler is called for OPTIONS requests when AutoOptions is true and
+	// the pattern has no OPTIONS handler. The methods parameter is the same as for
+	// MethodNotAllowedHandler, and includes OPTIONS itself. The default handler,
+	// AutoOptionsHandler, sets the Allow header and writes http.StatusOK. Replace it
+	// to customize the response, for example by adding CORS headers.
+	AutoOptionsHandler func(w http.ResponseWriter, r *http.Request,
+		methods map[string]HandlerFunc)
 	// MethodNotAllowedHandler is called when a pattern matches, but that
 	// pattern does not have a handler for the requested method. The default
 	// handler just writes the status code http.StatusMethodNotAllowed and adds
-	// the required Allowed header.
+	// the required Allow header.
 	// The methods parameter contains the map of each method to the corresponding
-	// handler function.
+	// handler function. When HeadCanUseGet is true and the pattern has a GET handler,
+	// the map also includes HEAD, and when AutoOptions is true it includes OPTIONS.
+	// A group can replace it for the paths within it with
+	// Group.SetMethodNotAllowedHandler.
 	MethodNotAllowedHandler func(w http.ResponseWriter, r *http.Request,
 		methods map[string]HandlerFunc)
 	// HeadCanUseGet allows the router to use the GET handler to respond to
 	// HEAD requests if no explicit HEAD handler has been added for the
-	// matching pattern. This is true by default.
+	// matching pattern. The GET handler's headers are sent, but anything it writes
+	// to the body is discarded. Set this to false to respond to such requests with
+	// MethodNotAllowedHandler instead. This is true by default.
 	HeadCanUseGet bool
 
-	// RedirectCleanPath allows the router to try clean the current request path,
-	// if no handler is registered for it, using CleanPath from github.com/dimfeld/httppath.
-	// This is true by default.
+	// RedirectCleanPath allows the router to clean the current request path using
+	// Clean from github.com/dimfeld/httppath, removing duplicate slashes and . and ..
+	// elements. If the clean path matches a route, the request is redirected to it
+	// before the original path is searched, so that unclean paths never reach a
+	// wildcard or catch-all. This is true by default.
 	RedirectCleanPath bool
 
 	// RedirectTrailingSlash enables automatic redirection in case router doesn't find a matching route
@@ -79,6 +235,36 @@ type TreeMux struct {
 	// slash exists. This is true by default.
 	RedirectTrailingSlash bool
 
+	// CaseInsensitive allows static path segments to match without regard to case
+	// when no route matches the path exactly. Wildcard and catch-all values keep
+	// the case used in the request. This is false by default.
+	CaseInsensitive bool
+
+	// RedirectCase redirects requests whose paths CaseInsensitive matched with a
+	// different case to the path with the case of the route's static segments, instead
+	// of serving them, so that each page has a single URL. Wildcard and catch-all values
+	// keep the case used in the request. The redirect follows RedirectBehavior, like
+	// those for trailing slashes. This is false by default.
+	RedirectCase bool
+
+	// BacktrackMethods lets the search continue when a request's path matches a route
+	// that has no handler for its method, so that a wildcard or catch-all with a
+	// handler for the method can match instead. With GET /users/new and
+	// POST /users/:id, a POST to /users/new then goes to the wildcard rather than
+	// MethodNotAllowedHandler. This is false by default.
+	BacktrackMethods bool
+
+	// Precedence is the order in which the kinds of children of each node in the tree
+	// are tried. Kinds that are left out are never matched. The default, when this is
+	// nil, is MatchStatic, MatchConstrained, MatchWildcard, MatchCatchAll.
+	Precedence []MatchKind
+
+	// TrailingSlashBehavior chooses what happens when RedirectTrailingSlash is true and
+	// a request's trailing slash doesn't match the pattern. The default value is
+	// TrailingSlashRedirect. This can be overridden for a single pattern with
+	// Route.TrailingSlash.
+	TrailingSlashBehavior TrailingSlashBehavior
+
 	// RemoveCatchAllTrailingSlash removes the trailing slash when a catch-all pattern
 	// is matched, if set to true. By default, catch-all paths are never redirected.
 	RemoveCatchAllTrailingSlash bool
@@ -87,8 +273,21 @@ type TreeMux struct {
 	// RedirectCleanPath are true. The default value is Redirect301.
 	RedirectBehavior RedirectBehavior
 
+	// RedirectReasonBehavior overrides RedirectBehavior for redirects made for a
+	// particular reason, such as to use Redirect307 for trailing slashes while URLs are
+	// being migrated, so that caches don't keep the redirects.
+	RedirectReasonBehavior map[RedirectReason]RedirectBehavior
+
+	// RedirectNonGetBehavior replaces Redirect301 from RedirectBehavior or
+	// RedirectReasonBehavior for methods other than GET and HEAD, since most clients
+	// turn a POST that gets a 301 into a GET and drop its body. The default value is
+	// Redirect308, which keeps the method and body. Set it to Redirect301 to use 301 for
+	// every method.
+	RedirectNonGetBehavior RedirectBehavior
+
 	// RedirectMethodBehavior overrides the default behavior for a particular HTTP method.
 	// The key is the method name, and the value is the behavior to use for that method.
+	// It takes precedence over RedirectReasonBehavior.
 	RedirectMethodBehavior map[string]RedirectBehavior
 
 	// PathSource determines from where the router gets its path to search.
@@ -100,20 +299,360 @@ type TreeMux struct {
 	// better compatibility with some utility functions in the http
 	// library that modify the Request before passing it to the router.
 	PathSource PathSource
+
+	// EncodedSlashBehavior chooses what happens to encoded slashes (%2F) in the request
+	// path when PathSource is RequestURI. By default, with EncodedSlashInParam, an
+	// encoded slash is part of the segment it appears in, and is unescaped to a slash
+	// in the value of a wildcard or catch-all. EncodedSlashSeparator treats it like
+	// any other slash, and EncodedSlashReject responds to the request with a 400 code.
+	EncodedSlashBehavior EncodedSlashBehavior
+
+	// RawParams passes the values of wildcards and catch-alls to handlers exactly as
+	// they appear in the request path, without unescaping them. This is useful when
+	// the values must be byte-exact, such as for signed URLs. Constraints and types
+	// are still matched against the unescaped values. Since URL.Path is already
+	// unescaped, this only has an effect when PathSource is RequestURI. This is false
+	// by default.
+	RawParams bool
+
+	// ReuseParams makes the router keep the params maps passed to handlers in a pool,
+	// and reuse them for later requests once the handler has returned. This reduces
+	// garbage collection under heavy load, but handlers and middleware must not keep
+	// the map, or the context holding it, after they return, such as by using it in
+	// another goroutine. Copy any values that are needed later. This is false by
+	// default.
+	ReuseParams bool
+	paramsPool  sync.Pool
+
+	// RouteInContext stores the pattern of the matched route, such as /users/:id, in
+	// the request's context before the handler and its middleware are called. It can
+	// be retrieved with ContextRoute, and is useful for metrics and logging that need
+	// the route rather than the path. Since this allocates a new request and context
+	// for every request, it is false by default. It requires Go 1.7 or later.
+	RouteInContext bool
+
+	// CORS is the policy for cross-origin requests to routes that don't have one of
+	// their own from Group.CORS or Route.CORS. The router answers preflight requests for
+	// routes with a policy itself. This is nil by default, which turns off CORS.
+	CORS *CORS
+
+	// JWT checks the bearer tokens of requests for routes that require scopes with
+	// Route.Require. If it is nil, requests for those routes are rejected. This is nil
+	// by default.
+	JWT *JWTAuth
+
+	// Locales, if not nil, lets paths start with a locale, which is passed to the
+	// handler in the locale param. This is nil by default.
+	Locales *Locales
+
+	// FormatExtensions lists file extensions, without the dot, that are treated as the
+	// format of the response rather than as part of the path. When the last segment of
+	// a request's path ends with one of them, such as /reports/123.json, the route is
+	// looked up without it, and the extension is passed to the handler in the format
+	// param. If no route matches the path without the extension, the whole path is
+	// looked up instead. This is nil by default.
+	FormatExtensions []string
+
+	// Versioning, if not nil, sets how the versions of routes that have them with
+	// Route.Version are chosen from the vendor media types in Accept headers.
+	Versioning *Versioning
+
+	// Compression, if not nil, compresses the responses of routes that don't have a
+	// Compression of their own from Group.Compression or Route.Compression, for clients
+	// that accept it. This is nil by default.
+	Compression *Compression
+
+	// SecurityHeaders, if not nil, sets security headers such as Strict-Transport-Security
+	// on every response, including those for requests that match no route. This is nil
+	// by default.
+	SecurityHeaders *SecurityHeaders
+
+	// RequestID, if not nil, gives each request an ID, taken from a header of the
+	// request or generated, which is sent back in the response and passed to the
+	// logging and metrics hooks. This is nil by default.
+	RequestID *RequestID
+
+	// MethodOverride, if not nil, lets requests ask for a different method, such as with
+	// an X-HTTP-Method-Override header or a _method form field, before their route is
+	// looked up. This is nil by default.
+	MethodOverride *MethodOverride
 }
 
-// Dump returns a text representation of the routing tree.
+// Use appends a middleware function to the router's middleware stack. Every handler
+// registered after this call is wrapped by the stack, with the first middleware added
+// being the outermost one. Routes registered before Use is called are not affected, so
+// the middleware stack should normally be set up before adding any routes.
+func (t *TreeMux) Use(middleware MiddlewareFunc) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.middleware = append(t.middleware, middleware)
+}
+
+// With returns a group at the root of the router whose handlers are wrapped by the given
+// middleware, inside the router's own middleware. See Group.With.
+func (t *TreeMux) With(middleware ...MiddlewareFunc) *Group {
+	return (&Group{mux: t}).With(middleware...)
+}
+
+// wrapHandler applies the middleware stack to a handler.
+func (t *TreeMux) wrapHandler(handler HandlerFunc) HandlerFunc {
+	return applyMiddleware(t.middleware, handler)
+}
+
+// applyMiddleware wraps a handler in a middleware stack, with the first middleware
+// being the outermost one.
+func applyMiddleware(middleware []MiddlewareFunc, handler HandlerFunc) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Dump returns a text representation of the routing tree, followed by the tree for
+// each host.
 func (t *TreeMux) Dump() string {
-	return t.root.dumpTree("", "")
+	trees := t.loadTrees()
+	dump := trees.root.dumpTree("", "")
+
+	hosts := make([]string, 0, len(trees.hosts))
+	for host := range trees.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		dump += "host " + host + "\n" + trees.hosts[host].dumpTree("", "")
+	}
+	return dump
+}
+
+// Walk calls fn for each handler in the default tree, with its method and the full
+// pattern of its route, until fn returns false. Routes are visited in the order the
+// tree would try them, and methods in alphabetical order. Handlers that were added
+// automatically from OptionsHandler are skipped. Use Group.Walk for the routes of
+// a host or a path prefix. The walk uses the routes as they were when Walk was
+// called, even if routes are changed while it runs.
+func (t *TreeMux) Walk(fn func(method, path string, handler HandlerFunc) bool) {
+	t.loadTrees().root.walk([]walkPiece{{text: "/"}},
+		func(n *node, method, path string, handler HandlerFunc) bool {
+			return fn(method, path, handler)
+		})
+}
+
+// Redirect adds a route that redirects requests for from to the path to, such as
+// router.Redirect("/old/users/:id", "/users/:id", http.StatusMovedPermanently). The
+// wildcards and catch-all of to are filled in from the values that matched from, and
+// the query string of the request is kept. To may also be an absolute URL, such as
+// https://example.com/users/:id. Redirect panics if to uses a wildcard that from
+// doesn't have, or if the status code is not 301, 302, 303, 307 or 308. The routes for
+// all of the methods are added together, so none are added if one of them conflicts
+// with an existing route.
+//
+// The route handles GET, and HEAD through HeadCanUseGet. With
+// http.StatusTemporaryRedirect or http.StatusPermanentRedirect, which keep the method of
+// the request, it also handles POST, PUT, PATCH and DELETE. The Route returned is the
+// one for GET.
+func (t *TreeMux) Redirect(from, to string, statusCode int) *Route {
+	return (&Group{mux: t}).Redirect(from, to, statusCode)
+}
+
+// WalkRoutes calls fn for each handler in the default tree, with a description of its
+// route that includes its metadata, until fn returns false. It visits routes in the
+// same order as Walk. Use Group.WalkRoutes for the routes of a host or a path prefix.
+func (t *TreeMux) WalkRoutes(fn func(route RouteInfo) bool) {
+	(&Group{mux: t}).WalkRoutes(fn)
+}
+
+// Mount adds the routes of another router under the path, so that separately developed
+// parts of an application can each build their own router. The routes are copied into
+// this router's tree when Mount is called, so there is no extra cost when looking them
+// up, but routes added to sub afterwards are not mounted. The handlers keep the
+// middleware of sub, inside this router's middleware. Only the routes in the default
+// tree of sub are mounted, and its settings and error handlers don't apply to them.
+// Like Handle, Mount panics if a route conflicts with one that already exists.
+func (t *TreeMux) Mount(path string, sub *TreeMux) {
+	(&Group{mux: t}).Mount(path, sub)
+}
+
+// MountHandler passes requests under the path to handler, with the part of the path
+// before the catch-all removed, as by http.StripPrefix. The path must end with a
+// catch-all, such as /debug/*path, so a request for /debug/vars is passed to handler
+// with the path /vars, and a request for /debug/ with the path /. Routes are added for
+// the GET, HEAD, POST, PUT, PATCH, DELETE and OPTIONS methods, and handler is
+// responsible for any of them that it doesn't support.
+func (t *TreeMux) MountHandler(path string, handler http.Handler) {
+	(&Group{mux: t}).MountHandler(path, handler)
+}
+
+// Swap replaces all of the router's routes with those of other, including the routes of
+// each host, the route names, and the handlers set on groups with
+// Group.SetNotFoundHandler and Group.SetMaintenance. The change is atomic, so each
+// request is served either entirely by the old routes or entirely by the new ones, and
+// requests that are in progress finish with the routes they started with. This lets a
+// new set of routes be built in a separate router while this one keeps serving, and
+// then put in place without downtime.
+//
+// The router's own settings, such as NotFoundHandler and its middleware stack, are
+// not changed. The handlers from other keep the middleware of other, as with Mount.
+// The two routers don't affect each other afterwards, and routes added to other later
+// are not added to this one.
+func (t *TreeMux) Swap(other *TreeMux) {
+	if other == t {
+		return
+	}
+
+	other.mutex.Lock()
+	trees := other.loadTrees()
+	names := copyNamedRoutes(other.namedRoutes, t)
+	other.mutex.Unlock()
+
+	var before, after routeTable
+	// This is deferred before the mutex is unlocked, so that it runs afterwards.
+	defer func() {
+		t.reportChanges(before, after)
+	}()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	before = t.routeTable()
+	// The trees are never changed once they are published, so the routers can share
+	// them.
+	t.trees.Store(trees)
+	t.namedRoutes = names
+	after = t.routeTable()
+}
+
+func (t *TreeMux) loadTrees() *routingTrees {
+	return t.trees.Load().(*routingTrees)
+}
+
+// updateTree calls fn with a copy of the root of the tree for the host, or of the
+// default tree if host is empty, creating the host's tree if necessary. Nodes below
+// the root must be copied with clone before fn changes them. If fn succeeds, the new
+// tree replaces the old one for requests that start after updateTree returns. If fn
+// returns an error, its changes are discarded. The caller must hold t.mutex.
+func (t *TreeMux) updateTree(host string, fn func(root *node) error) error {
+	trees := t.loadTrees()
+	newTrees := &routingTrees{root: trees.root, hosts: trees.hosts, hostPatterns: trees.hostPatterns,
+		groupHandlers: trees.groupHandlers, maintenance: trees.maintenance}
+
+	if host == "" {
+		newTrees.root = trees.root.clone()
+		if err := fn(newTrees.root); err != nil {
+			return err
+		}
+	} else {
+		root, ok := trees.hosts[host]
+		if ok {
+			root = root.clone()
+		} else {
+			root = &node{path: "/"}
+		}
+		if err := fn(root); err != nil {
+			return err
+		}
+
+		newTrees.hosts = make(map[string]*node, len(trees.hosts)+1)
+		for h, hostRoot := range trees.hosts {
+			newTrees.hosts[h] = hostRoot
+		}
+		newTrees.hosts[host] = root
+		if !ok && isHostPattern(host) {
+			newTrees.hostPatterns = hostPatterns(newTrees.hosts)
+		}
+	}
+
+	t.trees.Store(newTrees)
+	return nil
+}
+
+// translateBraces converts wildcards written as {name} and {name...}, as used by
+// http.ServeMux in Go 1.22, to the :name and *name forms. Each must take up a whole path
+// segment, and {name...} must be the last one.
+func translateBraces(path string) (string, error) {
+	if !strings.ContainsAny(path, "{}") {
+		return path, nil
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if len(segment) == 0 {
+			continue
+		}
+
+		switch segment[0] {
+		case ':':
+			// A regular expression constraint may contain braces, but the name may not.
+			if name, _, _ := splitWildcard(segment[1:]); !strings.ContainsAny(name, "{}") {
+				continue
+			}
+		case '*':
+			if !strings.ContainsAny(segment, "{}") {
+				continue
+			}
+		default:
+			if !strings.ContainsAny(segment, "{}") {
+				continue
+			}
+			if segment == "{$}" {
+				return "", fmt.Errorf("Path %s uses {$}, which is not supported", path)
+			}
+			if len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}' {
+				name := segment[1 : len(segment)-1]
+				prefix := ":"
+				if strings.HasSuffix(name, "...") {
+					if i != len(segments)-1 {
+						return "", fmt.Errorf("Path %s has %s before its last segment", path, segment)
+					}
+					name = name[:len(name)-3]
+					prefix = "*"
+				}
+				if isWildcardName(name) {
+					segments[i] = prefix + name
+					continue
+				}
+			}
+		}
+		return "", fmt.Errorf("Path %s has segment %s that mixes wildcard syntaxes or isn't a whole {name} wildcard", path, segment)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// isWildcardName reports whether name is made only of letters, digits and underscores,
+// as the names in {name} wildcards must be.
+func isWildcardName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isNameChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// trimTrailingSlash removes the trailing slash from a pattern when RedirectTrailingSlash
+// is set, since the pattern is then stored without it. It reports whether a slash was
+// removed.
+func (t *TreeMux) trimTrailingSlash(path string) (string, bool) {
+	if len(path) > 1 && path[len(path)-1] == '/' && t.RedirectTrailingSlash {
+		return path[:len(path)-1], true
+	}
+	return path, false
 }
 
 // Path elements starting with : indicate a wildcard in the path. A wildcard will only match on a
 // single path segment. That is, the pattern `/post/:postid` will match on `/post/1` or `/post/1/`,
 // but not `/post/1/2`.
 //
+// A wildcard name may be followed by a | and a regular expression, such as `/post/:postid|^[0-9]+$`.
+// The wildcard then only matches when the unescaped path segment matches the expression.
+// Constrained wildcards are checked before an unconstrained wildcard at the same position.
+//
 // A path element starting with * is a catch-all, whose value will be a string containing all text
 // in the URL matched by the wildcards. For example, with a pattern of `/images/*path` and a
-// requested URL `images/abc/def`, path would contain `abc/def`.
+// requested URL `images/abc/def`, path would contain `abc/def`. A catch-all can be followed
+// by static text that the path must end with, such as `/assets/*path.js`.
 //
 // # Routing Rule Priority
 //
@@ -123,7 +662,11 @@ func (t *TreeMux) Dump() string {
 //
 // 2. Wildcards take second priority. For a particular wildcard to match, that wildcard and its subtree must match the URL.
 //
-// 3. Finally, a catch-all rule will match when the earlier path segments have matched, and none of the static or wildcard conditions have matched. Catch-all rules must be at the end of a pattern.
+// 3. Finally, a catch-all rule will match when the earlier path segments have matched, and none of the static or wildcard conditions have matched. Catch-all rules must be at the end of a pattern, apart from a static suffix.
+//
+// When a branch fails to match the rest of the URL, the search backs up and tries the next
+// branch, back to the root. Set BacktrackMethods to do the same when the matching route has
+// no handler for the request's method.
 //
 // So with the following patterns, we'll see certain matches:
 //	 router = httptreemux.New()
@@ -169,74 +712,381 @@ func (t *TreeMux) Dump() string {
 // 	GET /posts will redirect to /posts/.
 // 	GET /posts/ will match normally.
 // 	POST /posts will redirect to /posts/, because the GET method used a trailing slash.
-func (t *TreeMux) Handle(method, path string, handler HandlerFunc) {
-	if path[0] != '/' {
-		panic(fmt.Sprintf("Path %s must start with slash", path))
+func (t *TreeMux) Handle(method, path string, handler HandlerFunc) *Route {
+	route, err := t.addRoute("", method, path, handler, nil)
+	if err != nil {
+		panic(err)
 	}
+	return route
+}
 
-	addSlash := false
-	if len(path) > 1 && path[len(path)-1] == '/' && t.RedirectTrailingSlash {
-		addSlash = true
+// HandleErr is like Handle, but returns an error instead of panicking if the route can
+// not be added, such as when the method already has a handler for the pattern, or the
+// pattern's wildcards conflict with those of an existing route. This is useful when the
+// routes come from configuration rather than code.
+func (t *TreeMux) HandleErr(method, path string, handler HandlerFunc) (*Route, error) {
+	return t.addRoute("", method, path, handler, nil)
+}
+
+// HandleMethods adds the handler for each of the methods at the path, as if Handle
+// were called once for each of them, and returns their routes in the same order. The
+// path is only added to the tree once, and if any of the methods can't be added, none
+// of them are. It panics if the routes can't be added.
+//
+//	router.HandleMethods([]string{"GET", "HEAD", "OPTIONS"}, "/posts/:id", postHandler)
+func (t *TreeMux) HandleMethods(methods []string, path string, handler HandlerFunc) []*Route {
+	routes, err := t.addRoutes("", methods, path, handler, nil)
+	if err != nil {
+		panic(err)
+	}
+	return routes
+}
+
+// HandleMethodsErr is like HandleMethods, but returns an error instead of panicking
+// if the routes can not be added.
+func (t *TreeMux) HandleMethodsErr(methods []string, path string, handler HandlerFunc) ([]*Route, error) {
+	return t.addRoutes("", methods, path, handler, nil)
+}
+
+// HandleE adds a handler that returns an error for the path. A non-nil error returned
+// by the handler is passed to ErrorHandler, which writes the response for it. The
+// path follows the same rules as Handle.
+func (t *TreeMux) HandleE(method, path string, handler ErrHandlerFunc) *Route {
+	return t.Handle(method, path, t.handleErrors(handler))
+}
+
+// routeSettings are the settings that a group gives its routes. They are set on the
+// routes' nodes in the same update that adds them, so that a route is never served
+// without them, such as before its ports or required scopes are set.
+type routeSettings struct {
+	// The route's metadata, which must not be modified, or nil.
+	meta map[string]interface{}
+	// The CORS policy, if corsSet is true.
+	cors    *CORS
+	corsSet bool
+	// The compression, if compressionSet is true.
+	compression    *Compression
+	compressionSet bool
+	// The trailing slash behavior, if trailingSlashSet is true.
+	trailingSlash    TrailingSlashBehavior
+	trailingSlashSet bool
+}
+
+// apply sets the settings on the node for the method.
+func (s *routeSettings) apply(n *node, method string) {
+	if s.meta != nil {
+		if n.leafMeta == nil {
+			n.leafMeta = make(map[string]map[string]interface{})
+		}
+		n.leafMeta[method] = s.meta
+	}
+	if s.corsSet {
+		if n.leafCORS == nil {
+			n.leafCORS = make(map[string]*CORS)
+		}
+		n.leafCORS[method] = s.cors
+	}
+	if s.compressionSet {
+		if n.leafCompression == nil {
+			n.leafCompression = make(map[string]*Compression)
+		}
+		n.leafCompression[method] = s.compression
+	}
+	if s.trailingSlashSet {
+		n.trailingSlash = s.trailingSlash
+		n.trailingSlashSet = true
+	}
+}
+
+// addRoute adds a handler to the tree for the host, or to the default tree if
+// host is empty.
+func (t *TreeMux) addRoute(host, method, path string, handler HandlerFunc, settings *routeSettings) (*Route, error) {
+	routes, err := t.addRoutes(host, []string{method}, path, handler, settings)
+	if err != nil {
+		return nil, err
+	}
+	return routes[0], nil
+}
+
+// addRoutes adds a handler for each of the methods to the tree for the host, or to
+// the default tree if host is empty. The path is only added to the tree once, and
+// either all of the methods are added or none are. The settings may be nil.
+func (t *TreeMux) addRoutes(host string, methods []string, path string, handler HandlerFunc,
+	settings *routeSettings) ([]*Route, error) {
+
+	if len(path) == 0 || path[0] != '/' {
+		return nil, fmt.Errorf("Path %s must start with slash", path)
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("No methods given for path %s", path)
+	}
+
+	path, err := translateBraces(path)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := expandOptional(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []*Route
+	// This is deferred before the mutex is unlocked, so that it runs afterwards.
+	defer func() {
+		t.routesAdded(routes)
+	}()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	handler = t.wrapHandler(handler)
+	middleware := t.middleware
+	wrap := func(variant string, handler HandlerFunc) HandlerFunc {
+		return applyMiddleware(middleware, handler)
+	}
+	optionsHandler := t.OptionsHandler
+	if optionsHandler != nil {
+		optionsHandler = t.wrapHandler(optionsHandler)
+	}
+
+	// All of the paths of a pattern with optional segments are added in one update,
+	// so that either all of them are served or none are.
+	err = t.updateTree(host, func(root *node) error {
+		for _, fullPath := range paths {
+			path, addSlash := t.trimTrailingSlash(fullPath)
+			node, err := root.addPath(path[1:], nil)
+			if err != nil {
+				return err
+			}
+
+			for _, method := range methods {
+				if err := node.setHandler(method, handler, optionsHandler); err != nil {
+					return err
+				}
+				if settings != nil {
+					settings.apply(node, method)
+				}
+			}
+
+			if addSlash {
+				node.addSlash = true
+			}
+			if node.fullPath == "" {
+				node.fullPath = fullPath
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var meta map[string]interface{}
+	if settings != nil {
+		meta = settings.meta
+	}
+	routes = make([]*Route, len(methods))
+	for i, method := range methods {
+		routes[i] = &Route{mux: t, host: host, method: method, path: paths[len(paths)-1], paths: paths,
+			handler: handler, meta: meta, wrap: wrap}
+	}
+	return routes, nil
+}
+
+// expandOptional returns the paths for a pattern whose last segments are optional
+// wildcards, such as /articles/:year/:month?/:day?, from the shortest to the longest.
+// A pattern without optional segments is returned as it is.
+func expandOptional(path string) ([]string, error) {
+	if strings.IndexByte(path, '?') == -1 {
+		return []string{path}, nil
+	}
+
+	trailingSlash := ""
+	if len(path) > 1 && path[len(path)-1] == '/' {
+		trailingSlash = "/"
 		path = path[:len(path)-1]
 	}
 
-	node := t.root.addPath(path[1:], nil)
-	if addSlash {
-		node.addSlash = true
+	segments := strings.Split(path, "/")
+	first := -1
+	for i, segment := range segments {
+		optional := len(segment) > 2 && segment[0] == ':' && segment[len(segment)-1] == '?' &&
+			strings.IndexByte(segment, '|') == -1
+		if optional {
+			segments[i] = segment[:len(segment)-1]
+			if first == -1 {
+				first = i
+			}
+		} else if first != -1 {
+			return nil, fmt.Errorf("Path %s has a required segment after an optional one", path+trailingSlash)
+		}
+	}
+	if first == -1 {
+		return []string{path + trailingSlash}, nil
 	}
-	node.setHandler(method, handler, t.OptionsHandler)
+
+	paths := make([]string, 0, len(segments)-first+1)
+	for i := first; i <= len(segments); i++ {
+		p := strings.Join(segments[:i], "/")
+		if p == "" {
+			p = "/"
+		} else {
+			p += trailingSlash
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// Remove removes the handler for the method and pattern, reporting whether the router
+// had such a route. The pattern must be written the same way it was when the route was
+// added, including any wildcard names. Parts of the tree that are left without any
+// routes are pruned. If the route had a name, the name is released as well.
+func (t *TreeMux) Remove(method, path string) bool {
+	return t.removeRoute("", method, path)
+}
+
+func (t *TreeMux) removeRoute(host, method, path string) bool {
+	if len(path) == 0 || path[0] != '/' {
+		return false
+	}
+
+	path, err := translateBraces(path)
+	if err != nil {
+		return false
+	}
+	paths, err := expandOptional(path)
+	if err != nil {
+		return false
+	}
+	for i := range paths {
+		paths[i], _ = t.trimTrailingSlash(paths[i])
+	}
+
+	var removed []RouteInfo
+	// This is deferred before the mutex is unlocked, so that it runs afterwards.
+	defer func() {
+		t.routesRemoved(removed)
+	}()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if _, ok := t.loadTrees().hosts[host]; host != "" && !ok {
+		return false
+	}
+
+	var infos []RouteInfo
+	if len(t.loadHooks()) != 0 {
+		infos = t.removedRoutes(host, method, paths)
+	}
+
+	err = t.updateTree(host, func(root *node) error {
+		for _, path := range paths {
+			if root.removePath(path[1:], method, nil) == nil {
+				return errNoRoute
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false
+	}
+
+	for name, route := range t.namedRoutes {
+		routePath, _ := t.trimTrailingSlash(route.path)
+		for _, path := range paths {
+			if routePath == path && route.method == method && route.host == host {
+				delete(t.namedRoutes, name)
+				route.name = ""
+			}
+		}
+	}
+	removed = infos
+	return true
 }
 
 // Syntactic sugar for Handle("GET", path, handler)
-func (t *TreeMux) GET(path string, handler HandlerFunc) {
-	t.Handle("GET", path, handler)
+func (t *TreeMux) GET(path string, handler HandlerFunc) *Route {
+	return t.Handle("GET", path, handler)
 }
 
 // Syntactic sugar for Handle("POST", path, handler)
-func (t *TreeMux) POST(path string, handler HandlerFunc) {
-	t.Handle("POST", path, handler)
+func (t *TreeMux) POST(path string, handler HandlerFunc) *Route {
+	return t.Handle("POST", path, handler)
 }
 
 // Syntactic sugar for Handle("PUT", path, handler)
-func (t *TreeMux) PUT(path string, handler HandlerFunc) {
-	t.Handle("PUT", path, handler)
+func (t *TreeMux) PUT(path string, handler HandlerFunc) *Route {
+	return t.Handle("PUT", path, handler)
 }
 
 // Syntactic sugar for Handle("DELETE", path, handler)
-func (t *TreeMux) DELETE(path string, handler HandlerFunc) {
-	t.Handle("DELETE", path, handler)
+func (t *TreeMux) DELETE(path string, handler HandlerFunc) *Route {
+	return t.Handle("DELETE", path, handler)
 }
 
 // Syntactic sugar for Handle("PATCH", path, handler)
-func (t *TreeMux) PATCH(path string, handler HandlerFunc) {
-	t.Handle("PATCH", path, handler)
+func (t *TreeMux) PATCH(path string, handler HandlerFunc) *Route {
+	return t.Handle("PATCH", path, handler)
 }
 
 // Syntactic sugar for Handle("HEAD", path, handler)
-func (t *TreeMux) HEAD(path string, handler HandlerFunc) {
-	t.Handle("HEAD", path, handler)
+func (t *TreeMux) HEAD(path string, handler HandlerFunc) *Route {
+	return t.Handle("HEAD", path, handler)
 }
 
 // Syntactic sugar for Handle("OPTIONS", path, handler)
-func (t *TreeMux) OPTIONS(path string, handler HandlerFunc) {
-	t.Handle("OPTIONS", path, handler)
+func (t *TreeMux) OPTIONS(path string, handler HandlerFunc) *Route {
+	return t.Handle("OPTIONS", path, handler)
+}
+
+// Any adds a handler for every method that has no handler of its own for the path.
+// Explicit handlers take precedence, as does the GET handler for HEAD requests when
+// HeadCanUseGet is true. Syntactic sugar for Handle(AnyMethod, path, handler).
+func (t *TreeMux) Any(path string, handler HandlerFunc) *Route {
+	return t.Handle(AnyMethod, path, handler)
+}
+
+// PanicError is passed as the err argument to the PanicHandler when the router
+// recovers from a panic while serving a request.
+type PanicError struct {
+	// Err is the value that was passed to panic.
+	Err interface{}
+	// Route is the pattern of the matched route, or an empty string if the panic
+	// happened before a route was matched.
+	Route string
+}
+
+func (p *PanicError) Error() string {
+	if p.Route == "" {
+		return fmt.Sprint(p.Err)
+	}
+	return fmt.Sprintf("%v (route %s)", p.Err, p.Route)
 }
 
-func (t *TreeMux) serveHTTPPanic(w http.ResponseWriter, r *http.Request) {
-	if err := recover(); err != nil {
-		t.PanicHandler(w, r, err)
+func (t *TreeMux) serveHTTPPanic(w http.ResponseWriter, r *http.Request, n *node, err interface{}) {
+	panicErr := &PanicError{Err: err}
+	if n != nil {
+		panicErr.Route = n.fullPath
 	}
+	t.PanicHandler(w, r, panicErr)
 }
 
-func (t *TreeMux) redirectStatusCode(method string) (int, bool) {
+func (t *TreeMux) redirectStatusCode(method string, reason RedirectReason) (int, bool) {
 	var behavior RedirectBehavior
 	var ok bool
 	if behavior, ok = t.RedirectMethodBehavior[method]; !ok {
-		behavior = t.RedirectBehavior
+		if behavior, ok = t.RedirectReasonBehavior[reason]; !ok {
+			behavior = t.RedirectBehavior
+		}
+		if behavior == Redirect301 && method != "GET" && method != "HEAD" {
+			behavior = t.RedirectNonGetBehavior
+		}
 	}
 	switch behavior {
 	case Redirect301:
 		return http.StatusMovedPermanently, true
+	case Redirect302:
+		return http.StatusFound, true
 	case Redirect307:
 		return http.StatusTemporaryRedirect, true
 	case Redirect308:
@@ -259,12 +1109,237 @@ func redirect(w http.ResponseWriter, r *http.Request, newPath string, statusCode
 	http.Redirect(w, r, newURL.String(), statusCode)
 }
 
+// trailingSlashBehavior returns the behavior for the node, which is the router's
+// setting unless it was overridden for the pattern.
+func (t *TreeMux) trailingSlashBehavior(n *node) TrailingSlashBehavior {
+	if n.trailingSlashSet {
+		return n.trailingSlash
+	}
+	return t.TrailingSlashBehavior
+}
+
+// searchTree looks up the path in the tree, falling back to a case-insensitive search
+// if that is enabled. The search is recorded in trace if it is not nil. If the path
+// only matched without regard to case, it also returns the path with the case of the
+// route's static segments, and otherwise an empty string.
+func (t *TreeMux) searchTree(root *node, path string, trace *searchTrace) (*node, []string, string) {
+	return t.searchTreeMethods(root, path, nil, trace)
+}
+
+// searchTreeMethods is like searchTree, but if methods is not nil, it only matches a
+// node with a handler for one of them.
+func (t *TreeMux) searchTreeMethods(root *node, path string, methods []string,
+	trace *searchTrace) (*node, []string, string) {
+	opts := searchOptions{methods: methods, precedence: t.Precedence, trace: trace}
+	n, params := root.searchWith(path, &opts)
+	var canonical string
+	if n == nil && t.CaseInsensitive {
+		if trace != nil {
+			trace.note("No exact match, so searching again without regard to case")
+		}
+		opts.ignoreCase = true
+		n, params = root.searchWith(path, &opts)
+		if n != nil && len(opts.caseFixes) != 0 {
+			canonical = applyCaseFixes(path, opts.caseFixes)
+		}
+	}
+	return n, params, canonical
+}
+
+// servesMethod reports whether the node has a handler that the router would use for
+// the method.
+func (t *TreeMux) servesMethod(n *node, method string) bool {
+	if _, ok := n.leafHandler[method]; ok {
+		return true
+	}
+	if _, ok := n.leafHandler[AnyMethod]; ok {
+		return true
+	}
+	if method == "HEAD" && t.HeadCanUseGet {
+		_, ok := n.leafHandler["GET"]
+		return ok
+	}
+	return method == "OPTIONS" && t.AutoOptions
+}
+
+// LookupResult is the outcome of finding the route for a request without serving it.
+// It is returned by Lookup and LookupRequest, and can be passed to ServeLookupResult to
+// serve the request.
+type LookupResult struct {
+	// StatusCode is http.StatusOK if a handler was found. Otherwise it is the status
+	// the router responds with: http.StatusNotFound, http.StatusMethodNotAllowed,
+	// http.StatusBadRequest for a rejected encoded slash, or a redirect status when
+	// the path needs to be cleaned or its trailing slash fixed.
+	StatusCode int
+	// Handler is the handler that serves the request, when StatusCode is http.StatusOK.
+	Handler HandlerFunc
+	// Params holds the values of the route's wildcards and catch-all, or nil if it has
+	// none.
+	Params map[string]string
+	// Pattern is the pattern of the matched route, or an empty string if no route
+	// matched.
+	Pattern string
+	// RedirectPath is the path that the request is redirected to, when StatusCode is a
+	// redirect status.
+	RedirectPath string
+	// Methods holds the methods that the matched route allows, as passed to
+	// MethodNotAllowedHandler, when StatusCode is http.StatusMethodNotAllowed or the
+	// router is answering an OPTIONS request itself.
+	Methods map[string]HandlerFunc
+	// Meta holds the metadata added to the matched route with Route.Meta, or nil if it
+	// has none. It must not be modified.
+	Meta map[string]interface{}
+	// Deprecation is the deprecation set on the matched route with Route.Deprecated, or
+	// nil if it isn't deprecated.
+	Deprecation *Deprecation
+
+	node        *node
+	rawParams   []string
+	headUsesGet bool
+	// The CORS policy of the matched route, or nil if it has none.
+	cors *CORS
+	// The compression of the matched route, or nil if it has none.
+	compression *Compression
+	// The statistics of the matched route's handler.
+	stats *routeStats
+}
+
+// Lookup finds the route for a request with the method and path in the default tree,
+// without serving it. The path is as it appears in a request URI, without the query
+// string. The boolean result reports whether a handler was found, which is the same
+// as the StatusCode of the result being http.StatusOK.
+func (t *TreeMux) Lookup(method, path string) (LookupResult, bool) {
+	lr := t.lookup(t.loadTrees().root, method, path)
+	return lr, lr.StatusCode == http.StatusOK
+}
+
+// LookupHost is like Lookup, but uses the tree for the host when it has routes of its
+// own, as LookupRequest does. The host may include a port. Since it needs no
+// http.Request, it lets servers that don't use net/http, such as fasthttp, find routes
+// in the tree.
+func (t *TreeMux) LookupHost(host, method, path string) (LookupResult, bool) {
+	lr := t.lookupHost(host, method, path)
+	return lr, lr.StatusCode == http.StatusOK
+}
+
+// LookupRequest finds the route for the request, as ServeHTTP would, without serving
+// it. Unlike Lookup, it uses the request's host and the router's PathSource. This
+// lets middleware see the matched route before deciding whether to serve it with
+// ServeLookupResult.
+func (t *TreeMux) LookupRequest(r *http.Request) (LookupResult, bool) {
+	method := r.Method
+	if t.MethodOverride != nil {
+		method = t.MethodOverride.apply(r).Method
+	}
+	lr := t.lookupHost(r.Host, method, t.requestPath(r))
+	return lr, lr.StatusCode == http.StatusOK
+}
+
+// ServeLookupResult serves the request using the result of Lookup or LookupRequest. It
+// calls the handler when one was found, and otherwise responds as ServeHTTP would.
+func (t *TreeMux) ServeLookupResult(w http.ResponseWriter, r *http.Request, lr LookupResult) {
+	t.serve(w, r, &lr)
+}
+
 func (t *TreeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.serve(w, r, nil)
+}
+
+// serve serves the request from the lookup result, or looks up its route first if found
+// is nil. It records the request with Metrics, Tracer and OnRequest, and recovers from
+// panics with PanicHandler, when they are set.
+func (t *TreeMux) serve(w http.ResponseWriter, r *http.Request, found *LookupResult) {
+	// lr.node is the matched node, and is used to report the route when recovering
+	// from a panic.
+	var lr LookupResult
+
+	if t.ReuseParams {
+		// This is deferred first so that the params are released after everything else
+		// deferred here is done with them.
+		defer func() {
+			t.releaseParams(lr.Params)
+		}()
+	}
+
+	if t.CountInFlight {
+		atomic.AddInt64(&t.inFlight, 1)
+		defer atomic.AddInt64(&t.inFlight, -1)
+	}
+
+	if t.SecurityHeaders != nil {
+		setHeaders(w.Header(), t.SecurityHeaders.headers())
+	}
+
+	var requestID string
+	if t.RequestID != nil {
+		requestID = t.RequestID.id(r)
+		w.Header().Set(t.RequestID.header(), requestID)
+		if withRequestID != nil {
+			r = withRequestID(r, requestID)
+		}
+	}
+
+	// This is deferred before the panic handler so that it sees the response the panic
+	// handler writes.
+	var endSpan func(statusCode int)
+	if t.Metrics != nil || t.Tracer != nil || t.OnRequest != nil {
+		rw := &recordingResponseWriter{ResponseWriter: w}
+		start := time.Now()
+		defer func() {
+			duration := time.Since(start)
+			if endSpan != nil {
+				endSpan(rw.statusCode())
+			}
+			if recorder, ok := t.Metrics.(RequestIDRecorder); ok && t.RequestID != nil {
+				recorder.ObserveRequestWithID(r.Method, lr.Pattern, rw.statusCode(), duration, rw.size, requestID)
+			} else if t.Metrics != nil {
+				t.Metrics.ObserveRequest(r.Method, lr.Pattern, rw.statusCode(), duration, rw.size)
+			}
+			if t.OnRequest != nil {
+				t.OnRequest(RequestInfo{
+					Request:    r,
+					Route:      lr.Pattern,
+					Params:     lr.Params,
+					StatusCode: rw.statusCode(),
+					Duration:   duration,
+					Size:       rw.size,
+					RequestID:  requestID,
+				})
+			}
+		}()
+		w = rw
+	}
 
 	if t.PanicHandler != nil {
-		defer t.serveHTTPPanic(w, r)
+		defer func() {
+			if err := recover(); err != nil {
+				t.serveHTTPPanic(w, r, lr.node, err)
+			}
+		}()
+	}
+
+	if t.MethodOverride != nil {
+		r = t.MethodOverride.apply(r)
 	}
 
+	if found != nil {
+		lr = *found
+	} else {
+		lr = t.lookupHost(r.Host, r.Method, t.requestPath(r))
+	}
+
+	if t.Locales != nil && t.Locales.Redirect {
+		lr = t.Locales.redirect(w, r, lr)
+	}
+
+	if t.Tracer != nil {
+		r, endSpan = t.Tracer.StartSpan(r, lr.Pattern)
+	}
+	t.serveLookupResult(w, r, lr)
+}
+
+// requestPath returns the path of the request to search for, according to PathSource.
+func (t *TreeMux) requestPath(r *http.Request) string {
 	path := r.RequestURI
 	pathLen := len(path)
 	if pathLen > 0 && t.PathSource == RequestURI {
@@ -273,72 +1348,248 @@ func (t *TreeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if rawQueryLen != 0 || path[pathLen-1] == '?' {
 			// Remove any query string and the ?.
 			path = path[:pathLen-rawQueryLen-1]
-			pathLen = len(path)
 		}
-	} else {
-		// In testing with http.NewRequest,
-		// RequestURI is not set so just grab URL.Path instead.
-		path = r.URL.Path
-		pathLen = len(path)
+		return path
+	}
+
+	// In testing with http.NewRequest,
+	// RequestURI is not set so just grab URL.Path instead.
+	return r.URL.Path
+}
+
+func (t *TreeMux) lookup(root *node, method, path string) LookupResult {
+	return t.lookupTrace(root, method, path, nil)
+}
+
+// lookupTrace is like lookup, but records the search in trace if it is not nil.
+func (t *TreeMux) lookupTrace(root *node, method, path string, trace *searchTrace) LookupResult {
+	if t.Locales != nil {
+		if locale, rest := t.Locales.split(path); locale != "" {
+			if trace != nil {
+				trace.note("The first segment is the locale " + locale + ", so searching for " + rest)
+			}
+			lr := t.lookupFormat(root, method, rest, trace)
+			if lr.StatusCode == http.StatusOK || lr.StatusCode == http.StatusMethodNotAllowed {
+				lr.addParam(LocaleParam, locale)
+				return lr
+			}
+			if trace != nil {
+				trace.note("No route matches " + rest + ", so searching for the whole path")
+			}
+		}
+	}
+	return t.lookupFormat(root, method, path, trace)
+}
+
+// lookupFormat is like lookupTrace, but only handles FormatExtensions.
+func (t *TreeMux) lookupFormat(root *node, method, path string, trace *searchTrace) LookupResult {
+	if len(t.FormatExtensions) != 0 {
+		if base, format := t.splitFormat(path); format != "" {
+			if trace != nil {
+				trace.note("The extension ." + format + " is a format, so searching for " + base)
+			}
+			lr := t.lookupPath(root, method, base, trace)
+			if lr.StatusCode == http.StatusOK || lr.StatusCode == http.StatusMethodNotAllowed {
+				lr.addParam(FormatParam, format)
+				return lr
+			}
+			if trace != nil {
+				trace.note("No route matches " + base + ", so searching for the whole path")
+			}
+		}
+	}
+	return t.lookupPath(root, method, path, trace)
+}
+
+// addParam adds a param that was taken from the path before it was looked up, unless
+// the route has a param with the same name.
+func (lr *LookupResult) addParam(name, value string) {
+	if lr.Params == nil {
+		lr.Params = make(map[string]string, 1)
+	}
+	if _, ok := lr.Params[name]; !ok {
+		lr.Params[name] = value
+	}
+}
+
+// lookupPath looks up the route for the path, recording the search in trace if it is
+// not nil.
+func (t *TreeMux) lookupPath(root *node, method, path string, trace *searchTrace) (lr LookupResult) {
+	if t.EncodedSlashBehavior != EncodedSlashInParam && hasEncodedSlash(path) {
+		if t.EncodedSlashBehavior == EncodedSlashReject {
+			lr.StatusCode = http.StatusBadRequest
+			return
+		}
+		path = unescapeSlashes(path)
+		if trace != nil {
+			trace.note("Encoded slashes are treated as separators, so the path is " + path)
+		}
+	}
+
+	pathLen := len(path)
+	if pathLen == 0 || path[0] != '/' {
+		// Requests such as "OPTIONS *" don't have a path that can match any route.
+		lr.StatusCode = http.StatusNotFound
+		return
 	}
 
 	trailingSlash := path[pathLen-1] == '/' && pathLen > 1
 	if trailingSlash && t.RedirectTrailingSlash {
 		path = path[:pathLen-1]
+		if trace != nil {
+			trace.note("RedirectTrailingSlash is set, so the trailing slash is removed for the search")
+		}
+	}
+
+	var n *node
+	var params []string
+	// The path with the case of the route's static segments, if it only matched
+	// without regard to case.
+	var canonical string
+	cleaned := false
+	if t.RedirectCleanPath {
+		// Look for the clean version of the path first, so that paths like /files/../x
+		// are redirected even if they would match a wildcard or catch-all as is.
+		cleanPath := httppath.Clean(path)
+		if cleanPath != path {
+			cleanSlash := trailingSlash
+			if t.RedirectTrailingSlash && len(cleanPath) > 1 && cleanPath[len(cleanPath)-1] == '/' {
+				// Clean converts a trailing /. or /.. into a slash.
+				cleanPath = cleanPath[:len(cleanPath)-1]
+				cleanSlash = true
+			}
+
+			if trace != nil {
+				trace.note("Searching for the clean path " + cleanPath)
+			}
+			n, params, canonical = t.searchTree(root, cleanPath[1:], trace)
+			if n != nil {
+				path = cleanPath
+				trailingSlash = cleanSlash
+				cleaned = true
+			}
+		}
 	}
-	n, params := t.root.search(path[1:])
+
 	if n == nil {
-		if t.RedirectCleanPath {
-			// Path was not found. Try cleaning it up and search again.
-			// TODO Test this
-			cleanPath := httppath.Clean(path)
-			n, params = t.root.search(cleanPath[1:])
-			if n == nil {
-				// Still nothing found.
-				t.NotFoundHandler(w, r)
-				return
-			} else {
-				if statusCode, ok := t.redirectStatusCode(r.Method); ok {
-					// Redirect to the actual path
-					redirect(w, r, cleanPath, statusCode)
-					return
+		if trace != nil {
+			trace.note("Searching for " + path)
+		}
+		n, params, canonical = t.searchTree(root, path[1:], trace)
+		if n == nil {
+			lr.StatusCode = http.StatusNotFound
+			return
+		}
+	}
+
+	if t.BacktrackMethods && !t.servesMethod(n, method) {
+		if trace != nil {
+			trace.note("BacktrackMethods is set and " + n.fullPath + " has no handler for " + method +
+				", so searching for a route that has one")
+		}
+		methods := []string{method, AnyMethod}
+		if method == "HEAD" && t.HeadCanUseGet {
+			methods = append(methods, "GET")
+		}
+		if other, otherParams, otherCanonical := t.searchTreeMethods(root, path[1:], methods, trace); other != nil {
+			n, params, canonical = other, otherParams, otherCanonical
+		}
+	}
+
+	lr.node = n
+	lr.Pattern = n.fullPath
+
+	checkSlash := t.RedirectTrailingSlash && (!n.isCatchAll || t.RemoveCatchAllTrailingSlash)
+	wantSlash := n.addSlash
+	if checkSlash {
+		switch t.trailingSlashBehavior(n) {
+		case TrailingSlashAdd:
+			wantSlash = true
+		case TrailingSlashRemove:
+			wantSlash = false
+		case TrailingSlashEquivalent:
+			wantSlash = trailingSlash
+		case TrailingSlashStrict:
+			if trailingSlash != n.addSlash {
+				if trace != nil {
+					trace.note("The trailing slash doesn't match the route, which uses TrailingSlashStrict")
 				}
+				lr.StatusCode = http.StatusNotFound
+				return
 			}
-		} else {
-			t.NotFoundHandler(w, r)
-			return
 		}
 	}
 
-	handler, ok := n.leafHandler[r.Method]
+	// The method whose handler is used, for the metadata.
+	handlerMethod := method
+	handler, ok := n.leafHandler[method]
 	if !ok {
-		if r.Method == "HEAD" && t.HeadCanUseGet {
+		if method == "HEAD" && t.HeadCanUseGet {
 			handler, ok = n.leafHandler["GET"]
+			lr.headUsesGet = ok
+			handlerMethod = "GET"
+		}
+
+		if !ok {
+			// A handler added with Any serves the methods that have no handler of
+			// their own.
+			handler, ok = n.leafHandler[AnyMethod]
+			handlerMethod = AnyMethod
+		}
+
+		if !ok && method == "OPTIONS" && t.AutoOptions {
+			lr.Methods = t.allowedMethods(n)
+			handler, ok = lr.Methods["OPTIONS"], true
 		}
 
 		if !ok {
-			t.MethodNotAllowedHandler(w, r, n.leafHandler)
+			lr.StatusCode = http.StatusMethodNotAllowed
+			lr.Methods = t.allowedMethods(n)
 			return
 		}
 	}
 
-	if !n.isCatchAll || t.RemoveCatchAllTrailingSlash {
-		if trailingSlash != n.addSlash && t.RedirectTrailingSlash {
-			if statusCode, ok := t.redirectStatusCode(r.Method); ok {
-				if n.addSlash {
-					// Need to add a slash.
-					redirect(w, r, path+"/", statusCode)
-				} else if path != "/" {
-					// We need to remove the slash. This was already done at the
-					// beginning of the function.
-					redirect(w, r, path, statusCode)
+	if !checkSlash {
+		// Keep the slash as it was in the request. If RedirectTrailingSlash is false,
+		// it was never removed from the path.
+		wantSlash = trailingSlash && t.RedirectTrailingSlash
+	}
+
+	caseFixed := t.RedirectCase && canonical != ""
+	if caseFixed {
+		path = "/" + canonical
+	}
+
+	if cleaned || caseFixed || (checkSlash && trailingSlash != wantSlash && path != "/") {
+		reason := ReasonTrailingSlash
+		if cleaned {
+			reason = ReasonCleanPath
+		} else if caseFixed {
+			reason = ReasonCase
+		}
+		if statusCode, ok := t.redirectStatusCode(method, reason); ok {
+			if trace != nil {
+				if cleaned {
+					trace.note("The clean path matched, so the request is redirected to it")
+				} else if caseFixed {
+					trace.note("The path matched without regard to case, so the request is redirected to " + path)
+				} else {
+					trace.note("The trailing slash doesn't match the route, so the request is redirected")
 				}
-				return
 			}
+			lr.StatusCode = statusCode
+			if wantSlash && path != "/" {
+				// Need to add a slash.
+				lr.RedirectPath = path + "/"
+			} else {
+				// Any slash to be removed was already taken off at the beginning of
+				// the function.
+				lr.RedirectPath = path
+			}
+			return
 		}
 	}
 
-	var paramMap map[string]string
 	if len(params) != 0 {
 		if len(params) != len(n.leafWildcardNames) {
 			// Need better behavior here. Should this be a panic?
@@ -346,39 +1597,284 @@ func (t *TreeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				params, n.leafWildcardNames))
 		}
 
-		paramMap = make(map[string]string)
+		var paramMap map[string]string
+		if t.ReuseParams {
+			paramMap, _ = t.paramsPool.Get().(map[string]string)
+		}
+		if paramMap == nil {
+			paramMap = make(map[string]string, len(params))
+		}
 		numParams := len(params)
 		for index := 0; index < numParams; index++ {
-			paramMap[n.leafWildcardNames[numParams-index-1]] = params[index]
+			value := params[index]
+			if !t.RawParams {
+				value = unescapeToken(value)
+			}
+			paramMap[n.leafWildcardNames[numParams-index-1]] = value
+		}
+		lr.Params = paramMap
+		lr.rawParams = params
+	}
+
+	lr.StatusCode = http.StatusOK
+	lr.Handler = handler
+	if n.leafMeta != nil {
+		lr.Meta = n.leafMeta[handlerMethod]
+	}
+	if n.leafDeprecation != nil {
+		lr.Deprecation = n.leafDeprecation[handlerMethod]
+	}
+	lr.cors = t.corsPolicy(n, handlerMethod)
+	lr.compression = t.compression(n, handlerMethod)
+	lr.stats = n.leafStats[handlerMethod]
+	return
+}
+
+func (t *TreeMux) serveLookupResult(w http.ResponseWriter, r *http.Request, lr LookupResult) {
+	if r.Method == "OPTIONS" && lr.node != nil &&
+		(lr.StatusCode == http.StatusOK || lr.StatusCode == http.StatusMethodNotAllowed) &&
+		t.servePreflight(w, r, lr.node) {
+		return
+	}
+
+	switch lr.StatusCode {
+	case http.StatusOK:
+		if trees := t.loadTrees(); trees.maintenance {
+			if handler := trees.maintenanceHandlerFor(r, lr.Pattern); handler != nil {
+				lr.Handler = handler
+			}
+		}
+	case http.StatusNotFound:
+		t.notFound(w, r)
+		return
+	case http.StatusMethodNotAllowed:
+		t.methodNotAllowed(w, r, lr.Methods)
+		return
+	case http.StatusBadRequest:
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	default:
+		redirect(w, r, lr.RedirectPath, lr.StatusCode)
+		return
+	}
+
+	if ports, _ := lr.Meta[PortsMetaKey].([]string); len(ports) != 0 && !containsString(ports, requestPort(r)) {
+		t.notFound(w, r)
+		return
+	}
+
+	for _, hooks := range t.loadHooks() {
+		if hooks.OnMatch != nil {
+			hooks.OnMatch(r, lr)
+		}
+	}
+
+	if lr.stats != nil {
+		if t.CountHits {
+			atomic.AddUint64(&lr.stats.hits, 1)
+		}
+		if t.CountInFlight {
+			atomic.AddInt64(&lr.stats.inFlight, 1)
+			defer atomic.AddInt64(&lr.stats.inFlight, -1)
+		}
+		if t.LatencyBuckets != nil {
+			start := time.Now()
+			defer func() {
+				lr.stats.observeLatency(t.LatencyBuckets, time.Since(start))
+			}()
+		}
+	}
+
+	if lr.headUsesGet {
+		w = headResponseWriter{w}
+	}
+
+	if lr.Deprecation != nil {
+		lr.Deprecation.setHeaders(w.Header())
+	}
+
+	if lr.cors != nil {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			lr.cors.setHeaders(w.Header(), origin)
+		}
+	}
+
+	if lr.node.leafParamTypes != nil && withTypedParams != nil {
+		r = withTypedParams(r, lr.node.typedParams(lr.rawParams))
+	}
+
+	if t.RouteInContext && withRoute != nil {
+		r = withRoute(r, lr.Pattern)
+	}
+
+	if scopes, ok := lr.Meta[ScopesMetaKey].([]string); ok {
+		var allowed bool
+		if r, allowed = t.JWT.authorize(w, r, lr.Params, scopes); !allowed {
+			return
 		}
 	}
 
-	handler(w, r, paramMap)
+	if lr.Meta != nil && withMeta != nil {
+		r = withMeta(r, lr.Meta)
+	}
+
+	if lr.compression != nil {
+		var finish func()
+		w, finish = lr.compression.wrap(w, r)
+		defer finish()
+	}
+
+	lr.Handler(w, r, lr.Params)
+}
+
+// releaseParams returns a params map to the pool for reuse.
+func (t *TreeMux) releaseParams(params map[string]string) {
+	if params == nil {
+		return
+	}
+	for key := range params {
+		delete(params, key)
+	}
+	t.paramsPool.Put(params)
+}
+
+// headResponseWriter discards the body written by a GET handler that is responding to
+// a HEAD request.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Flush passes the flush on to the wrapped ResponseWriter, if it supports flushing, so
+// that streaming handlers keep working for HEAD requests.
+func (w headResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection from the wrapped ResponseWriter, if it supports
+// hijacking, so that handlers such as websocket upgrades keep working for HEAD
+// requests.
+func (w headResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("The ResponseWriter does not support hijacking")
+}
+
+// Unwrap returns the wrapped ResponseWriter, for use by http.ResponseController.
+func (w headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// hasEncodedSlash reports whether the path contains %2F or %2f.
+func hasEncodedSlash(path string) bool {
+	for i := 0; i+2 < len(path); i++ {
+		if path[i] == '%' && path[i+1] == '2' && (path[i+2] == 'F' || path[i+2] == 'f') {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeSlashes replaces each encoded slash in the path with a slash.
+func unescapeSlashes(path string) string {
+	buf := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i] == '%' && i+2 < len(path) && path[i+1] == '2' &&
+			(path[i+2] == 'F' || path[i+2] == 'f') {
+			buf = append(buf, '/')
+			i += 2
+			continue
+		}
+		buf = append(buf, path[i])
+	}
+	return string(buf)
+}
+
+// allowedMethods returns the methods that the node can serve. This is the node's
+// handler map without the handler added with Any, plus HEAD if the router will use the
+// GET handler for it, and OPTIONS if the router will answer OPTIONS requests itself.
+func (t *TreeMux) allowedMethods(n *node) map[string]HandlerFunc {
+	getHandler, hasGet := n.leafHandler["GET"]
+	_, hasHead := n.leafHandler["HEAD"]
+	_, hasOptions := n.leafHandler["OPTIONS"]
+	_, hasAny := n.leafHandler[AnyMethod]
+	addHead := t.HeadCanUseGet && hasGet && !hasHead
+	addOptions := t.AutoOptions && !hasOptions
+	if !addHead && !addOptions && !hasAny {
+		return n.leafHandler
+	}
+
+	methods := make(map[string]HandlerFunc, len(n.leafHandler)+2)
+	for m, handler := range n.leafHandler {
+		// A handler added with Any has no method of its own to list.
+		if m != AnyMethod {
+			methods[m] = handler
+		}
+	}
+	if addHead {
+		methods["HEAD"] = getHandler
+	}
+	if addOptions {
+		methods["OPTIONS"] = func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			t.AutoOptionsHandler(w, r, methods)
+		}
+	}
+	return methods
+}
+
+// allowHeader returns the sorted, comma-separated list of methods for an Allow header.
+func allowHeader(methods map[string]HandlerFunc) string {
+	allowed := make([]string, 0, len(methods))
+	for m := range methods {
+		allowed = append(allowed, m)
+	}
+	sort.Strings(allowed)
+	return strings.Join(allowed, ", ")
 }
 
 // MethodNotAllowedHandler is the default handler for TreeMux.MethodNotAllowedHandler,
 // which is called for patterns that match, but do not have a handler installed for the
-// requested method. It simply writes the status code http.StatusMethodNotAllowed.
+// requested method. It sets the Allow header to the list of methods that the pattern
+// supports and writes the status code http.StatusMethodNotAllowed.
 func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request,
 	methods map[string]HandlerFunc) {
 
-	for m := range methods {
-		w.Header().Add("Allow", m)
-	}
-
+	w.Header().Set("Allow", allowHeader(methods))
 	w.WriteHeader(http.StatusMethodNotAllowed)
 }
 
+// AutoOptionsHandler is the default handler for TreeMux.AutoOptionsHandler, which is
+// called for OPTIONS requests to patterns that have no OPTIONS handler when
+// TreeMux.AutoOptions is true. It sets the Allow header to the list of methods that
+// the pattern supports and writes the status code http.StatusOK.
+func AutoOptionsHandler(w http.ResponseWriter, r *http.Request,
+	methods map[string]HandlerFunc) {
+
+	w.Header().Set("Allow", allowHeader(methods))
+	w.WriteHeader(http.StatusOK)
+}
+
 func New() *TreeMux {
-	root := &node{path: "/"}
-	return &TreeMux{root: root,
-		NotFoundHandler:         http.NotFound,
+	t := &TreeMux{
+		PanicHandler:            SimplePanicHandler,
+		ErrorHandler:            SimpleErrorHandler,
+		NotFoundHandler:         NotFoundHandler,
 		MethodNotAllowedHandler: MethodNotAllowedHandler,
+		AutoOptionsHandler:      AutoOptionsHandler,
 		HeadCanUseGet:           true,
 		RedirectTrailingSlash:   true,
 		RedirectCleanPath:       true,
 		RedirectBehavior:        Redirect301,
+		RedirectNonGetBehavior:  Redirect308,
 		RedirectMethodBehavior:  make(map[string]RedirectBehavior),
 		PathSource:              RequestURI,
 	}
+	t.trees.Store(&routingTrees{root: &node{path: "/"}})
+	return t
 }
@@ -1,6 +1,7 @@
 package httptreemux
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -8,6 +9,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -93,7 +95,7 @@ func testMethods(t *testing.T, newRequest RequestCreator) {
 		r, _ := newRequest(method, "/user/"+method, nil)
 		router.ServeHTTP(w, r)
 		if expect == "" && w.Code != http.StatusMethodNotAllowed {
-			t.Errorf("Method %s not expected to match but saw code %d", w.Code)
+			t.Errorf("Method %s not expected to match but saw code %d", method, w.Code)
 		}
 
 		if result != expect {
@@ -122,6 +124,71 @@ func testMethods(t *testing.T, newRequest RequestCreator) {
 	testMethod("HEAD", "HEAD")
 }
 
+func TestHeadDiscardsGetBody(t *testing.T) {
+	router := New()
+	router.GET("/user", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.Header().Set("Content-Type", "text/plain")
+		n, err := w.Write([]byte("body"))
+		if n != 4 || err != nil {
+			t.Errorf("Expected the discarded write to succeed, saw %d, %v", n, err)
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("Expected the ResponseWriter to be a Flusher")
+		}
+		flusher.Flush()
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := newRequest("HEAD", "/user", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("Expected 200 with the GET handler's headers, saw %d %v", w.Code, w.Header())
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected no body for HEAD, saw %q", w.Body.String())
+	}
+	if !w.Flushed {
+		t.Error("Expected the flush to reach the ResponseWriter for HEAD")
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = newRequest("GET", "/user", nil)
+	router.ServeHTTP(w, r)
+	if w.Body.String() != "body" {
+		t.Errorf("Expected body for GET, saw %q", w.Body.String())
+	}
+
+	// A GET handler can hijack the connection of a HEAD request.
+	router.GET("/hijack", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nX-Hijacked: yes\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+		rw.Flush()
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+	resp, err := http.Head(server.URL + "/hijack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Hijacked") != "yes" {
+		t.Errorf("Expected the hijacked response for HEAD, saw %d %v", resp.StatusCode, resp.Header)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = newRequest("HEAD", "/hijack", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected a 500 response when hijacking isn't supported, saw %d", w.Code)
+	}
+}
+
 func TestNotFound(t *testing.T) {
 	calledNotFound := false
 
@@ -149,6 +216,38 @@ func TestNotFound(t *testing.T) {
 	}
 }
 
+func TestNotFoundAfterFallbacks(t *testing.T) {
+	router := New()
+	router.GET("/", simpleHandler)
+	router.GET("/user/:id/", simpleHandler)
+	router.NotFoundHandler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not found"}`))
+	}
+
+	testPath := func(method, path string, expectedCode int) {
+		r, _ := newRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != expectedCode {
+			t.Errorf("%s %s expected code %d, saw %d", method, path, expectedCode, w.Code)
+		}
+		if expectedCode == http.StatusNotFound && w.Body.String() != `{"error":"not found"}` {
+			t.Errorf("%s %s expected JSON body from custom handler, saw %q", method, path, w.Body.String())
+		}
+	}
+
+	// These are found by the trailing slash and clean path logic.
+	testPath("GET", "/user/abc", http.StatusMovedPermanently)
+	testPath("GET", "/user//abc/", http.StatusMovedPermanently)
+
+	testPath("GET", "/user/abc/def", http.StatusNotFound)
+	testPath("GET", "/user/abc/def/", http.StatusNotFound)
+	testPath("GET", "/user//abc/def/", http.StatusNotFound)
+	testPath("OPTIONS", "*", http.StatusNotFound)
+}
+
 func TestMethodNotAllowedHandler(t *testing.T) {
 	calledNotAllowed := false
 
@@ -157,7 +256,7 @@ func TestMethodNotAllowedHandler(t *testing.T) {
 
 		calledNotAllowed = true
 
-		expected := []string{"GET", "PUT", "DELETE"}
+		expected := []string{"GET", "HEAD", "PUT", "DELETE"}
 		allowed := make([]string, 0)
 		for m := range methods {
 			allowed = append(allowed, m)
@@ -187,15 +286,22 @@ func TestMethodNotAllowedHandler(t *testing.T) {
 	}
 
 	allowed := w.Header()["Allow"]
-	sort.Strings(allowed)
-	expected := []string{"DELETE", "GET", "PUT"}
-	sort.Strings(expected)
+	expected := []string{"DELETE, GET, HEAD, PUT"}
 
 	if !reflect.DeepEqual(allowed, expected) {
 		t.Errorf("Expected Allow header %v, saw %v",
 			expected, allowed)
 	}
 
+	router.HeadCanUseGet = false
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, PUT" {
+		t.Errorf("With HeadCanUseGet false, expected Allow header %q, saw %q",
+			"DELETE, GET, PUT", allow)
+	}
+	router.HeadCanUseGet = true
+
 	// Now try with a custom handler.
 	router.MethodNotAllowedHandler = notAllowedHandler
 
@@ -205,6 +311,20 @@ func TestMethodNotAllowedHandler(t *testing.T) {
 	}
 }
 
+func TestDefaultPanicHandler(t *testing.T) {
+	router := New()
+	router.GET("/user/:id", panicHandler)
+	r, _ := newRequest("GET", "/user/abc", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected code %d from default panic handler, saw %d",
+			http.StatusInternalServerError, w.Code)
+	}
+}
+
 func TestPanic(t *testing.T) {
 
 	router := New()
@@ -223,6 +343,17 @@ func TestPanic(t *testing.T) {
 	sawPanic := false
 	router.PanicHandler = func(w http.ResponseWriter, r *http.Request, err interface{}) {
 		sawPanic = true
+		panicErr, ok := err.(*PanicError)
+		if !ok {
+			t.Errorf("Expected panic handler to receive a *PanicError, saw %T", err)
+			return
+		}
+		if panicErr.Err != "test panic" {
+			t.Errorf("Expected recovered value %q, saw %v", "test panic", panicErr.Err)
+		}
+		if panicErr.Route != "/abc" {
+			t.Errorf("Expected route /abc in panic error, saw %q", panicErr.Route)
+		}
 	}
 
 	router.ServeHTTP(w, r)
@@ -254,6 +385,83 @@ func TestRedirect(t *testing.T) {
 	}
 }
 
+func TestRedirectNonGetBehavior(t *testing.T) {
+	router := New()
+	router.POST("/noslash", simpleHandler)
+	router.GET("/noslash", simpleHandler)
+
+	for _, test := range []struct {
+		behavior RedirectBehavior
+		method   string
+		code     int
+	}{
+		{Redirect308, "GET", http.StatusMovedPermanently},
+		{Redirect308, "POST", 308},
+		{Redirect307, "POST", http.StatusTemporaryRedirect},
+		{Redirect301, "POST", http.StatusMovedPermanently},
+	} {
+		router.RedirectNonGetBehavior = test.behavior
+		r, _ := newRequest(test.method, "/noslash/", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s with RedirectNonGetBehavior %d expected %d, saw %d", test.method, test.behavior,
+				test.code, w.Code)
+		}
+	}
+
+	// An explicit RedirectBehavior other than 301 applies to every method.
+	router.RedirectNonGetBehavior = Redirect308
+	router.RedirectBehavior = Redirect307
+	r, _ := newRequest("POST", "/noslash/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Errorf("Expected 307 from RedirectBehavior, saw %d", w.Code)
+	}
+}
+
+func TestRedirectReasonBehavior(t *testing.T) {
+	router := New()
+	router.RedirectReasonBehavior = map[RedirectReason]RedirectBehavior{
+		ReasonTrailingSlash: Redirect307,
+		ReasonCleanPath:     Redirect302,
+	}
+	router.GET("/a/b", simpleHandler)
+	router.POST("/a/b", simpleHandler)
+
+	tests := []struct {
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		{"GET", "/a/b/", http.StatusTemporaryRedirect, "/a/b"},
+		{"GET", "/a/../a/b", http.StatusFound, "/a/b"},
+		{"GET", "/a//b/", http.StatusFound, "/a/b"},
+		{"POST", "/a/b/", http.StatusTemporaryRedirect, "/a/b"},
+		{"DELETE", "/a/b/", http.StatusMethodNotAllowed, ""},
+	}
+	for _, test := range tests {
+		r, _ := newRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("%s %s expected %d to %q, saw %d to %q", test.method, test.path, test.code,
+				test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// The method's behavior takes precedence.
+	router.RedirectMethodBehavior["GET"] = Redirect301
+	r, _ := newRequest("GET", "/a/b/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected RedirectMethodBehavior to take precedence, saw %d", w.Code)
+	}
+}
+
 func behaviorToCode(b RedirectBehavior) int {
 	switch b {
 	case Redirect301:
@@ -262,6 +470,8 @@ func behaviorToCode(b RedirectBehavior) int {
 		return http.StatusTemporaryRedirect
 	case Redirect308:
 		return 308
+	case Redirect302:
+		return http.StatusFound
 	case UseHandler:
 		// Not normally, but the handler in the below test returns this.
 		return http.StatusNoContent
@@ -282,6 +492,10 @@ func testRedirect(t *testing.T, defaultBehavior, getBehavior, postBehavior Redir
 	router.RedirectBehavior = defaultBehavior
 
 	var expectedCodeMap = map[string]int{"PUT": behaviorToCode(defaultBehavior)}
+	if defaultBehavior == Redirect301 {
+		// 301 is only used for GET and HEAD unless RedirectNonGetBehavior says otherwise.
+		expectedCodeMap["PUT"] = 308
+	}
 
 	if customMethods {
 		router.RedirectMethodBehavior["GET"] = getBehavior
@@ -289,7 +503,7 @@ func testRedirect(t *testing.T, defaultBehavior, getBehavior, postBehavior Redir
 		expectedCodeMap["GET"] = behaviorToCode(getBehavior)
 		expectedCodeMap["POST"] = behaviorToCode(postBehavior)
 	} else {
-		expectedCodeMap["GET"] = expectedCodeMap["PUT"]
+		expectedCodeMap["GET"] = behaviorToCode(defaultBehavior)
 		expectedCodeMap["POST"] = expectedCodeMap["PUT"]
 	}
 
@@ -387,6 +601,61 @@ func testRedirect(t *testing.T, defaultBehavior, getBehavior, postBehavior Redir
 	}
 }
 
+func TestRedirectCleanPath(t *testing.T) {
+	var param string
+	handler := func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		param = params["path"]
+	}
+
+	router := New()
+	router.GET("/b", simpleHandler)
+	router.GET("/slash/", simpleHandler)
+	router.GET("/files/*path", handler)
+
+	testPath := func(path string, expectedCode int, expectedLocation string) {
+		param = ""
+		r, _ := newRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != expectedCode {
+			t.Errorf("%s expected code %d, saw %d", path, expectedCode, w.Code)
+		}
+		if location := w.Header().Get("Location"); location != expectedLocation {
+			t.Errorf("%s expected location %q, saw %q", path, expectedLocation, location)
+		}
+	}
+
+	testPath("//a/../b", http.StatusMovedPermanently, "/b")
+	testPath("/a/./../b?x=1", http.StatusMovedPermanently, "/b?x=1")
+	testPath("/./b/", http.StatusMovedPermanently, "/b")
+	// Redirect directly to the canonical trailing slash.
+	testPath("//slash", http.StatusMovedPermanently, "/slash/")
+	testPath("/slash/.", http.StatusMovedPermanently, "/slash/")
+	// Unclean paths aren't passed to the catch-all.
+	testPath("/files/../files/x", http.StatusMovedPermanently, "/files/x")
+	testPath("/files//x", http.StatusMovedPermanently, "/files/x")
+	testPath("/files/a/../x/", http.StatusMovedPermanently, "/files/x/")
+	testPath("/files/x", http.StatusOK, "")
+	if param != "x" {
+		t.Errorf("Expected catch-all value x, saw %q", param)
+	}
+	testPath("//nothing/../c", http.StatusNotFound, "")
+
+	router.RedirectBehavior = UseHandler
+	testPath("/files/../files/x", http.StatusOK, "")
+	if param != "x" {
+		t.Errorf("With UseHandler, expected catch-all value x, saw %q", param)
+	}
+
+	router.RedirectBehavior = Redirect301
+	router.RedirectCleanPath = false
+	testPath("//a/../b", http.StatusNotFound, "")
+	testPath("/files/../x", http.StatusOK, "")
+	if param != "../x" {
+		t.Errorf("With RedirectCleanPath false, expected catch-all value ../x, saw %q", param)
+	}
+}
+
 func TestSkipRedirect(t *testing.T) {
 	router := New()
 	router.RedirectTrailingSlash = false
@@ -416,6 +685,60 @@ func TestSkipRedirect(t *testing.T) {
 	}
 }
 
+func TestTrailingSlashBehavior(t *testing.T) {
+	router := New()
+	router.GET("/", simpleHandler)
+	router.GET("/slash/", simpleHandler)
+	router.GET("/noslash", simpleHandler)
+	router.GET("/override", simpleHandler).TrailingSlash(TrailingSlashStrict)
+
+	testPath := func(path string, expectedCode int, expectedLocation string) {
+		r, _ := newRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != expectedCode {
+			t.Errorf("Behavior %d: %s expected code %d, saw %d",
+				router.TrailingSlashBehavior, path, expectedCode, w.Code)
+		}
+		if location := w.Header().Get("Location"); location != expectedLocation {
+			t.Errorf("Behavior %d: %s expected location %q, saw %q",
+				router.TrailingSlashBehavior, path, expectedLocation, location)
+		}
+	}
+
+	testPath("/slash", http.StatusMovedPermanently, "/slash/")
+	testPath("/noslash/", http.StatusMovedPermanently, "/noslash")
+	testPath("/override", http.StatusOK, "")
+	testPath("/override/", http.StatusNotFound, "")
+
+	router.TrailingSlashBehavior = TrailingSlashAdd
+	testPath("/", http.StatusOK, "")
+	testPath("/slash", http.StatusMovedPermanently, "/slash/")
+	testPath("/slash/", http.StatusOK, "")
+	testPath("/noslash", http.StatusMovedPermanently, "/noslash/")
+	testPath("/noslash/", http.StatusOK, "")
+
+	router.TrailingSlashBehavior = TrailingSlashRemove
+	testPath("/", http.StatusOK, "")
+	testPath("/slash", http.StatusOK, "")
+	testPath("/slash/", http.StatusMovedPermanently, "/slash")
+	testPath("/noslash", http.StatusOK, "")
+	testPath("/noslash/", http.StatusMovedPermanently, "/noslash")
+
+	router.TrailingSlashBehavior = TrailingSlashEquivalent
+	testPath("/slash", http.StatusOK, "")
+	testPath("/slash/", http.StatusOK, "")
+	testPath("/noslash", http.StatusOK, "")
+	testPath("/noslash/", http.StatusOK, "")
+	testPath("/override/", http.StatusNotFound, "")
+
+	router.TrailingSlashBehavior = TrailingSlashStrict
+	testPath("/slash", http.StatusNotFound, "")
+	testPath("/slash/", http.StatusOK, "")
+	testPath("/noslash", http.StatusOK, "")
+	testPath("/noslash/", http.StatusNotFound, "")
+}
+
 func TestCatchAllTrailingSlashRedirect(t *testing.T) {
 	router := New()
 	redirectSettings := []bool{false, true}
@@ -458,6 +781,78 @@ func TestCatchAllTrailingSlashRedirect(t *testing.T) {
 
 }
 
+func TestCaseInsensitive(t *testing.T) {
+	var param string
+	router := New()
+	router.GET("/users/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		param = params["id"]
+	})
+	router.GET("/USERS/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		param = "upper " + params["id"]
+	})
+
+	testPath := func(path string, expectedCode int, expectedParam string) {
+		param = ""
+		r, _ := newRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != expectedCode || param != expectedParam {
+			t.Errorf("Path %s with CaseInsensitive %v expected code %d and param %q, saw %d and %q",
+				path, router.CaseInsensitive, expectedCode, expectedParam, w.Code, param)
+		}
+	}
+
+	testPath("/Users/Bob", http.StatusNotFound, "")
+	router.CaseInsensitive = true
+	testPath("/users/Bob", http.StatusOK, "Bob")
+	testPath("/USERS/Bob", http.StatusOK, "upper Bob")
+	testPath("/Users/Bob", http.StatusOK, "Bob")
+	testPath("/Users/Bob/", http.StatusMovedPermanently, "")
+	testPath("/Users//Bob", http.StatusMovedPermanently, "")
+}
+
+func TestRedirectCase(t *testing.T) {
+	router := New()
+	router.CaseInsensitive = true
+	router.RedirectCase = true
+	router.GET("/Users/:id/Posts", simpleHandler)
+	router.GET("/files/*path", simpleHandler)
+	router.GET("/api/", simpleHandler)
+	router.POST("/Users/:id/Posts", simpleHandler)
+
+	tests := []struct {
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		{"GET", "/Users/Bob/Posts", http.StatusOK, ""},
+		{"GET", "/users/Bob/posts", http.StatusMovedPermanently, "/Users/Bob/Posts"},
+		{"GET", "/USERS/bob/POSTS?page=2", http.StatusMovedPermanently, "/Users/bob/Posts?page=2"},
+		{"GET", "/FILES/Docs/A.txt", http.StatusMovedPermanently, "/files/Docs/A.txt"},
+		{"GET", "/API", http.StatusMovedPermanently, "/api/"},
+		{"GET", "/users/../Users/x/posts", http.StatusMovedPermanently, "/Users/x/Posts"},
+		{"POST", "/users/Bob/posts", 308, "/Users/Bob/Posts"},
+	}
+	for _, test := range tests {
+		r, _ := newRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("%s %s expected %d to %q, saw %d to %q", test.method, test.path, test.code,
+				test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	router.RedirectReasonBehavior = map[RedirectReason]RedirectBehavior{ReasonCase: UseHandler}
+	r, _ := newRequest("GET", "/users/Bob/posts", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected UseHandler for ReasonCase to serve the request, saw %d", w.Code)
+	}
+}
+
 func TestRoot(t *testing.T) {
 	for _, scenario := range scenarios {
 		t.Log(scenario.description)
@@ -491,7 +886,7 @@ func TestWildcardAtSplitNode(t *testing.T) {
 	router.GET("/:slug", simpleHandler)
 	router.GET("/:slug/abc", simpleHandler)
 
-	t.Log(router.root.dumpTree("", " "))
+	t.Log(router.Dump())
 
 	r, _ := newRequest("GET", "/patch", nil)
 	w := httptest.NewRecorder()
@@ -628,48 +1023,1168 @@ func TestPathSource(t *testing.T) {
 	}
 }
 
-func BenchmarkRouterSimple(b *testing.B) {
+func TestHandleErr(t *testing.T) {
 	router := New()
+	if _, err := router.HandleErr("GET", "/user/:id", simpleHandler); err != nil {
+		t.Errorf("Unexpected error adding route: %s", err)
+	}
 
-	router.GET("/", simpleHandler)
-	router.GET("/user/dimfeld", simpleHandler)
+	badRoutes := []struct {
+		method string
+		path   string
+	}{
+		{"GET", "user"},
+		{"GET", "/user/:id"},
+		{"POST", "/user/:name"},
+		{"GET", "/files/*path/:abc"},
+		{"GET", "/abc/de:f"},
+	}
 
-	r, _ := newRequest("GET", "/user/dimfeld", nil)
+	for _, route := range badRoutes {
+		if _, err := router.HandleErr(route.method, route.path, simpleHandler); err == nil {
+			t.Errorf("Expected error adding %s %s", route.method, route.path)
+		}
 
-	benchRequest(b, router, r)
+		// Handle should panic for the same routes.
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected panic from Handle for %s %s", route.method, route.path)
+				}
+			}()
+			router.Handle(route.method, route.path, simpleHandler)
+		}()
+	}
+
+	if _, err := router.Group("/api").HandleErr("GET", "noslash", simpleHandler); err == nil {
+		t.Error("Expected error from group for path without leading slash")
+	}
+
+	// The failed routes should not have changed the router.
+	w := httptest.NewRecorder()
+	r, _ := newRequest("POST", "/user/abc", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST after failed registration, saw %d", w.Code)
+	}
 }
 
-func BenchmarkRouterRootWithPanicHandler(b *testing.B) {
+func TestRemove(t *testing.T) {
 	router := New()
-	router.PanicHandler = SimplePanicHandler
+	router.OptionsHandler = simpleHandler
+	router.GET("/user/:id", simpleHandler).Name("user")
+	router.POST("/user/:id", simpleHandler)
+	router.GET("/dir/", simpleHandler)
+	api := router.Group("/api")
+	api.GET("/items", simpleHandler)
+
+	if router.Remove("GET", "/user/:name") {
+		t.Error("Remove with different wildcard names should fail")
+	}
+	if !router.Remove("GET", "/user/:id") {
+		t.Error("Expected to remove GET /user/:id")
+	}
+	if router.Remove("GET", "/user/:id") {
+		t.Error("Removing a route twice should fail")
+	}
 
-	router.GET("/", simpleHandler)
-	router.GET("/user/dimfeld", simpleHandler)
+	if _, err := router.URL("user", map[string]string{"id": "1"}); err == nil {
+		t.Error("Expected the name of a removed route to be released")
+	}
+	router.PUT("/user/:id", simpleHandler).Name("user")
 
-	r, _ := newRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	r, _ := newRequest("GET", "/user/1", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for removed GET handler, saw %d", w.Code)
+	}
 
-	benchRequest(b, router, r)
+	// The automatic OPTIONS handler goes away with the last route.
+	router.Remove("POST", "/user/:id")
+	router.Remove("PUT", "/user/:id")
+	w = httptest.NewRecorder()
+	r, _ = newRequest("OPTIONS", "/user/1", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after removing all handlers, saw %d", w.Code)
+	}
+
+	if !router.Remove("GET", "/dir/") {
+		t.Error("Expected to remove GET /dir/")
+	}
+	if !api.Remove("GET", "/items") {
+		t.Error("Expected to remove GET /items from group")
+	}
+	if router.Remove("GET", "noslash") {
+		t.Error("Remove should fail for a path without a leading slash")
+	}
+
+	for _, path := range []string{"/dir/", "/dir", "/api/items"} {
+		w = httptest.NewRecorder()
+		r, _ = newRequest("GET", path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s after removal, saw %d", path, w.Code)
+		}
+	}
 }
 
-func BenchmarkRouterRootWithoutPanicHandler(b *testing.B) {
+func TestRegisterWhileServing(t *testing.T) {
 	router := New()
-	router.PanicHandler = nil
+	router.GET("/user/:id", simpleHandler)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				w := httptest.NewRecorder()
+				r, _ := newRequest("GET", "/user/abc", nil)
+				router.ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					t.Errorf("Expected 200 while routes are added, saw %d", w.Code)
+					return
+				}
+			}
+		}()
+	}
 
-	router.GET("/", simpleHandler)
-	router.GET("/user/dimfeld", simpleHandler)
+	for i := 0; i < 100; i++ {
+		path := fmt.Sprintf("/tenant%d/:id", i)
+		router.GET(path, simpleHandler)
+		router.Host(fmt.Sprintf("tenant%d.example.com", i)).GET("/", simpleHandler)
+		if i%2 == 0 {
+			router.Remove("GET", path)
+		}
+	}
+	close(done)
+	wg.Wait()
 
-	r, _ := newRequest("GET", "/", nil)
+	for i, expected := range []int{http.StatusNotFound, http.StatusOK} {
+		w := httptest.NewRecorder()
+		r, _ := newRequest("GET", fmt.Sprintf("/tenant%d/abc", i), nil)
+		router.ServeHTTP(w, r)
+		if w.Code != expected {
+			t.Errorf("Expected %d for tenant%d, saw %d", expected, i, w.Code)
+		}
+	}
+}
 
-	benchRequest(b, router, r)
+func TestWalk(t *testing.T) {
+	router := New()
+	router.OptionsHandler = simpleHandler
+	patterns := []string{
+		"/",
+		"/users/",
+		"/users/:id",
+		"/users/:id/posts/:post",
+		"/users/:id|^[0-9]+$/edit",
+		"/user",
+		"/files/*path",
+		"/images/*",
+		"/files/:name.:ext/:page",
+		"/files/*path.js",
+		"/repos/*repo/blob/",
+	}
+	for _, pattern := range patterns {
+		router.GET(pattern, simpleHandler)
+	}
+	router.POST("/users/:id", simpleHandler)
+
+	var routes []string
+	router.Walk(func(method, path string, handler HandlerFunc) bool {
+		if handler == nil {
+			t.Errorf("Nil handler for %s %s", method, path)
+		}
+		routes = append(routes, method+" "+path)
+		return true
+	})
+
+	expected := []string{"POST /users/:id"}
+	for _, pattern := range patterns {
+		expected = append(expected, "GET "+pattern)
+	}
+	sort.Strings(routes)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Expected routes %v, saw %v", expected, routes)
+	}
+
+	count := 0
+	router.Walk(func(method, path string, handler HandlerFunc) bool {
+		count++
+		return count < 3
+	})
+	if count != 3 {
+		t.Errorf("Expected Walk to stop after 3 routes, saw %d", count)
+	}
 }
 
-func BenchmarkRouterParam(b *testing.B) {
+func TestAutoOptions(t *testing.T) {
 	router := New()
+	router.GET("/user/:id", simpleHandler)
+	router.PUT("/user/:id", simpleHandler)
+	router.OPTIONS("/explicit", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.GET("/explicit", simpleHandler)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := newRequest(method, path, nil)
+		router.ServeHTTP(w, r)
+		return w
+	}
 
-	router.GET("/", simpleHandler)
-	router.GET("/user/:name", simpleHandler)
+	if w := serve("OPTIONS", "/user/1"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for OPTIONS without AutoOptions, saw %d", w.Code)
+	}
 
-	r, _ := newRequest("GET", "/user/dimfeld", nil)
+	router.AutoOptions = true
+	w := serve("OPTIONS", "/user/1")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for automatic OPTIONS, saw %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, PUT" {
+		t.Errorf("Expected Allow header GET, HEAD, OPTIONS, PUT, saw %s", allow)
+	}
 
-	benchRequest(b, router, r)
+	if w := serve("DELETE", "/user/1"); w.Header().Get("Allow") != "GET, HEAD, OPTIONS, PUT" {
+		t.Errorf("Expected OPTIONS in the 405 Allow header, saw %s", w.Header().Get("Allow"))
+	}
+
+	if w := serve("OPTIONS", "/explicit"); w.Code != http.StatusTeapot {
+		t.Errorf("Expected the explicit OPTIONS handler, saw %d", w.Code)
+	}
+
+	router.AutoOptionsHandler = func(w http.ResponseWriter, r *http.Request, methods map[string]HandlerFunc) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		AutoOptionsHandler(w, r, methods)
+	}
+	w = serve("OPTIONS", "/user/1")
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Code != http.StatusOK {
+		t.Errorf("Expected the custom AutoOptionsHandler to be used, saw %d %v", w.Code, w.Header())
+	}
+
+	if w := serve("OPTIONS", "/missing"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for OPTIONS on a missing path, saw %d", w.Code)
+	}
+}
+
+func TestExplicitOptionsReplacesOptionsHandler(t *testing.T) {
+	router := New()
+	router.OptionsHandler = simpleHandler
+	router.GET("/user", simpleHandler)
+
+	if _, err := router.HandleErr("OPTIONS", "/user", simpleHandler); err != nil {
+		t.Errorf("Expected explicit OPTIONS to replace the automatic one, saw %s", err)
+	}
+	if _, err := router.HandleErr("OPTIONS", "/user", simpleHandler); err == nil {
+		t.Error("Expected error adding a second explicit OPTIONS handler")
+	}
+}
+
+func TestEncodedSlashBehavior(t *testing.T) {
+	var params map[string]string
+	handler := func(w http.ResponseWriter, r *http.Request, p map[string]string) {
+		params = p
+	}
+
+	router := New()
+	router.GET("/post/:post", handler)
+	router.GET("/post/:post/:page", handler)
+
+	tests := []struct {
+		behavior EncodedSlashBehavior
+		code     int
+		params   map[string]string
+	}{
+		{EncodedSlashInParam, http.StatusOK, map[string]string{"post": "abc/def"}},
+		{EncodedSlashSeparator, http.StatusOK, map[string]string{"post": "abc", "page": "def"}},
+		{EncodedSlashReject, http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		router.EncodedSlashBehavior = test.behavior
+		for _, path := range []string{"/post/abc%2Fdef", "/post/abc%2fdef"} {
+			params = nil
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", path, nil)
+			r.RequestURI = path
+			router.ServeHTTP(w, r)
+
+			if w.Code != test.code {
+				t.Errorf("Behavior %d, path %s expected code %d, saw %d", test.behavior, path, test.code, w.Code)
+			}
+			if !reflect.DeepEqual(params, test.params) {
+				t.Errorf("Behavior %d, path %s expected params %v, saw %v", test.behavior, path, test.params, params)
+			}
+		}
+
+		// Paths without an encoded slash are not affected.
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/post/abc%2E", nil)
+		r.RequestURI = "/post/abc%2E"
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("Behavior %d expected 200 without an encoded slash, saw %d", test.behavior, w.Code)
+		}
+	}
+}
+
+func TestRawParams(t *testing.T) {
+	var params map[string]string
+	handler := func(w http.ResponseWriter, r *http.Request, p map[string]string) {
+		params = p
+	}
+
+	router := New()
+	router.GET("/keys/:key/*path", handler)
+
+	serve := func() {
+		params = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/keys/a+b%20c/d%2Fe/f%3D", nil)
+		r.RequestURI = "/keys/a+b%20c/d%2Fe/f%3D"
+		router.ServeHTTP(w, r)
+	}
+
+	serve()
+	expected := map[string]string{"key": "a+b c", "path": "d/e/f="}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected unescaped params %v, saw %v", expected, params)
+	}
+
+	router.RawParams = true
+	serve()
+	expected = map[string]string{"key": "a+b%20c", "path": "d%2Fe/f%3D"}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected raw params %v, saw %v", expected, params)
+	}
+}
+
+func TestAllocations(t *testing.T) {
+	router := New()
+	router.GET("/user/dimfeld", simpleHandler)
+	router.GET("/repos/:owner/:repo/issues/:number/comments/*path", simpleHandler)
+
+	w := httptest.NewRecorder()
+	static, _ := newRequest("GET", "/user/dimfeld", nil)
+	if allocs := testing.AllocsPerRun(100, func() { router.ServeHTTP(w, static) }); allocs != 0 {
+		t.Errorf("Expected no allocations for a static route, saw %v", allocs)
+	}
+
+	// One for the params slice, and the rest for the map, however many params there are.
+	params, _ := newRequest("GET", "/repos/dimfeld/httptreemux/issues/1/comments/a/b", nil)
+	if allocs := testing.AllocsPerRun(100, func() { router.ServeHTTP(w, params) }); allocs > 3 {
+		t.Errorf("Expected at most 3 allocations for a route with params, saw %v", allocs)
+	}
+}
+
+func TestReuseParams(t *testing.T) {
+	var saw map[string]string
+	handler := func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		saw = make(map[string]string, len(params))
+		for key, value := range params {
+			saw[key] = value
+		}
+	}
+
+	router := New()
+	router.ReuseParams = true
+	router.GET("/user/:id", handler)
+	router.GET("/post/:post/:page", handler)
+	router.GET("/static", handler)
+
+	tests := []struct {
+		path   string
+		params map[string]string
+	}{
+		{"/user/1", map[string]string{"id": "1"}},
+		{"/post/a/2", map[string]string{"post": "a", "page": "2"}},
+		{"/user/3", map[string]string{"id": "3"}},
+		{"/static", map[string]string{}},
+	}
+
+	for i := 0; i < 3; i++ {
+		for _, test := range tests {
+			w := httptest.NewRecorder()
+			r, _ := newRequest("GET", test.path, nil)
+			router.ServeHTTP(w, r)
+			if !reflect.DeepEqual(saw, test.params) {
+				t.Errorf("%s expected params %v, saw %v", test.path, test.params, saw)
+			}
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	var served string
+	router := New()
+	router.GET("/user/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		served = params["id"]
+	})
+	router.GET("/dir/", simpleHandler)
+	router.Host("example.com").GET("/hosted", simpleHandler)
+
+	tests := []struct {
+		method       string
+		path         string
+		code         int
+		found        bool
+		pattern      string
+		params       map[string]string
+		redirectPath string
+	}{
+		{"GET", "/user/a%20b", http.StatusOK, true, "/user/:id", map[string]string{"id": "a b"}, ""},
+		{"HEAD", "/user/1", http.StatusOK, true, "/user/:id", map[string]string{"id": "1"}, ""},
+		{"POST", "/user/1", http.StatusMethodNotAllowed, false, "/user/:id", nil, ""},
+		{"GET", "/dir", http.StatusMovedPermanently, false, "/dir/", nil, "/dir/"},
+		{"GET", "/user//1", http.StatusMovedPermanently, false, "/user/:id", nil, "/user/1"},
+		{"GET", "/missing", http.StatusNotFound, false, "", nil, ""},
+		{"GET", "/hosted", http.StatusNotFound, false, "", nil, ""},
+		{"GET", "*", http.StatusNotFound, false, "", nil, ""},
+	}
+
+	for _, test := range tests {
+		lr, found := router.Lookup(test.method, test.path)
+		if found != test.found || lr.StatusCode != test.code {
+			t.Errorf("%s %s expected %d, %v, saw %d, %v", test.method, test.path,
+				test.code, test.found, lr.StatusCode, found)
+		}
+		if lr.Pattern != test.pattern {
+			t.Errorf("%s %s expected pattern %q, saw %q", test.method, test.path, test.pattern, lr.Pattern)
+		}
+		if test.params != nil && !reflect.DeepEqual(lr.Params, test.params) {
+			t.Errorf("%s %s expected params %v, saw %v", test.method, test.path, test.params, lr.Params)
+		}
+		if lr.RedirectPath != test.redirectPath {
+			t.Errorf("%s %s expected redirect to %q, saw %q", test.method, test.path, test.redirectPath, lr.RedirectPath)
+		}
+		if found && lr.Handler == nil {
+			t.Errorf("%s %s expected a handler", test.method, test.path)
+		}
+	}
+
+	if lr, _ := router.Lookup("POST", "/user/1"); !reflect.DeepEqual(sortedMethods(lr.Methods), []string{"GET", "HEAD"}) {
+		t.Errorf("Expected methods GET and HEAD for 405, saw %v", lr.Methods)
+	}
+
+	r, _ := newRequest("GET", "/hosted", nil)
+	r.Host = "example.com"
+	if lr, found := router.LookupRequest(r); !found || lr.Pattern != "/hosted" {
+		t.Errorf("Expected LookupRequest to use the host tree, saw %d %q", lr.StatusCode, lr.Pattern)
+	}
+
+	// Serving the result acts like ServeHTTP.
+	r, _ = newRequest("GET", "/user/42", nil)
+	lr, _ := router.LookupRequest(r)
+	w := httptest.NewRecorder()
+	router.ServeLookupResult(w, r, lr)
+	if served != "42" || w.Code != http.StatusOK {
+		t.Errorf("Expected handler to be served with id 42, saw %q, %d", served, w.Code)
+	}
+
+	r, _ = newRequest("GET", "/dir", nil)
+	lr, _ = router.LookupRequest(r)
+	w = httptest.NewRecorder()
+	router.ServeLookupResult(w, r, lr)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/dir/" {
+		t.Errorf("Expected redirect to /dir/, saw %d %v", w.Code, w.Header())
+	}
+
+	r, _ = newRequest("POST", "/user/1", nil)
+	lr, _ = router.LookupRequest(r)
+	w = httptest.NewRecorder()
+	router.ServeLookupResult(w, r, lr)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("Expected 405 with Allow header, saw %d %v", w.Code, w.Header())
+	}
+}
+
+func sortedMethods(methods map[string]HandlerFunc) []string {
+	var sorted []string
+	for method := range methods {
+		sorted = append(sorted, method)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func TestMiddleware(t *testing.T) {
+	var execLog []string
+
+	record := func(s string) {
+		execLog = append(execLog, s)
+	}
+
+	newMiddleware := func(name string) MiddlewareFunc {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+				record(name)
+				next(w, r, params)
+			}
+		}
+	}
+
+	router := New()
+	router.GET("/before", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		record("before")
+	})
+
+	router.Use(newMiddleware("m1"))
+	router.Use(newMiddleware("m2"))
+	router.GET("/h/:param", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		record("handler " + params["param"])
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := newRequest("GET", "/h/abc", nil)
+	router.ServeHTTP(w, r)
+
+	expected := []string{"m1", "m2", "handler abc"}
+	if !reflect.DeepEqual(execLog, expected) {
+		t.Errorf("Expected execution order %v, saw %v", expected, execLog)
+	}
+
+	execLog = nil
+	r, _ = newRequest("GET", "/before", nil)
+	router.ServeHTTP(w, r)
+
+	expected = []string{"before"}
+	if !reflect.DeepEqual(execLog, expected) {
+		t.Errorf("Middleware should not wrap routes added before Use, saw %v", execLog)
+	}
+}
+
+func BenchmarkRouterSimple(b *testing.B) {
+	router := New()
+
+	router.GET("/", simpleHandler)
+	router.GET("/user/dimfeld", simpleHandler)
+
+	r, _ := newRequest("GET", "/user/dimfeld", nil)
+
+	benchRequest(b, router, r)
+}
+
+func BenchmarkRouterRootWithPanicHandler(b *testing.B) {
+	router := New()
+	router.PanicHandler = SimplePanicHandler
+
+	router.GET("/", simpleHandler)
+	router.GET("/user/dimfeld", simpleHandler)
+
+	r, _ := newRequest("GET", "/", nil)
+
+	benchRequest(b, router, r)
+}
+
+func BenchmarkRouterRootWithoutPanicHandler(b *testing.B) {
+	router := New()
+	router.PanicHandler = nil
+
+	router.GET("/", simpleHandler)
+	router.GET("/user/dimfeld", simpleHandler)
+
+	r, _ := newRequest("GET", "/", nil)
+
+	benchRequest(b, router, r)
+}
+
+func BenchmarkRouterParam(b *testing.B) {
+	router := New()
+
+	router.GET("/", simpleHandler)
+	router.GET("/user/:name", simpleHandler)
+
+	r, _ := newRequest("GET", "/user/dimfeld", nil)
+
+	benchRequest(b, router, r)
+}
+
+func BenchmarkRouterManyParams(b *testing.B) {
+	router := New()
+
+	router.GET("/", simpleHandler)
+	router.GET("/repos/:owner/:repo/issues/:number/comments/*path", simpleHandler)
+
+	r, _ := newRequest("GET", "/repos/dimfeld/httptreemux/issues/1/comments/a/b", nil)
+
+	benchRequest(b, router, r)
+}
+
+func BenchmarkRouterParamReuse(b *testing.B) {
+	router := New()
+	router.ReuseParams = true
+
+	router.GET("/", simpleHandler)
+	router.GET("/user/:name", simpleHandler)
+
+	r, _ := newRequest("GET", "/user/dimfeld", nil)
+
+	benchRequest(b, router, r)
+}
+
+func TestBraceWildcards(t *testing.T) {
+	var matched string
+	router := New()
+	router.GET("/users/{id}/posts/{post_id}", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		matched = params["id"] + " " + params["post_id"]
+	})
+	router.GET("/files/{path...}", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		matched = params["path"]
+	})
+
+	tests := []struct {
+		path   string
+		expect string
+	}{
+		{"/users/5/posts/6", "5 6"},
+		{"/files/a/b.txt", "a/b.txt"},
+	}
+	for _, test := range tests {
+		matched = ""
+		r, _ := newRequest("GET", test.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if matched != test.expect {
+			t.Errorf("Path %s expected match %q, saw %q", test.path, test.expect, matched)
+		}
+	}
+
+	// Either syntax can be used to remove the route.
+	if !router.Remove("GET", "/users/:id/posts/{post_id}") {
+		t.Error("Expected route to be removed")
+	}
+	if _, found := router.Lookup("GET", "/users/5/posts/6"); found {
+		t.Error("Expected removed route not to be found")
+	}
+}
+
+func TestTranslateBraces(t *testing.T) {
+	tests := []struct {
+		path   string
+		expect string
+		ok     bool
+	}{
+		{"/users/:id", "/users/:id", true},
+		{"/users/{id}", "/users/:id", true},
+		{"/users/{id}/", "/users/:id/", true},
+		{"/files/{path...}", "/files/*path", true},
+		{"/codes/:code|^[0-9]{3}$", "/codes/:code|^[0-9]{3}$", true},
+		{"/codes/:code|^[0-9]{3}$/{id}", "/codes/:code|^[0-9]{3}$/:id", true},
+		{"/users/{id}x", "", false},
+		{"/users/x{id}", "", false},
+		{"/users/{}", "", false},
+		{"/users/{a-b}", "", false},
+		{"/users/:id{x}", "", false},
+		{"/files/*{path}", "", false},
+		{"/files/{path...}/x", "", false},
+		{"/users/{$}", "", false},
+	}
+
+	for _, test := range tests {
+		path, err := translateBraces(test.path)
+		if (err == nil) != test.ok || path != test.expect {
+			t.Errorf("Path %s expected %q with ok %v, saw %q with error %v", test.path, test.expect, test.ok, path, err)
+		}
+	}
+
+	if _, err := New().HandleErr("GET", "/users/{id}x", simpleHandler); err == nil {
+		t.Error("Expected HandleErr to return an error for mixed wildcard syntax")
+	}
+}
+
+func TestOptionalSegments(t *testing.T) {
+	var params map[string]string
+	router := New()
+	router.GET("/articles/:year/:month?/:day?", func(w http.ResponseWriter, r *http.Request, p map[string]string) {
+		params = p
+	})
+
+	tests := []struct {
+		path   string
+		expect map[string]string
+	}{
+		{"/articles/2024", map[string]string{"year": "2024"}},
+		{"/articles/2024/05", map[string]string{"year": "2024", "month": "05"}},
+		{"/articles/2024/05/17", map[string]string{"year": "2024", "month": "05", "day": "17"}},
+		{"/articles", nil},
+		{"/articles/2024/05/17/x", nil},
+	}
+	for _, test := range tests {
+		params = nil
+		r, _ := newRequest("GET", test.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if !reflect.DeepEqual(params, test.expect) {
+			t.Errorf("Path %s expected params %v, saw %v", test.path, test.expect, params)
+		}
+	}
+
+	if !router.Remove("GET", "/articles/:year/:month?/:day?") {
+		t.Error("Expected route to be removed")
+	}
+	for _, path := range []string{"/articles/2024", "/articles/2024/05", "/articles/2024/05/17"} {
+		if _, found := router.Lookup("GET", path); found {
+			t.Errorf("Expected removed route %s not to be found", path)
+		}
+	}
+
+	// A conflict in any of the expanded paths leaves the tree as it was.
+	router.GET("/posts/:id", simpleHandler)
+	if _, err := router.HandleErr("GET", "/posts/:slug/:page?", simpleHandler); err == nil {
+		t.Error("Expected an error for a conflicting wildcard name")
+	}
+	if _, found := router.Lookup("GET", "/posts/a/2"); found {
+		t.Error("Expected no route to be added after a conflict")
+	}
+}
+
+func TestExpandOptional(t *testing.T) {
+	tests := []struct {
+		path   string
+		expect []string
+		ok     bool
+	}{
+		{"/articles/:year", []string{"/articles/:year"}, true},
+		{"/articles/:year?", []string{"/articles", "/articles/:year"}, true},
+		{"/articles/:year?/", []string{"/articles/", "/articles/:year/"}, true},
+		{"/:lang?", []string{"/", "/:lang"}, true},
+		{"/a/:b?/:c?", []string{"/a", "/a/:b", "/a/:b/:c"}, true},
+		{"/a/:b:int?", []string{"/a", "/a/:b:int"}, true},
+		{"/a/:b|^x?$", []string{"/a/:b|^x?$"}, true},
+		{"/a/:b?/c", nil, false},
+		{"/a/:b?/:c", nil, false},
+	}
+
+	for _, test := range tests {
+		paths, err := expandOptional(test.path)
+		if (err == nil) != test.ok || !reflect.DeepEqual(paths, test.expect) {
+			t.Errorf("Path %s expected %v with ok %v, saw %v with error %v", test.path, test.expect, test.ok, paths, err)
+		}
+	}
+}
+
+func TestBacktracking(t *testing.T) {
+	var matched string
+	handler := func(pattern string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			matched = pattern
+		}
+	}
+
+	router := New()
+	router.GET("/users/new", handler("/users/new"))
+	router.GET("/users/:id/edit", handler("/users/:id/edit"))
+	router.GET("/users/new/:step/done", handler("/users/new/:step/done"))
+	router.GET("/users/*path", handler("/users/*path"))
+	router.POST("/users/:id", handler("POST /users/:id"))
+	router.PUT("/files/*path", handler("PUT /files/*path"))
+	router.GET("/files/readme", handler("/files/readme"))
+
+	type backtrackTest struct {
+		method string
+		path   string
+		expect string
+		status int
+	}
+	run := func(tests []backtrackTest) {
+		for _, test := range tests {
+			matched = ""
+			r, _ := newRequest(test.method, test.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != test.status || matched != test.expect {
+				t.Errorf("%s %s with BacktrackMethods %v expected %d from %q, saw %d from %q",
+					test.method, test.path, router.BacktrackMethods, test.status, test.expect, w.Code, matched)
+			}
+		}
+	}
+
+	run([]backtrackTest{
+		{"GET", "/users/new", "/users/new", http.StatusOK},
+		{"GET", "/users/new/edit", "/users/:id/edit", http.StatusOK},
+		{"GET", "/users/new/1/done", "/users/new/:step/done", http.StatusOK},
+		{"GET", "/users/new/1/other", "/users/*path", http.StatusOK},
+		{"GET", "/users/5/edit/x", "/users/*path", http.StatusOK},
+		{"POST", "/users/new", "", http.StatusMethodNotAllowed},
+		{"PUT", "/files/readme", "", http.StatusMethodNotAllowed},
+	})
+
+	router.BacktrackMethods = true
+	run([]backtrackTest{
+		{"GET", "/users/new", "/users/new", http.StatusOK},
+		{"POST", "/users/new", "POST /users/:id", http.StatusOK},
+		{"PUT", "/files/readme", "PUT /files/*path", http.StatusOK},
+		{"DELETE", "/users/new", "", http.StatusMethodNotAllowed},
+		{"HEAD", "/users/new", "/users/new", http.StatusOK},
+	})
+}
+
+func TestPrecedence(t *testing.T) {
+	var matched string
+	handler := func(pattern string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			matched = pattern
+		}
+	}
+
+	router := New()
+	router.GET("/users/new", handler("/users/new"))
+	router.GET("/users/:id|^[0-9]+$", handler("/users/:id|^[0-9]+$"))
+	router.GET("/users/:name", handler("/users/:name"))
+	router.GET("/users/*path", handler("/users/*path"))
+
+	tests := []struct {
+		precedence []MatchKind
+		path       string
+		expect     string
+	}{
+		{nil, "/users/new", "/users/new"},
+		{nil, "/users/5", "/users/:id|^[0-9]+$"},
+		{nil, "/users/bob", "/users/:name"},
+		{nil, "/users/a/b", "/users/*path"},
+		{[]MatchKind{MatchWildcard, MatchConstrained, MatchStatic, MatchCatchAll}, "/users/new", "/users/:name"},
+		{[]MatchKind{MatchWildcard, MatchConstrained, MatchStatic, MatchCatchAll}, "/users/5", "/users/:name"},
+		{[]MatchKind{MatchConstrained, MatchStatic, MatchWildcard}, "/users/5", "/users/:id|^[0-9]+$"},
+		{[]MatchKind{MatchCatchAll, MatchStatic}, "/users/new", "/users/*path"},
+		// Kinds that are left out never match.
+		{[]MatchKind{MatchStatic, MatchWildcard}, "/users/a/b", ""},
+	}
+
+	for _, test := range tests {
+		matched = ""
+		router.Precedence = test.precedence
+		r, _ := newRequest("GET", test.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if matched != test.expect {
+			t.Errorf("Path %s with precedence %v expected %q, saw %q", test.path, test.precedence, test.expect, matched)
+		}
+	}
+}
+
+func TestRedirectRoutes(t *testing.T) {
+	router := New()
+	router.Redirect("/old/users/:id", "/users/:id", http.StatusMovedPermanently)
+	router.Redirect("/old/files/*path", "/files/{path...}", http.StatusFound)
+	router.Redirect("/old/api/:version/:name", "https://api.example.com/:version/:name", 308)
+	router.Group("/v1").Redirect("/items/:id", "/v2/items/:id", http.StatusMovedPermanently)
+	router.Redirect("/o/*path", "/*path", http.StatusMovedPermanently)
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{"GET", "/old/users/5", http.StatusMovedPermanently, "/users/5"},
+		{"GET", "/old/users/a%20b?x=1", http.StatusMovedPermanently, "/users/a%20b?x=1"},
+		{"HEAD", "/old/users/5", http.StatusMovedPermanently, "/users/5"},
+		{"POST", "/old/users/5", http.StatusMethodNotAllowed, ""},
+		{"GET", "/old/files/a/b.txt", http.StatusFound, "/files/a/b.txt"},
+		{"POST", "/old/api/v2/orders", 308, "https://api.example.com/v2/orders"},
+		{"GET", "/v1/items/7", http.StatusMovedPermanently, "/v2/items/7"},
+		// Encoded slashes and backslashes at the start of a catch-all must not make a
+		// location that points at another host.
+		{"GET", "/o/%2Fevil.com", http.StatusMovedPermanently, "/evil.com"},
+		{"GET", "/o/%5Cevil.com", http.StatusMovedPermanently, "/evil.com"},
+		{"GET", "/o/%2F%5C%2Fevil.com/a", http.StatusMovedPermanently, "/evil.com/a"},
+		{"GET", "/o/a%2Fb", http.StatusMovedPermanently, "/a/b"},
+	}
+	for _, test := range tests {
+		r, _ := newRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.status || w.Header().Get("Location") != test.location {
+			t.Errorf("%s %s expected %d to %q, saw %d to %q", test.method, test.path,
+				test.status, test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	bad := []struct{ from, to string }{
+		{"/a/:id", "/b/:name"},
+		{"/a/:id?", "/b/:id"},
+		{"/a/:id", "/b/{id"},
+	}
+	for _, test := range bad {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected panic for redirect from %s to %s", test.from, test.to)
+				}
+			}()
+			New().Redirect(test.from, test.to, http.StatusFound)
+		}()
+	}
+
+	for _, statusCode := range []int{http.StatusOK, http.StatusMultipleChoices, http.StatusNotModified} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected panic for status code %d, which is not a redirect", statusCode)
+				}
+			}()
+			New().Redirect("/a", "/b", statusCode)
+		}()
+	}
+
+	// A conflict on one method leaves none of the redirect's routes behind.
+	router = New()
+	router.DELETE("/a", simpleHandler)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected panic for a redirect that conflicts with a route")
+			}
+		}()
+		router.Redirect("/a", "/b", http.StatusTemporaryRedirect)
+	}()
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH"} {
+		if _, found := router.Lookup(method, "/a"); found {
+			t.Errorf("Expected no %s route to be left from the failed redirect", method)
+		}
+	}
+}
+
+func TestAny(t *testing.T) {
+	var matched string
+	handler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			matched = name + " " + r.Method
+		}
+	}
+
+	router := New()
+	router.Any("/proxy/*path", handler("any")).Meta("kind", "proxy")
+	router.GET("/proxy/*path", handler("get"))
+	router.DELETE("/proxy/*path", handler("delete"))
+	router.GET("/items/:id", handler("get"))
+
+	tests := []struct {
+		method string
+		path   string
+		expect string
+		status int
+	}{
+		{"GET", "/proxy/a", "get GET", http.StatusOK},
+		{"HEAD", "/proxy/a", "get HEAD", http.StatusOK},
+		{"DELETE", "/proxy/a", "delete DELETE", http.StatusOK},
+		{"POST", "/proxy/a", "any POST", http.StatusOK},
+		{"PROPFIND", "/proxy/a", "any PROPFIND", http.StatusOK},
+		{"OPTIONS", "/proxy/a", "any OPTIONS", http.StatusOK},
+		{"POST", "/items/1", "", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		matched = ""
+		r, _ := newRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.status || matched != test.expect {
+			t.Errorf("%s %s expected %d from %q, saw %d from %q", test.method, test.path,
+				test.status, test.expect, w.Code, matched)
+		}
+	}
+
+	if lr, _ := router.Lookup("POST", "/proxy/a"); lr.Meta["kind"] != "proxy" {
+		t.Errorf("Expected the metadata of the Any route, saw %v", lr.Meta)
+	}
+	if lr, _ := router.Lookup("GET", "/proxy/a"); lr.Meta != nil {
+		t.Errorf("Expected no metadata for the GET route, saw %v", lr.Meta)
+	}
+
+	// An OPTIONS handler added automatically doesn't hide the Any handler.
+	router = New()
+	router.OptionsHandler = handler("options")
+	router.GET("/a", handler("get"))
+	router.Any("/a", handler("any"))
+	router.Any("/b", handler("any"))
+	router.GET("/b", handler("get"))
+	for _, path := range []string{"/a", "/b"} {
+		matched = ""
+		r, _ := newRequest("OPTIONS", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if matched != "any OPTIONS" {
+			t.Errorf("OPTIONS %s expected the Any handler, saw %q", path, matched)
+		}
+	}
+
+	// The Any handler isn't listed as a method of its own, such as in Allow headers.
+	lr, _ := router.Lookup("GET", "/a")
+	if methods := router.allowedMethods(lr.node); allowHeader(methods) != "GET, HEAD" {
+		t.Errorf("Expected the allowed methods to be GET, HEAD, saw %s", allowHeader(methods))
+	}
+}
+
+func TestHandleMethods(t *testing.T) {
+	var matched string
+	handler := func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		matched = r.Method + " " + params["id"]
+	}
+
+	router := New()
+	routes := router.HandleMethods([]string{"GET", "HEAD", "OPTIONS"}, "/posts/:id", handler)
+	if len(routes) != 3 || routes[0].method != "GET" || routes[2].method != "OPTIONS" {
+		t.Fatalf("Expected a route for each method, saw %v", routes)
+	}
+
+	for _, method := range []string{"GET", "HEAD", "OPTIONS"} {
+		matched = ""
+		r, _ := newRequest(method, "/posts/1", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || matched != method+" 1" {
+			t.Errorf("%s expected the handler, saw %d from %q", method, w.Code, matched)
+		}
+	}
+
+	r, _ := newRequest("POST", "/posts/1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST expected 405, saw %d", w.Code)
+	}
+
+	// If one of the methods can't be added, none of them are.
+	router.PUT("/items/:id", handler)
+	if _, err := router.HandleMethodsErr([]string{"GET", "PUT"}, "/items/:id", handler); err == nil {
+		t.Error("Expected an error for a method that is already handled")
+	}
+	if lr, found := router.Lookup("GET", "/items/1"); found || lr.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET to be rolled back, saw %d", lr.StatusCode)
+	}
+
+	if _, err := router.HandleMethodsErr(nil, "/empty", handler); err == nil {
+		t.Error("Expected an error with no methods")
+	}
+
+	group := router.Group("/api")
+	group.HandleMethods([]string{"GET", "DELETE"}, "/users/:id", handler)
+	for _, method := range []string{"GET", "DELETE"} {
+		if _, found := router.Lookup(method, "/api/users/1"); !found {
+			t.Errorf("Expected %s /api/users/1 to be found", method)
+		}
+	}
+}
+
+func TestSwap(t *testing.T) {
+	handler := func(body string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			w.Write([]byte(body))
+		}
+	}
+
+	router := New()
+	router.GET("/a", handler("old"))
+	router.GET("/old", handler("old"))
+
+	next := New()
+	next.GET("/a", handler("new")).Name("a")
+	next.Host("example.com").GET("/a", handler("host"))
+
+	// Requests served while the routes are swapped get one set of routes or the other.
+	var wg sync.WaitGroup
+	errs := make(chan string, 100)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r, _ := newRequest("GET", "/a", nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+				if body := w.Body.String(); body != "old" && body != "new" {
+					errs <- body
+					return
+				}
+			}
+		}()
+	}
+	router.Swap(next)
+	wg.Wait()
+	close(errs)
+	for body := range errs {
+		t.Errorf("Expected old or new while swapping, saw %q", body)
+	}
+
+	serve := func(host, path string) *httptest.ResponseRecorder {
+		r, _ := newRequest("GET", path, nil)
+		r.Host = host
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	if w := serve("", "/a"); w.Body.String() != "new" {
+		t.Errorf("Expected the new route after Swap, saw %q", w.Body.String())
+	}
+	if w := serve("", "/old"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the old route to be gone after Swap, saw %d", w.Code)
+	}
+	if w := serve("example.com", "/a"); w.Body.String() != "host" {
+		t.Errorf("Expected the host route after Swap, saw %q", w.Body.String())
+	}
+	if url, err := router.URL("a", nil); err != nil || url != "/a" {
+		t.Errorf("Expected the route name after Swap, saw %q, %v", url, err)
+	}
+
+	// The routers are independent afterwards.
+	next.GET("/later", handler("new"))
+	router.Remove("GET", "/a")
+	if w := serve("", "/later"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected routes added to the other router not to be served, saw %d", w.Code)
+	}
+	if _, found := next.Lookup("GET", "/a"); !found {
+		t.Error("Expected the other router to keep its route")
+	}
+	if _, err := next.URL("a", nil); err != nil {
+		t.Errorf("Expected the other router to keep its route name, saw %v", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	router := New()
+	router.GET("/a", simpleHandler).Name("a")
+	v1 := router.Snapshot()
+
+	router.GET("/b", simpleHandler).Name("b")
+	router.Remove("GET", "/a")
+	v2 := router.Snapshot()
+	if v2.ID <= v1.ID {
+		t.Errorf("Expected increasing IDs, saw %d then %d", v1.ID, v2.ID)
+	}
+
+	router.Restore(v1)
+	if _, found := router.Lookup("GET", "/a"); !found {
+		t.Error("Expected /a after restoring the first version")
+	}
+	if _, found := router.Lookup("GET", "/b"); found {
+		t.Error("Expected no /b after restoring the first version")
+	}
+	if _, err := router.URL("b", nil); err == nil {
+		t.Error("Expected no route named b after restoring the first version")
+	}
+
+	// Changes after a restore don't change the snapshot.
+	router.GET("/c", simpleHandler).Name("c")
+	router.Restore(v2)
+	router.Restore(v1)
+	if _, found := router.Lookup("GET", "/c"); found {
+		t.Error("Expected the snapshot not to include a route added after it was restored")
+	}
+	if _, err := router.URL("c", nil); err == nil {
+		t.Error("Expected the snapshot not to include a name added after it was restored")
+	}
+
+	router.Restore(RouteTableVersion{})
+	if _, found := router.Lookup("GET", "/a"); !found {
+		t.Error("Expected restoring the zero version to do nothing")
+	}
 }
@@ -0,0 +1,132 @@
+package httptreemux
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// routeEntry is the representation of a route used by RoutesHandler.
+type routeEntry struct {
+	Host    string                 `json:"host,omitempty"`
+	Method  string                 `json:"method"`
+	Pattern string                 `json:"pattern"`
+	Name    string                 `json:"name,omitempty"`
+	Meta    map[string]interface{} `json:"meta,omitempty"`
+}
+
+var routesTemplate = template.Must(template.New("routes").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Routes</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+td.pattern { font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>Routes</h1>
+<table>
+<tr><th>Host</th><th>Method</th><th>Pattern</th><th>Name</th><th>Metadata</th></tr>
+{{range .}}<tr><td>{{.Host}}</td><td>{{.Method}}</td><td class="pattern">{{.Pattern}}</td><td>{{.Name}}</td><td>{{range $key, $value := .Meta}}{{$key}}: {{$value}}<br>{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// RoutesHandler returns a handler that lists the routes of the router, including
+// those of every host, with their methods, patterns, names and metadata. The list is
+// written as an HTML table for browsers, whose Accept header includes text/html, and
+// as JSON otherwise. The format query parameter, with the value html or json,
+// overrides this. The routes are read when each request is served, so the list is
+// always up to date. Since it reveals the whole API, the handler is meant for
+// development and internal use:
+//
+//	router.With(requireAdmin).GET("/debug/routes", router.RoutesHandler())
+func (t *TreeMux) RoutesHandler() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		routes := t.routeEntries()
+
+		format := r.URL.Query().Get("format")
+		if format == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			format = "html"
+		}
+
+		if format == "html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			routesTemplate.Execute(w, routes)
+			return
+		}
+
+		body, err := json.MarshalIndent(routes, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
+
+// routeEntries returns every route of the router, sorted by host, pattern and method.
+func (t *TreeMux) routeEntries() []routeEntry {
+	hosts := []string{""}
+	for host := range t.loadTrees().hosts {
+		hosts = append(hosts, host)
+	}
+
+	routes := []routeEntry{}
+	for _, host := range hosts {
+		(&Group{mux: t, host: host}).WalkRoutes(func(route RouteInfo) bool {
+			routes = append(routes, routeEntry{
+				Host:    route.Host,
+				Method:  route.Method,
+				Pattern: route.Pattern,
+				Name:    route.Name,
+				Meta:    printableMeta(route.Meta),
+			})
+			return true
+		})
+	}
+
+	sort.Sort(byRoute(routes))
+	return routes
+}
+
+// byRoute sorts routes by host, pattern and method.
+type byRoute []routeEntry
+
+func (s byRoute) Len() int      { return len(s) }
+func (s byRoute) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byRoute) Less(i, j int) bool {
+	if s[i].Host != s[j].Host {
+		return s[i].Host < s[j].Host
+	}
+	if s[i].Pattern != s[j].Pattern {
+		return s[i].Pattern < s[j].Pattern
+	}
+	return s[i].Method < s[j].Method
+}
+
+// printableMeta returns a copy of the metadata in which values that can't be encoded
+// as JSON, such as functions, are replaced by their text as formatted by fmt.
+func printableMeta(meta map[string]interface{}) map[string]interface{} {
+	if meta == nil {
+		return nil
+	}
+
+	printable := make(map[string]interface{}, len(meta))
+	for key, value := range meta {
+		if _, err := json.Marshal(value); err != nil {
+			value = fmt.Sprint(value)
+		}
+		printable[key] = value
+	}
+	return printable
+}
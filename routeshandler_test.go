@@ -0,0 +1,73 @@
+package httptreemux
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoutesHandler(t *testing.T) {
+	router := New()
+	router.GET("/users/:id", simpleHandler).Name("user").Meta("owner", "accounts")
+	router.POST("/users", simpleHandler).Meta("handler", simpleHandler)
+	router.Host("example.com").GET("/", simpleHandler)
+	router.GET("/debug/routes", router.RoutesHandler())
+
+	r, _ := http.NewRequest("GET", "/debug/routes", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected JSON, saw %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	var routes []routeEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil {
+		t.Fatalf("Error decoding routes: %s", err)
+	}
+	expected := []routeEntry{
+		{Method: "GET", Pattern: "/debug/routes"},
+		{Method: "POST", Pattern: "/users"},
+		{Method: "GET", Pattern: "/users/:id", Name: "user",
+			Meta: map[string]interface{}{"owner": "accounts"}},
+		{Host: "example.com", Method: "GET", Pattern: "/"},
+	}
+	if len(routes) != len(expected) {
+		t.Fatalf("Expected %d routes, saw %+v", len(expected), routes)
+	}
+	for i := range expected {
+		if i == 1 {
+			// The function can't be encoded as JSON, so it is formatted instead.
+			if _, ok := routes[i].Meta["handler"].(string); !ok {
+				t.Errorf("Expected the handler metadata as a string, saw %v", routes[i].Meta)
+			}
+			routes[i].Meta = nil
+		}
+		if !reflect.DeepEqual(routes[i], expected[i]) {
+			t.Errorf("Route %d expected %+v, saw %+v", i, expected[i], routes[i])
+		}
+	}
+
+	for _, r := range []*http.Request{
+		func() *http.Request {
+			r, _ := http.NewRequest("GET", "/debug/routes", nil)
+			r.Header.Set("Accept", "text/html,application/xhtml+xml")
+			return r
+		}(),
+		func() *http.Request {
+			r, _ := http.NewRequest("GET", "/debug/routes?format=html", nil)
+			return r
+		}(),
+	} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		body := w.Body.String()
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") ||
+			!strings.Contains(body, "<td class=\"pattern\">/users/:id</td><td>user</td>") ||
+			!strings.Contains(body, "owner: accounts") {
+			t.Errorf("Expected an HTML table for %s, saw\n%s", r.URL, body)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package httptreemux
+
+// RouteSource provides the routes of a router from somewhere other than code, such as
+// a service registry like etcd or Consul, or a database, for a SourceWatcher.
+type RouteSource interface {
+	// List returns every route.
+	List() ([]RouteSpec, error)
+	// Watch sends an update to updates whenever the routes change, until stop is
+	// closed, and then returns. An error that ends the watch, rather than one that is
+	// reported in an update, is returned.
+	Watch(updates chan<- RouteUpdate, stop <-chan struct{}) error
+}
+
+// RouteUpdate is sent by a RouteSource when its routes change.
+type RouteUpdate struct {
+	// Routes is the complete new list of routes, which replaces the old one.
+	Routes []RouteSpec
+	// Err reports that the source couldn't get the new routes, such as because it
+	// lost its connection. The routes being served are kept.
+	Err error
+}
+
+// SourceWatcher keeps the routes of a router in sync with a RouteSource. Each update
+// is applied as a whole: the routes are added to a new router, checked with Validate,
+// and put in place with TreeMux.Swap, so requests never see some of the changes
+// without the others. If anything fails, the routes that are being served are kept.
+//
+//	watcher := &httptreemux.SourceWatcher{
+//		Router:   router,
+//		Source:   registrySource,
+//		Handlers: map[string]httptreemux.HandlerFunc{"proxy": proxyHandler},
+//	}
+//	if err := watcher.Start(); err != nil {
+//		log.Fatal(err)
+//	}
+type SourceWatcher struct {
+	// Router is the router whose routes are replaced.
+	Router *TreeMux
+	// Source provides the routes.
+	Source RouteSource
+	// Handlers maps the handler names used by the source to handlers, as for LoadRoutes.
+	Handlers map[string]HandlerFunc
+	// Setup, if set, is called with each new router before the routes from the source
+	// are added to it, to add the routes that don't come from the source, since every
+	// route of Router is replaced.
+	Setup func(router *TreeMux) error
+	// OnUpdate, if set, is called after each update from the source, with nil if the
+	// new routes are being served, or the error that stopped them otherwise. It is
+	// also called with the error that ended Watch, if any. It is not called for the
+	// first load done by Start, which returns the error instead.
+	OnUpdate func(err error)
+	// SkipValidation puts the new routes in place even if Validate finds problems
+	// with them.
+	SkipValidation bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Start loads the routes returned by the source's List, and then applies the updates
+// from its Watch in a separate goroutine until Stop is called. If the first load fails,
+// its error is returned and the source isn't watched.
+func (w *SourceWatcher) Start() error {
+	specs, err := w.Source.List()
+	if err == nil {
+		err = w.apply(specs)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.watch(w.stop, w.done)
+	return nil
+}
+
+// Stop stops watching the source, and waits for its Watch to return and for an update
+// that is in progress to finish.
+func (w *SourceWatcher) Stop() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+}
+
+func (w *SourceWatcher) watch(stop, done chan struct{}) {
+	defer close(done)
+
+	updates := make(chan RouteUpdate)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- w.Source.Watch(updates, stop)
+	}()
+
+	for {
+		// Updates are read until Watch returns, so that it's never left blocked
+		// sending one.
+		select {
+		case update := <-updates:
+			err := update.Err
+			if err == nil {
+				err = w.apply(update.Routes)
+			}
+			if w.OnUpdate != nil {
+				w.OnUpdate(err)
+			}
+
+		case err := <-watchErr:
+			if err != nil && w.OnUpdate != nil {
+				w.OnUpdate(err)
+			}
+			return
+		}
+	}
+}
+
+func (w *SourceWatcher) apply(specs []RouteSpec) error {
+	return w.Router.replaceRoutes(specs, w.Handlers, w.Setup, !w.SkipValidation)
+}
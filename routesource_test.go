@@ -0,0 +1,88 @@
+package httptreemux
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// testRouteSource is a RouteSource whose updates are sent by the test.
+type testRouteSource struct {
+	routes  []RouteSpec
+	updates chan RouteUpdate
+}
+
+func (s *testRouteSource) List() ([]RouteSpec, error) {
+	return s.routes, nil
+}
+
+func (s *testRouteSource) Watch(updates chan<- RouteUpdate, stop <-chan struct{}) error {
+	for {
+		select {
+		case update := <-s.updates:
+			updates <- update
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+func TestSourceWatcher(t *testing.T) {
+	source := &testRouteSource{
+		routes:  []RouteSpec{{Method: "GET", Path: "/a", Handler: "h"}},
+		updates: make(chan RouteUpdate),
+	}
+	router := New()
+	results := make(chan error)
+	watcher := &SourceWatcher{
+		Router:   router,
+		Source:   source,
+		Handlers: map[string]HandlerFunc{"h": simpleHandler},
+		OnUpdate: func(err error) { results <- err },
+	}
+	if err := watcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	status := func(path string) int {
+		lr, _ := router.Lookup("GET", path)
+		return lr.StatusCode
+	}
+	if status("/a") != http.StatusOK {
+		t.Fatal("Expected the routes from List to be loaded by Start")
+	}
+
+	source.updates <- RouteUpdate{Routes: []RouteSpec{
+		{Method: "GET", Path: "/b", Handler: "h"},
+		{Method: "GET", Path: "/c", Handler: "h"},
+	}}
+	if err := <-results; err != nil {
+		t.Fatalf("Unexpected update error %v", err)
+	}
+	if status("/a") != http.StatusNotFound || status("/b") != http.StatusOK || status("/c") != http.StatusOK {
+		t.Error("Expected the update to replace the routes")
+	}
+
+	// An update that fails part way is not applied at all.
+	source.updates <- RouteUpdate{Routes: []RouteSpec{
+		{Method: "GET", Path: "/d", Handler: "h"},
+		{Method: "GET", Path: "/d", Handler: "h"},
+	}}
+	if err := <-results; err == nil || !strings.Contains(err.Error(), "routes[1] (GET /d)") {
+		t.Errorf("Expected an error for the duplicate route, saw %v", err)
+	}
+	if status("/b") != http.StatusOK || status("/d") != http.StatusNotFound {
+		t.Error("Expected the old routes to be kept after a failed update")
+	}
+
+	sourceErr := errors.New("connection lost")
+	source.updates <- RouteUpdate{Err: sourceErr}
+	if err := <-results; err != sourceErr {
+		t.Errorf("Expected the source's error, saw %v", err)
+	}
+	if status("/b") != http.StatusOK {
+		t.Error("Expected the old routes to be kept after a source error")
+	}
+}
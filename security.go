@@ -0,0 +1,98 @@
+package httptreemux
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SecurityHeaders sets headers that tell browsers to apply security policies to a
+// site's responses. Set TreeMux.SecurityHeaders to send them with every response,
+// including the router's own 404, 405 and redirect responses, or add its Middleware to
+// a group to send them, or different values, with the group's routes. A header whose
+// field is empty isn't sent, so DefaultSecurityHeaders is a better place to start than
+// the zero value. Handlers can replace the headers, since they are set before the
+// handler is called.
+type SecurityHeaders struct {
+	// HSTSMaxAge is how long browsers should only use HTTPS for the site, sent in the
+	// Strict-Transport-Security header. The header isn't sent if it is zero.
+	HSTSMaxAge time.Duration
+	// HSTSIncludeSubdomains adds includeSubDomains to the Strict-Transport-Security
+	// header.
+	HSTSIncludeSubdomains bool
+	// HSTSPreload adds preload to the Strict-Transport-Security header.
+	HSTSPreload bool
+	// ContentTypeOptions is the X-Content-Type-Options header, which should be nosniff.
+	ContentTypeOptions string
+	// FrameOptions is the X-Frame-Options header, such as DENY or SAMEORIGIN.
+	FrameOptions string
+	// ReferrerPolicy is the Referrer-Policy header, such as
+	// strict-origin-when-cross-origin.
+	ReferrerPolicy string
+	// ContentSecurityPolicy is the Content-Security-Policy header.
+	ContentSecurityPolicy string
+}
+
+// DefaultSecurityHeaders returns the headers that most sites should send: HSTS for two
+// years, including subdomains, nosniff, DENY for framing, and a Referrer-Policy of
+// strict-origin-when-cross-origin. It has no Content-Security-Policy, since that
+// depends on the site.
+func DefaultSecurityHeaders() *SecurityHeaders {
+	return &SecurityHeaders{
+		HSTSMaxAge:            2 * 365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentTypeOptions:    "nosniff",
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "strict-origin-when-cross-origin",
+	}
+}
+
+// Middleware returns middleware that sets the headers on the responses of a group's
+// routes, replacing those set by TreeMux.SecurityHeaders.
+//
+//	embeds := router.Group("/embed")
+//	headers := httptreemux.DefaultSecurityHeaders()
+//	headers.FrameOptions = "SAMEORIGIN"
+//	embeds.Use(headers.Middleware())
+func (s *SecurityHeaders) Middleware() MiddlewareFunc {
+	headers := s.headers()
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			setHeaders(w.Header(), headers)
+			next(w, r, params)
+		}
+	}
+}
+
+// headers returns the headers to send, leaving out those that are empty.
+func (s *SecurityHeaders) headers() [][2]string {
+	var headers [][2]string
+	if s.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(int64(s.HSTSMaxAge/time.Second), 10)
+		if s.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if s.HSTSPreload {
+			hsts += "; preload"
+		}
+		headers = append(headers, [2]string{"Strict-Transport-Security", hsts})
+	}
+	for _, h := range [][2]string{
+		{"X-Content-Type-Options", s.ContentTypeOptions},
+		{"X-Frame-Options", s.FrameOptions},
+		{"Referrer-Policy", s.ReferrerPolicy},
+		{"Content-Security-Policy", s.ContentSecurityPolicy},
+	} {
+		if h[1] != "" {
+			headers = append(headers, h)
+		}
+	}
+	return headers
+}
+
+// setHeaders sets each of the headers, given as name and value.
+func setHeaders(header http.Header, headers [][2]string) {
+	for _, h := range headers {
+		header.Set(h[0], h[1])
+	}
+}
@@ -0,0 +1,53 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	router := New()
+	router.SecurityHeaders = DefaultSecurityHeaders()
+	router.GET("/", simpleHandler)
+	router.GET("/dir/", simpleHandler)
+	embed := &SecurityHeaders{FrameOptions: "SAMEORIGIN", ContentSecurityPolicy: "frame-ancestors 'self'"}
+	router.With(embed.Middleware()).GET("/embed", simpleHandler)
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		frame  string
+	}{
+		{"GET", "/", http.StatusOK, "DENY"},
+		{"GET", "/missing", http.StatusNotFound, "DENY"},
+		{"POST", "/", http.StatusMethodNotAllowed, "DENY"},
+		{"GET", "/dir", http.StatusMovedPermanently, "DENY"},
+		{"GET", "/embed", http.StatusOK, "SAMEORIGIN"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		header := w.Header()
+		if w.Code != test.code || header.Get("X-Frame-Options") != test.frame {
+			t.Errorf("%s %s expected %d with X-Frame-Options %s, saw %d with %q", test.method, test.path,
+				test.code, test.frame, w.Code, header.Get("X-Frame-Options"))
+		}
+		if header.Get("Strict-Transport-Security") != "max-age=63072000; includeSubDomains" ||
+			header.Get("X-Content-Type-Options") != "nosniff" ||
+			header.Get("Referrer-Policy") != "strict-origin-when-cross-origin" {
+			t.Errorf("%s %s expected the default headers, saw %v", test.method, test.path, header)
+		}
+		if csp := header.Get("Content-Security-Policy"); (csp != "") != (test.path == "/embed") {
+			t.Errorf("%s %s saw Content-Security-Policy %q", test.method, test.path, csp)
+		}
+	}
+
+	headers := (&SecurityHeaders{HSTSMaxAge: time.Hour, HSTSPreload: true}).headers()
+	if len(headers) != 1 || headers[0][1] != "max-age=3600; preload" {
+		t.Errorf("Expected only HSTS with preload, saw %v", headers)
+	}
+}
@@ -0,0 +1,80 @@
+package httptreemux
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// lastRouteTableID is the ID of the last RouteTableVersion taken.
+var lastRouteTableID uint64
+
+// RouteTableVersion is a copy of a router's routes, taken by Snapshot, that can be put
+// back with Restore.
+type RouteTableVersion struct {
+	// ID identifies the version. It increases with each snapshot taken in the process.
+	ID uint64
+	// Time is when the snapshot was taken.
+	Time time.Time
+
+	trees *routingTrees
+	names map[string]*Route
+}
+
+// Snapshot returns a copy of the router's routes, which Restore can put back later,
+// such as to roll back a configuration that turned out to be bad. A snapshot holds
+// everything that Swap replaces. It is cheap, since the trees of routes are never
+// changed once they are in use, so the snapshot shares them with the router rather than
+// copying them, and keeping several snapshots only costs the memory of the routes that
+// have since been replaced.
+//
+//	versions = append(versions, router.Snapshot())
+//	if len(versions) > 10 {
+//		versions = versions[1:]
+//	}
+//	router.Swap(next)
+//	// Later, to roll back:
+//	router.Restore(versions[len(versions)-1])
+func (t *TreeMux) Snapshot() RouteTableVersion {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return RouteTableVersion{
+		ID:    atomic.AddUint64(&lastRouteTableID, 1),
+		Time:  time.Now(),
+		trees: t.loadTrees(),
+		names: copyNamedRoutes(t.namedRoutes, t),
+	}
+}
+
+// Restore replaces the router's routes with those of the snapshot, as Swap does. The
+// snapshot may have been taken from another router, in which case its handlers keep
+// the middleware of that router. Restoring the zero RouteTableVersion does nothing.
+func (t *TreeMux) Restore(version RouteTableVersion) {
+	if version.trees == nil {
+		return
+	}
+
+	var before, after routeTable
+	// This is deferred before the mutex is unlocked, so that it runs afterwards.
+	defer func() {
+		t.reportChanges(before, after)
+	}()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	before = t.routeTable()
+	t.trees.Store(version.trees)
+	t.namedRoutes = copyNamedRoutes(version.names, t)
+	after = t.routeTable()
+}
+
+// copyNamedRoutes returns a copy of the named routes that belongs to the router, so
+// that naming the routes of one doesn't change the other.
+func copyNamedRoutes(named map[string]*Route, t *TreeMux) map[string]*Route {
+	names := make(map[string]*Route, len(named))
+	for name, route := range named {
+		copied := *route
+		copied.mux = t
+		names[name] = &copied
+	}
+	return names
+}
@@ -0,0 +1,205 @@
+package httptreemux
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sort"
+)
+
+// SplitKeyFunc returns the value that a request is assigned to a handler of a Split by,
+// such as a user ID, so that every request with the same value gets the same handler.
+// An empty string assigns the request at random.
+type SplitKeyFunc func(r *http.Request) string
+
+// SplitByHeader returns a SplitKeyFunc that assigns requests by the value of the
+// request header.
+func SplitByHeader(name string) SplitKeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// SplitByCookie returns a SplitKeyFunc that assigns requests by the value of the
+// cookie.
+func SplitByCookie(name string) SplitKeyFunc {
+	return func(r *http.Request) string {
+		if cookie, err := r.Cookie(name); err == nil {
+			return cookie.Value
+		}
+		return ""
+	}
+}
+
+// Split sends the given percentage of the route's requests to the canary handler, and
+// the rest to the route's own handler, for rolling out a new version of a handler
+// gradually. Requests are assigned by the value that by returns, so a client that
+// sends the same header or cookie keeps getting the same handler, and raising the
+// percentage only moves clients from the route's handler to the canary. If by is nil,
+// requests are assigned at random.
+//
+//	router.GET("/checkout", checkoutHandler).
+//		Split(10, newCheckoutHandler, httptreemux.SplitByCookie("session"))
+//
+// The canary is wrapped in the same middleware as the route's handler. The rate limits,
+// circuit breakers and coalescing of the route's group apply to the canary separately.
+// Requests served by the canary have the variant name canary, as returned by
+// ContextVariant. Calling Split or Variants again replaces the canary.
+func (r *Route) Split(percent int, canary HandlerFunc, by SplitKeyFunc) *Route {
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	canary = r.wrap("canary", canary)
+	return r.setVariants(func(stable HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request, params map[string]string) {
+			if splitBucket(req, by) < percent {
+				if withVariant != nil {
+					req = withVariant(req, "canary")
+				}
+				canary(w, req, params)
+			} else {
+				stable(w, req, params)
+			}
+		}
+	})
+}
+
+// VariantSelector returns the name of the variant that serves a request, for
+// Route.Variants.
+type VariantSelector func(r *http.Request) string
+
+// VariantFromHeader returns a VariantSelector that uses the value of the request header
+// as the name of the variant.
+func VariantFromHeader(name string) VariantSelector {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// VariantFromCookie returns a VariantSelector that uses the value of the cookie as the
+// name of the variant.
+func VariantFromCookie(name string) VariantSelector {
+	return func(r *http.Request) string {
+		if cookie, err := r.Cookie(name); err == nil {
+			return cookie.Value
+		}
+		return ""
+	}
+}
+
+// VariantByPercent returns a VariantSelector that sends the given percentage of the
+// requests to each variant, assigning them by the value that by returns as Split does.
+// The remaining requests get the route's own handler.
+func VariantByPercent(by SplitKeyFunc, percents map[string]int) VariantSelector {
+	names := make([]string, 0, len(percents))
+	for name := range percents {
+		names = append(names, name)
+	}
+	// Sort the names so that each bucket always belongs to the same variant.
+	sort.Strings(names)
+
+	return func(r *http.Request) string {
+		bucket := splitBucket(r, by)
+		for _, name := range names {
+			if bucket < percents[name] {
+				return name
+			}
+			bucket -= percents[name]
+		}
+		return ""
+	}
+}
+
+// Variants serves the route's requests with one of the named handlers, for A/B tests.
+// The selector picks the name of the variant for each request, and requests for which
+// it returns a name that isn't in variants, such as an empty string, get the route's
+// own handler.
+//
+//	router.GET("/pricing", pricingHandler).Variants(httptreemux.VariantByPercent(
+//		httptreemux.SplitByCookie("visitor"), map[string]int{"b": 50}),
+//		map[string]httptreemux.HandlerFunc{"b": newPricingHandler})
+//
+// The name of the variant that serves a request is stored in its context, where it can
+// be retrieved with ContextVariant by the handler and its middleware, such as one that
+// records analytics. The variants are wrapped in the same middleware as the route's
+// handler, and the rate limits, circuit breakers and coalescing of the route's group
+// apply to each separately. Calling Variants or Split again replaces the variants.
+func (r *Route) Variants(selector VariantSelector, variants map[string]HandlerFunc) *Route {
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	handlers := make(map[string]HandlerFunc, len(variants))
+	for name, handler := range variants {
+		handlers[name] = r.wrap(name, handler)
+	}
+	return r.setVariants(func(own HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request, params map[string]string) {
+			name := selector(req)
+			handler, ok := handlers[name]
+			if !ok {
+				own(w, req, params)
+				return
+			}
+			if withVariant != nil {
+				req = withVariant(req, name)
+			}
+			handler(w, req, params)
+		}
+	})
+}
+
+// setVariants sets the function that chooses between the route's variants, given the
+// route's own handler. The router's mutex must be held.
+func (r *Route) setVariants(choose func(own HandlerFunc) HandlerFunc) *Route {
+	return r.setHandler(choose, r.versions, r.conditions)
+}
+
+// setHandler replaces the route's handler with one that checks the conditions, then
+// the versions, and otherwise chooses between the variants, if there are any. The
+// router's mutex must be held.
+func (r *Route) setHandler(choose func(own HandlerFunc) HandlerFunc, versions map[string]HandlerFunc,
+	conditions []routeCondition) *Route {
+
+	own := r.handler
+	if r.unsplit != nil {
+		own = r.unsplit
+	}
+	handler := own
+	if choose != nil {
+		handler = choose(own)
+	}
+	if len(versions) != 0 {
+		handler = versionHandler(r.mux, versions, handler)
+	}
+	if len(conditions) != 0 {
+		handler = conditionHandler(conditions, handler)
+	}
+
+	err := r.updateNodes(func(n *node) {
+		n.leafHandler[r.method] = handler
+	})
+	if err == nil {
+		r.unsplit = own
+		r.variants = choose
+		r.versions = versions
+		r.conditions = conditions
+		r.handler = handler
+	}
+	return r
+}
+
+// splitBucket returns a number from 0 to 99 for the request, the same for every request
+// with the same key.
+func splitBucket(r *http.Request, by SplitKeyFunc) int {
+	var key string
+	if by != nil {
+		key = by(r)
+	}
+	if key == "" {
+		return rand.Intn(100)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % 100)
+}
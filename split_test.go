@@ -0,0 +1,92 @@
+package httptreemux
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	router := New()
+	var served []string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			served = append(served, name)
+		}
+	}
+	var wrapped int
+	api := router.Group("/api")
+	api.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			wrapped++
+			next(w, r, params)
+		}
+	})
+	route := api.GET("/checkout", makeHandler("stable")).
+		Split(30, makeHandler("canary"), SplitByHeader("X-User"))
+
+	serve := func(user string) {
+		r, _ := http.NewRequest("GET", "/api/checkout", nil)
+		if user != "" {
+			r.Header.Set("X-User", user)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// The same user always gets the same handler.
+	counts := map[string]int{}
+	for i := 0; i < 200; i++ {
+		served = nil
+		user := fmt.Sprintf("user%d", i)
+		serve(user)
+		serve(user)
+		if len(served) != 2 || served[0] != served[1] {
+			t.Fatalf("Expected %s to get the same handler twice, saw %v", user, served)
+		}
+		counts[served[0]]++
+	}
+	if counts["canary"] < 30 || counts["canary"] > 90 {
+		t.Errorf("Expected about 30%% of the users to get the canary, saw %v", counts)
+	}
+	if wrapped != 400 {
+		t.Errorf("Expected the middleware to wrap both handlers, saw %d calls", wrapped)
+	}
+
+	// Without a key, requests are assigned at random.
+	served = nil
+	for i := 0; i < 100; i++ {
+		serve("")
+	}
+	if len(served) != 100 {
+		t.Errorf("Expected 100 requests to be served, saw %d", len(served))
+	}
+
+	// Replacing the canary keeps the route's own handler.
+	route.Split(100, makeHandler("canary2"), nil)
+	served = nil
+	serve("user1")
+	route.Split(0, makeHandler("canary3"), nil)
+	serve("user1")
+	if fmt.Sprint(served) != "[canary2 stable]" {
+		t.Errorf("Expected [canary2 stable], saw %v", served)
+	}
+}
+
+func TestVariantByPercent(t *testing.T) {
+	selector := VariantByPercent(SplitByHeader("X-User"), map[string]int{"a": 20, "b": 30})
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("X-User", fmt.Sprintf("user%d", i))
+		name := selector(r)
+		if again := selector(r); again != name {
+			t.Fatalf("Expected the same variant for the same user, saw %q and %q", name, again)
+		}
+		counts[name]++
+	}
+	if counts["a"] < 120 || counts["a"] > 280 || counts["b"] < 220 || counts["b"] > 380 ||
+		counts[""] < 400 || counts[""] > 600 {
+		t.Errorf("Expected about 20%% a, 30%% b and 50%% the route's handler, saw %v", counts)
+	}
+}
@@ -0,0 +1,236 @@
+package httptreemux
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLatencyBuckets are latency buckets suited to typical web services, from 5ms to
+// 10s, for TreeMux.LatencyBuckets.
+var DefaultLatencyBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// HistogramRecorder is implemented by a MetricsRecorder that records latency
+// histograms. When TreeMux.Metrics implements it, TreeMux.ExportHistograms calls
+// ObserveHistogram with the histogram of each route, so that the histograms kept by the
+// router can be exported without the recorder keeping its own.
+type HistogramRecorder interface {
+	ObserveHistogram(method, route string, histogram Histogram)
+}
+
+// routeStats holds the statistics of the handler of a route for a method. It is shared
+// by the clones of the route's node.
+type routeStats struct {
+	// The number of requests served, when TreeMux.CountHits is set. It is first in the
+	// struct so that it is aligned for atomic access on 32-bit platforms.
+	hits uint64
+	// The number of requests being served, when TreeMux.CountInFlight is set.
+	inFlight int64
+
+	// The *histogram of latencies, created with the router's LatencyBuckets on the
+	// first request. The mutex serializes its creation.
+	latency atomic.Value
+	mutex   sync.Mutex
+}
+
+// observeLatency records the duration of a request in the latency histogram, creating
+// it with the buckets if the route doesn't have one yet.
+func (s *routeStats) observeLatency(buckets []time.Duration, duration time.Duration) {
+	h, _ := s.latency.Load().(*histogram)
+	if h == nil {
+		s.mutex.Lock()
+		if h, _ = s.latency.Load().(*histogram); h == nil {
+			h = newHistogram(buckets)
+			s.latency.Store(h)
+		}
+		s.mutex.Unlock()
+	}
+	h.observe(duration)
+}
+
+// histogram counts durations in buckets, with atomic counters.
+type histogram struct {
+	// The sum of the durations, in nanoseconds. It is first in the struct so that it is
+	// aligned for atomic access on 32-bit platforms.
+	sum uint64
+	// The upper bounds of the buckets, in increasing order.
+	bounds []time.Duration
+	// The number of durations in each bucket, with an extra bucket for those above the
+	// last bound.
+	counts []uint64
+}
+
+func newHistogram(buckets []time.Duration) *histogram {
+	bounds := append([]time.Duration(nil), buckets...)
+	sort.Sort(byDuration(bounds))
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(duration time.Duration) {
+	i := sort.Search(len(h.bounds), func(i int) bool {
+		return duration <= h.bounds[i]
+	})
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.sum, uint64(duration))
+}
+
+// snapshot returns the current values of the histogram.
+func (h *histogram) snapshot() *Histogram {
+	s := &Histogram{
+		Buckets: h.bounds,
+		Counts:  make([]uint64, len(h.counts)),
+		Sum:     time.Duration(atomic.LoadUint64(&h.sum)),
+	}
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+		s.Count += s.Counts[i]
+	}
+	return s
+}
+
+type byDuration []time.Duration
+
+func (d byDuration) Len() int           { return len(d) }
+func (d byDuration) Less(i, j int) bool { return d[i] < d[j] }
+func (d byDuration) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// Histogram holds the latencies of the requests served by a route, as recorded when
+// TreeMux.LatencyBuckets is set.
+type Histogram struct {
+	// Buckets are the upper bounds of the buckets, in increasing order. They must not be
+	// modified.
+	Buckets []time.Duration
+	// Counts holds the number of requests in each bucket, which took longer than the
+	// bound of the bucket before it, and no longer than its own. It has an extra entry
+	// at the end for the requests that took longer than the last bound.
+	Counts []uint64
+	// Count is the total number of requests.
+	Count uint64
+	// Sum is the total time taken by the requests.
+	Sum time.Duration
+}
+
+// Within returns the number of requests that took no longer than the duration, rounded
+// down to the nearest bucket bound, such as for the proportion of requests that met a
+// latency objective.
+func (h Histogram) Within(d time.Duration) uint64 {
+	var within uint64
+	for i, bound := range h.Buckets {
+		if bound > d {
+			break
+		}
+		within += h.Counts[i]
+	}
+	return within
+}
+
+// RouteStats holds the statistics of a route, as returned by TreeMux.RouteStats.
+type RouteStats struct {
+	Method string
+	// Host is the host the route was registered for, or an empty string for the
+	// default tree.
+	Host string
+	// Pattern is the full pattern of the route, as passed to Walk.
+	Pattern string
+	// Hits is the number of requests the route has served since it was added, counted
+	// while TreeMux.CountHits is set.
+	Hits uint64
+	// InFlight is the number of requests the route is serving, counted while
+	// TreeMux.CountInFlight is set.
+	InFlight int64
+	// Latency is the histogram of the route's latencies, or nil if none have been
+	// recorded because TreeMux.LatencyBuckets is nil or the route hasn't been
+	// requested.
+	Latency *Histogram
+}
+
+// RouteStats returns the statistics of every route, including those in the trees for
+// hosts, in the order that WalkRoutes visits them, with the default tree first and
+// then each host's in alphabetical order. Routes that have never been requested are
+// included with no hits, so that routes which are no longer used can be found:
+//
+//	for _, stats := range router.RouteStats() {
+//		if stats.Hits == 0 {
+//			log.Printf("unused route %s %s%s", stats.Method, stats.Host, stats.Pattern)
+//		}
+//	}
+func (t *TreeMux) RouteStats() []RouteStats {
+	trees := t.loadTrees()
+	var stats []RouteStats
+	appendStats := func(host string, root *node) {
+		root.walk([]walkPiece{{text: "/"}}, func(n *node, method, pattern string, handler HandlerFunc) bool {
+			s := RouteStats{Method: method, Host: host, Pattern: pattern}
+			if rs := n.leafStats[method]; rs != nil {
+				s.Hits = atomic.LoadUint64(&rs.hits)
+				s.InFlight = atomic.LoadInt64(&rs.inFlight)
+				if h, _ := rs.latency.Load().(*histogram); h != nil {
+					s.Latency = h.snapshot()
+				}
+			}
+			stats = append(stats, s)
+			return true
+		})
+	}
+
+	appendStats("", trees.root)
+	hosts := make([]string, 0, len(trees.hosts))
+	for host := range trees.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		appendStats(host, trees.hosts[host])
+	}
+	return stats
+}
+
+// InFlight returns the number of requests that the router is serving, counted while
+// CountInFlight is set. Unlike the InFlight of RouteStats, it includes requests that
+// didn't match a route. To see which routes are busiest:
+//
+//	for _, stats := range router.RouteStats() {
+//		if stats.InFlight > 0 {
+//			log.Printf("%s %s: %d of %d in flight", stats.Method, stats.Pattern,
+//				stats.InFlight, router.InFlight())
+//		}
+//	}
+func (t *TreeMux) InFlight() int64 {
+	return atomic.LoadInt64(&t.inFlight)
+}
+
+// PublishRouteStats publishes the statistics of the routes as an expvar variable with
+// the name, which appears in the output of the expvar handler mounted with MountExpvar.
+// The variable is an object with a key for each route, made of its method, host and
+// pattern, such as "GET /users/:id", whose value is the route's number of hits. Like
+// expvar.Publish, it panics if the name is already used.
+func (t *TreeMux) PublishRouteStats(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		hits := make(map[string]uint64)
+		for _, stats := range t.RouteStats() {
+			hits[stats.Method+" "+stats.Host+stats.Pattern] = stats.Hits
+		}
+		return hits
+	}))
+}
+
+// ExportHistograms passes the latency histogram of each route that has one to
+// TreeMux.Metrics, if it implements HistogramRecorder. The route is the route's host
+// followed by its pattern. Call it periodically, or whenever the recorder is about to
+// be read, such as from the Collect method of a Prometheus collector.
+func (t *TreeMux) ExportHistograms() {
+	recorder, ok := t.Metrics.(HistogramRecorder)
+	if !ok {
+		return
+	}
+	for _, stats := range t.RouteStats() {
+		if stats.Latency != nil {
+			recorder.ObserveHistogram(stats.Method, stats.Host+stats.Pattern, *stats.Latency)
+		}
+	}
+}
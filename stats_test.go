@@ -0,0 +1,187 @@
+package httptreemux
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRouteHits(t *testing.T) {
+	router := New()
+	router.CountHits = true
+	router.GET("/users/:id", simpleHandler)
+	router.POST("/users/:id", simpleHandler)
+	router.GET("/unused", simpleHandler)
+	router.Host("api.example.com").GET("/status", simpleHandler)
+
+	requests := []struct {
+		method, host, path string
+	}{
+		{"GET", "", "/users/1"},
+		{"GET", "", "/users/2"},
+		{"HEAD", "", "/users/3"},
+		{"POST", "", "/users/1"},
+		{"PUT", "", "/users/1"},
+		{"GET", "", "/users/1/"},
+		{"GET", "api.example.com", "/status"},
+		{"GET", "", "/missing"},
+	}
+	for _, request := range requests {
+		r, _ := http.NewRequest(request.method, request.path, nil)
+		r.Host = request.host
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	expected := []RouteStats{
+		{Method: "GET", Pattern: "/users/:id", Hits: 3},
+		{Method: "POST", Pattern: "/users/:id", Hits: 1},
+		{Method: "GET", Pattern: "/unused"},
+		{Method: "GET", Host: "api.example.com", Pattern: "/status", Hits: 1},
+	}
+	if stats := router.RouteStats(); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected %v, saw %v", expected, stats)
+	}
+
+	// Changing the routes keeps the counts of the routes that are left.
+	router.GET("/new", simpleHandler)
+	router.Remove("POST", "/users/:id")
+	expected = []RouteStats{
+		{Method: "GET", Pattern: "/users/:id", Hits: 3},
+		{Method: "GET", Pattern: "/unused"},
+		{Method: "GET", Pattern: "/new"},
+		{Method: "GET", Host: "api.example.com", Pattern: "/status", Hits: 1},
+	}
+	if stats := router.RouteStats(); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected %v after changing the routes, saw %v", expected, stats)
+	}
+
+	router.PublishRouteStats("httptreemux_test_routes")
+	hits := expvar.Get("httptreemux_test_routes").(expvar.Func)().(map[string]uint64)
+	if hits["GET /users/:id"] != 3 || hits["GET api.example.com/status"] != 1 || len(hits) != 4 {
+		t.Errorf("Expected the hits in expvar, saw %v", hits)
+	}
+}
+
+func TestRouteHitsOff(t *testing.T) {
+	router := New()
+	router.GET("/", simpleHandler)
+	r, _ := http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if stats := router.RouteStats(); len(stats) != 1 || stats[0].Hits != 0 {
+		t.Errorf("Expected no hits to be counted, saw %v", stats)
+	}
+}
+
+type histogramRecorder struct {
+	histograms map[string]Histogram
+}
+
+func (r *histogramRecorder) ObserveRequest(method, route string, statusCode int, duration time.Duration, size int64) {
+}
+
+func (r *histogramRecorder) ObserveHistogram(method, route string, histogram Histogram) {
+	r.histograms[method+" "+route] = histogram
+}
+
+func TestRouteLatency(t *testing.T) {
+	recorder := &histogramRecorder{histograms: make(map[string]Histogram)}
+	router := New()
+	router.Metrics = recorder
+	router.LatencyBuckets = []time.Duration{time.Hour, time.Millisecond}
+	router.GET("/fast", simpleHandler)
+	router.GET("/slow", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		time.Sleep(5 * time.Millisecond)
+	})
+	router.GET("/unused", simpleHandler)
+
+	for _, path := range []string{"/fast", "/fast", "/slow", "/missing"} {
+		r, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	stats := router.RouteStats()
+	if len(stats) != 3 {
+		t.Fatalf("Expected 3 routes, saw %v", stats)
+	}
+	buckets := []time.Duration{time.Millisecond, time.Hour}
+	for _, s := range stats {
+		switch s.Pattern {
+		case "/fast":
+			if s.Latency == nil || !reflect.DeepEqual(s.Latency.Buckets, buckets) ||
+				!reflect.DeepEqual(s.Latency.Counts, []uint64{2, 0, 0}) || s.Latency.Count != 2 {
+				t.Errorf("Expected two fast requests, saw %+v", s.Latency)
+			}
+		case "/slow":
+			if s.Latency == nil || !reflect.DeepEqual(s.Latency.Counts, []uint64{0, 1, 0}) ||
+				s.Latency.Sum < 5*time.Millisecond {
+				t.Errorf("Expected one slow request, saw %+v", s.Latency)
+			} else if within := s.Latency.Within(time.Millisecond); within != 0 {
+				t.Errorf("Expected no slow request within 1ms, saw %d", within)
+			} else if within := s.Latency.Within(2 * time.Hour); within != 1 {
+				t.Errorf("Expected the slow request within 2h, saw %d", within)
+			}
+		case "/unused":
+			if s.Latency != nil {
+				t.Errorf("Expected no histogram for an unused route, saw %+v", s.Latency)
+			}
+		}
+		if s.Hits != 0 {
+			t.Errorf("Expected no hits to be counted for %s, saw %d", s.Pattern, s.Hits)
+		}
+	}
+
+	router.ExportHistograms()
+	if len(recorder.histograms) != 2 || recorder.histograms["GET /slow"].Count != 1 {
+		t.Errorf("Expected the histograms to be exported, saw %v", recorder.histograms)
+	}
+}
+
+func TestRouteInFlight(t *testing.T) {
+	router := New()
+	router.CountInFlight = true
+	started := make(chan bool)
+	release := make(chan bool)
+	router.GET("/slow", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		started <- true
+		<-release
+	})
+	router.GET("/fast", simpleHandler)
+
+	done := make(chan bool)
+	for i := 0; i < 2; i++ {
+		go func() {
+			r, _ := http.NewRequest("GET", "/slow", nil)
+			router.ServeHTTP(httptest.NewRecorder(), r)
+			done <- true
+		}()
+		<-started
+	}
+	r, _ := http.NewRequest("GET", "/fast", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	if inFlight := router.InFlight(); inFlight != 2 {
+		t.Errorf("Expected 2 requests in flight, saw %d", inFlight)
+	}
+	for _, stats := range router.RouteStats() {
+		expected := int64(0)
+		if stats.Pattern == "/slow" {
+			expected = 2
+		}
+		if stats.InFlight != expected {
+			t.Errorf("Expected %d requests in flight for %s, saw %d", expected, stats.Pattern, stats.InFlight)
+		}
+	}
+
+	close(release)
+	<-done
+	<-done
+	if inFlight := router.InFlight(); inFlight != 0 {
+		t.Errorf("Expected no requests in flight once they finished, saw %d", inFlight)
+	}
+	if stats := router.RouteStats(); stats[0].InFlight != 0 || stats[1].InFlight != 0 {
+		t.Errorf("Expected no requests in flight for the routes once they finished, saw %v", stats)
+	}
+}
@@ -0,0 +1,164 @@
+package httptreemux
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// withSuggestions returns the request with the routes suggested for it added to its
+// context, and requestSuggestions retrieves them. They are nil when the context
+// package is not available.
+var (
+	withSuggestions    func(r *http.Request, suggestions []string) *http.Request
+	requestSuggestions func(r *http.Request) []string
+)
+
+// NotFoundHandler is the default handler for TreeMux.NotFoundHandler. It responds as
+// http.NotFound does, and when TreeMux.Suggestions found routes similar to the
+// request's path, it lists them in the body.
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	var suggestions []string
+	if requestSuggestions != nil {
+		suggestions = requestSuggestions(r)
+	}
+	if len(suggestions) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprintln(w, "404 page not found")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Did you mean:")
+	for _, pattern := range suggestions {
+		fmt.Fprintln(w, "  "+pattern)
+	}
+}
+
+// suggest returns up to t.Suggestions patterns of the routes in the tree for the
+// request's host that are closest to its path, closest first.
+func (t *TreeMux) suggest(r *http.Request) []string {
+	path := r.URL.Path
+	segments := pathSegments(path)
+	maxDistance := 3 + len(path)/5
+
+	var found []suggestion
+	seen := make(map[string]bool)
+	t.loadTrees().rootForHost(r.Host).walk([]walkPiece{{text: "/"}},
+		func(n *node, method, pattern string, handler HandlerFunc) bool {
+			if seen[pattern] {
+				return true
+			}
+			seen[pattern] = true
+			if d := segmentDistance(segments, pathSegments(pattern)); d <= maxDistance {
+				found = append(found, suggestion{pattern, d})
+			}
+			return true
+		})
+
+	sort.Sort(byDistance(found))
+	if len(found) > t.Suggestions {
+		found = found[:t.Suggestions]
+	}
+	suggestions := make([]string, len(found))
+	for i, s := range found {
+		suggestions[i] = s.pattern
+	}
+	return suggestions
+}
+
+// suggestion is a route suggested for a request, with its distance from the request's
+// path.
+type suggestion struct {
+	pattern  string
+	distance int
+}
+
+// byDistance sorts suggestions by distance, and then by pattern.
+type byDistance []suggestion
+
+func (s byDistance) Len() int      { return len(s) }
+func (s byDistance) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byDistance) Less(i, j int) bool {
+	if s[i].distance != s[j].distance {
+		return s[i].distance < s[j].distance
+	}
+	return s[i].pattern < s[j].pattern
+}
+
+// pathSegments splits a path into its segments, ignoring empty ones.
+func pathSegments(path string) []string {
+	return strings.FieldsFunc(path, func(c rune) bool {
+		return c == '/'
+	})
+}
+
+// segmentDistance returns the edit distance between the segments of a path and those
+// of a pattern. Replacing a segment costs the edit distance between the two, and adding
+// or removing one costs its length. Wildcards match any segment, and a catch-all any
+// number of them, at no cost.
+func segmentDistance(path, pattern []string) int {
+	// prev[i] is the distance between the first i segments of the path and the pattern
+	// segments before the current one.
+	prev := make([]int, len(path)+1)
+	cur := make([]int, len(path)+1)
+	for i := 1; i <= len(path); i++ {
+		prev[i] = prev[i-1] + len(path[i-1])
+	}
+
+	for _, segment := range pattern {
+		switch {
+		case segment[0] == '*':
+			cur[0] = prev[0]
+			for i := 1; i <= len(path); i++ {
+				cur[i] = minInt(prev[i], cur[i-1])
+			}
+		case strings.IndexByte(segment, ':') != -1:
+			cur[0] = prev[0] + 1
+			for i := 1; i <= len(path); i++ {
+				cur[i] = minInt(prev[i-1], minInt(prev[i]+1, cur[i-1]+len(path[i-1])))
+			}
+		default:
+			cur[0] = prev[0] + len(segment)
+			for i := 1; i <= len(path); i++ {
+				cur[i] = minInt(prev[i-1]+stringDistance(path[i-1], segment),
+					minInt(prev[i]+len(segment), cur[i-1]+len(path[i-1])))
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(path)]
+}
+
+// stringDistance returns the Levenshtein distance between two strings, comparing bytes
+// without regard to ASCII case.
+func stringDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if toLowerASCII(a[i-1]) == toLowerASCII(b[j-1]) {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j-1]+cost, minInt(prev[j]+1, cur[j-1]+1))
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,27 @@
+package httptreemux
+
+import "testing"
+
+func TestSegmentDistance(t *testing.T) {
+	tests := []struct {
+		path     string
+		pattern  string
+		distance int
+	}{
+		{"/users/1", "/users/:id", 0},
+		{"/usres/1", "/users/:id", 2},
+		{"/Users/1", "/users/:id", 0},
+		{"/api/users", "/api/v1/users", 2},
+		{"/api/v1/users/1", "/api/v1/users", 1},
+		{"/files/a/b/c", "/files/*path", 0},
+		{"/file/a/b", "/files/*path", 1},
+		{"/", "/", 0},
+		{"/orders", "/users/:id", 4},
+	}
+	for _, test := range tests {
+		d := segmentDistance(pathSegments(test.path), pathSegments(test.pattern))
+		if d != test.distance {
+			t.Errorf("%s and %s expected distance %d, saw %d", test.path, test.pattern, test.distance, d)
+		}
+	}
+}
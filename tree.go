@@ -1,8 +1,10 @@
 package httptreemux
 
 import (
+	"errors"
 	"fmt"
-	"net/url"
+	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -15,21 +17,109 @@ type node struct {
 	staticIndices []byte
 	staticChild   []*node
 
-	// If none of the above match, check the wildcard children
-	wildcardChild *node
+	// If none of the above match, check the wildcard children. Wildcards with a regular
+	// expression or type constraint are tried in the order they were added, before the
+	// unconstrained wildcard.
+	constrainedWildcardChildren []*node
+	wildcardChild               *node
 
-	// If none of the above match, then we use the catch-all, if applicable.
-	catchAllChild *node
+	// For a constrained wildcard node, the expression or the type that the segment
+	// must match. The node's path is the expression or the name of the type.
+	regExpr   *regexp.Regexp
+	paramType *paramType
+	// For a node that matches several wildcards in one segment, such as :name.:ext, the
+	// number of wildcards. The node's path is the segment with the names removed, such
+	// as :.:, and regExpr captures the value of each wildcard.
+	multiParams int
+
+	// If none of the above match, then we use the catch-all, if applicable. Catch-alls
+	// that must be followed by a static suffix, such as *path.js, are tried first, with
+	// the longest suffix first. The path of each of them is its suffix.
+	suffixCatchAllChildren []*node
+	catchAllChild          *node
 
 	// Data for the node is below.
 
 	addSlash   bool
 	isCatchAll bool
+	// An override of the router's TrailingSlashBehavior for this pattern.
+	trailingSlash    TrailingSlashBehavior
+	trailingSlashSet bool
 	// If this node is the end of the URL, then call the handler, if applicable.
 	leafHandler map[string]HandlerFunc
+	// True if the OPTIONS handler was added automatically from TreeMux.OptionsHandler.
+	implicitOptions bool
+	// The metadata added with Route.Meta for each method. The map for a method is
+	// replaced rather than changed, so it can be shared by clones.
+	leafMeta map[string]map[string]interface{}
+	// The deprecation set with Route.Deprecated for each method.
+	leafDeprecation map[string]*Deprecation
+	// The CORS policy set with Route.CORS for each method. A nil policy turns off the
+	// router's policy for the method.
+	leafCORS map[string]*CORS
+	// The compression set with Route.Compression for each method. A nil value turns off
+	// the router's compression for the method.
+	leafCompression map[string]*Compression
+	// The statistics of the handler for each method. They are shared by clones, so that
+	// they are kept when the tree changes.
+	leafStats map[string]*routeStats
 
 	// The names of the parameters to apply.
 	leafWildcardNames []string
+	// The types of the parameters, in the same order as leafWildcardNames, or nil if
+	// none of them have a type.
+	leafParamTypes []*paramType
+
+	// The route pattern that was registered for this node, for reporting.
+	fullPath string
+}
+
+// clone returns a copy of the node that can be changed without affecting the original,
+// which may still be used by requests that are being served. The children are shared
+// with the original, so they must be cloned as well before they are changed.
+func (n *node) clone() *node {
+	c := *n
+	c.staticIndices = append([]byte(nil), n.staticIndices...)
+	c.staticChild = append([]*node(nil), n.staticChild...)
+	c.constrainedWildcardChildren = append([]*node(nil), n.constrainedWildcardChildren...)
+	c.suffixCatchAllChildren = append([]*node(nil), n.suffixCatchAllChildren...)
+	if n.leafHandler != nil {
+		c.leafHandler = make(map[string]HandlerFunc, len(n.leafHandler))
+		for method, handler := range n.leafHandler {
+			c.leafHandler[method] = handler
+		}
+	}
+	if n.leafMeta != nil {
+		c.leafMeta = make(map[string]map[string]interface{}, len(n.leafMeta))
+		for method, meta := range n.leafMeta {
+			c.leafMeta[method] = meta
+		}
+	}
+	if n.leafDeprecation != nil {
+		c.leafDeprecation = make(map[string]*Deprecation, len(n.leafDeprecation))
+		for method, deprecation := range n.leafDeprecation {
+			c.leafDeprecation[method] = deprecation
+		}
+	}
+	if n.leafCORS != nil {
+		c.leafCORS = make(map[string]*CORS, len(n.leafCORS))
+		for method, policy := range n.leafCORS {
+			c.leafCORS[method] = policy
+		}
+	}
+	if n.leafCompression != nil {
+		c.leafCompression = make(map[string]*Compression, len(n.leafCompression))
+		for method, compression := range n.leafCompression {
+			c.leafCompression[method] = compression
+		}
+	}
+	if n.leafStats != nil {
+		c.leafStats = make(map[string]*routeStats, len(n.leafStats))
+		for method, stats := range n.leafStats {
+			c.leafStats[method] = stats
+		}
+	}
+	return &c
 }
 
 func (n *node) sortStaticChild(i int) {
@@ -40,25 +130,48 @@ func (n *node) sortStaticChild(i int) {
 	}
 }
 
-func (n *node) setHandler(verb string, handler HandlerFunc, optionsHandler HandlerFunc) {
+func (n *node) setHandler(verb string, handler HandlerFunc, optionsHandler HandlerFunc) error {
+	if verb == "OPTIONS" && n.implicitOptions {
+		// An OPTIONS handler that was added automatically gives way to an explicit one.
+		n.leafHandler[verb] = handler
+		n.leafStats[verb] = &routeStats{}
+		n.implicitOptions = false
+		return nil
+	}
+
+	if _, ok := n.leafHandler[verb]; ok {
+		return fmt.Errorf("%s already handles %s", n.path, verb)
+	}
+
 	if n.leafHandler == nil {
 		n.leafHandler = make(map[string]HandlerFunc)
 	}
-	_, ok := n.leafHandler[verb]
-	if ok {
-		panic(fmt.Sprintf("%s already handles %s", n.path, verb))
-	}
 	n.leafHandler[verb] = handler
+	if n.leafStats == nil {
+		n.leafStats = make(map[string]*routeStats)
+	}
+	n.leafStats[verb] = &routeStats{}
+	if verb == AnyMethod && n.implicitOptions {
+		// A handler for any method answers OPTIONS itself.
+		delete(n.leafHandler, "OPTIONS")
+		n.implicitOptions = false
+	}
 	if optionsHandler == nil {
-		return
+		return nil
 	}
-	_, ok = n.leafHandler["OPTIONS"]
-	if !ok {
+	_, hasOptions := n.leafHandler["OPTIONS"]
+	_, hasAny := n.leafHandler[AnyMethod]
+	if !hasOptions && !hasAny {
 		n.leafHandler["OPTIONS"] = optionsHandler
+		n.implicitOptions = true
 	}
+	return nil
 }
 
-func (n *node) addPath(path string, wildcards []string) *node {
+// addPath returns the node for the pattern, creating any nodes that don't exist yet.
+// Existing children are cloned before they are changed, so that a tree which is being
+// served is never modified.
+func (n *node) addPath(path string, wildcards []string) (*node, error) {
 	leaf := len(path) == 0
 	if leaf {
 		if wildcards != nil {
@@ -67,13 +180,13 @@ func (n *node) addPath(path string, wildcards []string) *node {
 			if n.leafWildcardNames != nil {
 				if len(n.leafWildcardNames) != len(wildcards) {
 					// This should never happen.
-					panic("Reached leaf node with differing wildcard array length. Please report this as a bug.")
+					return nil, errors.New("Reached leaf node with differing wildcard array length. Please report this as a bug.")
 				}
 
 				for i := 0; i < len(wildcards); i++ {
 					if n.leafWildcardNames[i] != wildcards[i] {
-						panic(fmt.Sprintf("Wildcards %v are ambiguous with wildcards %v",
-							n.leafWildcardNames, wildcards))
+						return nil, fmt.Errorf("Wildcards %v are ambiguous with wildcards %v",
+							n.leafWildcardNames, wildcards)
 					}
 				}
 			} else {
@@ -82,7 +195,7 @@ func (n *node) addPath(path string, wildcards []string) *node {
 			}
 		}
 
-		return n
+		return n, nil
 	}
 
 	c := path[0]
@@ -104,18 +217,23 @@ func (n *node) addPath(path string, wildcards []string) *node {
 
 	if c == '*' {
 		// Token starts with a *, so it's a catch-all
-		thisToken = thisToken[1:]
-		if n.catchAllChild == nil {
-			n.catchAllChild = &node{path: thisToken, isCatchAll: true}
+		name, suffix := splitCatchAll(path[1:])
+		if suffix != "" {
+			return n.addSuffixCatchAll(path, name, suffix, wildcards)
 		}
+		thisToken = thisToken[1:]
 
-		if path[1:] != n.catchAllChild.path {
-			panic(fmt.Sprintf("Catch-all name in %s doesn't match %s",
-				path, n.catchAllChild.path))
+		// Check everything before modifying the tree, so that a failed route
+		// doesn't leave a catch-all behind.
+		if n.catchAllChild != nil && thisToken != n.catchAllChild.path {
+			return nil, fmt.Errorf("Catch-all name in %s doesn't match %s",
+				path, n.catchAllChild.path)
 		}
 
-		if nextSlash != -1 {
-			panic("/ after catch-all found in " + path)
+		if n.catchAllChild == nil {
+			n.catchAllChild = &node{path: thisToken, isCatchAll: true}
+		} else {
+			n.catchAllChild = n.catchAllChild.clone()
 		}
 
 		if wildcards == nil {
@@ -123,28 +241,55 @@ func (n *node) addPath(path string, wildcards []string) *node {
 		} else {
 			wildcards = append(wildcards, thisToken)
 		}
-		n.catchAllChild.leafWildcardNames = wildcards
 
-		return n.catchAllChild
+		return n.catchAllChild.addPath("", wildcards)
 	} else if c == ':' {
 		// Token starts with a :
 		thisToken = thisToken[1:]
 
+		names, template, err := splitMultiWildcard(thisToken)
+		if err != nil {
+			return nil, fmt.Errorf("%s in %s", err, path)
+		}
+		if names != nil {
+			child := n.multiWildcardChildFor(template, len(names))
+			return child.addPath(remainingPath, append(wildcards, names...))
+		}
+
+		name, constraint, typed := splitWildcard(thisToken)
+		if (typed || strings.IndexByte(thisToken, '|') != -1) && constraint == "" {
+			return nil, errors.New("Empty wildcard constraint in " + path)
+		}
+
 		if wildcards == nil {
-			wildcards = []string{thisToken}
+			wildcards = []string{name}
 		} else {
-			wildcards = append(wildcards, thisToken)
+			wildcards = append(wildcards, name)
 		}
 
-		if n.wildcardChild == nil {
-			n.wildcardChild = &node{path: "wildcard"}
+		child, err := n.wildcardChildFor(constraint, typed)
+		if err != nil {
+			return nil, err
 		}
 
-		return n.wildcardChild.addPath(remainingPath, wildcards)
+		leaf, err := child.addPath(remainingPath, wildcards)
+		if err != nil || child.paramType == nil {
+			return leaf, err
+		}
+
+		// Record the type at the leaf, so the router can convert the value once the
+		// route is matched. The leaf may be shared with a published tree, so the
+		// slice is copied rather than changed.
+		index := len(wildcards) - 1
+		types := make([]*paramType, len(leaf.leafWildcardNames))
+		copy(types, leaf.leafParamTypes)
+		types[index] = child.paramType
+		leaf.leafParamTypes = types
+		return leaf, nil
 
 	} else {
 		if strings.ContainsAny(thisToken, ":*") {
-			panic("* or : in middle of path component " + path)
+			return nil, errors.New("* or : in middle of path component " + path)
 		}
 
 		// Do we have an existing node that starts with the same letter?
@@ -152,6 +297,7 @@ func (n *node) addPath(path string, wildcards []string) *node {
 			if c == index {
 				// Yes. Split it based on the common prefix of the existing
 				// node and the new one.
+				n.staticChild[i] = n.staticChild[i].clone()
 				child, prefixSplit := n.splitCommonPrefix(i, thisToken)
 				child.priority++
 				n.sortStaticChild(i)
@@ -173,6 +319,407 @@ func (n *node) addPath(path string, wildcards []string) *node {
 	}
 }
 
+// wildcardChildFor returns the wildcard child with the given constraint, creating it if
+// necessary. An empty constraint returns the unconstrained wildcard child.
+func (n *node) wildcardChildFor(constraint string, typed bool) (*node, error) {
+	if constraint == "" {
+		if n.wildcardChild == nil {
+			n.wildcardChild = &node{path: "wildcard"}
+		} else {
+			n.wildcardChild = n.wildcardChild.clone()
+		}
+		return n.wildcardChild, nil
+	}
+
+	if i := n.constrainedChildIndex(constraint, typed); i != -1 {
+		n.constrainedWildcardChildren[i] = n.constrainedWildcardChildren[i].clone()
+		return n.constrainedWildcardChildren[i], nil
+	}
+
+	child := &node{path: constraint}
+	if typed {
+		child.paramType = lookupParamType(constraint)
+		if child.paramType == nil {
+			return nil, fmt.Errorf("Unknown parameter type %s", constraint)
+		}
+	} else {
+		re, err := regexp.Compile(constraint)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid wildcard constraint %s: %s", constraint, err)
+		}
+		child.regExpr = re
+	}
+
+	n.constrainedWildcardChildren = append(n.constrainedWildcardChildren, child)
+	return child, nil
+}
+
+// multiWildcardChildFor returns the child that matches several wildcards in one segment
+// with the template, creating it if necessary. It is kept with the constrained wildcard
+// children, since its expression must match the segment.
+func (n *node) multiWildcardChildFor(template string, count int) *node {
+	if i := n.multiChildIndex(template); i != -1 {
+		n.constrainedWildcardChildren[i] = n.constrainedWildcardChildren[i].clone()
+		return n.constrainedWildcardChildren[i]
+	}
+
+	// Each wildcard is greedy, so that for :name.:ext the last . separates the two.
+	expr := []byte{'^'}
+	for _, part := range strings.SplitAfter(template, ":")[1:] {
+		expr = append(expr, "(.+)"...)
+		expr = append(expr, regexp.QuoteMeta(strings.TrimSuffix(part, ":"))...)
+	}
+	expr = append(expr, '$')
+
+	child := &node{path: template, regExpr: regexp.MustCompile(string(expr)), multiParams: count}
+
+	// Try templates with more wildcards first, so that :from-:to doesn't hide
+	// :from-:to.:format. Otherwise children keep the order they were added in.
+	i := len(n.constrainedWildcardChildren)
+	for j, other := range n.constrainedWildcardChildren {
+		if other.multiParams != 0 && other.multiParams < count {
+			i = j
+			break
+		}
+	}
+	n.constrainedWildcardChildren = append(n.constrainedWildcardChildren, nil)
+	copy(n.constrainedWildcardChildren[i+1:], n.constrainedWildcardChildren[i:])
+	n.constrainedWildcardChildren[i] = child
+	return child
+}
+
+// constrainedChildIndex returns the index of the constrained wildcard child with the
+// regular expression or type, or -1 if there is none.
+func (n *node) constrainedChildIndex(constraint string, typed bool) int {
+	for i, child := range n.constrainedWildcardChildren {
+		if child.path == constraint && child.multiParams == 0 && (child.paramType != nil) == typed {
+			return i
+		}
+	}
+	return -1
+}
+
+// multiChildIndex returns the index of the child that matches several wildcards in one
+// segment with the template, or -1 if there is none.
+func (n *node) multiChildIndex(template string) int {
+	for i, child := range n.constrainedWildcardChildren {
+		if child.multiParams != 0 && child.path == template {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchesConstraint reports whether the unescaped segment satisfies the regular
+// expression or type of a constrained wildcard node.
+func (n *node) matchesConstraint(segment string) bool {
+	if n.paramType != nil {
+		_, err := n.paramType.parse(segment)
+		return err == nil
+	}
+	return n.regExpr.MatchString(segment)
+}
+
+// splitWildcard splits the text of a wildcard token, without its leading :, into the
+// wildcard's name and its constraint. The constraint is either a regular expression
+// after a |, or the name of a parameter type after a second :, in which case typed is
+// true.
+func splitWildcard(token string) (name, constraint string, typed bool) {
+	pipe := strings.IndexByte(token, '|')
+	colon := strings.IndexByte(token, ':')
+	if colon != -1 && (pipe == -1 || colon < pipe) {
+		return token[:colon], token[colon+1:], true
+	}
+	if pipe != -1 {
+		return token[:pipe], token[pipe+1:], false
+	}
+	return token, "", false
+}
+
+var errMultiWildcard = errors.New("Wildcards in a segment must have names and be separated by static text")
+
+// splitMultiWildcard parses a wildcard token, without its leading :, that holds several
+// wildcards separated by static text, such as name.:ext or from-:to. It returns the
+// names, and the token with the names removed, such as :.: or :-:. The names are nil if
+// the token is a single wildcard, which is the case unless a : follows a character that
+// can't be part of a name. So :id:int is still a typed wildcard, and :user-id is a
+// wildcard named user-id.
+func splitMultiWildcard(token string) (names []string, template string, err error) {
+	end := len(token)
+	if pipe := strings.IndexByte(token, '|'); pipe != -1 {
+		end = pipe
+	}
+
+	multi := false
+	for i := 1; i < end; i++ {
+		if token[i] == ':' && !isNameChar(token[i-1]) {
+			multi = true
+			break
+		}
+	}
+	if !multi {
+		return nil, "", nil
+	}
+	if end != len(token) || strings.IndexByte(token, '*') != -1 {
+		return nil, "", errors.New("Constraints and catch-alls can't be used in a segment with several wildcards")
+	}
+
+	var buf []byte
+	for i := 0; i < len(token); {
+		start := i
+		for i < len(token) && isNameChar(token[i]) {
+			i++
+		}
+		if i == start {
+			return nil, "", errMultiWildcard
+		}
+		names = append(names, token[start:i])
+		buf = append(buf, ':')
+
+		start = i
+		for i < len(token) && token[i] != ':' {
+			i++
+		}
+		if i == start && i != len(token) {
+			return nil, "", errMultiWildcard
+		}
+		buf = append(buf, token[start:i]...)
+		if i < len(token) {
+			// Skip the : that starts the next wildcard.
+			i++
+			if i == len(token) {
+				return nil, "", errMultiWildcard
+			}
+		}
+	}
+	return names, string(buf), nil
+}
+
+// splitCatchAll splits a catch-all token, without its leading *, into the name and the
+// static suffix that must follow the value, which starts at the first . or /. So
+// path.js has a suffix of .js, and path/edit has a suffix of /edit.
+func splitCatchAll(token string) (name, suffix string) {
+	if i := strings.IndexAny(token, "./"); i != -1 {
+		return token[:i], token[i:]
+	}
+	return token, ""
+}
+
+// addSuffixCatchAll adds a catch-all that must be followed by the suffix. The path is
+// the rest of the pattern, for errors.
+func (n *node) addSuffixCatchAll(path, name, suffix string, wildcards []string) (*node, error) {
+	if suffix == "/" {
+		return nil, errors.New("/ after catch-all found in " + path)
+	}
+	if strings.ContainsAny(suffix, ":*") {
+		return nil, errors.New("Wildcard after catch-all found in " + path)
+	}
+
+	var child *node
+	if i := n.suffixCatchAllIndex(suffix); i != -1 {
+		child = n.suffixCatchAllChildren[i].clone()
+		n.suffixCatchAllChildren[i] = child
+	} else {
+		child = &node{path: suffix}
+		i = len(n.suffixCatchAllChildren)
+		for j, other := range n.suffixCatchAllChildren {
+			if len(other.path) < len(suffix) {
+				i = j
+				break
+			}
+		}
+		n.suffixCatchAllChildren = append(n.suffixCatchAllChildren, nil)
+		copy(n.suffixCatchAllChildren[i+1:], n.suffixCatchAllChildren[i:])
+		n.suffixCatchAllChildren[i] = child
+	}
+
+	return child.addPath("", append(wildcards, name))
+}
+
+// suffixCatchAllIndex returns the index of the catch-all child with the suffix, or -1
+// if there is none.
+func (n *node) suffixCatchAllIndex(suffix string) int {
+	for i, child := range n.suffixCatchAllChildren {
+		if child.path == suffix {
+			return i
+		}
+	}
+	return -1
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// removePath removes the handler for the method from the node for the pattern, and
+// prunes any nodes along the way that are left without handlers or children. Like
+// addPath, it clones the children it changes. It returns the node the handler was
+// removed from, or nil if the pattern had no handler for the method.
+func (n *node) removePath(path string, method string, wildcards []string) *node {
+	if len(path) == 0 {
+		if _, ok := n.leafHandler[method]; !ok || !equalStrings(n.leafWildcardNames, wildcards) {
+			return nil
+		}
+
+		delete(n.leafHandler, method)
+		delete(n.leafMeta, method)
+		delete(n.leafDeprecation, method)
+		delete(n.leafCORS, method)
+		delete(n.leafCompression, method)
+		delete(n.leafStats, method)
+		if len(n.leafHandler) == 1 && n.implicitOptions {
+			delete(n.leafHandler, "OPTIONS")
+		}
+
+		if len(n.leafHandler) == 0 {
+			n.leafHandler = nil
+			n.leafWildcardNames = nil
+			n.leafParamTypes = nil
+			n.leafMeta = nil
+			n.leafDeprecation = nil
+			n.leafCORS = nil
+			n.leafCompression = nil
+			n.leafStats = nil
+			n.addSlash = false
+			n.trailingSlashSet = false
+			n.implicitOptions = false
+			n.fullPath = ""
+		}
+		return n
+	}
+
+	c := path[0]
+	nextSlash := strings.IndexByte(path, '/')
+	thisToken := path
+	remainingPath := ""
+	if c != '/' && nextSlash != -1 {
+		thisToken = path[:nextSlash]
+		remainingPath = path[nextSlash:]
+	}
+
+	switch c {
+	case '*':
+		if name, suffix := splitCatchAll(path[1:]); suffix != "" {
+			i := n.suffixCatchAllIndex(suffix)
+			if i == -1 {
+				return nil
+			}
+			child := n.suffixCatchAllChildren[i].clone()
+			n.suffixCatchAllChildren[i] = child
+
+			found := child.removePath("", method, append(wildcards, name))
+			if found != nil && child.isEmpty() {
+				n.suffixCatchAllChildren = append(n.suffixCatchAllChildren[:i], n.suffixCatchAllChildren[i+1:]...)
+			}
+			return found
+		}
+
+		if n.catchAllChild == nil || n.catchAllChild.path != thisToken[1:] {
+			return nil
+		}
+		child := n.catchAllChild.clone()
+		n.catchAllChild = child
+
+		found := child.removePath("", method, append(wildcards, thisToken[1:]))
+		if found != nil && child.isEmpty() {
+			n.catchAllChild = nil
+		}
+		return found
+
+	case ':':
+		if names, template, _ := splitMultiWildcard(thisToken[1:]); names != nil {
+			i := n.multiChildIndex(template)
+			if i == -1 {
+				return nil
+			}
+			child := n.constrainedWildcardChildren[i].clone()
+			n.constrainedWildcardChildren[i] = child
+
+			found := child.removePath(remainingPath, method, append(wildcards, names...))
+			if found != nil && child.isEmpty() {
+				n.constrainedWildcardChildren = append(n.constrainedWildcardChildren[:i],
+					n.constrainedWildcardChildren[i+1:]...)
+			}
+			return found
+		}
+
+		name, constraint, typed := splitWildcard(thisToken[1:])
+		wildcards = append(wildcards, name)
+
+		if constraint == "" {
+			if n.wildcardChild == nil {
+				return nil
+			}
+			child := n.wildcardChild.clone()
+			n.wildcardChild = child
+
+			found := child.removePath(remainingPath, method, wildcards)
+			if found != nil && child.isEmpty() {
+				n.wildcardChild = nil
+			}
+			return found
+		}
+
+		i := n.constrainedChildIndex(constraint, typed)
+		if i == -1 {
+			return nil
+		}
+		child := n.constrainedWildcardChildren[i].clone()
+		n.constrainedWildcardChildren[i] = child
+
+		found := child.removePath(remainingPath, method, wildcards)
+		if found != nil && child.isEmpty() {
+			n.constrainedWildcardChildren = append(n.constrainedWildcardChildren[:i],
+				n.constrainedWildcardChildren[i+1:]...)
+		}
+		return found
+
+	default:
+		for i, index := range n.staticIndices {
+			if c != index {
+				continue
+			}
+
+			if !strings.HasPrefix(path, n.staticChild[i].path) {
+				return nil
+			}
+			child := n.staticChild[i].clone()
+			n.staticChild[i] = child
+
+			found := child.removePath(path[len(child.path):], method, wildcards)
+			if found != nil {
+				child.priority--
+				if child.isEmpty() {
+					n.staticIndices = append(n.staticIndices[:i], n.staticIndices[i+1:]...)
+					n.staticChild = append(n.staticChild[:i], n.staticChild[i+1:]...)
+				}
+			}
+			return found
+		}
+		return nil
+	}
+}
+
+// isEmpty reports whether the node has no handlers and no children, and so can be
+// removed from the tree.
+func (n *node) isEmpty() bool {
+	return len(n.leafHandler) == 0 && len(n.staticChild) == 0 &&
+		len(n.constrainedWildcardChildren) == 0 && n.wildcardChild == nil &&
+		len(n.suffixCatchAllChildren) == 0 && n.catchAllChild == nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (n *node) splitCommonPrefix(existingNodeIndex int, path string) (*node, int) {
 	childNode := n.staticChild[existingNodeIndex]
 
@@ -213,78 +760,490 @@ func (n *node) splitCommonPrefix(existingNodeIndex int, path string) (*node, int
 	return newNode, i
 }
 
+// searchOptions changes how search matches a path. The zero value matches as search
+// does.
+type searchOptions struct {
+	// Static path segments match without regard to ASCII case.
+	ignoreCase bool
+	// If not nil, only nodes with a handler for one of the methods match, so that a
+	// route for other methods doesn't hide a wildcard or catch-all.
+	methods []string
+	// The order to try the kinds of children in, or nil for the default order of static,
+	// constrained, wildcard and catch-all.
+	precedence []MatchKind
+	// If not nil, the branches that are tried are recorded in it, for Explain.
+	trace *searchTrace
+	// The static parts of the path that matched with a different case, recorded when
+	// ignoreCase is set, for TreeMux.RedirectCase.
+	caseFixes []caseFix
+}
+
+// caseFix is a static part of a path that matched a node with a different case.
+type caseFix struct {
+	// The length of the path from the start of the part to its end.
+	fromEnd int
+	// The part as the node has it.
+	text string
+}
+
+// applyCaseFixes returns the path with the parts in fixes replaced by the text of the
+// nodes they matched.
+func applyCaseFixes(path string, fixes []caseFix) string {
+	b := []byte(path)
+	for _, fix := range fixes {
+		copy(b[len(b)-fix.fromEnd:], fix.text)
+	}
+	return string(b)
+}
+
+// search returns the node matching the path, and the values of its wildcards and
+// catch-all in reverse order. The values are returned as they appear in the path,
+// though constraints are matched against the unescaped values.
 func (n *node) search(path string) (found *node, params []string) {
+	return n.searchWith(path, &searchOptions{})
+}
+
+// searchCaseInsensitive is like search, but static path segments match without regard
+// to ASCII case.
+func (n *node) searchCaseInsensitive(path string) (found *node, params []string) {
+	return n.searchWith(path, &searchOptions{ignoreCase: true})
+}
+
+func (n *node) searchWith(path string, opts *searchOptions) (found *node, params []string) {
 	// if test != nil {
 	// 	test.Logf("Searching for %s in %s", path, n.dumpTree("", ""))
 	// }
-	pathLen := len(path)
-	if pathLen == 0 {
-		if len(n.leafHandler) == 0 {
+	if len(path) == 0 {
+		if len(n.leafHandler) == 0 || !n.handlesAny(opts.methods) {
+			if opts.trace != nil {
+				if len(n.leafHandler) == 0 {
+					opts.trace.fail("no route ends here")
+				} else {
+					opts.trace.fail("the route has no handler for the method")
+				}
+			}
 			return nil, nil
+		} else if len(n.leafWildcardNames) != 0 {
+			// Allocate the params once, with room for the values that the wildcards
+			// above will add as the search returns.
+			return n, make([]string, 0, len(n.leafWildcardNames))
 		} else {
 			return n, nil
 		}
 	}
 
-	// First see if this matches a static token.
+	if opts.precedence != nil {
+		return n.searchPrecedence(path, opts)
+	}
+
+	// Checking for each kind of child first saves the calls for the kinds a node
+	// doesn't have.
+	if len(n.staticIndices) != 0 {
+		if found, params = n.searchStatic(path, opts); found != nil {
+			return
+		}
+	}
+	if len(n.constrainedWildcardChildren) != 0 {
+		if found, params = n.searchConstrained(path, opts); found != nil {
+			return
+		}
+	}
+	if n.wildcardChild != nil {
+		if found, params = n.searchWildcard(path, opts); found != nil {
+			return
+		}
+	}
+	if n.catchAllChild != nil || len(n.suffixCatchAllChildren) != 0 {
+		return n.searchCatchAll(path, opts)
+	}
+	return nil, nil
+}
+
+// searchPrecedence is like searchWith, but tries the kinds of children in the order of
+// opts.precedence.
+func (n *node) searchPrecedence(path string, opts *searchOptions) (found *node, params []string) {
+	for _, kind := range opts.precedence {
+		switch kind {
+		case MatchStatic:
+			found, params = n.searchStatic(path, opts)
+		case MatchConstrained:
+			found, params = n.searchConstrained(path, opts)
+		case MatchWildcard:
+			found, params = n.searchWildcard(path, opts)
+		case MatchCatchAll:
+			found, params = n.searchCatchAll(path, opts)
+		}
+		if found != nil {
+			return
+		}
+	}
+	return nil, nil
+}
+
+func (n *node) searchStatic(path string, opts *searchOptions) (found *node, params []string) {
+	pathLen := len(path)
 	firstChar := path[0]
+	ignoreCase := opts.ignoreCase
 	for i, staticIndex := range n.staticIndices {
-		if staticIndex == firstChar {
+		if staticIndex == firstChar || ignoreCase && toLowerASCII(staticIndex) == toLowerASCII(firstChar) {
 			child := n.staticChild[i]
 			childPathLen := len(child.path)
-			if pathLen >= childPathLen && child.path == path[:childPathLen] {
+			if pathLen >= childPathLen && (child.path == path[:childPathLen] ||
+				ignoreCase && equalFoldASCII(child.path, path[:childPathLen])) {
 				nextPath := path[childPathLen:]
-				found, params = child.search(nextPath)
+				if opts.trace != nil {
+					found, params = child.searchTraced("static", path, nextPath, opts)
+				} else {
+					found, params = child.searchWith(nextPath, opts)
+				}
+				if found != nil {
+					if ignoreCase && child.path != path[:childPathLen] {
+						opts.caseFixes = append(opts.caseFixes, caseFix{fromEnd: pathLen, text: child.path})
+					}
+					return
+				}
+			} else if opts.trace != nil {
+				opts.trace.rejectf("static", child, path, "the path doesn't start with %q", child.path)
 			}
-			break
-		}
-	}
 
-	if found != nil {
-		return
+			if !ignoreCase {
+				// Only one child can start with this character.
+				break
+			}
+		}
 	}
+	return nil, nil
+}
 
-	if n.wildcardChild != nil {
-		// Didn't find a static token, so check for a wildcard.
-		nextSlash := 0
-		for nextSlash < pathLen && path[nextSlash] != '/' {
-			nextSlash++
+func (n *node) searchConstrained(path string, opts *searchOptions) (found *node, params []string) {
+	thisToken, nextToken := splitToken(path)
+	if len(thisToken) == 0 { // Don't match on empty tokens.
+		if opts.trace != nil {
+			for _, child := range n.constrainedWildcardChildren {
+				opts.trace.reject(child.constrainedKind(), child, path, "the segment is empty")
+			}
 		}
+		return nil, nil
+	}
 
-		thisToken := path[0:nextSlash]
-		nextToken := path[nextSlash:]
-
-		if len(thisToken) > 0 { // Don't match on empty tokens.
-			found, params = n.wildcardChild.search(nextToken)
+	unescaped := unescapeToken(thisToken)
+	for _, child := range n.constrainedWildcardChildren {
+		if child.multiParams != 0 {
+			// Match the raw token, since the values are returned raw.
+			values := child.regExpr.FindStringSubmatch(thisToken)
+			if values == nil {
+				if opts.trace != nil {
+					opts.trace.rejectf("multiWildcard", child, path, "%q doesn't match the template", thisToken)
+				}
+				continue
+			}
+			if opts.trace != nil {
+				found, params = child.searchTraced("multiWildcard", path, nextToken, opts)
+			} else {
+				found, params = child.searchWith(nextToken, opts)
+			}
 			if found != nil {
-				unescaped, err := url.QueryUnescape(thisToken)
-				if err != nil {
-					unescaped = thisToken
+				for i := len(values) - 1; i > 0; i-- {
+					params = append(params, values[i])
 				}
+				return
+			}
+			continue
+		}
 
-				if params == nil {
-					params = []string{unescaped}
+		if !child.matchesConstraint(unescaped) {
+			if opts.trace != nil {
+				if child.paramType != nil {
+					opts.trace.rejectf("typed", child, path, "%q isn't of the type", unescaped)
 				} else {
-					params = append(params, unescaped)
+					opts.trace.rejectf("regexp", child, path, "%q doesn't match the constraint", unescaped)
 				}
+			}
+			continue
+		}
 
-				return
+		if opts.trace != nil {
+			found, params = child.searchTraced(child.constrainedKind(), path, nextToken, opts)
+		} else {
+			found, params = child.searchWith(nextToken, opts)
+		}
+		if found != nil {
+			params = append(params, thisToken)
+			return
+		}
+	}
+	return nil, nil
+}
+
+func (n *node) searchWildcard(path string, opts *searchOptions) (found *node, params []string) {
+	if n.wildcardChild == nil {
+		return nil, nil
+	}
+
+	thisToken, nextToken := splitToken(path)
+	if len(thisToken) == 0 { // Don't match on empty tokens.
+		if opts.trace != nil {
+			opts.trace.reject("wildcard", n.wildcardChild, path, "the segment is empty")
+		}
+		return nil, nil
+	}
+
+	if opts.trace != nil {
+		found, params = n.wildcardChild.searchTraced("wildcard", path, nextToken, opts)
+	} else {
+		found, params = n.wildcardChild.searchWith(nextToken, opts)
+	}
+	if found != nil {
+		params = append(params, thisToken)
+	}
+	return
+}
+
+func (n *node) searchCatchAll(path string, opts *searchOptions) (found *node, params []string) {
+	pathLen := len(path)
+	for _, child := range n.suffixCatchAllChildren {
+		// The catch-all must match at least one character before the suffix.
+		valueLen := pathLen - len(child.path)
+		if valueLen > 0 && (path[valueLen:] == child.path ||
+			opts.ignoreCase && equalFoldASCII(child.path, path[valueLen:])) && child.handlesAny(opts.methods) {
+			if opts.trace != nil {
+				opts.trace.match("suffixCatchAll", child, path)
+			}
+			params = make([]string, 1, len(child.leafWildcardNames))
+			params[0] = path[:valueLen]
+			return child, params
+		}
+
+		if opts.trace != nil {
+			if valueLen > 0 && (path[valueLen:] == child.path ||
+				opts.ignoreCase && equalFoldASCII(child.path, path[valueLen:])) {
+				opts.trace.reject("suffixCatchAll", child, path, "the route has no handler for the method")
+			} else {
+				opts.trace.rejectf("suffixCatchAll", child, path,
+					"the path doesn't end with %q after at least one character", child.path)
 			}
 		}
 	}
 
 	catchAllChild := n.catchAllChild
-	if catchAllChild != nil {
+	if catchAllChild != nil && catchAllChild.handlesAny(opts.methods) {
+		if opts.trace != nil {
+			opts.trace.match("catchAll", catchAllChild, path)
+		}
 		// Hit the catchall, so just assign the whole remaining path.
-		unescaped, err := url.QueryUnescape(path)
-		if err != nil {
-			unescaped = path
+		params = make([]string, 1, len(catchAllChild.leafWildcardNames))
+		params[0] = path
+		return catchAllChild, params
+	}
+	if catchAllChild != nil && opts.trace != nil {
+		opts.trace.reject("catchAll", catchAllChild, path, "the route has no handler for the method")
+	}
+	return nil, nil
+}
+
+// searchTraced is like searchWith, but records the branch in opts.trace, which must
+// not be nil. The node is a child of the kind, and path is what was left to match at
+// its parent.
+func (n *node) searchTraced(kind, path, nextPath string, opts *searchOptions) (found *node, params []string) {
+	step := opts.trace.enter(kind, n, path)
+	found, params = n.searchWith(nextPath, opts)
+	opts.trace.exit(step, found)
+	return
+}
+
+// constrainedKind returns the kind of a constrained wildcard child, as used by
+// DumpJSON.
+func (n *node) constrainedKind() string {
+	if n.multiParams != 0 {
+		return "multiWildcard"
+	} else if n.paramType != nil {
+		return "typed"
+	}
+	return "regexp"
+}
+
+// splitToken returns the first segment of the path, and the rest of the path.
+func splitToken(path string) (thisToken, nextToken string) {
+	nextSlash := 0
+	for nextSlash < len(path) && path[nextSlash] != '/' {
+		nextSlash++
+	}
+	return path[0:nextSlash], path[nextSlash:]
+}
+
+// handlesAny reports whether the node has a handler for one of the methods, or true if
+// methods is nil.
+func (n *node) handlesAny(methods []string) bool {
+	if methods == nil {
+		return true
+	}
+	for _, method := range methods {
+		if _, ok := n.leafHandler[method]; ok {
+			return true
 		}
+	}
+	return false
+}
 
-		return catchAllChild, []string{unescaped}
+func toLowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
 	}
+	return c
+}
 
-	return nil, nil
+// equalFoldASCII reports whether two strings of the same length are equal, ignoring
+// ASCII case.
+func equalFoldASCII(a, b string) bool {
+	for i := 0; i < len(a); i++ {
+		if toLowerASCII(a[i]) != toLowerASCII(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// unescapeToken decodes the escaped characters in a path token, returning the
+// token unchanged if it is not validly escaped. Unlike in a query string, a + in a
+// path is not a space, so it is left as it is.
+func unescapeToken(token string) string {
+	if strings.IndexByte(token, '%') == -1 {
+		return token
+	}
+
+	buf := make([]byte, 0, len(token))
+	for i := 0; i < len(token); i++ {
+		c := token[i]
+		if c != '%' {
+			buf = append(buf, c)
+			continue
+		}
+
+		if i+2 >= len(token) || !isHex(token[i+1]) || !isHex(token[i+2]) {
+			return token
+		}
+		buf = append(buf, unhex(token[i+1])<<4|unhex(token[i+2]))
+		i += 2
+	}
+	return string(buf)
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// walkPiece is a part of a pattern being rebuilt by walk. The names of wildcards and
+// catch-alls are only known at the leaf, so they are filled in there.
+type walkPiece struct {
+	text     string
+	wildcard bool
+	catchAll bool
+	// The text is the template of a segment with several wildcards, such as :.:.
+	multi bool
+}
+
+// walk calls fn for each handler in the tree below n, with the node that holds it and
+// the pattern it was registered for. Handlers added automatically for OPTIONS are
+// skipped. It returns false if fn returned false to stop the walk.
+func (n *node) walk(pieces []walkPiece, fn func(n *node, method, path string, handler HandlerFunc) bool) bool {
+	if len(n.leafHandler) != 0 {
+		pattern := n.rebuildPattern(pieces)
+		methods := make([]string, 0, len(n.leafHandler))
+		for method := range n.leafHandler {
+			if method == "OPTIONS" && n.implicitOptions {
+				continue
+			}
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			if !fn(n, method, pattern, n.leafHandler[method]) {
+				return false
+			}
+		}
+	}
+
+	for _, child := range n.staticChild {
+		if !child.walk(append(pieces, walkPiece{text: child.path}), fn) {
+			return false
+		}
+	}
+
+	for _, child := range n.constrainedWildcardChildren {
+		piece := walkPiece{text: "|" + child.path, wildcard: true}
+		if child.multiParams != 0 {
+			piece = walkPiece{text: child.path, multi: true}
+		} else if child.paramType != nil {
+			piece.text = ":" + child.path
+		}
+		if !child.walk(append(pieces, piece), fn) {
+			return false
+		}
+	}
+
+	if n.wildcardChild != nil {
+		if !n.wildcardChild.walk(append(pieces, walkPiece{wildcard: true}), fn) {
+			return false
+		}
+	}
+
+	for _, child := range n.suffixCatchAllChildren {
+		if !child.walk(append(pieces, walkPiece{text: child.path, catchAll: true}), fn) {
+			return false
+		}
+	}
+
+	if n.catchAllChild != nil {
+		return n.catchAllChild.walk(append(pieces, walkPiece{catchAll: true}), fn)
+	}
+	return true
+}
+
+func (n *node) rebuildPattern(pieces []walkPiece) string {
+	var pattern []byte
+	wildcard := 0
+	for _, piece := range pieces {
+		switch {
+		case piece.multi:
+			for i := 0; i < len(piece.text); i++ {
+				pattern = append(pattern, piece.text[i])
+				if piece.text[i] == ':' && wildcard < len(n.leafWildcardNames) {
+					pattern = append(pattern, n.leafWildcardNames[wildcard]...)
+					wildcard++
+				}
+			}
+			continue
+		case piece.catchAll:
+			pattern = append(pattern, '*')
+		case piece.wildcard:
+			pattern = append(pattern, ':')
+		default:
+			pattern = append(pattern, piece.text...)
+			continue
+		}
+
+		if wildcard < len(n.leafWildcardNames) {
+			pattern = append(pattern, n.leafWildcardNames[wildcard]...)
+		}
+		wildcard++
+		pattern = append(pattern, piece.text...)
+	}
+
+	if n.addSlash {
+		pattern = append(pattern, '/')
+	}
+	return string(pattern)
 }
 
 func (n *node) dumpTree(prefix, nodeType string) string {
@@ -294,9 +1253,21 @@ func (n *node) dumpTree(prefix, nodeType string) string {
 	for _, node := range n.staticChild {
 		line += node.dumpTree(prefix, "")
 	}
+	for _, node := range n.constrainedWildcardChildren {
+		if node.multiParams != 0 {
+			line += node.dumpTree(prefix, "")
+		} else if node.paramType != nil {
+			line += node.dumpTree(prefix, "::")
+		} else {
+			line += node.dumpTree(prefix, ":|")
+		}
+	}
 	if n.wildcardChild != nil {
 		line += n.wildcardChild.dumpTree(prefix, ":")
 	}
+	for _, node := range n.suffixCatchAllChildren {
+		line += node.dumpTree(prefix, "*")
+	}
 	if n.catchAllChild != nil {
 		line += n.catchAllChild.dumpTree(prefix, "*")
 	}
@@ -2,6 +2,7 @@ package httptreemux
 
 import (
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -12,7 +13,10 @@ func dummyHandler(w http.ResponseWriter, r *http.Request, urlParams map[string]s
 
 func addPath(t *testing.T, tree *node, path string) {
 	t.Logf("Adding path %s", path)
-	n := tree.addPath(path[1:], nil)
+	n, err := tree.addPath(path[1:], nil)
+	if err != nil {
+		t.Fatalf("Error adding path %s: %s", path, err)
+	}
 	handler := func(w http.ResponseWriter, r *http.Request, urlParams map[string]string) {
 		urlParams["path"] = path
 	}
@@ -27,7 +31,13 @@ func testPath(t *testing.T, tree *node, path string, expectPath string, expected
 		t.FailNow()
 	}
 
-	expectCatchAll := strings.Contains(expectPath, "/*")
+	// A catch-all followed by a suffix doesn't keep the trailing slash in its value, so
+	// its node isn't marked as a catch-all.
+	expectCatchAll := false
+	if star := strings.LastIndex(expectPath, "/*"); star != -1 {
+		_, suffix := splitCatchAll(expectPath[star+2:])
+		expectCatchAll = suffix == ""
+	}
 
 	t.Log("Testing", path)
 	n, paramList := tree.search(path[1:])
@@ -66,7 +76,7 @@ func testPath(t *testing.T, tree *node, path string, expectPath string, expected
 
 	if expectedParams == nil {
 		if len(paramList) != 0 {
-			t.Errorf("Path %p expected no parameters, saw %v", path, paramList)
+			t.Errorf("Path %s expected no parameters, saw %v", path, paramList)
 		}
 	} else {
 		if len(paramList) != len(n.leafWildcardNames) {
@@ -74,9 +84,10 @@ func testPath(t *testing.T, tree *node, path string, expectPath string, expected
 				len(paramList), len(n.leafWildcardNames))
 		}
 
+		// Unescape the values like the router does.
 		params := map[string]string{}
 		for i := 0; i < len(paramList); i++ {
-			params[n.leafWildcardNames[len(paramList)-i-1]] = paramList[i]
+			params[n.leafWildcardNames[len(paramList)-i-1]] = unescapeToken(paramList[i])
 		}
 		t.Log("\tGot params", params)
 
@@ -203,7 +214,7 @@ func TestTree(t *testing.T) {
 	t.Log("Test retrieval of duplicate paths")
 	params := make(map[string]string)
 	p := "date/:year/:month/abc"
-	n := tree.addPath(p, nil)
+	n, _ := tree.addPath(p, nil)
 	if n == nil {
 		t.Errorf("Duplicate add of %s didn't return a node", p)
 	} else {
@@ -227,81 +238,355 @@ func TestTree(t *testing.T) {
 	test = nil
 }
 
-func TestPanics(t *testing.T) {
-	sawPanic := false
+func TestWildcardConstraints(t *testing.T) {
+	tree := &node{path: "/"}
+
+	addPath(t, tree, "/users/:id|^[0-9]+$")
+	addPath(t, tree, "/users/:id|^[0-9]+$/edit")
+	addPath(t, tree, "/users/:name")
+	addPath(t, tree, "/users/:name/profile")
+	addPath(t, tree, "/users/:code|^[a-z]{3}$/profile")
+	addPath(t, tree, "/users/new")
+
+	testPath(t, tree, "/users/42", "/users/:id|^[0-9]+$",
+		map[string]string{"id": "42"})
+	testPath(t, tree, "/users/42/edit", "/users/:id|^[0-9]+$/edit",
+		map[string]string{"id": "42"})
+	testPath(t, tree, "/users/bob", "/users/:name",
+		map[string]string{"name": "bob"})
+	testPath(t, tree, "/users/new", "/users/new", nil)
+	testPath(t, tree, "/users/abc/profile", "/users/:code|^[a-z]{3}$/profile",
+		map[string]string{"code": "abc"})
+	// Matches the number constraint, but that subtree has no profile route.
+	testPath(t, tree, "/users/42/profile", "/users/:name/profile",
+		map[string]string{"name": "42"})
+	testPath(t, tree, "/users/bobby/profile", "/users/:name/profile",
+		map[string]string{"name": "bobby"})
+	testPath(t, tree, "/users/bob/edit", "", nil)
+	// The constraint is checked against the unescaped value.
+	testPath(t, tree, "/users/%34%32", "/users/:id|^[0-9]+$",
+		map[string]string{"id": "42"})
+}
+
+func TestTypedWildcards(t *testing.T) {
+	tree := &node{path: "/"}
+
+	addPath(t, tree, "/orders/:id:int")
+	addPath(t, tree, "/orders/:id:int/items/:item:uint")
+	addPath(t, tree, "/orders/:ref:uuid")
+	addPath(t, tree, "/orders/:name")
+	addPath(t, tree, "/orders/:id|^x[0-9]+$")
+
+	testPath(t, tree, "/orders/42", "/orders/:id:int",
+		map[string]string{"id": "42"})
+	testPath(t, tree, "/orders/-3/items/7", "/orders/:id:int/items/:item:uint",
+		map[string]string{"id": "-3", "item": "7"})
+	testPath(t, tree, "/orders/42/items/-7", "", nil)
+	testPath(t, tree, "/orders/0b5e8c64-1f4e-4a47-9f2e-6d1b2c3a4f5e", "/orders/:ref:uuid",
+		map[string]string{"ref": "0b5e8c64-1f4e-4a47-9f2e-6d1b2c3a4f5e"})
+	testPath(t, tree, "/orders/x42", "/orders/:id|^x[0-9]+$",
+		map[string]string{"id": "x42"})
+	testPath(t, tree, "/orders/abc", "/orders/:name",
+		map[string]string{"name": "abc"})
+
+	n, _ := tree.search("orders/1/items/2")
+	if len(n.leafParamTypes) != 2 || n.leafParamTypes[0] == nil || n.leafParamTypes[1] == nil {
+		t.Errorf("Expected two parameter types at the leaf, saw %v", n.leafParamTypes)
+	}
+	if values := n.typedParams([]string{"2", "1"}); values["id"] != 1 ||
+		values["item"] != uint64(2) {
+		t.Errorf("Expected converted values 1 and 2, saw %v", values)
+	}
+
+	for _, path := range []string{"orders/:id:", "orders/:id:unknown"} {
+		if _, err := tree.addPath(path, nil); err == nil {
+			t.Errorf("Expected error adding %s", path)
+		}
+	}
+}
+
+func TestMultiWildcards(t *testing.T) {
+	tree := &node{path: "/"}
+
+	addPath(t, tree, "/files/:name.:ext")
+	addPath(t, tree, "/files/:name.:ext/raw")
+	addPath(t, tree, "/files/:name")
+	addPath(t, tree, "/range/:from-:to")
+	addPath(t, tree, "/range/:from-:to.:format")
+	addPath(t, tree, "/users/:user-id")
+
+	testPath(t, tree, "/files/report.pdf", "/files/:name.:ext",
+		map[string]string{"name": "report", "ext": "pdf"})
+	testPath(t, tree, "/files/archive.tar.gz", "/files/:name.:ext",
+		map[string]string{"name": "archive.tar", "ext": "gz"})
+	testPath(t, tree, "/files/report.pdf/raw", "/files/:name.:ext/raw",
+		map[string]string{"name": "report", "ext": "pdf"})
+	testPath(t, tree, "/files/README", "/files/:name",
+		map[string]string{"name": "README"})
+	testPath(t, tree, "/files/.hidden", "/files/:name",
+		map[string]string{"name": ".hidden"})
+	testPath(t, tree, "/range/1-5", "/range/:from-:to",
+		map[string]string{"from": "1", "to": "5"})
+	testPath(t, tree, "/range/1-5.csv", "/range/:from-:to.:format",
+		map[string]string{"from": "1", "to": "5", "format": "csv"})
+	testPath(t, tree, "/users/7", "/users/:user-id",
+		map[string]string{"user-id": "7"})
+
+	for _, path := range []string{"files/:a:.x", "files/:a.:", "files/:a.:b|^x$", "files/:a.:b*"} {
+		if _, err := tree.addPath(path, nil); err == nil {
+			t.Errorf("Expected error adding %s", path)
+		}
+	}
+
+	if found := tree.removePath("files/:name.:ext", "GET", nil); found == nil {
+		t.Error("Expected to remove files/:name.:ext")
+	}
+	testPath(t, tree, "/files/report.pdf", "/files/:name",
+		map[string]string{"name": "report.pdf"})
+}
+
+func TestSuffixCatchAll(t *testing.T) {
+	tree := &node{path: "/"}
+
+	addPath(t, tree, "/assets/*path.js")
+	addPath(t, tree, "/assets/*path.min.js")
+	addPath(t, tree, "/assets/*path")
+	addPath(t, tree, "/repos/*repo/blob")
+	addPath(t, tree, "/repos/:owner")
+
+	testPath(t, tree, "/assets/app.js", "/assets/*path.js",
+		map[string]string{"path": "app"})
+	testPath(t, tree, "/assets/lib/jquery.min.js", "/assets/*path.min.js",
+		map[string]string{"path": "lib/jquery"})
+	testPath(t, tree, "/assets/lib/site.css", "/assets/*path",
+		map[string]string{"path": "lib/site.css"})
+	testPath(t, tree, "/assets/.js", "/assets/*path",
+		map[string]string{"path": ".js"})
+	testPath(t, tree, "/repos/a/b/blob", "/repos/*repo/blob",
+		map[string]string{"repo": "a/b"})
+	testPath(t, tree, "/repos/a", "/repos/:owner",
+		map[string]string{"owner": "a"})
+	testPath(t, tree, "/repos/a/b", "", nil)
+
+	for _, path := range []string{"x/*path/", "x/*path/:id", "x/*path.*ext"} {
+		if _, err := tree.addPath(path, nil); err == nil {
+			t.Errorf("Expected error adding %s", path)
+		}
+	}
+
+	if found := tree.removePath("assets/*path.js", "GET", nil); found == nil {
+		t.Error("Expected to remove assets/*path.js")
+	}
+	testPath(t, tree, "/assets/app.js", "/assets/*path",
+		map[string]string{"path": "app.js"})
+}
+
+func TestUnescapeToken(t *testing.T) {
+	tests := []struct {
+		token    string
+		expected string
+	}{
+		{"abc", "abc"},
+		{"a%20b", "a b"},
+		{"a+b", "a+b"},
+		{"%2fx%2F", "/x/"},
+		{"%e2%9c%93", "\u2713"},
+		{"bad%2", "bad%2"},
+		{"bad%zz", "bad%zz"},
+	}
+
+	for _, test := range tests {
+		if unescaped := unescapeToken(test.token); unescaped != test.expected {
+			t.Errorf("%s expected %q, saw %q", test.token, test.expected, unescaped)
+		}
+	}
+}
+
+func TestSplitWildcard(t *testing.T) {
+	tests := []struct {
+		token      string
+		name       string
+		constraint string
+		typed      bool
+	}{
+		{"id", "id", "", false},
+		{"id:int", "id", "int", true},
+		{"id|^[0-9]+$", "id", "^[0-9]+$", false},
+		{"id|(?:a|b)", "id", "(?:a|b)", false},
+	}
+
+	for _, test := range tests {
+		name, constraint, typed := splitWildcard(test.token)
+		if name != test.name || constraint != test.constraint || typed != test.typed {
+			t.Errorf("%s expected %s, %s, %v, saw %s, %s, %v", test.token,
+				test.name, test.constraint, test.typed, name, constraint, typed)
+		}
+	}
+}
+
+func TestSearchCaseInsensitive(t *testing.T) {
+	tree := &node{path: "/"}
+	for _, path := range []string{"/users/:id", "/users/:id/Edit", "/Upload", "/upper", "/files/*path"} {
+		n, _ := tree.addPath(path[1:], nil)
+		n.setHandler("GET", dummyHandler, nil)
+	}
+
+	tests := []struct {
+		path   string
+		params []string
+	}{
+		{"USERS/Bob", []string{"Bob"}},
+		{"Users/Bob/edit", []string{"Bob"}},
+		{"upload", nil},
+		{"UPPER", nil},
+		{"Files/A/B", []string{"A/B"}},
+	}
 
-	panicHandler := func() {
-		if err := recover(); err != nil {
-			sawPanic = true
+	for _, test := range tests {
+		if n, _ := tree.search(test.path); n != nil {
+			t.Errorf("Expected no case-sensitive match for %s", test.path)
 		}
+
+		n, params := tree.searchCaseInsensitive(test.path)
+		if n == nil {
+			t.Errorf("No case-insensitive match for %s", test.path)
+			continue
+		}
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("Path %s expected params %v, saw %v", test.path, test.params, params)
+		}
+	}
+
+	if n, _ := tree.searchCaseInsensitive("uploads"); n != nil {
+		t.Errorf("Expected no match for uploads, saw %s", n.path)
+	}
+}
+
+func TestRemovePath(t *testing.T) {
+	tree := &node{path: "/"}
+	for _, path := range []string{"/users", "/users/:id", "/users/:id|^[0-9]+$/posts", "/user", "/files/*path"} {
+		n, _ := tree.addPath(path[1:], nil)
+		n.setHandler("GET", dummyHandler, nil)
+		n.setHandler("POST", dummyHandler, nil)
+	}
+
+	if tree.removePath("users/:name", "GET", nil) != nil {
+		t.Error("Removing a pattern with different wildcard names should fail")
+	}
+	if tree.removePath("users/:id", "PUT", nil) != nil {
+		t.Error("Removing a method with no handler should fail")
+	}
+	if tree.removePath("use", "GET", nil) != nil {
+		t.Error("Removing a partial static path should fail")
+	}
+
+	tree.removePath("users/:id", "GET", nil)
+	if n, _ := tree.search("users/abc"); n == nil || n.leafHandler["GET"] != nil {
+		t.Error("Expected only the POST handler for users/abc to remain")
+	}
+
+	// Removing the last handler prunes the node, but not its children.
+	tree.removePath("users/:id", "POST", nil)
+	if n, _ := tree.search("users/abc"); n != nil {
+		t.Error("Expected no match for users/abc after removal")
+	}
+	if n, _ := tree.search("users/1/posts"); n == nil {
+		t.Error("Expected users/1/posts to remain")
+	}
+
+	for _, method := range []string{"GET", "POST"} {
+		tree.removePath("users/:id|^[0-9]+$/posts", method, nil)
+		tree.removePath("files/*path", method, nil)
+	}
+	if len(tree.staticChild) != 1 {
+		t.Fatalf("Expected the files branch to be pruned, saw %d children", len(tree.staticChild))
 	}
 
-	addPathPanic := func(p ...string) {
-		sawPanic = false
-		defer panicHandler()
+	users, _ := tree.search("users")
+	if users.wildcardChild != nil || len(users.constrainedWildcardChildren) != 0 {
+		t.Error("Expected wildcard children of users to be pruned")
+	}
+	if n, _ := tree.search("user"); n == nil {
+		t.Error("Expected user to remain")
+	}
+}
+
+func TestAddPathErrors(t *testing.T) {
+	addPathError := func(p ...string) error {
 		tree := &node{path: "/"}
 		for _, path := range p {
-			tree.addPath(path, nil)
+			if _, err := tree.addPath(path, nil); err != nil {
+				return err
+			}
 		}
+		return nil
 	}
 
-	addPathPanic("abc/*path/")
-	if !sawPanic {
-		t.Error("Expected panic with slash after catch-all")
+	if addPathError("abc/*path/") == nil {
+		t.Error("Expected error with slash after catch-all")
 	}
 
-	addPathPanic("abc/*path/def")
-	if !sawPanic {
-		t.Error("Expected panic with path segment after catch-all")
+	if addPathError("abc/*path/:def") == nil {
+		t.Error("Expected error with wildcard after catch-all")
 	}
 
-	addPathPanic("abc/*path", "abc/*paths")
-	if !sawPanic {
-		t.Error("Expected panic when adding conflicting catch-alls")
+	if addPathError("abc/*path.js", "abc/*file.js") == nil {
+		t.Error("Expected error when adding conflicting catch-alls with a suffix")
 	}
 
-	func() {
-		sawPanic = false
-		defer panicHandler()
-		tree := &node{path: "/"}
-		tree.setHandler("GET", dummyHandler, nil)
-		tree.setHandler("GET", dummyHandler, nil)
-	}()
-	if !sawPanic {
-		t.Error("Expected panic when adding a duplicate handler for a pattern")
+	if addPathError("abc/*path", "abc/*paths") == nil {
+		t.Error("Expected error when adding conflicting catch-alls")
+	}
+
+	tree := &node{path: "/"}
+	tree.addPath("abc/*path/:def", nil)
+	if _, err := tree.addPath("abc/*other", nil); err != nil {
+		t.Errorf("A rejected catch-all should not conflict with later routes, saw %s", err)
+	}
+
+	tree = &node{path: "/"}
+	if err := tree.setHandler("GET", dummyHandler, nil); err != nil {
+		t.Errorf("Unexpected error adding handler: %s", err)
+	}
+	if tree.setHandler("GET", dummyHandler, nil) == nil {
+		t.Error("Expected error when adding a duplicate handler for a pattern")
+	}
+
+	if addPathError("abc/ab:cd") == nil {
+		t.Error("Expected error with : in middle of path segment")
+	}
+
+	if addPathError("abc/ab", "abc/ab:cd") == nil {
+		t.Error("Expected error with : in middle of path segment with existing path")
 	}
 
-	addPathPanic("abc/ab:cd")
-	if !sawPanic {
-		t.Error("Expected panic with : in middle of path segment")
+	if addPathError("abc/ab*cd") == nil {
+		t.Error("Expected error with * in middle of path segment")
 	}
 
-	addPathPanic("abc/ab", "abc/ab:cd")
-	if !sawPanic {
-		t.Error("Expected panic with : in middle of path segment with existing path")
+	if addPathError("abc/ab", "abc/ab*cd") == nil {
+		t.Error("Expected error with * in middle of path segment with existing path")
 	}
 
-	addPathPanic("abc/ab*cd")
-	if !sawPanic {
-		t.Error("Expected panic with * in middle of path segment")
+	if addPathError("abc/:id|[0-9") == nil {
+		t.Error("Expected error with invalid wildcard constraint")
 	}
 
-	addPathPanic("abc/ab", "abc/ab*cd")
-	if !sawPanic {
-		t.Error("Expected panic with * in middle of path segment with existing path")
+	if addPathError("abc/:id|") == nil {
+		t.Error("Expected error with empty wildcard constraint")
 	}
 
-	twoPathPanic := func(first, second string) {
-		addPathPanic(first, second)
-		if !sawPanic {
-			t.Errorf("Expected panic with ambiguous wildcards on paths %s and %s", first, second)
+	twoPathError := func(first, second string) {
+		if addPathError(first, second) == nil {
+			t.Errorf("Expected error with ambiguous wildcards on paths %s and %s", first, second)
 		}
 	}
 
-	twoPathPanic("abc/:ab/def/:cd", "abc/:ad/def/:cd")
-	twoPathPanic("abc/:ab/def/:cd", "abc/:ab/def/:ef")
-	twoPathPanic(":abc", ":def")
-	twoPathPanic(":abc/ggg", ":def/ggg")
+	twoPathError("abc/:ab/def/:cd", "abc/:ad/def/:cd")
+	twoPathError("abc/:ab/def/:cd", "abc/:ab/def/:ef")
+	twoPathError(":abc", ":def")
+	twoPathError(":abc/ggg", ":def/ggg")
+	twoPathError(":abc/*path", ":def/*path")
 }
 
 func BenchmarkTreeNullRequest(b *testing.B) {
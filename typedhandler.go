@@ -0,0 +1,148 @@
+//go:build go1.18
+// +build go1.18
+
+package httptreemux
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+// HandleTyped adds a handler for the path that receives the route's params decoded into
+// a struct of type T, instead of a map. The router is a *TreeMux or a *Group. Each
+// field of T with a route tag is set from the param of that name:
+//
+//	type userParams struct {
+//		ID   int    `route:"id"`
+//		Name string `route:"name"`
+//	}
+//
+//	httptreemux.HandleTyped(router, "GET", "/users/:id/:name",
+//		func(w http.ResponseWriter, r *http.Request, p userParams) {
+//			...
+//		})
+//
+// Fields may be strings, bools, integers, floats, or types whose pointer implements
+// encoding.TextUnmarshaler. HandleTyped panics if T is not a struct or has a tagged
+// field of any other type. If a param can't be converted to its field's type, the
+// handler is not called, and ErrorHandler is called with a *StatusError with the code
+// http.StatusBadRequest. A tag naming a param that the route doesn't have is reported
+// the same way, with the code http.StatusInternalServerError.
+func HandleTyped[T any](router interface {
+	HandleE(method, path string, handler ErrHandlerFunc) *Route
+}, method, path string, handler func(http.ResponseWriter, *http.Request, T)) *Route {
+	fields := typedFields(reflect.TypeOf((*T)(nil)).Elem())
+	return router.HandleE(method, path,
+		func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+			var value T
+			if err := decodeTypedFields(reflect.ValueOf(&value).Elem(), fields, params); err != nil {
+				return err
+			}
+			handler(w, r, value)
+			return nil
+		})
+}
+
+// typedField is a field of the struct used by HandleTyped, and the param it is set from.
+type typedField struct {
+	index int
+	name  string
+	param string
+	set   func(field reflect.Value, value string) error
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// typedFields returns the tagged fields of a struct type, panicking if the type can't be
+// used with HandleTyped.
+func typedFields(t reflect.Type) []typedField {
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("HandleTyped requires a struct type, not %s", t))
+	}
+
+	var fields []typedField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		param, ok := f.Tag.Lookup("route")
+		if !ok {
+			continue
+		}
+		if f.PkgPath != "" {
+			panic(fmt.Sprintf("HandleTyped field %s of %s is tagged but not exported", f.Name, t))
+		}
+
+		set := typedFieldSetter(f.Type)
+		if set == nil {
+			panic(fmt.Sprintf("HandleTyped field %s of %s has unsupported type %s", f.Name, t, f.Type))
+		}
+		fields = append(fields, typedField{index: i, name: f.Name, param: param, set: set})
+	}
+	return fields
+}
+
+// typedFieldSetter returns a function that parses a param into a field of type t, or
+// nil if t is not supported.
+func typedFieldSetter(t reflect.Type) func(field reflect.Value, value string) error {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return func(field reflect.Value, value string) error {
+			return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return func(field reflect.Value, value string) error {
+			field.SetString(value)
+			return nil
+		}
+	case reflect.Bool:
+		return func(field reflect.Value, value string) error {
+			b, err := strconv.ParseBool(value)
+			field.SetBool(b)
+			return err
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(field reflect.Value, value string) error {
+			i, err := strconv.ParseInt(value, 10, t.Bits())
+			field.SetInt(i)
+			return err
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(field reflect.Value, value string) error {
+			u, err := strconv.ParseUint(value, 10, t.Bits())
+			field.SetUint(u)
+			return err
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(field reflect.Value, value string) error {
+			f, err := strconv.ParseFloat(value, t.Bits())
+			field.SetFloat(f)
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeTypedFields sets the fields of v from the params.
+func decodeTypedFields(v reflect.Value, fields []typedField, params map[string]string) error {
+	for _, f := range fields {
+		value, ok := params[f.param]
+		if !ok {
+			return &StatusError{
+				Code: http.StatusInternalServerError,
+				Err:  fmt.Errorf("Route has no parameter %s for field %s", f.param, f.name),
+			}
+		}
+
+		if err := f.set(v.Field(f.index), value); err != nil {
+			return &StatusError{
+				Code: http.StatusBadRequest,
+				Err:  fmt.Errorf("Invalid value for parameter %s: %s", f.param, value),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+//go:build go1.18
+// +build go1.18
+
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type upperString string
+
+func (s *upperString) UnmarshalText(text []byte) error {
+	*s = upperString(strings.ToUpper(string(text)))
+	return nil
+}
+
+func TestHandleTyped(t *testing.T) {
+	type itemParams struct {
+		ID     int         `route:"id"`
+		Active bool        `route:"active"`
+		Price  float64     `route:"price"`
+		Code   upperString `route:"code"`
+		Path   string      `route:"path"`
+		Other  string
+	}
+
+	var seen itemParams
+	router := New()
+	HandleTyped(router, "GET", "/items/:id/:active/:price/:code/*path",
+		func(w http.ResponseWriter, r *http.Request, p itemParams) {
+			seen = p
+		})
+
+	type missingParams struct {
+		ID int `route:"missing"`
+	}
+	HandleTyped(router.Group("/api"), "GET", "/:id",
+		func(w http.ResponseWriter, r *http.Request, p missingParams) {
+			t.Error("Handler called without its params")
+		})
+
+	r, _ := newRequest("GET", "/items/5/true/1.5/abc/a/b", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	expected := itemParams{ID: 5, Active: true, Price: 1.5, Code: "ABC", Path: "a/b"}
+	if w.Code != http.StatusOK || seen != expected {
+		t.Errorf("Expected code 200 and params %+v, saw %d and %+v", expected, w.Code, seen)
+	}
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/items/x/true/1.5/abc/a", http.StatusBadRequest},
+		{"/items/5/maybe/1.5/abc/a", http.StatusBadRequest},
+		{"/api/5", http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		r, _ := newRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("Path %s expected code %d, saw %d", test.path, test.code, w.Code)
+		}
+	}
+
+	expectPanic := func(desc string, f func()) {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Errorf("Expected panic for %s", desc)
+			}
+		}()
+		f()
+	}
+
+	expectPanic("non-struct type", func() {
+		HandleTyped(router, "GET", "/int/:id", func(w http.ResponseWriter, r *http.Request, p int) {})
+	})
+	expectPanic("unsupported field type", func() {
+		type badParams struct {
+			IDs []int `route:"id"`
+		}
+		HandleTyped(router, "GET", "/bad/:id", func(w http.ResponseWriter, r *http.Request, p badParams) {})
+	})
+}
@@ -0,0 +1,273 @@
+package httptreemux
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// The values used for wildcards and catch-alls when building the sample paths that
+// Validate looks up. There is one sample path for each value, and a route is
+// reachable if any of them finds it.
+var (
+	validateWildcardValues = []string{"validate", "0", "x.y"}
+	validateCatchAllValues = []string{"validate/path", "0", "x.y"}
+	// Values tried for constrained wildcards, in order, until enough of them match.
+	validateProbeValues = []string{"0", "1", "42", "-1", "1.5", "a", "abc", "validate", "A", "ABC",
+		"a_b", "x-1", "a.b", "2006-01-02", "true", "00000000-0000-0000-0000-000000000000"}
+)
+
+// wildcardPosition identifies a wildcard that several routes can share. For a
+// catch-all, the node is the parent of the catch-all children, and the index is -1,
+// since every catch-all below a node takes the same position.
+type wildcardPosition struct {
+	node  *node
+	index int
+}
+
+// wildcardUse records the name that the first route to use a wildcard gave it.
+type wildcardUse struct {
+	name    string
+	pattern string
+}
+
+// validator holds the state of Validate for a single tree.
+type validator struct {
+	t    *TreeMux
+	root *node
+	// The host of the tree, for the errors.
+	host   string
+	errors []error
+	names  map[wildcardPosition]wildcardUse
+}
+
+// Validate checks every route of the router for problems that don't prevent the route
+// from being added, but probably aren't intended, and returns an error for each one
+// it finds. It is meant to be called from a test, or before deploying, since it looks
+// up each route and is slow for large routers. It reports:
+//
+//   - Routes that can't be reached, such as because every path that they match is
+//     matched by another route first, or their kind is left out of Precedence.
+//   - Routes whose wildcards or catch-alls have a different name than the same
+//     wildcard or catch-all has in another route, such as /users/:id and
+//     /users/:userID/posts.
+//   - Routes that use the same wildcard name more than once.
+//
+// A route is considered reachable if a request for one of a few sample paths built from
+// its pattern finds it, so a route that can only be reached by unusual paths may be
+// reported, and a route with a constraint that none of the sample values satisfy is not
+// checked.
+func (t *TreeMux) Validate() []error {
+	return t.validateTrees(t.loadTrees())
+}
+
+// validateTrees is Validate for the trees, which need not be the router's own, using
+// the router's settings.
+func (t *TreeMux) validateTrees(trees *routingTrees) []error {
+	v := &validator{t: t, root: trees.root}
+	v.validate()
+	errs := v.errors
+
+	hosts := make([]string, 0, len(trees.hosts))
+	for host := range trees.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		v = &validator{t: t, root: trees.hosts[host], host: host}
+		v.validate()
+		errs = append(errs, v.errors...)
+	}
+	return errs
+}
+
+func (v *validator) validate() {
+	v.names = map[wildcardPosition]wildcardUse{}
+	samples := make([]string, len(validateWildcardValues))
+	for i := range samples {
+		samples[i] = "/"
+	}
+	v.visit(v.root, []walkPiece{{text: "/"}}, samples, nil)
+}
+
+// errorf adds an error about the pattern.
+func (v *validator) errorf(method, pattern, format string, args ...interface{}) {
+	route := v.host + pattern
+	if method != "" {
+		route = method + " " + route
+	}
+	v.errors = append(v.errors, fmt.Errorf("%s %s", route, fmt.Sprintf(format, args...)))
+}
+
+// visit checks the routes at and below n. The pieces are those of the pattern so far,
+// as for walk, the samples are the sample paths so far, or nil if one of the
+// constrained wildcards above couldn't be given a value, and positions holds the
+// position of each wildcard so far.
+func (v *validator) visit(n *node, pieces []walkPiece, samples []string, positions []wildcardPosition) {
+	if len(n.leafHandler) != 0 {
+		v.checkRoute(n, n.rebuildPattern(pieces), samples, positions)
+	}
+
+	for _, child := range n.staticChild {
+		v.visit(child, append(pieces, walkPiece{text: child.path}),
+			appendSamples(samples, child.path), positions)
+	}
+
+	for _, child := range n.constrainedWildcardChildren {
+		piece := walkPiece{text: "|" + child.path, wildcard: true}
+		var values []string
+		if child.multiParams != 0 {
+			piece = walkPiece{text: child.path, multi: true}
+			for _, value := range validateWildcardValues {
+				if segment := strings.Replace(child.path, ":", value, -1); child.regExpr.MatchString(segment) {
+					values = append(values, segment)
+				}
+			}
+		} else {
+			if child.paramType != nil {
+				piece.text = ":" + child.path
+			}
+			for _, value := range validateProbeValues {
+				if child.matchesConstraint(value) {
+					values = append(values, value)
+				}
+			}
+		}
+
+		// Routes below a constraint that none of the values satisfy can't be checked.
+		var childSamples []string
+		if len(values) != 0 {
+			childSamples = appendValues(samples, values, "")
+		}
+
+		childPositions := appendPosition(positions, wildcardPosition{child, 0})
+		for i := 1; i < child.multiParams; i++ {
+			childPositions = append(childPositions, wildcardPosition{child, i})
+		}
+		v.visit(child, append(pieces, piece), childSamples, childPositions)
+	}
+
+	if n.wildcardChild != nil {
+		v.visit(n.wildcardChild, append(pieces, walkPiece{wildcard: true}),
+			appendValues(samples, validateWildcardValues, ""),
+			appendPosition(positions, wildcardPosition{n.wildcardChild, 0}))
+	}
+
+	for _, child := range n.suffixCatchAllChildren {
+		v.visit(child, append(pieces, walkPiece{text: child.path, catchAll: true}),
+			appendValues(samples, validateCatchAllValues, child.path),
+			appendPosition(positions, wildcardPosition{n, -1}))
+	}
+
+	if n.catchAllChild != nil {
+		v.visit(n.catchAllChild, append(pieces, walkPiece{catchAll: true}),
+			appendValues(samples, validateCatchAllValues, ""),
+			appendPosition(positions, wildcardPosition{n, -1}))
+	}
+}
+
+// checkRoute checks the routes of the node, whose pattern is given.
+func (v *validator) checkRoute(n *node, pattern string, samples []string, positions []wildcardPosition) {
+	names := n.leafWildcardNames
+	for i, name := range names {
+		for _, other := range names[:i] {
+			if name == other {
+				v.errorf("", pattern, "uses the wildcard name %s more than once", name)
+			}
+		}
+	}
+
+	if len(positions) == len(names) {
+		for i, position := range positions {
+			use, ok := v.names[position]
+			if !ok {
+				v.names[position] = wildcardUse{name: names[i], pattern: pattern}
+			} else if use.name != names[i] {
+				v.errorf("", pattern, "calls a wildcard %s, but %s calls it %s", names[i], use.pattern, use.name)
+			}
+		}
+	}
+
+	if samples == nil {
+		return
+	}
+
+	methods := make([]string, 0, len(n.leafHandler))
+	for method := range n.leafHandler {
+		if method != "OPTIONS" || !n.implicitOptions {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+
+	for _, method := range methods {
+		// The result for the first sample is used to describe the problem.
+		var first LookupResult
+		var sample string
+		reached := false
+		for i, path := range samples {
+			if n.addSlash && path != "/" {
+				path += "/"
+			}
+			lr := v.t.lookup(v.root, method, path)
+			if lr.StatusCode == http.StatusOK && lr.node == n {
+				reached = true
+				break
+			}
+			if i == 0 {
+				first, sample = lr, path
+			}
+		}
+		if reached {
+			continue
+		}
+
+		switch first.StatusCode {
+		case http.StatusOK:
+			v.errorf(method, pattern, "is shadowed by %s, which matches %s", first.Pattern, sample)
+		case http.StatusMethodNotAllowed:
+			v.errorf(method, pattern, "is shadowed by %s, which matches %s but has no handler for %s",
+				first.Pattern, sample, method)
+		case http.StatusNotFound:
+			v.errorf(method, pattern, "can't be reached, since no route matches %s", sample)
+		case http.StatusBadRequest:
+			v.errorf(method, pattern, "can't be reached, since %s is rejected", sample)
+		default:
+			v.errorf(method, pattern, "can't be reached, since %s is redirected to %s", sample, first.RedirectPath)
+		}
+	}
+}
+
+// appendSamples returns the samples with the text added to each, or nil if samples is
+// nil.
+func appendSamples(samples []string, text string) []string {
+	if samples == nil {
+		return nil
+	}
+	result := make([]string, len(samples))
+	for i, sample := range samples {
+		result[i] = sample + text
+	}
+	return result
+}
+
+// appendValues returns the samples with one of the values, followed by the suffix,
+// added to each, or nil if samples is nil. If there are fewer values than samples, they
+// are repeated.
+func appendValues(samples []string, values []string, suffix string) []string {
+	if samples == nil {
+		return nil
+	}
+	result := make([]string, len(samples))
+	for i, sample := range samples {
+		result[i] = sample + values[i%len(values)] + suffix
+	}
+	return result
+}
+
+// appendPosition returns the positions with another added, without changing the
+// positions passed to visit for other children.
+func appendPosition(positions []wildcardPosition, position wildcardPosition) []wildcardPosition {
+	return append(positions[:len(positions):len(positions)], position)
+}
@@ -0,0 +1,59 @@
+package httptreemux
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	router := New()
+	router.GET("/users/:id", simpleHandler)
+	router.GET("/users/new", simpleHandler)
+	router.GET("/users/:id|^[0-9]+$/posts", simpleHandler)
+	router.GET("/files/*path", simpleHandler)
+	router.GET("/files/*path.js", simpleHandler)
+	router.GET("/posts/", simpleHandler)
+	router.GET("/", simpleHandler)
+
+	if errs := router.Validate(); len(errs) != 0 {
+		t.Errorf("Expected no errors for valid routes, saw %v", errs)
+	}
+
+	router.GET("/items/:name|.*", simpleHandler)
+	router.GET("/items/:id", simpleHandler)
+	router.POST("/orders/:id", simpleHandler)
+	router.GET("/orders/:orderID/lines", simpleHandler)
+	router.GET("/assets/*path", simpleHandler)
+	router.GET("/assets/*file.css", simpleHandler)
+	router.GET("/pairs/:a/:a", simpleHandler)
+	// No sample value has 20 digits, so this route isn't checked.
+	router.GET("/numbers/:n|^[0-9]{20}$", simpleHandler)
+	router.GET("/a/../users/new", simpleHandler)
+	router.Host("example.com").GET("/x/:a|.+", simpleHandler)
+	router.Host("example.com").PUT("/x/:b", simpleHandler)
+
+	var messages []string
+	for _, err := range router.Validate() {
+		messages = append(messages, err.Error())
+	}
+	expected := []string{
+		"/assets/*path calls a wildcard path, but /assets/*file.css calls it file",
+		"GET /a/../users/new can't be reached, since /a/../users/new is redirected to /users/new",
+		"GET /items/:id is shadowed by /items/:name|.*, which matches /items/validate",
+		"/orders/:orderID/lines calls a wildcard orderID, but /orders/:id calls it id",
+		"/pairs/:a/:a uses the wildcard name a more than once",
+		"PUT example.com/x/:b is shadowed by /x/:a|.+, which matches /x/validate but has no handler for PUT",
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Expected errors\n%q\nsaw\n%q", expected, messages)
+	}
+
+	// Kinds of routes that are left out of Precedence can't be reached.
+	router = New()
+	router.GET("/files/*path", simpleHandler)
+	router.Precedence = []MatchKind{MatchStatic, MatchWildcard}
+	errs := router.Validate()
+	if len(errs) != 1 || errs[0].Error() != "GET /files/*path can't be reached, since no route matches /files/validate/path" {
+		t.Errorf("Expected the catch-all to be unreachable, saw %v", errs)
+	}
+}
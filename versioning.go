@@ -0,0 +1,110 @@
+package httptreemux
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Versioning sets how TreeMux chooses the version of routes that have several, added
+// with Route.Version. Set it as TreeMux.Versioning. Without it, a version is taken from
+// the media type of any vendor.
+//
+// The version of a request is taken from the first vendor media type in its Accept
+// header that names one, as the part after .v, so application/vnd.myapi.v2+json asks
+// for version 2.
+type Versioning struct {
+	// Vendor is the name that media types must have after vnd., such as myapi. If it is
+	// empty, media types of any vendor are used.
+	Vendor string
+	// Default is the version of requests whose Accept header doesn't name one. If it is
+	// empty, they are served by the route's own handler.
+	Default string
+	// Observe, if not nil, is called with the version of each request to a route that
+	// has versions, before it is served, such as to count the requests for each version.
+	// The version is empty if the request didn't name one and there is no Default.
+	Observe func(r *http.Request, version string)
+}
+
+// Version serves the route's requests that ask for the version, in a vendor media type
+// of their Accept header, with another handler. Requests for versions that the route
+// doesn't have fall through to the route's own handler, so that a path can keep serving
+// its first version while a new one is added:
+//
+//	router.Versioning = &httptreemux.Versioning{Vendor: "myapi", Default: "1"}
+//	router.GET("/users/:id", getUserV1).
+//		Version("2", getUserV2)
+//
+// The version is given without the v. The handler is wrapped in the same middleware as
+// the route's own, and Accept is added to the Vary header of all of the route's
+// responses. Conditions added with WhenQuery, WhenHeader and When are checked before
+// the version.
+func (r *Route) Version(version string, handler HandlerFunc) *Route {
+	r.mux.mutex.Lock()
+	defer r.mux.mutex.Unlock()
+
+	versions := make(map[string]HandlerFunc, len(r.versions)+1)
+	for v, h := range r.versions {
+		versions[v] = h
+	}
+	versions[version] = r.wrap("v"+version, handler)
+	return r.setHandler(r.variants, versions, r.conditions)
+}
+
+// versionHandler returns a handler that serves each request with the handler for its
+// version, or with otherwise if there isn't one.
+func versionHandler(t *TreeMux, versions map[string]HandlerFunc, otherwise HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.Header().Add("Vary", "Accept")
+		v := t.Versioning
+		var version string
+		if v != nil {
+			version = acceptedVersion(r.Header.Get("Accept"), v.Vendor)
+			if version == "" {
+				version = v.Default
+			}
+			if v.Observe != nil {
+				v.Observe(r, version)
+			}
+		} else {
+			version = acceptedVersion(r.Header.Get("Accept"), "")
+		}
+
+		if handler, ok := versions[version]; ok {
+			handler(w, r, params)
+			return
+		}
+		otherwise(w, r, params)
+	}
+}
+
+// acceptedVersion returns the version named by the first vendor media type of the
+// vendor in the Accept header, or an empty string if there isn't one. Any vendor
+// matches if vendor is empty.
+func acceptedVersion(accept, vendor string) string {
+	if accept == "" {
+		return ""
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := part
+		if i := strings.IndexByte(part, ';'); i != -1 {
+			mediaType = part[:i]
+		}
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if !strings.HasPrefix(mediaType, "application/vnd.") {
+			continue
+		}
+		subtype := mediaType[len("application/vnd."):]
+		if i := strings.IndexByte(subtype, '+'); i != -1 {
+			subtype = subtype[:i]
+		}
+		i := strings.LastIndex(subtype, ".v")
+		if i == -1 || i+2 == len(subtype) {
+			continue
+		}
+		if vendor != "" && !strings.EqualFold(subtype[:i], vendor) {
+			continue
+		}
+		return subtype[i+2:]
+	}
+	return ""
+}
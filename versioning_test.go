@@ -0,0 +1,83 @@
+package httptreemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	var served string
+	var observed []string
+	makeHandler := func(name string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			served = name + " " + params["id"]
+		}
+	}
+	router := New()
+	router.Versioning = &Versioning{
+		Vendor:  "myapi",
+		Default: "1",
+		Observe: func(r *http.Request, version string) {
+			observed = append(observed, version)
+		},
+	}
+	router.GET("/users/:id", makeHandler("v1")).
+		Version("2", makeHandler("v2")).
+		Version("3", makeHandler("v3")).
+		WhenQuery("debug", "", makeHandler("debug"))
+	router.GET("/plain", makeHandler("plain"))
+
+	tests := []struct {
+		url     string
+		accept  string
+		served  string
+		version string
+	}{
+		{"/users/1", "", "v1 1", "1"},
+		{"/users/1", "application/json", "v1 1", "1"},
+		{"/users/1", "application/vnd.myapi.v2+json", "v2 1", "2"},
+		{"/users/1", "application/VND.MYAPI.V3+json; charset=utf-8", "v3 1", "3"},
+		{"/users/1", "text/html, application/vnd.myapi.v2", "v2 1", "2"},
+		{"/users/1", "application/vnd.other.v2+json", "v1 1", "1"},
+		{"/users/1", "application/vnd.myapi.v9+json", "v1 1", "9"},
+		{"/users/1?debug", "application/vnd.myapi.v2+json", "debug 1", ""},
+	}
+	for _, test := range tests {
+		served, observed = "", nil
+		r, _ := http.NewRequest("GET", test.url, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if served != test.served {
+			t.Errorf("%s with Accept %q expected %q, saw %q", test.url, test.accept, test.served, served)
+		}
+		if test.version != "" && (len(observed) != 1 || observed[0] != test.version) {
+			t.Errorf("%s with Accept %q expected version %s to be observed, saw %v", test.url, test.accept,
+				test.version, observed)
+		}
+		if test.version != "" && w.Header().Get("Vary") != "Accept" {
+			t.Errorf("%s expected Vary: Accept, saw %q", test.url, w.Header().Get("Vary"))
+		}
+	}
+
+	served, observed = "", nil
+	r, _ := http.NewRequest("GET", "/plain", nil)
+	r.Header.Set("Accept", "application/vnd.myapi.v2+json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if served != "plain " || observed != nil || w.Header().Get("Vary") != "" {
+		t.Errorf("Expected a route without versions to be unaffected, saw %q, %v, %q", served, observed,
+			w.Header().Get("Vary"))
+	}
+
+	router.Versioning = nil
+	r, _ = http.NewRequest("GET", "/users/2", nil)
+	r.Header.Set("Accept", "application/vnd.other.v3+json")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if served != "v3 2" {
+		t.Errorf("Expected any vendor without Versioning, saw %q", served)
+	}
+}